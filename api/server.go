@@ -15,13 +15,18 @@
 package api
 
 import (
+	"backend"
+	"backend/config"
 	"net/http"
 )
 
 func init() {
-	http.HandleFunc("/", serveNotFound)
-}
-
-func serveNotFound(w http.ResponseWriter, r *http.Request) {
-	http.NotFound(w, r)
+	cfg, err := config.Load("")
+	if err != nil {
+		panic(err)
+	}
+	// templates/error.html is copied to api/templates by gulp. Errors are
+	// sent as JSON if it's missing.
+	backend.LoadErrorPage(cfg)
+	http.HandleFunc("/", backend.NotFound)
 }
@@ -13,6 +13,8 @@
 package backend
 
 import (
+	"backend/config"
+	"backend/oauth"
 	"fmt"
 	"html/template"
 	"net/http"
@@ -44,9 +46,9 @@ var powerUsers = map[string]bool{
 	"Jane@gmail.com": true,
 }
 
-func InitAmpAccess() {
+func InitAmpAccess(cfg *config.Config) {
 	RegisterHandler(AMP_ACCESS_SAMPLE_PATH+"authorization", handleAuthorization)
-	RegisterHandler(AMP_ACCESS_SAMPLE_PATH+"login", handleLogin)
+	RegisterHandler(AMP_ACCESS_SAMPLE_PATH+"login", handleLogin(cfg.DistDir))
 	RegisterHandler(AMP_ACCESS_SAMPLE_PATH+"logout", handleLogout)
 	RegisterHandler(AMP_ACCESS_SAMPLE_PATH+"pingback", handlePingback)
 	RegisterHandler(AMP_ACCESS_SAMPLE_PATH+"submit", handleSubmit)
@@ -55,20 +57,22 @@ func InitAmpAccess() {
 func handlePingback(w http.ResponseWriter, r *http.Request) {
 }
 
-func handleLogin(w http.ResponseWriter, r *http.Request) {
-	returnURL := r.URL.Query().Get("return")
-	if !isValidURL(returnURL) {
-		http.Error(w, "Invalid return URL", http.StatusInternalServerError)
-		return
+func handleLogin(distDir string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		returnURL := r.URL.Query().Get("return")
+		if !isValidURL(returnURL) {
+			http.Error(w, "Invalid return URL", http.StatusInternalServerError)
+			return
+		}
+		filePath := path.Join(distDir, "login.html")
+		t, _ := template.ParseFiles(filePath)
+		t.Execute(w, AccessData{ReturnURL: returnURL})
 	}
-	filePath := path.Join(DIST_FOLDER, "login.html")
-	t, _ := template.ParseFiles(filePath)
-	t.Execute(w, AccessData{ReturnURL: returnURL})
 }
 
 func handleAuthorization(w http.ResponseWriter, r *http.Request) {
-	c, err := r.Cookie(AMP_ACCESS_COOKIE)
-	if err != nil {
+	email, name, ok := signedInUser(r)
+	if !ok {
 		SendJsonResponse(w, map[string]interface{}{
 			"loggedIn":  false,
 			"powerUser": false,
@@ -77,15 +81,48 @@ func handleAuthorization(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
-
-	email := strings.ToLower(c.Value)
-	isPowerUser := powerUsers[email]
 	SendJsonResponse(w, map[string]interface{}{
 		"loggedIn":  true,
-		"powerUser": isPowerUser,
+		"powerUser": powerUsers[email],
 		"email":     email,
-		"name":      strings.Split(email, "@")[0],
+		"name":      name,
+	})
+}
+
+// signedInUser returns the user signed in with the amp-access sample or,
+// failing that, via OAuth, who share their identity with the samples.
+func signedInUser(r *http.Request) (email string, name string, ok bool) {
+	if c, err := r.Cookie(AMP_ACCESS_COOKIE); err == nil {
+		email = strings.ToLower(c.Value)
+		return email, strings.Split(email, "@")[0], true
+	}
+	if user, err := oauth.GetUser(r); err == nil {
+		return user.Email, user.Name, true
+	}
+	return "", "", false
+}
+
+// sampleUser identifies the user by their sign in or, failing that, by an
+// anonymous ID kept in the cookie. If create is set, users without either are
+// given a new anonymous ID, otherwise "" is returned for them.
+func sampleUser(w http.ResponseWriter, r *http.Request, cookieName string, create bool) string {
+	if email, _, ok := signedInUser(r); ok {
+		return "user:" + email
+	}
+	if cookie, err := r.Cookie(cookieName); err == nil && cookie.Value != "" {
+		return "anonymous:" + cookie.Value
+	}
+	if !create {
+		return ""
+	}
+	id := randomSecret()
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookieName,
+		Value:    id,
+		Expires:  time.Now().AddDate(1, 0, 0),
+		HttpOnly: true,
 	})
+	return "anonymous:" + id
 }
 
 func handleLogout(w http.ResponseWriter, r *http.Request) {
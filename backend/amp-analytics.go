@@ -15,13 +15,14 @@
 package backend
 
 import (
+	"backend/config"
 	"backend/util"
 
 	"net/http"
 )
 
-func InitAmpAnalytics() {
-	//RegisterSample(CATEGORY_COMPONENTS+"/amp-analytics", renderAnalyticsSample)
+func InitAmpAnalytics(cfg *config.Config) {
+	//RegisterSample(cfg, CATEGORY_COMPONENTS+"/amp-analytics", renderAnalyticsSample)
 }
 
 func renderAnalyticsSample(w http.ResponseWriter, r *http.Request, page Page) {
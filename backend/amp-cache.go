@@ -15,13 +15,13 @@
 package backend
 
 import (
+	"backend/config"
 	"net/http"
 	"time"
 )
 
-func InitAmpCache() {
-	RegisterTemplate("/g", "", TEMPLATE_FOLDER+"/get-example.html", parameterDemoHandler)
-	http.HandleFunc("/error", returnCode500)
+func InitAmpCache(cfg *config.Config) {
+	RegisterTemplate(cfg, "/g", "", cfg.TemplateDir+"/get-example.html", parameterDemoHandler)
 }
 
 func parameterDemoHandler(w http.ResponseWriter, r *http.Request, page Page) {
@@ -30,8 +30,3 @@ func parameterDemoHandler(w http.ResponseWriter, r *http.Request, page Page) {
 	s := timestamp + ": '" + r.URL.Query().Get("value") + "'"
 	page.Render(w, s)
 }
-
-func returnCode500(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusInternalServerError)
-	w.Write([]byte("Internal Server Error"))
-}
@@ -15,6 +15,7 @@
 package backend
 
 import (
+	"backend/config"
 	"net/http"
 )
 
@@ -22,7 +23,7 @@ const (
 	CONSENT_SAMPLE_PATH = "/" + CATEGORY_SAMPLE_TEMPLATES + "/consent/"
 )
 
-func InitAmpConsent() {
+func InitAmpConsent(cfg *config.Config) {
 	RegisterHandler(CONSENT_SAMPLE_PATH+"getConsent", onlyPost(submitConsentXHR))
 }
 
@@ -15,6 +15,7 @@
 package backend
 
 import (
+	"backend/config"
 	"fmt"
 	"net/http"
 )
@@ -24,7 +25,7 @@ const (
 	SAMPLE_NAME         = "/" + CATEGORY_COMPONENTS + "/amp-form/"
 )
 
-func InitAmpForm() {
+func InitAmpForm(cfg *config.Config) {
 	RegisterHandler(SAMPLE_NAME+"submit-form-input-text-xhr", onlyPost(submitFormXHRInputText))
 	RegisterHandler(SAMPLE_NAME+"verify-form-input-text-xhr", onlyPost(verifyFormXHRInputText))
 	RegisterHandler(SAMPLE_NAME+"submit-form-xhr", onlyPost(submitFormXHR))
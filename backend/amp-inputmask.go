@@ -15,6 +15,7 @@
 package backend
 
 import (
+	"backend/config"
 	"net/http"
 )
 
@@ -22,7 +23,7 @@ const (
 	AMP_INPUTMASK_SAMPLE_NAME = "/" + CATEGORY_COMPONENTS + "/amp-inputmask/"
 )
 
-func InitAmpInputmask() {
+func InitAmpInputmask(cfg *config.Config) {
 	RegisterHandler(AMP_INPUTMASK_SAMPLE_NAME+"default", onlyPost(submitPostalFormXHRInputMask))
 	RegisterHandler(AMP_INPUTMASK_SAMPLE_NAME+"postal", onlyPost(submitDefaultFormXHRInputMask))
 	RegisterHandler(AMP_INPUTMASK_SAMPLE_NAME+"phone", onlyPost(submitPhoneFormXHRInputMask))
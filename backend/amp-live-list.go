@@ -15,13 +15,13 @@
 package backend
 
 import (
+	"backend/config"
+	"backend/pagination"
 	"encoding/json"
 	"fmt"
 	"html/template"
-	"math"
 	"net/http"
 	"strconv"
-	"strings"
 	"time"
 )
 
@@ -118,10 +118,10 @@ type LiveBlogSample struct {
 
 var blogs []BlogItem
 
-func InitAmpLiveList() {
+func InitAmpLiveList(cfg *config.Config) {
 	initBlogPosts()
-	RegisterSample(CATEGORY_SAMPLE_TEMPLATES+"/live_blog", handleLiveList)
-	RegisterSample(CATEGORY_COMPONENTS+"/amp-live-list", handleLiveList)
+	RegisterSample(cfg, CATEGORY_SAMPLE_TEMPLATES+"/live_blog", handleLiveList)
+	RegisterSample(cfg, CATEGORY_COMPONENTS+"/amp-live-list", handleLiveList)
 }
 
 func initBlogPosts() {
@@ -141,9 +141,10 @@ func initBlogPosts() {
 
 func handleLiveList(w http.ResponseWriter, r *http.Request, page Page) {
 	newStatus := updateStatus(w, r)
-	firstBlogID := strings.TrimPrefix(r.URL.Query().Get("from"), BLOG_ID_PREFIX)
 	origin := GetOrigin(r)
-	page.Render(w, createLiveBlogSample(newStatus, time.Now(), firstBlogID, origin, page))
+	pager := pagination.NewPager(r, GetHost(r), "from")
+	pager.FirstPage = 1
+	page.Render(w, createLiveBlogSample(newStatus, time.Now(), pager, origin))
 }
 
 func updateStatus(w http.ResponseWriter, r *http.Request) int {
@@ -179,74 +180,37 @@ func createMetadata(sourceOrigin string) []BlogPosting {
 	return result
 }
 
-func createLiveBlogSample(newStatus int, timestamp time.Time, firstBlogID string, origin string, page Page) LiveBlogSample {
+func createLiveBlogSample(newStatus int, timestamp time.Time, pager *pagination.Pager, origin string) LiveBlogSample {
 	if newStatus > len(blogs) {
 		newStatus = len(blogs)
 	}
 	blogItems := getBlogEntries(newStatus, timestamp)
 	score := createScore(newStatus, 0)
-	firstItemIndex := getBlogEntryIndexFromID(firstBlogID, blogItems)
-	lenghtCurrentPageBlog := int(math.Min(float64(len(blogItems)), float64(firstItemIndex+MAX_BLOG_ITEMS_NUMBER_PER_PAGE)))
-
-	urlPrefix := buildPrefixPaginationURL(origin, page)
-	nextPageId := getNextPageId(blogItems, firstItemIndex+MAX_BLOG_ITEMS_NUMBER_PER_PAGE)
-	previousPageId := getPrevPageId(firstItemIndex)
-	nextPageUrl := buildPaginationURL(urlPrefix, nextPageId)
-	prevPageUrl := buildPaginationURL(urlPrefix, previousPageId)
+	keys := make([]string, len(blogItems))
+	for i, item := range blogItems {
+		keys[i] = item.ID
+	}
+	page, err := pager.Cursor(keys, MAX_BLOG_ITEMS_NUMBER_PER_PAGE)
+	if err != nil {
+		// Posts are gone when the status cookie is reset, start over.
+		pager.Value = ""
+		page, _ = pager.Cursor(keys, MAX_BLOG_ITEMS_NUMBER_PER_PAGE)
+	}
 	disabled := ""
-	if prevPageUrl != "" {
+	if page.Prev != "" {
 		disabled = "disabled"
 	}
 	blogMetadata, _ := json.MarshalIndent(createMetadata(origin), "        ", "  ")
 
-	return LiveBlogSample{BlogItems: blogItems[firstItemIndex:lenghtCurrentPageBlog],
+	return LiveBlogSample{BlogItems: blogItems[page.Start:page.End],
 		FootballScore: score,
 		BlogMetadata:  template.JS(blogMetadata),
-		NextPageURL:   nextPageUrl,
-		PrevPageURL:   prevPageUrl,
-		PageNumber:    getPageNumberFromProductIndex(firstItemIndex),
+		NextPageURL:   page.Next,
+		PrevPageURL:   page.Prev,
+		PageNumber:    page.Number,
 		Disabled:      template.HTMLAttr(disabled)}
 }
 
-func getNextPageId(blogItems []BlogItem, nextPageFirstItemIndex int) string {
-	if nextPageFirstItemIndex < len(blogItems) {
-		return fmt.Sprintf("%s%d", BLOG_ID_PREFIX, nextPageFirstItemIndex+1)
-	}
-	return ""
-}
-
-func getPrevPageId(firstItemIndex int) string {
-	if firstItemIndex >= MAX_BLOG_ITEMS_NUMBER_PER_PAGE {
-		return fmt.Sprintf("%s%d", BLOG_ID_PREFIX, firstItemIndex-MAX_BLOG_ITEMS_NUMBER_PER_PAGE+1)
-	}
-	return ""
-}
-
-func buildPrefixPaginationURL(origin string, page Page) string {
-	return origin + page.Route + "?from="
-}
-
-func buildPaginationURL(urlPrefix string, pageId string) string {
-	if pageId != "" {
-		return urlPrefix + pageId
-	}
-	return ""
-}
-
-func getPageNumberFromProductIndex(index int) int {
-	return (index / MAX_BLOG_ITEMS_NUMBER_PER_PAGE) + 1
-}
-
-func getBlogEntryIndexFromID(id string, blogItems []BlogItem) int {
-	blogEntryId, error := strconv.Atoi(id)
-	//default to the first page
-	if error != nil || blogEntryId > len(blogItems) {
-		return 0
-	}
-	//blog entry ids start from 1
-	return blogEntryId - 1
-}
-
 func getBlogEntries(size int, timestamp time.Time) []BlogItem {
 	result := make([]BlogItem, 0)
 	for i := 0; i < size; i++ {
@@ -15,6 +15,7 @@
 package backend
 
 import (
+	"backend/config"
 	"fmt"
 	"math/rand"
 	"net/http"
@@ -23,18 +24,20 @@ import (
 
 const NUMBER_OF_CONFIGS = 5
 
-func InitAmpStoryAutoAds() {
-	RegisterHandler("/json/amp-story-auto-ads/", serveRandomAdConfig)
+func InitAmpStoryAutoAds(cfg *config.Config) {
+	RegisterHandler("/json/amp-story-auto-ads/", serveRandomAdConfig(cfg.DistDir))
 }
 
 func getConfigNumber() int {
 	return rand.Intn(NUMBER_OF_CONFIGS)
 }
 
-func serveRandomAdConfig(w http.ResponseWriter, r *http.Request) {
-	configNumber := getConfigNumber()
-	configName := fmt.Sprintf("amp-story-auto-ads-%v.json", configNumber)
-	filePath := path.Join(DIST_FOLDER, "json", configName)
+func serveRandomAdConfig(distDir string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		configNumber := getConfigNumber()
+		configName := fmt.Sprintf("amp-story-auto-ads-%v.json", configNumber)
+		filePath := path.Join(distDir, "json", configName)
 
-	SendJsonFile(w, filePath)
+		SendJsonFile(w, filePath)
+	}
 }
@@ -15,6 +15,7 @@
 package backend
 
 import (
+	"backend/config"
 	"fmt"
 	"net/http"
 )
@@ -23,7 +24,7 @@ const (
 	EMAIL_BASE_PATH = "/amphtml-email/"
 )
 
-func InitAmpEmail() {
+func InitAmpEmail(cfg *config.Config) {
 	RegisterHandler(EMAIL_BASE_PATH+"submit-form-friend-request", onlyPost(submitFormFriendRequest))
 	RegisterHandler(EMAIL_BASE_PATH+"submit-form-bookmark", onlyPost(submitFormBookmark))
 }
@@ -12,40 +12,28 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-package datastore
+package backend
 
 import (
-	"io/ioutil"
-
-	"cloud.google.com/go/storage"
-	"golang.org/x/net/context"
-	"google.golang.org/appengine/file"
+	"backend/assets"
+	"backend/config"
+	"log"
 )
 
-func ReadFile(ctx context.Context, filename string) ([]byte, error) {
-	bucketName, err := file.DefaultBucketName(ctx)
-	if err != nil {
-		return nil, err
-	}
+// Fingerprinted names of the assets in DistDir, see the asset template
+// function.
+var assetManifest = assets.Manifest{}
 
-	client, err := storage.NewClient(ctx)
+func InitAssets(cfg *config.Config) {
+	log.Printf("Loading asset manifest")
+	manifest, err := assets.LoadManifest(cfg.AssetManifest)
 	if err != nil {
-		return nil, err
-	}
-	defer client.Close()
-
-	bucket := client.Bucket(bucketName)
-
-	rc, err := bucket.Object(filename).NewReader(ctx)
-	if err != nil {
-		return nil, err
-	}
-	defer rc.Close()
-
-	data, err := ioutil.ReadAll(rc)
-	if err != nil {
-		return nil, err
+		panic(err)
 	}
+	assetManifest = manifest
+}
 
-	return data, nil
+// assetPath is available in templates as [[asset "/css/main.css"]].
+func assetPath(name string) string {
+	return assetManifest.Path(name)
 }
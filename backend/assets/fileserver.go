@@ -0,0 +1,241 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package assets
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// Cache-Control of fingerprinted files, their content never changes.
+	IMMUTABLE_CACHE_CONTROL = "max-age=31536000, public, immutable"
+	INDEX_FILE              = "index.html"
+	// Length of the ETag hash in hex characters.
+	ETAG_LENGTH = 32
+)
+
+// Precompressed siblings in order of preference.
+var encodings = []struct {
+	name string
+	ext  string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// Content types missing from some mime tables.
+var contentTypes = map[string]string{
+	".json":        "application/json",
+	".webmanifest": "application/manifest+json",
+	".woff2":       "font/woff2",
+}
+
+type fileServer struct {
+	root     string
+	notFound http.HandlerFunc
+
+	etagsLock sync.Mutex
+	etags     map[string]string
+}
+
+// FileServer returns a handler serving the files below root. Unlike
+// http.FileServer it doesn't list directories. Missing files are passed to
+// notFound, nil means http.NotFound.
+func FileServer(root string, notFound http.HandlerFunc) http.Handler {
+	if notFound == nil {
+		notFound = http.NotFound
+	}
+	return &fileServer{root: root, notFound: notFound, etags: make(map[string]string)}
+}
+
+func (s *fileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	urlPath := path.Clean("/" + r.URL.Path)
+	if strings.HasSuffix(urlPath, "/"+INDEX_FILE) {
+		redirect(w, r, strings.TrimSuffix(urlPath, INDEX_FILE))
+		return
+	}
+	name := filepath.Join(s.root, filepath.FromSlash(urlPath))
+	info, err := os.Stat(name)
+	if err != nil {
+		s.notFound(w, r)
+		return
+	}
+	if info.IsDir() {
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			redirect(w, r, path.Base(urlPath)+"/")
+			return
+		}
+		name = filepath.Join(name, INDEX_FILE)
+	}
+
+	contentType, err := s.contentType(name)
+	if err != nil {
+		s.notFound(w, r)
+		return
+	}
+	w.Header().Add("Vary", "Accept-Encoding")
+	f, info, encoding, err := s.open(name, r.Header.Get("Accept-Encoding"))
+	if err != nil {
+		s.notFound(w, r)
+		return
+	}
+	defer f.Close()
+	etag, err := s.etag(f, info)
+	if err != nil {
+		http.Error(w, "failed to read file", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("ETag", etag)
+	if encoding != "" {
+		w.Header().Set("Content-Encoding", encoding)
+	}
+	if IsFingerprinted(name) {
+		w.Header().Set("Cache-Control", IMMUTABLE_CACHE_CONTROL)
+	}
+	// ServeContent takes care of HEAD, conditional and Range requests.
+	http.ServeContent(w, r, name, info.ModTime(), f)
+}
+
+// open returns the best precompressed sibling of name accepted by the
+// client, or name itself.
+func (s *fileServer) open(name string, acceptEncoding string) (*os.File, os.FileInfo, string, error) {
+	accepted := parseAcceptEncoding(acceptEncoding)
+	for _, e := range encodings {
+		if !accepted(e.name) {
+			continue
+		}
+		f, info, err := openFile(name + e.ext)
+		if err == nil {
+			return f, info, e.name, nil
+		}
+	}
+	f, info, err := openFile(name)
+	return f, info, "", err
+}
+
+func openFile(name string) (*os.File, os.FileInfo, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		f.Close()
+		return nil, nil, os.ErrNotExist
+	}
+	return f, info, nil
+}
+
+// contentType is looked up by extension, or sniffed from the uncompressed
+// file.
+func (s *fileServer) contentType(name string) (string, error) {
+	ext := strings.ToLower(filepath.Ext(name))
+	if t, ok := contentTypes[ext]; ok {
+		return t, nil
+	}
+	if t := mime.TypeByExtension(ext); t != "" {
+		return t, nil
+	}
+	f, _, err := openFile(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	var buf [512]byte
+	n, _ := io.ReadFull(f, buf[:])
+	return http.DetectContentType(buf[:n]), nil
+}
+
+// etag returns a strong ETag of the file contents. Hashes are cached by
+// name, size and modification time and f is rewound afterwards.
+func (s *fileServer) etag(f *os.File, info os.FileInfo) (string, error) {
+	key := fmt.Sprintf("%s|%d|%d", f.Name(), info.Size(), info.ModTime().UnixNano())
+	s.etagsLock.Lock()
+	etag, ok := s.etags[key]
+	s.etagsLock.Unlock()
+	if ok {
+		return etag, nil
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	etag = `"` + hex.EncodeToString(h.Sum(nil))[:ETAG_LENGTH] + `"`
+	s.etagsLock.Lock()
+	s.etags[key] = etag
+	s.etagsLock.Unlock()
+	return etag, nil
+}
+
+// parseAcceptEncoding returns whether an encoding is acceptable according to
+// the Accept-Encoding header value. Encodings with q=0 are refused, "*"
+// accepts everything not listed.
+func parseAcceptEncoding(header string) func(string) bool {
+	qualities := make(map[string]float64)
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(fields[0]))
+		if coding == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		qualities[coding] = q
+	}
+	return func(coding string) bool {
+		if q, ok := qualities[coding]; ok {
+			return q > 0
+		}
+		q, ok := qualities["*"]
+		return ok && q > 0
+	}
+}
+
+// redirect keeps the query, like http.FileServer does.
+func redirect(w http.ResponseWriter, r *http.Request, target string) {
+	if q := r.URL.RawQuery; q != "" {
+		target += "?" + q
+	}
+	w.Header().Set("Location", target)
+	w.WriteHeader(http.StatusMovedPermanently)
+}
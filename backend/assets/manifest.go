@@ -0,0 +1,77 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package assets serves the built site: precompressed siblings are picked
+// by Accept-Encoding, responses carry strong ETags and support Range
+// requests, and fingerprinted files are cached forever. A Manifest maps the
+// logical names of fingerprinted files to their current names.
+package assets
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Matches file names like "main.3f2a9c1b0d.css".
+var fingerprintRegex = regexp.MustCompile(`\.[0-9a-f]{8,64}\.[A-Za-z0-9]+$`)
+
+// Manifest maps logical asset paths, e.g. "css/main.css", to their
+// fingerprinted paths, e.g. "css/main.3f2a9c1b0d.css". Paths are relative to
+// the served folder.
+type Manifest map[string]string
+
+// LoadManifest reads a manifest written by tools/fingerprint. A missing file
+// results in an empty manifest.
+func LoadManifest(manifestPath string) (Manifest, error) {
+	data, err := ioutil.ReadFile(manifestPath)
+	if os.IsNotExist(err) {
+		return Manifest{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Path returns the URL path of the asset name. Names missing from the
+// manifest are returned as they are. A leading "/" is kept.
+func (m Manifest) Path(name string) string {
+	prefix := ""
+	if strings.HasPrefix(name, "/") {
+		prefix = "/"
+	}
+	if hashed, ok := m[strings.TrimPrefix(name, "/")]; ok {
+		return prefix + hashed
+	}
+	return name
+}
+
+// IsFingerprinted reports whether the file name contains a content hash.
+func IsFingerprinted(name string) bool {
+	return fingerprintRegex.MatchString(path.Base(name))
+}
+
+// Fingerprint returns name with hash inserted before the extension.
+func Fingerprint(name string, hash string) string {
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + hash + ext
+}
@@ -15,6 +15,7 @@
 package backend
 
 import (
+	"backend/config"
 	"fmt"
 	"net/http"
 	"strings"
@@ -24,7 +25,7 @@ const (
 	AUTOSUGGEST_SAMPLE_PATH = "/" + CATEGORY_ADVANCED + "/autosuggest/"
 )
 
-func InitAutosuggestSample() {
+func InitAutosuggestSample(cfg *config.Config) {
 	US_CAPITAL_CITIES := []string{
 		"Montgomery, Alabama",
 		"Juneau, Alaska",
@@ -15,27 +15,183 @@
 package backend
 
 import (
-	"fmt"
+	"backend/config"
+	"backend/money"
+	"backend/orders"
+	"backend/payments"
+	"backend/promotions"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"log"
 	"net/http"
+	"net/mail"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/appengine"
 )
 
-const SHOPPING_CART_TOTAL = 9.94
+const (
+	CHECKOUT_PATH_PREFIX = "/checkout"
+	ORDERS_PATH          = CHECKOUT_PATH_PREFIX + "/orders/"
+	// Shipping of the shopping cart is estimated for this country until an
+	// address is entered.
+	CHECKOUT_DEFAULT_COUNTRY = "US"
+	// Number of clients whose applied codes are remembered.
+	CHECKOUT_MAX_CARTS = 1000
+	// Number of orders kept in memory.
+	CHECKOUT_MAX_ORDERS    = 1000
+	IDEMPOTENCY_KEY_HEADER = "Idempotency-Key"
+)
 
-var discounts map[string]float32
+// Card fields aren't part of the form fingerprint, so that a declined order
+// can be paid by submitting the form again with another card.
+var paymentFields = map[string]bool{
+	"cc":         true,
+	"ccname":     true,
+	"cardnumber": true,
+	"cvc":        true,
+	"cc-exp":     true,
+}
 
-func InitCheckout() {
-	RegisterHandler("/checkout/shopping-cart", handleShoppingCart)
-	RegisterHandler("/checkout/apply-code", handleApplyCode)
-	discounts = make(map[string]float32)
+// The shopping cart of clients that didn't add anything with the product
+// page sample.
+var checkoutDemoItems = []promotions.Item{
+	{SKU: "item-1", Name: "Item 1", Price: 199, Quantity: 2},
+	{SKU: "item-2", Name: "Item 2", Price: 299, Quantity: 1},
+	{SKU: "item-3", Name: "Item 3", Price: 99, Quantity: 3},
+}
+
+var checkoutPromotions = []promotions.Promotion{
+	{
+		Code:        "ABC123",
+		Kind:        promotions.PERCENTAGE,
+		Description: "20% off",
+		Percent:     20,
+		Stackable:   true,
+	},
+	{
+		Code:        "FREESHIP",
+		Kind:        promotions.FREE_SHIPPING,
+		Description: "Free shipping",
+		Stackable:   true,
+	},
+	{
+		Code:        "ITEM3",
+		Kind:        promotions.BUY_X_GET_Y,
+		Description: "Buy 2 Item 3, get 1 free",
+		SKU:         "item-3",
+		Buy:         2,
+		Get:         1,
+		Stackable:   true,
+	},
+	{
+		Code:               "WELCOME",
+		Kind:               promotions.FIXED_AMOUNT,
+		Description:        "$1 off your first order",
+		Amount:             100,
+		MaxUsesPerCustomer: 1,
+	},
+	{
+		Code:        "BIGSPENDER",
+		Kind:        promotions.FIXED_AMOUNT,
+		Description: "$10 off orders over $50",
+		Amount:      1000,
+		MinSubtotal: 5000,
+	},
+	{
+		Code:        "SUMMER2018",
+		Kind:        promotions.PERCENTAGE,
+		Description: "15% summer sale",
+		Percent:     15,
+		Ends:        time.Date(2018, time.September, 1, 0, 0, 0, 0, time.UTC),
+	},
+}
+
+var checkoutEngine *promotions.Engine
+var checkoutRules *orders.Rules
+var orderStore orders.Store
+
+// Addresses logged in users can pick, by ID.
+var savedAddresses map[string]orders.Address
+
+// Codes applied by client ID.
+var appliedCodes = struct {
+	sync.Mutex
+	cache *LRUCache
+}{cache: NewLRUCache(CHECKOUT_MAX_CARTS)}
+
+func InitCheckout(cfg *config.Config) {
+	engine, err := promotions.NewEngine(checkoutPromotions)
+	if err != nil {
+		panic(err)
+	}
+	checkoutEngine = engine
+	checkoutRules = &orders.Rules{
+		TaxRates:         cfg.Checkout.TaxRates,
+		ShippingRates:    cfg.Checkout.ShippingRates,
+		FreeShippingOver: cfg.Checkout.FreeShippingOver,
+	}
+	orderStore = orders.ParseStore(cfg.Checkout.OrderStore, CHECKOUT_MAX_ORDERS)
+	savedAddresses = loadSavedAddresses(cfg.DistDir + "/json/addresses.json")
+	RegisterHandler(CHECKOUT_PATH_PREFIX+"/shopping-cart", handleShoppingCart)
+	RegisterHandler(CHECKOUT_PATH_PREFIX+"/apply-code", onlyPost(handleApplyCode))
+	RegisterHandler(CHECKOUT_PATH_PREFIX+"/place-order", onlyPost(handlePlaceOrder))
+	RegisterTemplate(cfg, ORDERS_PATH, "", cfg.TemplateDir+"/order-confirmation.html", renderOrder)
 }
 
 func handleApplyCode(w http.ResponseWriter, r *http.Request) {
 	SetMaxAge(w, 0)
-	if r.Method == "POST" {
-		clientId := r.FormValue("clientId")
-		discounts[clientId] = 0.2
-		writeShoppingCart(w, r, clientId)
+	clientId := r.FormValue("clientId")
+	code := r.FormValue("code")
+	if code == "" {
+		sendCodeError(w, &promotions.RejectedError{
+			Reason:  promotions.REJECT_UNKNOWN,
+			Message: "Please enter a code.",
+		})
+		return
 	}
+
+	cart := clientCart(clientId, CHECKOUT_DEFAULT_COUNTRY)
+	appliedCodes.Lock()
+	defer appliedCodes.Unlock()
+	codes := getAppliedCodes(clientId)
+	// Codes are only redeemed when the order is placed.
+	if err := checkoutEngine.Check(cart, codes, code, clientId); err != nil {
+		sendCodeError(w, err)
+		return
+	}
+	p, _ := checkoutEngine.Lookup(code)
+	codes = append(codes, p.Code)
+	appliedCodes.cache.Add(clientId, codes)
+	SendJsonResponse(w, map[string]string{
+		"code":        p.Code,
+		"description": p.Description,
+	})
+}
+
+// sendCodeError responds with the reason for rejecting a code, for the
+// submit-error template of the form.
+func sendCodeError(w http.ResponseWriter, err error) {
+	rejected, ok := err.(*promotions.RejectedError)
+	if !ok {
+		SendJsonError(w, http.StatusInternalServerError, map[string]string{
+			"message": "The code couldn't be applied, please try again.",
+		})
+		return
+	}
+	SendJsonError(w, http.StatusBadRequest, map[string]string{
+		"code":    rejected.Code,
+		"reason":  rejected.Reason,
+		"message": rejected.Message,
+	})
 }
 
 func handleShoppingCart(w http.ResponseWriter, r *http.Request) {
@@ -47,34 +203,443 @@ func handleShoppingCart(w http.ResponseWriter, r *http.Request) {
 }
 
 func writeShoppingCart(w http.ResponseWriter, r *http.Request, clientId string) {
-	discount := discounts[clientId]
-	total := SHOPPING_CART_TOTAL - SHOPPING_CART_TOTAL*discount
-	cart := createShoppingCart()
-	cart["total"] = fmt.Sprintf("%.2f", total)
-	if discount > 0 {
-		cart["discount"] = fmt.Sprintf("%g%%", (discount * 100))
-	}
-	SendJsonResponse(w, cart)
-}
-
-func createShoppingCart() map[string]interface{} {
-	return map[string]interface{}{
-		"items": []interface{}{
-			map[string]interface{}{
-				"name":     "Item 1",
-				"price":    "1.99",
-				"quantity": "2",
-			},
-			map[string]interface{}{
-				"name":     "Item 2",
-				"price":    "2.99",
-				"quantity": "1",
-			},
-			map[string]interface{}{
-				"name":     "Item 3",
-				"price":    "0.99",
-				"quantity": "3",
-			},
-		},
+	cart := clientCart(clientId, CHECKOUT_DEFAULT_COUNTRY)
+	appliedCodes.Lock()
+	codes := getAppliedCodes(clientId)
+	appliedCodes.Unlock()
+	result := checkoutEngine.Apply(cart, codes)
+
+	items := make([]interface{}, len(cart.Items))
+	for i, item := range cart.Items {
+		items[i] = map[string]interface{}{
+			"name":     item.Name,
+			"price":    item.Price,
+			"quantity": item.Quantity,
+		}
+	}
+	SendJsonResponse(w, map[string]interface{}{
+		"items":     items,
+		"subtotal":  result.Subtotal,
+		"discounts": result.Discounts,
+		"shipping":  result.Shipping,
+		"total":     result.Total,
+	})
+}
+
+func handlePlaceOrder(w http.ResponseWriter, r *http.Request) {
+	SetMaxAge(w, 0)
+	clientId := r.FormValue("clientId")
+	if clientId == "" {
+		SendJsonError(w, http.StatusBadRequest, map[string]string{
+			"message": "Missing client ID.",
+		})
+		return
+	}
+
+	name := formValue(r, "name")
+	email := formValue(r, "email")
+	var fieldErrors []orders.FieldError
+	if name == "" {
+		fieldErrors = append(fieldErrors, orders.FieldError{Name: "name", Message: "Please enter your name."})
+	}
+	if _, err := mail.ParseAddress(email); err != nil {
+		fieldErrors = append(fieldErrors, orders.FieldError{Name: "email", Message: "Please enter a valid email address."})
+	}
+	shipping, errs := shippingAddress(r, name)
+	fieldErrors = append(fieldErrors, errs...)
+	billing := shipping
+	if formValue(r, "billing-address") != "" {
+		billing, errs = formAddress(r, "billing-", name)
+		fieldErrors = append(fieldErrors, errs...)
+	}
+	token, err := paymentToken(r)
+	if err != nil {
+		fieldErrors = append(fieldErrors, orders.FieldError{
+			Name:    "cardnumber",
+			Message: "Please use a test card, e.g. 4242 4242 4242 4242.",
+		})
+	}
+	if len(fieldErrors) == 0 {
+		cart := clientCart(clientId, CHECKOUT_DEFAULT_COUNTRY)
+		if _, ok := checkoutRules.Shipping(shipping.Country, cart.Subtotal()); !ok {
+			fieldErrors = append(fieldErrors, orders.FieldError{
+				Name:    "ship-country",
+				Message: "Sorry, we don't ship to " + shipping.Country + ".",
+			})
+		}
+	}
+	if len(fieldErrors) > 0 {
+		SendJsonError(w, http.StatusBadRequest, map[string]interface{}{
+			"message": "Please check your details.",
+			"errors":  fieldErrors,
+		})
+		return
+	}
+
+	// Keys are scoped to the client so that they can't collide.
+	key := r.Header.Get(IDEMPOTENCY_KEY_HEADER)
+	if key == "" {
+		key = r.FormValue("idempotencyKey")
+	}
+	if key != "" {
+		key = clientId + ":" + key
+	}
+	ctx := appengine.NewContext(r)
+	order, replayed, err := orderStore.Place(ctx, key, formFingerprint(r.PostForm), func() (*orders.Order, error) {
+		return createOrder(clientId, name, email, shipping, billing)
+	})
+	switch err {
+	case nil:
+	case orders.ErrConflict:
+		SendJsonError(w, http.StatusConflict, map[string]string{
+			"message": "This order was submitted already with different details. Please reload the page.",
+		})
+		return
+	case orders.ErrPending:
+		SendJsonError(w, http.StatusConflict, map[string]string{
+			"message": "Your order is being placed, please wait a moment and try again.",
+		})
+		return
+	default:
+		if _, ok := err.(*promotions.RejectedError); ok {
+			sendCodeError(w, err)
+			return
+		}
+		log.Printf("Failed to place order for %s: %v", clientId, err)
+		SendJsonError(w, http.StatusInternalServerError, map[string]string{
+			"message": "Your order couldn't be placed, please try again.",
+		})
+		return
+	}
+	if !replayed {
+		cartLock.Lock()
+		cartCache.Remove(clientId)
+		cartLock.Unlock()
+		appliedCodes.Lock()
+		appliedCodes.cache.Remove(clientId)
+		appliedCodes.Unlock()
+	}
+	payOrder(w, r, order, token)
+}
+
+// payOrder charges the order with the payment method behind token, unless
+// it was paid already. Customers that have to pass a challenge are
+// redirected to it and come back to the order confirmation.
+func payOrder(w http.ResponseWriter, r *http.Request, order *orders.Order, token string) {
+	ctx := appengine.NewContext(r)
+	// The codes were given back if an earlier attempt failed.
+	redeemed, err := redeemCodes(ctx, order.ID)
+	if _, ok := err.(*promotions.RejectedError); ok {
+		sendCodeError(w, err)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to redeem the codes of order %s: %v", order.ID, err)
+		SendJsonError(w, http.StatusInternalServerError, map[string]string{
+			"message": "Your payment couldn't be processed, please try again.",
+		})
+		return
+	}
+	order = redeemed
+	intent, err := paymentProvider.CreateIntent(ctx, payments.IntentParams{
+		Amount:         order.Total,
+		Currency:       PAYMENTS_CURRENCY,
+		OrderID:        order.ID,
+		ReturnURL:      GetHost(r) + ORDERS_PATH + order.ID,
+		IdempotencyKey: order.ID,
+	})
+	if err == nil && intent.Status == payments.STATUS_REQUIRES_PAYMENT_METHOD {
+		_, err = orderStore.Update(ctx, order.ID, func(o *orders.Order) {
+			o.PaymentIntent = intent.ID
+		})
+		if err == nil {
+			intent, err = paymentProvider.Confirm(ctx, intent.ID, token)
+		}
+	}
+	if decline, ok := err.(*payments.DeclineError); ok {
+		recordPayment(ctx, intent)
+		SendJsonError(w, http.StatusPaymentRequired, map[string]string{
+			"message": decline.Message + " Please try another card.",
+		})
+		return
+	}
+	if err != nil {
+		updateReleasingCodes(ctx, order.ID, markCodesReleased)
+		log.Printf("Failed to pay order %s: %v", order.ID, err)
+		SendJsonError(w, http.StatusInternalServerError, map[string]string{
+			"message": "Your payment couldn't be processed, please try again.",
+		})
+		return
+	}
+	recordPayment(ctx, intent)
+
+	if intent.Status == payments.STATUS_REQUIRES_ACTION {
+		w.Header().Set("Access-Control-Expose-Headers", "AMP-Access-Control-Allow-Source-Origin,AMP-Redirect-To")
+		w.Header().Set("AMP-Redirect-To", GetHost(r)+intent.ChallengeURL)
+	}
+	SendJsonResponse(w, map[string]interface{}{
+		"orderId":         order.ID,
+		"total":           order.Total,
+		"paymentStatus":   intent.Status,
+		"confirmationUrl": ORDERS_PATH + order.ID,
+	})
+}
+
+// paymentToken returns the token of the saved card or the test card
+// entered in the form.
+func paymentToken(r *http.Request) (string, error) {
+	if token, ok := savedCards[formValue(r, "cc")]; ok {
+		return token, nil
+	}
+	return payments.Tokenize(formValue(r, "cardnumber"))
+}
+
+// createOrder prices the client's cart and redeems the applied codes, all
+// of them or none.
+func createOrder(clientId string, name string, email string, shipping orders.Address, billing orders.Address) (*orders.Order, error) {
+	cart := clientCart(clientId, shipping.Country)
+	appliedCodes.Lock()
+	codes := getAppliedCodes(clientId)
+	appliedCodes.Unlock()
+	result := checkoutEngine.Apply(cart, codes)
+	if err := checkoutEngine.RedeemAll(discountCodes(result.Discounts), clientId); err != nil {
+		return nil, err
+	}
+	tax := checkoutRules.Tax(&shipping, result.Subtotal-result.Discount)
+	return &orders.Order{
+		ClientID:        clientId,
+		Name:            name,
+		Email:           email,
+		ShippingAddress: shipping,
+		BillingAddress:  billing,
+		Items:           cart.Items,
+		Discounts:       result.Discounts,
+		Subtotal:        result.Subtotal,
+		Discount:        result.Discount,
+		Shipping:        result.Shipping,
+		Tax:             tax,
+		Total:           result.Total + tax,
+		CodesRedeemed:   true,
+	}, nil
+}
+
+// redeemCodes counts the discount codes of the order with id as used,
+// unless they are already or the order is paid. The order is marked first,
+// so that concurrent requests don't redeem the codes twice.
+func redeemCodes(ctx context.Context, id string) (*orders.Order, error) {
+	redeem := false
+	order, err := orderStore.Update(ctx, id, func(o *orders.Order) {
+		redeem = !o.CodesRedeemed && o.PaymentStatus != payments.STATUS_SUCCEEDED
+		if redeem {
+			o.CodesRedeemed = true
+		}
+	})
+	if err != nil || !redeem {
+		return order, err
+	}
+	if err := checkoutEngine.RedeemAll(discountCodes(order.Discounts), order.ClientID); err != nil {
+		orderStore.Update(ctx, id, func(o *orders.Order) { o.CodesRedeemed = false })
+		return nil, err
+	}
+	return order, nil
+}
+
+// updateReleasingCodes updates the order with id and gives back its
+// discount codes if update returns true, so that they can be used again.
+// The codes are released once the order is stored, as update may be called
+// more than once.
+func updateReleasingCodes(ctx context.Context, id string, update func(*orders.Order) bool) (*orders.Order, error) {
+	release := false
+	order, err := orderStore.Update(ctx, id, func(o *orders.Order) {
+		release = update(o)
+	})
+	if err == nil && release {
+		checkoutEngine.Release(discountCodes(order.Discounts), order.ClientID)
+	}
+	return order, err
+}
+
+// markCodesReleased marks the discount codes of an order that couldn't be
+// paid as unused and reports whether they were counted.
+func markCodesReleased(o *orders.Order) bool {
+	released := o.CodesRedeemed
+	o.CodesRedeemed = false
+	return released
+}
+
+func discountCodes(discounts []promotions.Discount) []string {
+	codes := make([]string, len(discounts))
+	for i, discount := range discounts {
+		codes[i] = discount.Code
+	}
+	return codes
+}
+
+func renderOrder(w http.ResponseWriter, r *http.Request, page Page) {
+	ctx := appengine.NewContext(r)
+	order, err := orderStore.Get(ctx, strings.TrimPrefix(r.URL.Path, ORDERS_PATH))
+	if err == orders.ErrNotFound {
+		NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to read order %s: %v", r.URL.Path, err)
+		SendError(w, r, http.StatusInternalServerError, "The order couldn't be loaded, please try again.")
+		return
+	}
+	if order.PaymentStatus == payments.STATUS_PROCESSING {
+		// Delayed captures are applied when the intent is read.
+		if intent, err := paymentProvider.Get(ctx, order.PaymentIntent); err == nil {
+			if updated, err := recordPayment(ctx, intent); err == nil {
+				order = updated
+			}
+		}
+	}
+	w.Header().Set("Cache-Control", "private, no-store")
+	page.Render(w, order)
+}
+
+// shippingAddress is either one of the saved addresses or entered in the
+// form.
+func shippingAddress(r *http.Request, name string) (orders.Address, []orders.FieldError) {
+	if address, ok := savedAddresses[formValue(r, "address")]; ok {
+		return address, nil
+	}
+	return formAddress(r, "ship-", name)
+}
+
+// formAddress reads the address fields starting with prefix, errors are
+// reported with the form field names.
+func formAddress(r *http.Request, prefix string, name string) (orders.Address, []orders.FieldError) {
+	address := orders.Address{
+		Name:    name,
+		Street:  formValue(r, prefix+"address"),
+		City:    formValue(r, prefix+"city"),
+		State:   formValue(r, prefix+"state"),
+		Zip:     formValue(r, prefix+"zip"),
+		Country: formValue(r, prefix+"country"),
+	}
+	errors := address.Validate()
+	for i := range errors {
+		if errors[i].Name == "street" {
+			errors[i].Name = "address"
+		}
+		errors[i].Name = prefix + errors[i].Name
+	}
+	return address, errors
+}
+
+// formValue returns the first non-empty value of the field. The sample form
+// has the same fields for logged in and anonymous users.
+func formValue(r *http.Request, name string) string {
+	r.ParseMultipartForm(32 << 10)
+	for _, value := range r.Form[name] {
+		if value = strings.TrimSpace(value); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// formFingerprint identifies the submitted form independent of field order.
+func formFingerprint(form url.Values) string {
+	keys := make([]string, 0, len(form))
+	for key := range form {
+		if key != "idempotencyKey" && !paymentFields[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	h := sha256.New()
+	for _, key := range keys {
+		for _, value := range form[key] {
+			h.Write([]byte(key + "=" + value + "\n"))
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// clientCart returns the cart the client filled with the product page, or
+// the demo cart. Shipping is priced for country.
+func clientCart(clientId string, country string) *promotions.Cart {
+	var items []promotions.Item
+	cartLock.Lock()
+	if value, ok := cartCache.Get(clientId); ok {
+		for item, quantity := range value.(map[ShoppingCartItem]int) {
+			price, err := parsePrice(item.Price)
+			if err != nil {
+				continue
+			}
+			items = append(items, promotions.Item{
+				SKU:      strings.Join([]string{item.Name, item.Color, item.Size}, "/"),
+				Name:     cartItemName(item),
+				Price:    price,
+				Quantity: quantity,
+			})
+		}
+	}
+	cartLock.Unlock()
+	if len(items) == 0 {
+		items = make([]promotions.Item, len(checkoutDemoItems))
+		copy(items, checkoutDemoItems)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].SKU < items[j].SKU })
+	cart := &promotions.Cart{Items: items}
+	cart.Shipping, _ = checkoutRules.Shipping(country, cart.Subtotal())
+	return cart
+}
+
+func cartItemName(item ShoppingCartItem) string {
+	var details []string
+	for _, detail := range []string{item.Color, item.Size} {
+		if detail != "" {
+			details = append(details, detail)
+		}
+	}
+	if len(details) == 0 {
+		return item.Name
+	}
+	return item.Name + " (" + strings.Join(details, ", ") + ")"
+}
+
+// parsePrice reads prices like "1.99" or "$1.99".
+func parsePrice(price string) (money.Amount, error) {
+	return money.Parse(strings.TrimPrefix(strings.TrimSpace(price), "$"))
+}
+
+// getAppliedCodes needs appliedCodes to be locked.
+func getAppliedCodes(clientId string) []string {
+	codes, ok := appliedCodes.cache.Get(clientId)
+	if !ok {
+		return nil
+	}
+	return codes.([]string)
+}
+
+func loadSavedAddresses(path string) map[string]orders.Address {
+	addresses := make(map[string]orders.Address)
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return addresses
+	}
+	if err != nil {
+		panic(err)
+	}
+	var saved struct {
+		Addresses []struct {
+			ID string `json:"id"`
+			orders.Address
+		} `json:"addresses"`
+	}
+	if err := json.Unmarshal(data, &saved); err != nil {
+		panic(err)
+	}
+	for _, a := range saved.Addresses {
+		if a.Country == "" {
+			a.Country = CHECKOUT_DEFAULT_COUNTRY
+		}
+		a.Address.Normalize()
+		addresses[a.ID] = a.Address
 	}
+	return addresses
 }
@@ -0,0 +1,148 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package backend
+
+import (
+	"backend/orders"
+	"backend/payments"
+	"backend/promotions"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+// setUpCheckout replaces the checkout state with a memory order store, the
+// fake provider without webhooks and ONCE, a code that can be used once.
+func setUpCheckout(t *testing.T) {
+	engine, err := promotions.NewEngine([]promotions.Promotion{{
+		Code:    "ONCE",
+		Kind:    promotions.FIXED_AMOUNT,
+		Amount:  100,
+		MaxUses: 1,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkoutEngine = engine
+	orderStore = orders.NewMemoryStore(10)
+	paymentProvider = payments.NewFakeProvider(payments.FakeOptions{})
+}
+
+// codeAvailable reports whether ONCE can be redeemed, without redeeming it.
+func codeAvailable() bool {
+	if err := checkoutEngine.RedeemAll([]string{"ONCE"}, "probe"); err != nil {
+		return false
+	}
+	checkoutEngine.Release([]string{"ONCE"}, "probe")
+	return true
+}
+
+func TestDeclineReleasesCodesUntilRetry(t *testing.T) {
+	setUpCheckout(t)
+	ctx := context.Background()
+	order, _, err := orderStore.Place(ctx, "client:key", "form", func() (*orders.Order, error) {
+		if err := checkoutEngine.RedeemAll([]string{"ONCE"}, "client"); err != nil {
+			return nil, err
+		}
+		return &orders.Order{
+			ClientID:      "client",
+			Discounts:     []promotions.Discount{{Code: "ONCE", Amount: 100}},
+			Total:         900,
+			CodesRedeemed: true,
+		}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if codeAvailable() {
+		t.Fatal("code available after placing the order")
+	}
+
+	intent, err := paymentProvider.CreateIntent(ctx, payments.IntentParams{Amount: order.Total, OrderID: order.ID, IdempotencyKey: order.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	orderStore.Update(ctx, order.ID, func(o *orders.Order) { o.PaymentIntent = intent.ID })
+
+	// A declined card gives the code back.
+	declined, err := paymentProvider.Confirm(ctx, intent.ID, payments.TOKEN_DECLINED)
+	if _, ok := err.(*payments.DeclineError); !ok {
+		t.Fatalf("Confirm = %v, want a decline", err)
+	}
+	updated, err := recordPayment(ctx, declined)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.CodesRedeemed || updated.PaymentStatus != payments.STATUS_REQUIRES_PAYMENT_METHOD || updated.PaymentError == "" {
+		t.Errorf("order after decline = %+v", updated)
+	}
+	if !codeAvailable() {
+		t.Error("code not released after the decline")
+	}
+	// A late copy of the event doesn't release the code twice.
+	if _, err := recordPayment(ctx, declined); err != nil {
+		t.Fatal(err)
+	}
+
+	// Retrying redeems it again, once.
+	if updated, err = redeemCodes(ctx, order.ID); err != nil || !updated.CodesRedeemed {
+		t.Fatalf("redeemCodes = %+v, %v", updated, err)
+	}
+	if codeAvailable() {
+		t.Error("code available after the retry")
+	}
+	if _, err := redeemCodes(ctx, order.ID); err != nil {
+		t.Errorf("redeemCodes of redeemed codes = %v", err)
+	}
+
+	paid, err := paymentProvider.Confirm(ctx, intent.ID, payments.TOKEN_SUCCESS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated, err = recordPayment(ctx, paid); err != nil || updated.PaymentStatus != payments.STATUS_SUCCEEDED || updated.PaymentError != "" {
+		t.Errorf("order after payment = %+v, %v", updated, err)
+	}
+	// Events of the decline arriving after the payment are ignored.
+	if updated, err = recordPayment(ctx, declined); err != nil || updated.PaymentStatus != payments.STATUS_SUCCEEDED || !updated.CodesRedeemed {
+		t.Errorf("order after a late decline = %+v, %v", updated, err)
+	}
+	if codeAvailable() {
+		t.Error("code available after the payment")
+	}
+}
+
+func TestRetryWithUsedUpCode(t *testing.T) {
+	setUpCheckout(t)
+	ctx := context.Background()
+	order, _, err := orderStore.Place(ctx, "", "", func() (*orders.Order, error) {
+		return &orders.Order{
+			ClientID:  "client",
+			Discounts: []promotions.Discount{{Code: "ONCE", Amount: 100}},
+			Total:     900,
+		}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Someone else used the code while the payment was failing.
+	if err := checkoutEngine.RedeemAll([]string{"ONCE"}, "other"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := redeemCodes(ctx, order.ID); err == nil {
+		t.Fatal("redeemCodes succeeded with a used up code")
+	}
+	if stored, _ := orderStore.Get(ctx, order.ID); stored.CodesRedeemed {
+		t.Error("order marked as redeemed although the code was used up")
+	}
+}
@@ -15,6 +15,8 @@
 package backend
 
 import (
+	"backend/config"
+	"backend/oauth"
 	"github.com/patrickmn/go-cache"
 	"log"
 	"net/http"
@@ -47,7 +49,7 @@ var defaultComments = []Comment{
 	},
 }
 
-func InitCommentSection() {
+func InitCommentSection(cfg *config.Config) {
 	commentsCache = cache.New(5*time.Minute, 10*time.Minute)
 	RegisterHandler(COMMENT_SAMPLE_PATH+"comments/new", onlyPost(submitCommentXHR))
 	RegisterHandler(COMMENT_SAMPLE_PATH+"comments", handleComments)
@@ -79,9 +81,13 @@ func submitCommentXHR(w http.ResponseWriter, r *http.Request) {
 	comments := loadComments(r)
 	text := r.FormValue("text")
 	if text != "" {
+		user := oauth.GetUserName(r)
+		if user == "" {
+			user = USER
+		}
 		newComment := Comment{
 			Text:     text,
-			User:     USER,
+			User:     user,
 			Datetime: time.Now().Format("15:04:05"),
 		}
 		comments = append(comments, newComment)
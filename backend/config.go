@@ -15,14 +15,9 @@
 package backend
 
 const (
-	DIST_FOLDER     = "dist"
-	TEMPLATE_FOLDER = "templates"
-
 	AMP_CLIENT_ID_COOKIE = "AMP_ECID_GOOGLE"
 
 	CATEGORY_ADVANCED         = "advanced"
 	CATEGORY_COMPONENTS       = "components"
 	CATEGORY_SAMPLE_TEMPLATES = "samples_templates"
-	// Where to find the SXG service (i.e. host running https://github.com/ampproject/amppackager)
-	PACKAGER_PREFIX = "https://amp-by-example-sxg.appspot.com/"
 )
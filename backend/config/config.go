@@ -0,0 +1,321 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package config holds the runtime configuration of the server. It is loaded
+// from a JSON file and can be overridden with environment variables, so the
+// same binary can run as a production, staging or local instance.
+package config
+
+import (
+	"backend/money"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	DEFAULT_PATH = "config.json"
+	// Environment variable selecting the config file.
+	PATH_ENV_VAR = "ABE_CONFIG"
+)
+
+type Config struct {
+	// Canonical origin of the site. Relative redirects and insecure requests
+	// are redirected here.
+	Host string `json:"host"`
+	// Hosts that are redirected to Host.
+	LegacyHosts []string `json:"legacyHosts"`
+	// Folder containing the built site.
+	DistDir string `json:"distDir"`
+	// JSON array of the URL paths of all AMP documents in DistDir. If empty,
+	// AMP documents are detected by their <html> tag.
+	AMPManifest string `json:"ampManifest"`
+	// JSON file mapping asset names to their fingerprinted names, written by
+	// tools/fingerprint. Optional.
+	AssetManifest string `json:"assetManifest"`
+	// Folder containing server side templates.
+	TemplateDir string `json:"templateDir"`
+	// JSON file with the redirect rules, see package redirect.
+	Redirects string `json:"redirects"`
+	// Secrets backend, see secrets.ParseBackend.
+	SecretsBackend string `json:"secretsBackend"`
+	// Where favorites are kept, see items.UseDatastore.
+	FavoriteStore string `json:"favoriteStore"`
+	// Where ratings are kept, see items.UseDatastore.
+	RatingStore string `json:"ratingStore"`
+	// Where the seat map samples keep holds and bookings, see
+	// items.UseDatastore.
+	SeatStore string `json:"seatStore"`
+	// Where the bookings and loyalty accounts of the hotel sample are kept,
+	// see items.UseDatastore.
+	HotelStore     string               `json:"hotelStore"`
+	SignedExchange SignedExchangeConfig `json:"signedExchange"`
+	Playground     PlaygroundConfig     `json:"playground"`
+	Checkout       CheckoutConfig       `json:"checkout"`
+	Payments       PaymentsConfig       `json:"payments"`
+	Faults         FaultsConfig         `json:"faults"`
+	Features       Features             `json:"features"`
+}
+
+// SignedExchangeConfig names the secrets used to sign exchanges.
+type SignedExchangeConfig struct {
+	// PEM encoded certificate chain, leaf first. The leaf needs a P-256 key
+	// and the CanSignHttpExchanges extension.
+	CertSecret string `json:"certSecret"`
+	// PEM encoded private key of the leaf certificate.
+	KeySecret string `json:"keySecret"`
+	// DER encoded OCSP response for the leaf certificate (optional).
+	OCSPSecret string `json:"ocspSecret"`
+}
+
+type PlaygroundConfig struct {
+	// Hosts, including the port if any, the playground may load documents
+	// from through its fetch proxy.
+	FetchOrigins []string `json:"fetchOrigins"`
+	// Largest upstream response the fetch proxy passes on, in bytes.
+	FetchMaxBytes int64 `json:"fetchMaxBytes"`
+	// Time allowed for a fetch including all redirects, in seconds.
+	FetchTimeoutSeconds int `json:"fetchTimeoutSeconds"`
+	// Where the AMP component versions come from, see
+	// components.ParseSource in the playground.
+	ComponentsSource string `json:"componentsSource"`
+	// Where saved documents are kept, see snippets.ParseStore in the
+	// playground.
+	SnippetStore string `json:"snippetStore"`
+	// Largest document that can be saved, in bytes.
+	SnippetMaxBytes int64 `json:"snippetMaxBytes"`
+	// Saves allowed per client IP and minute.
+	SaveRateLimit int `json:"saveRateLimit"`
+	// Validator rules files or glob patterns, either validator.protoascii
+	// files from the amphtml repository or JSON files with the same fields.
+	// tools/validatorrules copies the protoascii files to the default.
+	ValidatorRules []string `json:"validatorRules"`
+}
+
+// CheckoutConfig holds the tax and shipping rules of the checkout sample.
+type CheckoutConfig struct {
+	// Tax rates in basis points (1/100 of a percent) by "<country>-<region>"
+	// or "<country>", e.g. "US-NY" or "DE". "*" applies everywhere else.
+	TaxRates map[string]int `json:"taxRates"`
+	// Shipping cost by country, "*" for all others. Countries without a rate
+	// aren't shipped to.
+	ShippingRates map[string]money.Amount `json:"shippingRates"`
+	// Subtotal from which shipping is free, 0 for never.
+	FreeShippingOver money.Amount `json:"freeShippingOver"`
+	// Where orders are kept, see items.UseDatastore.
+	OrderStore string `json:"orderStore"`
+}
+
+type PaymentsConfig struct {
+	// Payment provider, see payments.ParseProvider.
+	Provider string `json:"provider"`
+	// Time until the fake provider captures payments made with the delayed
+	// capture test card, in seconds.
+	CaptureDelaySeconds int `json:"captureDelaySeconds"`
+}
+
+// FaultsConfig limits the faults requests can ask for, see package faults.
+type FaultsConfig struct {
+	// Cap of the time a response is delayed, in seconds.
+	MaxDelaySeconds int `json:"maxDelaySeconds"`
+}
+
+type Features struct {
+	// Serve DistDir from Go instead of the app.yaml static handlers.
+	Static bool `json:"static"`
+	// Serve signed exchanges to clients asking for them.
+	SignedExchange bool `json:"signedExchange"`
+	// Serve AMP documents transformed by the AMP optimizer. Can be changed
+	// per request with ?optimize=1 or ?optimize=0.
+	Optimizer bool `json:"optimizer"`
+	// Inject the faults requests ask for into the responses of handlers
+	// registered with RegisterHandler.
+	Faults bool `json:"faults"`
+}
+
+func Default() *Config {
+	return &Config{
+		Host:        "https://ampbyexample.com",
+		LegacyHosts: []string{"amp-by-example.appspot.com"},
+		SignedExchange: SignedExchangeConfig{
+			CertSecret: "sxg_cert.pem",
+			KeySecret:  "sxg_key.pem",
+			OCSPSecret: "sxg_ocsp.der",
+		},
+		DistDir:       "dist",
+		AssetManifest: "dist/asset-manifest.json",
+		TemplateDir:   "templates",
+		Redirects:     "backend/redirects-amp.dev.json",
+		Playground: PlaygroundConfig{
+			FetchOrigins: []string{
+				"ampbyexample.com",
+				"ampstart.com",
+				"ampstart-staging.firebaseapp.com",
+				"localhost:8080",
+				"amp-by-example-staging.appspot.com",
+				"amp-by-example-sebastian.appspot.com",
+			},
+			FetchMaxBytes:       2 << 20, // 2 MB
+			FetchTimeoutSeconds: 10,
+			SnippetMaxBytes:     100 << 10, // 100 KB
+			SaveRateLimit:       10,
+			ValidatorRules:      []string{"playground/validator-rules/*.protoascii"},
+		},
+		Checkout: CheckoutConfig{
+			TaxRates: map[string]int{
+				"US-CA": 725,
+				"US-NY": 400,
+				"DE":    1900,
+				"FR":    2000,
+				"GB":    2000,
+				"*":     0,
+			},
+			ShippingRates: map[string]money.Amount{
+				"US": 499,
+				"*":  1499,
+			},
+			FreeShippingOver: 5000,
+		},
+		Payments: PaymentsConfig{
+			Provider:            "fake",
+			CaptureDelaySeconds: 30,
+		},
+		Faults: FaultsConfig{
+			MaxDelaySeconds: 10,
+		},
+		Features: Features{
+			SignedExchange: true,
+			Faults:         true,
+		},
+	}
+}
+
+// Load reads the config file at path on top of the defaults and applies the
+// environment overrides. An empty path means the file named by ABE_CONFIG or
+// DEFAULT_PATH. A missing file is not an error.
+func Load(path string) (*Config, error) {
+	if path == "" {
+		path = os.Getenv(PATH_ENV_VAR)
+	}
+	if path == "" {
+		path = DEFAULT_PATH
+	}
+	config := Default()
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := config.parse(data); err != nil {
+			return nil, fmt.Errorf("config: parsing %s: %v", path, err)
+		}
+	}
+	if err := config.applyEnv(os.LookupEnv); err != nil {
+		return nil, err
+	}
+	config.Host = strings.TrimSuffix(config.Host, "/")
+	return config, nil
+}
+
+// parse reads a config file on top of c. Values in the file replace the
+// defaults, lists and maps included: json.Unmarshal would add to the
+// default maps instead, so a file couldn't drop a default tax rate.
+func (c *Config) parse(data []byte) error {
+	defaults := *c
+	c.Checkout.TaxRates = nil
+	c.Checkout.ShippingRates = nil
+	if err := json.Unmarshal(data, c); err != nil {
+		return err
+	}
+	if c.Checkout.TaxRates == nil {
+		c.Checkout.TaxRates = defaults.Checkout.TaxRates
+	}
+	if c.Checkout.ShippingRates == nil {
+		c.Checkout.ShippingRates = defaults.Checkout.ShippingRates
+	}
+	return nil
+}
+
+func (c *Config) applyEnv(lookup func(string) (string, bool)) error {
+	stringVars := map[string]*string{
+		"ABE_HOST":                         &c.Host,
+		"ABE_SXG_CERT_SECRET":              &c.SignedExchange.CertSecret,
+		"ABE_SXG_KEY_SECRET":               &c.SignedExchange.KeySecret,
+		"ABE_SXG_OCSP_SECRET":              &c.SignedExchange.OCSPSecret,
+		"ABE_DIST_DIR":                     &c.DistDir,
+		"ABE_TEMPLATE_DIR":                 &c.TemplateDir,
+		"ABE_ASSET_MANIFEST":               &c.AssetManifest,
+		"ABE_REDIRECTS":                    &c.Redirects,
+		"ABE_SECRETS_BACKEND":              &c.SecretsBackend,
+		"ABE_FAVORITE_STORE":               &c.FavoriteStore,
+		"ABE_RATING_STORE":                 &c.RatingStore,
+		"ABE_HOTEL_STORE":                  &c.HotelStore,
+		"ABE_SEAT_STORE":                   &c.SeatStore,
+		"ABE_ORDER_STORE":                  &c.Checkout.OrderStore,
+		"ABE_PLAYGROUND_COMPONENTS_SOURCE": &c.Playground.ComponentsSource,
+		"ABE_PLAYGROUND_SNIPPET_STORE":     &c.Playground.SnippetStore,
+		"ABE_PAYMENTS_PROVIDER":            &c.Payments.Provider,
+	}
+	for name, field := range stringVars {
+		if value, ok := lookup(name); ok {
+			*field = value
+		}
+	}
+	if value, ok := lookup("ABE_LEGACY_HOSTS"); ok {
+		c.LegacyHosts = splitList(value)
+	}
+	if value, ok := lookup("ABE_PLAYGROUND_FETCH_ORIGINS"); ok {
+		c.Playground.FetchOrigins = splitList(value)
+	}
+
+	boolVars := map[string]*bool{
+		"ABE_FEATURE_STATIC":          &c.Features.Static,
+		"ABE_FEATURE_SIGNED_EXCHANGE": &c.Features.SignedExchange,
+		"ABE_FEATURE_OPTIMIZER":       &c.Features.Optimizer,
+		"ABE_FEATURE_FAULTS":          &c.Features.Faults,
+	}
+	for name, field := range boolVars {
+		if value, ok := lookup(name); ok {
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("config: %s: %v", name, err)
+			}
+			*field = b
+		}
+	}
+	return nil
+}
+
+// IsLegacyHost reports whether requests for host should be redirected to Host.
+func (c *Config) IsLegacyHost(host string) bool {
+	for _, h := range c.LegacyHosts {
+		if h == host {
+			return true
+		}
+	}
+	return false
+}
+
+func splitList(value string) []string {
+	var result []string
+	for _, s := range strings.Split(value, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			result = append(result, s)
+		}
+	}
+	return result
+}
@@ -15,11 +15,17 @@
 package cookie
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strings"
 )
 
+var ErrInvalidSignature = errors.New("cookie: invalid signature")
+
 func Set(w http.ResponseWriter, name string, value interface{}) error {
 	dataJson, err := json.Marshal(value)
 	if err != nil {
@@ -50,6 +56,52 @@ func Get(r *http.Request, name string, out interface{}) error {
 	return nil
 }
 
+// SetSigned is Set with an HMAC-SHA256 of the value under key appended, so
+// GetSigned can tell whether the client changed it.
+func SetSigned(w http.ResponseWriter, name string, value interface{}, key []byte) error {
+	dataJson, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(dataJson)
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    payload + "." + sign(name, payload, key),
+		Path:     "/",
+		HttpOnly: true,
+	})
+	return nil
+}
+
+// GetSigned reads a cookie written by SetSigned. It returns
+// ErrInvalidSignature if the value wasn't signed with key.
+func GetSigned(r *http.Request, name string, out interface{}, key []byte) error {
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return err
+	}
+	i := strings.LastIndex(cookie.Value, ".")
+	if i < 0 {
+		return ErrInvalidSignature
+	}
+	payload, signature := cookie.Value[:i], cookie.Value[i+1:]
+	if !hmac.Equal([]byte(signature), []byte(sign(name, payload, key))) {
+		return ErrInvalidSignature
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+// sign includes the name, so a value can't be moved to another cookie.
+func sign(name string, payload string, key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(name + "=" + payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
 func Clear(w http.ResponseWriter, name string) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     name,
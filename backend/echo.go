@@ -15,6 +15,7 @@
 package backend
 
 import (
+	"backend/config"
 	"net/http"
 )
 
@@ -24,7 +25,7 @@ const (
 	MAX_FORM_SIZE = 1024 * 100
 )
 
-func InitEcho() {
+func InitEcho(cfg *config.Config) {
 	RegisterHandler(ECHO_ENDPOINT, echoEndpoint)
 }
 
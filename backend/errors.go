@@ -0,0 +1,196 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"backend/config"
+	"crypto/rand"
+	"encoding/hex"
+	"html/template"
+	"log"
+	"mime"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+const (
+	ERROR_PATH = "/error"
+	// Set by App Engine on every request.
+	REQUEST_LOG_ID_HEADER = "X-Appengine-Request-Log-Id"
+	REQUEST_ID_HEADER     = "X-Request-Id"
+)
+
+var errorTemplate *template.Template
+
+// ErrorResponse is the body of JSON error responses.
+type ErrorResponse struct {
+	Status    int    `json:"status"`
+	Message   string `json:"message"`
+	RequestID string `json:"requestId,omitempty"`
+}
+
+type errorPage struct {
+	ErrorResponse
+	Title string
+}
+
+func InitErrorPages(cfg *config.Config) {
+	LoadErrorPage(cfg)
+	// A deliberate failure to test monitoring and the error pages with.
+	// /error?panic=1 goes through the recovery instead.
+	RegisterHandler(ERROR_PATH, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("panic") != "" {
+			panic("test panic requested on " + ERROR_PATH)
+		}
+		SendError(w, r, http.StatusInternalServerError, "This error was requested on purpose.")
+	})
+}
+
+// LoadErrorPage reads the error page template without registering
+// ERROR_PATH, for apps like the API that only need SendError and NotFound.
+// Without the template, SendError responds with JSON.
+func LoadErrorPage(cfg *config.Config) {
+	template, err := loadTemplate(cfg.TemplateDir + "/error.html")
+	if err != nil {
+		log.Printf("Error page not available, sending JSON errors: %v", err)
+		return
+	}
+	errorTemplate = template
+}
+
+// SendError responds with an AMP error page to document requests and with
+// an ErrorResponse to XHRs and clients preferring JSON.
+func SendError(w http.ResponseWriter, r *http.Request, code int, message string) {
+	response := ErrorResponse{
+		Status:    code,
+		Message:   message,
+		RequestID: RequestID(r),
+	}
+	w.Header().Del("Content-Encoding")
+	w.Header().Del("ETag")
+	SetMaxAge(w, 0)
+	if wantsJSON(r) || errorTemplate == nil {
+		SendJsonError(w, code, response)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+	err := errorTemplate.Execute(w, errorPage{response, http.StatusText(code)})
+	if err != nil {
+		log.Printf("Failed to render error page [%s]: %v", r.URL.Path, err)
+	}
+}
+
+// NotFound is http.NotFound with the error pages.
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	SendError(w, r, http.StatusNotFound, "There's nothing here, the page may have moved.")
+}
+
+// Recover turns panics in next into logged 500 responses instead of taking
+// down the request.
+func Recover(next http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rw := &recoveryWriter{ResponseWriter: w}
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+			log.Printf("panic serving %s [request %s]: %v\n%s", r.URL.Path, RequestID(r), err, debug.Stack())
+			if !rw.wroteHeader {
+				SendError(w, r, http.StatusInternalServerError, "Something went wrong on our side.")
+			}
+		}()
+		next.ServeHTTP(rw, r)
+	}
+}
+
+// recoveryWriter remembers whether a response was started, which can't be
+// replaced by an error page anymore.
+type recoveryWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *recoveryWriter) WriteHeader(code int) {
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *recoveryWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recoveryWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.wroteHeader = true
+		f.Flush()
+	}
+}
+
+// RequestID identifies r in the logs. Outside of App Engine a random ID is
+// assigned and stored in the request headers.
+func RequestID(r *http.Request) string {
+	if id := r.Header.Get(REQUEST_LOG_ID_HEADER); id != "" {
+		return id
+	}
+	if id := r.Header.Get(REQUEST_ID_HEADER); id != "" {
+		return id
+	}
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	id := hex.EncodeToString(b)
+	r.Header.Set(REQUEST_ID_HEADER, id)
+	return id
+}
+
+// wantsJSON reports whether r is an AMP XHR or prefers JSON over HTML.
+func wantsJSON(r *http.Request) bool {
+	if GetSourceOrigin(r) != "" || r.Header.Get("AMP-Same-Origin") == "true" {
+		return true
+	}
+	jsonQ, htmlQ := -1.0, -1.0
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		switch {
+		case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+			if q > jsonQ {
+				jsonQ = q
+			}
+		case mediaType == "text/html" || mediaType == "application/xhtml+xml":
+			if q > htmlQ {
+				htmlQ = q
+			}
+		}
+	}
+	return jsonQ > 0 && jsonQ > htmlQ
+}
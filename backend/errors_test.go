@@ -0,0 +1,45 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package backend
+
+import (
+	"backend/config"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSendErrorWithoutErrorPage(t *testing.T) {
+	errorTemplate = nil
+	LoadErrorPage(&config.Config{TemplateDir: "no-such-dir"})
+	if errorTemplate != nil {
+		t.Fatal("LoadErrorPage loaded a missing template")
+	}
+
+	r := httptest.NewRequest("GET", "/missing", nil)
+	r.Header.Set("Accept", "text/html")
+	w := httptest.NewRecorder()
+	NotFound(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status %d, want %d", w.Code, http.StatusNotFound)
+	}
+	var response ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("response %q isn't JSON: %v", w.Body.String(), err)
+	}
+	if response.Status != http.StatusNotFound {
+		t.Errorf("response status %d, want %d", response.Status, http.StatusNotFound)
+	}
+}
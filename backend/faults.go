@@ -0,0 +1,65 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"backend/config"
+	"backend/faults"
+	"net/http"
+	"time"
+)
+
+// Injects the faults requests ask for, nil if disabled. Set up by
+// InitFaults.
+var faultInjector *faults.Injector
+
+// InitFaults lets all handlers registered with RegisterHandler be slowed
+// down or broken with ?faults=..., see package faults.
+func InitFaults(cfg *config.Config) {
+	if !cfg.Features.Faults {
+		return
+	}
+	faultInjector = &faults.Injector{
+		MaxDelay: maxFaultDelay(cfg),
+		Error: func(w http.ResponseWriter, r *http.Request, status int) {
+			SendError(w, r, status, "This error was requested with "+faults.PARAM+".")
+		},
+	}
+}
+
+// InjectFaults serves r with next and the faults r asks for.
+func InjectFaults(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if faultInjector == nil || r.Method == "OPTIONS" {
+			next(w, r)
+			return
+		}
+		f, err := faults.FromRequest(r)
+		if err != nil {
+			SendError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		if f == nil {
+			next(w, r)
+			return
+		}
+		SetMaxAge(w, 0)
+		faultInjector.Serve(w, r, f, next)
+	}
+}
+
+func maxFaultDelay(cfg *config.Config) time.Duration {
+	return time.Duration(cfg.Faults.MaxDelaySeconds) * time.Second
+}
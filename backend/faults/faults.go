@@ -0,0 +1,256 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// Package faults makes responses slow or broken on request, to test how
+// clients deal with them. Faults are listed in the faults query parameter
+// or the X-Faults header, e.g. ?faults=delay:2000,jitter:500,error:503,rate:0.5
+//
+//	delay:MS       wait before responding
+//	jitter:MS      wait up to this much longer, at random
+//	error:STATUS   respond with the 4xx or 5xx status instead
+//	reset          close the connection without responding
+//	truncate:N     close the connection after N bytes of the body
+//	chunk:N        write the body N bytes at a time...
+//	chunkDelay:MS  ...waiting this long between them
+//	rate:P         probability of error, reset and truncate, 1 by default
+//
+// All waiting of a request together is capped by Injector.MaxDelay.
+package faults
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	PARAM  = "faults"
+	HEADER = "X-Faults"
+)
+
+// Faults are the faults requested for one response.
+type Faults struct {
+	Delay  time.Duration
+	Jitter time.Duration
+	// Status responded instead, 0 for none.
+	Status int
+	Reset  bool
+	// Bytes of the body sent before the connection is closed, 0 for all.
+	Truncate   int
+	ChunkSize  int
+	ChunkDelay time.Duration
+	// Probability of Status, Reset and Truncate.
+	Rate float64
+}
+
+// FromRequest returns the faults requested by r, nil if there are none.
+func FromRequest(r *http.Request) (*Faults, error) {
+	spec := r.URL.Query().Get(PARAM)
+	if spec == "" {
+		spec = r.Header.Get(HEADER)
+	}
+	if spec == "" {
+		return nil, nil
+	}
+	return Parse(spec)
+}
+
+// Parse parses a comma separated list of faults, see the package
+// documentation.
+func Parse(spec string) (*Faults, error) {
+	f := &Faults{Rate: 1}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, value := item, ""
+		if i := strings.Index(item, ":"); i >= 0 {
+			name, value = item[:i], item[i+1:]
+		}
+		var err error
+		switch name {
+		case "delay":
+			f.Delay, err = parseMillis(value)
+		case "jitter":
+			f.Jitter, err = parseMillis(value)
+		case "chunkDelay":
+			f.ChunkDelay, err = parseMillis(value)
+		case "error":
+			f.Status, err = parseInt(value, 400, 599)
+		case "truncate":
+			f.Truncate, err = parseInt(value, 1, 1<<30)
+		case "chunk":
+			f.ChunkSize, err = parseInt(value, 1, 1<<30)
+		case "reset":
+			if value != "" {
+				f.Reset, err = strconv.ParseBool(value)
+			} else {
+				f.Reset = true
+			}
+		case "rate":
+			f.Rate, err = strconv.ParseFloat(value, 64)
+			if err == nil && (f.Rate < 0 || f.Rate > 1) {
+				err = errors.New("must be between 0 and 1")
+			}
+		default:
+			return nil, fmt.Errorf("faults: unknown fault %q", name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("faults: invalid %s %q: %v", name, value, err)
+		}
+	}
+	return f, nil
+}
+
+func parseMillis(value string) (time.Duration, error) {
+	ms, err := parseInt(value, 0, 1<<30)
+	return time.Duration(ms) * time.Millisecond, err
+}
+
+func parseInt(value string, min int, max int) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, errors.New("not a number")
+	}
+	if n < min || n > max {
+		return 0, fmt.Errorf("must be between %d and %d", min, max)
+	}
+	return n, nil
+}
+
+// Injector serves responses with faults.
+type Injector struct {
+	// Cap of all waiting for one response.
+	MaxDelay time.Duration
+	// Responds with an injected error status, http.Error by default.
+	Error func(w http.ResponseWriter, r *http.Request, status int)
+	// Returns a number in [0, 1) to decide on faults with a rate,
+	// math/rand by default.
+	Random func() float64
+}
+
+// Serve serves r with next and the faults f.
+func (in *Injector) Serve(w http.ResponseWriter, r *http.Request, f *Faults, next http.Handler) {
+	budget := &delayBudget{left: in.MaxDelay}
+	delay := f.Delay
+	if f.Jitter > 0 {
+		delay += time.Duration(in.random() * float64(f.Jitter))
+	}
+	budget.sleep(delay)
+	failing := f.Rate >= 1 || in.random() < f.Rate
+	if failing && f.Reset {
+		panic(http.ErrAbortHandler)
+	}
+	if failing && f.Status != 0 {
+		if in.Error != nil {
+			in.Error(w, r, f.Status)
+		} else {
+			http.Error(w, http.StatusText(f.Status), f.Status)
+		}
+		return
+	}
+	fw := &faultWriter{
+		ResponseWriter: w,
+		left:           -1,
+		chunkSize:      f.ChunkSize,
+		chunkDelay:     f.ChunkDelay,
+		budget:         budget,
+	}
+	if failing && f.Truncate > 0 {
+		fw.left = f.Truncate
+	}
+	next.ServeHTTP(fw, r)
+	if fw.truncated {
+		// The client sees the connection close before the end of the body.
+		panic(http.ErrAbortHandler)
+	}
+}
+
+func (in *Injector) random() float64 {
+	if in.Random != nil {
+		return in.Random()
+	}
+	return rand.Float64()
+}
+
+type delayBudget struct {
+	left time.Duration
+}
+
+func (b *delayBudget) sleep(d time.Duration) {
+	if d > b.left {
+		d = b.left
+	}
+	if d <= 0 {
+		return
+	}
+	b.left -= d
+	time.Sleep(d)
+}
+
+// faultWriter truncates the body and writes it in slow chunks.
+type faultWriter struct {
+	http.ResponseWriter
+	// Bytes left to write before truncating, -1 for no limit.
+	left       int
+	truncated  bool
+	chunkSize  int
+	chunkDelay time.Duration
+	written    int
+	budget     *delayBudget
+}
+
+// Write pretends to write all of b, so handlers carry on as usual.
+func (w *faultWriter) Write(b []byte) (int, error) {
+	n := len(b)
+	if w.left >= 0 {
+		if len(b) > w.left {
+			b = b[:w.left]
+			w.truncated = true
+		}
+		w.left -= len(b)
+	}
+	for len(b) > 0 {
+		chunk := b
+		if w.chunkSize > 0 && len(chunk) > w.chunkSize {
+			chunk = chunk[:w.chunkSize]
+		}
+		if w.chunkSize > 0 && w.written > 0 {
+			w.budget.sleep(w.chunkDelay)
+		}
+		if _, err := w.ResponseWriter.Write(chunk); err != nil {
+			return 0, err
+		}
+		if w.chunkSize > 0 {
+			w.Flush()
+		}
+		w.written += len(chunk)
+		b = b[len(chunk):]
+	}
+	if w.truncated {
+		// Send what's left of the body before the connection is closed.
+		w.Flush()
+	}
+	return n, nil
+}
+
+func (w *faultWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
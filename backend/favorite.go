@@ -15,92 +15,99 @@
 package backend
 
 import (
+	"backend/config"
+	"backend/favorites"
+	"backend/items"
+	"log"
 	"net/http"
-	"strconv"
-	"time"
+
+	"google.golang.org/appengine"
 )
 
 const (
-	AMP_FAVORITE_COOKIE       = "amp-favorite"
-	AMP_FAVORITE_COUNT_COOKIE = "amp-favorite-with-count"
+	FAVORITES_PATH = "/favorites"
+	// Identifies users that aren't signed in.
+	AMP_FAVORITE_USER_COOKIE = "amp-favorite-user"
+	// Items liked with the sample buttons if the request doesn't name one.
+	FAVORITE_DEFAULT_ITEM    = "favorite-button"
+	FAVORITE_WITH_COUNT_ITEM = "favorite-with-count"
 )
 
-func InitFavoriteSample() {
+var favoriteStore favorites.Store
+
+func InitFavoriteSample(cfg *config.Config) {
+	favoriteStore = favorites.ParseStore(cfg.FavoriteStore)
 	RegisterHandler("/favorite", handleFavorite)
 	RegisterHandler("/favorite-with-count", handleFavoriteWithCount)
+	RegisterHandler(FAVORITES_PATH, handleFavorites)
 }
 
+// handleFavorite returns whether the user likes the item, POST toggles it.
 func handleFavorite(w http.ResponseWriter, r *http.Request) {
-	SetMaxAge(w, 0)
-	if r.Method == "POST" {
-		setFavorite(w, r)
-	} else if r.Method == "GET" {
-		getFavorite(w, r)
+	if favorite, ok := readOrToggleFavorite(w, r, FAVORITE_DEFAULT_ITEM); ok {
+		SendJsonResponse(w, favorite.Value)
 	}
 }
 
-func getFavorite(w http.ResponseWriter, r *http.Request) {
-	favorite := readFavoriteFromCookie(r, AMP_FAVORITE_COOKIE)
-	SendJsonResponse(w, favorite)
-}
-
-func setFavorite(w http.ResponseWriter, r *http.Request) {
-	favorite := !readFavoriteFromCookie(r, AMP_FAVORITE_COOKIE)
-	writeFavoriteCookie(w, r, AMP_FAVORITE_COOKIE, favorite)
-	SendJsonResponse(w, favorite)
-}
-
+// handleFavoriteWithCount also returns the number of users liking the item.
 func handleFavoriteWithCount(w http.ResponseWriter, r *http.Request) {
-	SetMaxAge(w, 0)
-	if r.Method == "POST" {
-		setFavoriteWithCount(w, r)
-	} else if r.Method == "GET" {
-		getFavoriteWithCount(w, r)
+	if favorite, ok := readOrToggleFavorite(w, r, FAVORITE_WITH_COUNT_ITEM); ok {
+		SendJsonResponse(w, map[string]interface{}{
+			"value": favorite.Value,
+			"count": favorite.Count,
+		})
 	}
 }
 
-func getFavoriteWithCount(w http.ResponseWriter, r *http.Request) {
-	favorite := readFavoriteFromCookie(r, AMP_FAVORITE_COUNT_COOKIE)
-	writeFavoriteWithCount(w, favorite)
-}
-
-func setFavoriteWithCount(w http.ResponseWriter, r *http.Request) {
-	favorite := !readFavoriteFromCookie(r, AMP_FAVORITE_COUNT_COOKIE)
-	writeFavoriteCookie(w, r, AMP_FAVORITE_COUNT_COOKIE, favorite)
-	writeFavoriteWithCount(w, favorite)
-}
-
-func writeFavoriteWithCount(w http.ResponseWriter, favorite bool) {
-	var count int
-	if favorite {
-		count = 124
-	} else {
-		count = 123
+// handleFavorites lists the items the user likes.
+func handleFavorites(w http.ResponseWriter, r *http.Request) {
+	SetMaxAge(w, 0)
+	list := []favorites.Favorite{}
+	if user := favoriteUser(w, r, false); user != "" {
+		result, err := favoriteStore.List(appengine.NewContext(r), user)
+		if err != nil {
+			log.Printf("Failed to list favorites: %v", err)
+			SendError(w, r, http.StatusInternalServerError, "Could not load favorites.")
+			return
+		}
+		list = append(list, result...)
 	}
 	SendJsonResponse(w, map[string]interface{}{
-		"value": favorite,
-		"count": count,
+		"items": list,
 	})
 }
 
-func writeFavoriteCookie(w http.ResponseWriter, r *http.Request, name string, value bool) {
-	expireInOneYear := time.Now().AddDate(1, 0, 0)
-	cookie := &http.Cookie{
-		Name:    name,
-		Expires: expireInOneYear,
-		Value:   strconv.FormatBool(value),
+func readOrToggleFavorite(w http.ResponseWriter, r *http.Request, defaultItem string) (*favorites.Favorite, bool) {
+	SetMaxAge(w, 0)
+	item := r.FormValue("item")
+	if item == "" {
+		item = defaultItem
 	}
-	http.SetCookie(w, cookie)
-}
-
-func readFavoriteFromCookie(r *http.Request, name string) bool {
-	cookie, err := r.Cookie(name)
-	if err != nil {
-		return false
+	if !items.ValidID(item) {
+		SendError(w, r, http.StatusBadRequest, "Invalid item.")
+		return nil, false
+	}
+	ctx := appengine.NewContext(r)
+	var favorite *favorites.Favorite
+	var err error
+	switch r.Method {
+	case "POST":
+		favorite, err = favoriteStore.Toggle(ctx, favoriteUser(w, r, true), item)
+	case "GET":
+		favorite, err = favoriteStore.Get(ctx, favoriteUser(w, r, false), item)
+	default:
+		SendError(w, r, http.StatusMethodNotAllowed, "Method not allowed.")
+		return nil, false
 	}
-	favorite, err := strconv.ParseBool(cookie.Value)
 	if err != nil {
-		return false
+		log.Printf("Failed to access favorite %s: %v", item, err)
+		SendError(w, r, http.StatusInternalServerError, "Could not favorite.")
+		return nil, false
 	}
-	return favorite
+	return favorite, true
+}
+
+// favoriteUser identifies the user of the favorite samples, see sampleUser.
+func favoriteUser(w http.ResponseWriter, r *http.Request, create bool) string {
+	return sampleUser(w, r, AMP_FAVORITE_USER_COOKIE, create)
 }
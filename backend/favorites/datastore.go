@@ -0,0 +1,189 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package favorites
+
+import (
+	"backend/items"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/datastore"
+)
+
+const (
+	FAVORITE_KIND             = "Favorite"
+	FAVORITE_COUNT_SHARD_KIND = "FavoriteCountShard"
+	// Count shards per item. Each shard can take about one write a second,
+	// and List reads MAX_LIST * COUNT_SHARDS keys in one call, which can't
+	// be more than 1000.
+	COUNT_SHARDS = 10
+	// Tries of a toggle that conflicts with others, each on another shard.
+	TOGGLE_ATTEMPTS = 5
+)
+
+// DatastoreStore keeps a favorite entity per item and user, and the count of
+// each item split over COUNT_SHARDS shard entities, so that popular items
+// can be liked by many users at once. A toggle changes the favorite and a
+// random shard in one cross-group transaction.
+type DatastoreStore struct{}
+
+// Favorites are listed by User and Created, see index.yaml.
+type favoriteEntity struct {
+	Item    string `datastore:",noindex"`
+	User    string
+	Created time.Time
+}
+
+type countEntity struct {
+	Count int `datastore:",noindex"`
+}
+
+func (s *DatastoreStore) Get(ctx context.Context, user string, item string) (*Favorite, error) {
+	if !items.ValidID(item) {
+		return nil, ErrInvalidItem
+	}
+	return get(ctx, user, item)
+}
+
+func (s *DatastoreStore) Toggle(ctx context.Context, user string, item string) (*Favorite, error) {
+	if !items.ValidID(item) {
+		return nil, ErrInvalidItem
+	}
+	favoriteKey := datastore.NewKey(ctx, FAVORITE_KIND, item+"/"+user, 0, nil)
+	var value bool
+	var created time.Time
+	err := datastore.RunInTransaction(ctx, func(tc context.Context) error {
+		var entity favoriteEntity
+		err := datastore.Get(tc, favoriteKey, &entity)
+		if err != nil && err != datastore.ErrNoSuchEntity {
+			return err
+		}
+		value = err == datastore.ErrNoSuchEntity
+		change := 1
+		if value {
+			created = time.Now()
+			if _, err := datastore.Put(tc, favoriteKey, &favoriteEntity{Item: item, User: user, Created: created}); err != nil {
+				return err
+			}
+		} else {
+			change = -1
+			created = time.Time{}
+			if err := datastore.Delete(tc, favoriteKey); err != nil {
+				return err
+			}
+		}
+		// Shards may go below zero, only their sum counts.
+		shardKey := countShardKey(tc, item, rand.Intn(COUNT_SHARDS))
+		var shard countEntity
+		if err := datastore.Get(tc, shardKey, &shard); err != nil && err != datastore.ErrNoSuchEntity {
+			return err
+		}
+		shard.Count += change
+		_, err = datastore.Put(tc, shardKey, &shard)
+		return err
+	}, &datastore.TransactionOptions{XG: true, Attempts: TOGGLE_ATTEMPTS})
+	if err != nil {
+		return nil, err
+	}
+	counts, err := getCounts(ctx, []string{item})
+	if err != nil {
+		return nil, err
+	}
+	return &Favorite{Item: item, Value: value, Count: counts[0], Created: created}, nil
+}
+
+func (s *DatastoreStore) List(ctx context.Context, user string) ([]Favorite, error) {
+	var entities []favoriteEntity
+	_, err := datastore.NewQuery(FAVORITE_KIND).
+		Filter("User =", user).
+		Order("-Created").
+		Limit(MAX_LIST).
+		GetAll(ctx, &entities)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(entities))
+	for i, entity := range entities {
+		ids[i] = entity.Item
+	}
+	counts, err := getCounts(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]Favorite, len(entities))
+	for i, entity := range entities {
+		list[i] = Favorite{
+			Item:    entity.Item,
+			Value:   true,
+			Count:   counts[i],
+			Created: entity.Created,
+		}
+	}
+	return list, nil
+}
+
+func get(ctx context.Context, user string, item string) (*Favorite, error) {
+	counts, err := getCounts(ctx, []string{item})
+	if err != nil {
+		return nil, err
+	}
+	favorite := &Favorite{Item: item, Count: counts[0]}
+	if user == "" {
+		return favorite, nil
+	}
+	var entity favoriteEntity
+	switch err := datastore.Get(ctx, datastore.NewKey(ctx, FAVORITE_KIND, item+"/"+user, 0, nil), &entity); err {
+	case nil:
+		favorite.Value = true
+		favorite.Created = entity.Created
+	case datastore.ErrNoSuchEntity:
+	default:
+		return nil, err
+	}
+	return favorite, nil
+}
+
+func countShardKey(ctx context.Context, item string, shard int) *datastore.Key {
+	return datastore.NewKey(ctx, FAVORITE_COUNT_SHARD_KIND, item+"/"+strconv.Itoa(shard), 0, nil)
+}
+
+// getCounts returns the counts of the items, summing their shards.
+func getCounts(ctx context.Context, ids []string) ([]int, error) {
+	keys := make([]*datastore.Key, 0, len(ids)*COUNT_SHARDS)
+	for _, item := range ids {
+		for shard := 0; shard < COUNT_SHARDS; shard++ {
+			keys = append(keys, countShardKey(ctx, item, shard))
+		}
+	}
+	shards := make([]countEntity, len(keys))
+	if err := datastore.GetMulti(ctx, keys, shards); err != nil {
+		errs, ok := err.(appengine.MultiError)
+		if !ok {
+			return nil, err
+		}
+		for _, err := range errs {
+			if err != nil && err != datastore.ErrNoSuchEntity {
+				return nil, err
+			}
+		}
+	}
+	counts := make([]int, len(ids))
+	for i, shard := range shards {
+		counts[i/COUNT_SHARDS] += shard.Count
+	}
+	return counts, nil
+}
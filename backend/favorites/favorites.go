@@ -0,0 +1,60 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// Package favorites stores which items users like and how many users like
+// each item. Counts are updated together with the favorite, so they are
+// always exact.
+package favorites
+
+import (
+	"backend/items"
+	"errors"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	// Most favorites returned by List.
+	MAX_LIST = 100
+)
+
+var (
+	ErrInvalidItem = errors.New("favorites: invalid item ID")
+)
+
+type Favorite struct {
+	Item string `json:"item"`
+	// Whether the user likes the item.
+	Value bool `json:"value"`
+	// Number of users liking the item.
+	Count   int       `json:"count"`
+	Created time.Time `json:"created,omitempty"`
+}
+
+type Store interface {
+	Get(ctx context.Context, user string, item string) (*Favorite, error)
+	// Toggle likes item for user, or stops liking it.
+	Toggle(ctx context.Context, user string, item string) (*Favorite, error)
+	// List returns the items user likes, most recent first, at most
+	// MAX_LIST.
+	List(ctx context.Context, user string) ([]Favorite, error)
+}
+
+// ParseStore returns the favorites store for spec, see items.UseDatastore.
+func ParseStore(spec string) Store {
+	if items.UseDatastore(spec) {
+		return &DatastoreStore{}
+	}
+	return NewMemoryStore()
+}
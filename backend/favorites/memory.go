@@ -0,0 +1,100 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package favorites
+
+import (
+	"backend/items"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// MemoryStore keeps favorites in memory, for development.
+type MemoryStore struct {
+	lock sync.Mutex
+	// Time liked by item and user.
+	liked  map[string]map[string]time.Time
+	counts map[string]int
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		liked:  make(map[string]map[string]time.Time),
+		counts: make(map[string]int),
+	}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, user string, item string) (*Favorite, error) {
+	if !items.ValidID(item) {
+		return nil, ErrInvalidItem
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.favorite(user, item), nil
+}
+
+func (s *MemoryStore) Toggle(ctx context.Context, user string, item string) (*Favorite, error) {
+	if !items.ValidID(item) {
+		return nil, ErrInvalidItem
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	users, ok := s.liked[item]
+	if !ok {
+		users = make(map[string]time.Time)
+		s.liked[item] = users
+	}
+	if _, ok := users[user]; ok {
+		delete(users, user)
+		s.counts[item]--
+	} else {
+		users[user] = time.Now()
+		s.counts[item]++
+	}
+	return s.favorite(user, item), nil
+}
+
+func (s *MemoryStore) List(ctx context.Context, user string) ([]Favorite, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var list []Favorite
+	for item, users := range s.liked {
+		if _, ok := users[user]; ok {
+			list = append(list, *s.favorite(user, item))
+		}
+	}
+	return sortFavorites(list), nil
+}
+
+// favorite needs s to be locked.
+func (s *MemoryStore) favorite(user string, item string) *Favorite {
+	created, ok := s.liked[item][user]
+	return &Favorite{
+		Item:    item,
+		Value:   ok,
+		Count:   s.counts[item],
+		Created: created,
+	}
+}
+
+// sortFavorites sorts the most recent first and keeps at most MAX_LIST.
+func sortFavorites(list []Favorite) []Favorite {
+	sort.Slice(list, func(i, j int) bool { return list[i].Created.After(list[j].Created) })
+	if len(list) > MAX_LIST {
+		list = list[:MAX_LIST]
+	}
+	return list
+}
@@ -11,14 +11,22 @@
 // WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
 // See the License for the specific language governing permissions and
 // limitations under the License.
-
 package backend
 
 import (
+	"backend/config"
+	"backend/hotel"
+	"backend/oauth"
 	"net/http"
+	"strconv"
+	"time"
+
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/log"
 )
 
 type HotelAuthorizationResponse struct {
+	LoggedIn   bool   `json:"loggedIn"`
 	User       string `json:"username"`
 	Status     string `json:"status"`
 	Freenights int    `json:"freenights"`
@@ -28,27 +36,197 @@ const (
 	HOTEL_SAMPLE_PATH = "/" + CATEGORY_SAMPLE_TEMPLATES + "/hotel/"
 )
 
-func InitHotelSample() {
-	RegisterHandler(HOTEL_SAMPLE_PATH+"book", onlyPost(book))
-	RegisterHandler(HOTEL_SAMPLE_PATH+"check-available", checkAvailability)
+var hotelRoomTypes = []hotel.RoomType{
+	{
+		ID:          "canal-view",
+		Name:        "Canal View",
+		Description: "Double room overlooking the canal",
+		Image:       "/img/hotel01_2benny_640x383.jpg",
+		MaxGuests:   2,
+		Rooms:       3,
+		Rate:        12900,
+		WeekendRate: 15900,
+	},
+	{
+		ID:          "garden",
+		Name:        "Garden Room",
+		Description: "Ground floor room with access to the garden",
+		Image:       "/img/hotel02_joepitha_640x383.jpg",
+		PetFriendly: true,
+		MaxGuests:   2,
+		Rooms:       2,
+		Rate:        9900,
+		WeekendRate: 11900,
+	},
+	{
+		ID:          "family",
+		Name:        "Family Suite",
+		Description: "Two bedrooms and a kitchenette",
+		Image:       "/img/hotel03_muffinn_640x383.jpg",
+		PetFriendly: true,
+		MaxGuests:   5,
+		Rooms:       1,
+		Rate:        21900,
+	},
+	{
+		ID:          "attic",
+		Name:        "Attic Single",
+		Description: "Cosy single room under the roof",
+		Image:       "/img/hotel04_robinhawkes_640x383.jpg",
+		MaxGuests:   1,
+		Rooms:       2,
+		Rate:        6900,
+	},
 }
 
-func (h HotelAuthorizationResponse) CreateAuthorizationResponse() AuthorizationResponse {
-	return HotelAuthorizationResponse{"test-user", "Gold", 2}
+var hotelInventory *hotel.Inventory
+
+// Room types and offers in the format of the sample's room list.
+type hotelRoom struct {
+	hotel.RoomType
+	Available int          `json:"available,omitempty"`
+	Quote     *hotel.Quote `json:"quote,omitempty"`
+	// The stay the quote is for, submitted again when booking.
+	Arriving string `json:"arriving,omitempty"`
+	Leaving  string `json:"leaving,omitempty"`
+	Guests   int    `json:"guests,omitempty"`
+}
+
+func InitHotelSample(cfg *config.Config) {
+	inventory, err := hotel.NewInventory(hotelRoomTypes, hotel.ParseStore(cfg.HotelStore))
+	if err != nil {
+		panic(err)
+	}
+	hotelInventory = inventory
+	RegisterHandler(HOTEL_SAMPLE_PATH+"book", onlyPost(book))
+	RegisterHandler(HOTEL_SAMPLE_PATH+"check-available", checkAvailability)
+	RegisterHandler(HOTEL_SAMPLE_PATH+"authorization", handleHotelAuthorization)
 }
 
 func handleHotelAuthorization(w http.ResponseWriter, r *http.Request) {
-	SendJsonResponse(w, new(HotelAuthorizationResponse).CreateAuthorizationResponse())
+	SetMaxAge(w, 0)
+	user := hotelUser(r)
+	if user == "" {
+		SendJsonResponse(w, HotelAuthorizationResponse{})
+		return
+	}
+	account, err := hotelInventory.Account(appengine.NewContext(r), user)
+	if err != nil {
+		sendHotelError(w, r, err)
+		return
+	}
+	SendJsonResponse(w, HotelAuthorizationResponse{
+		LoggedIn:   true,
+		User:       account.User,
+		Status:     account.Status,
+		Freenights: account.FreeNights,
+	})
 }
 
+// checkAvailability lists the rooms available for the stay with a price
+// quote, or all rooms if no dates are given.
 func checkAvailability(w http.ResponseWriter, r *http.Request) {
-	SendJsonResponse(w, map[string]string{
-		"result": "Available",
-	})
+	SetMaxAge(w, 0)
+	arriving := r.FormValue("arriving")
+	leaving := r.FormValue("leaving")
+	rooms := []hotelRoom{}
+	if arriving == "" && leaving == "" {
+		for _, t := range hotelInventory.RoomTypes() {
+			rooms = append(rooms, hotelRoom{RoomType: t})
+		}
+		SendJsonResponse(w, rooms)
+		return
+	}
+	stay, err := hotel.ParseStay(arriving, leaving, r.FormValue("guests"), time.Now())
+	if err != nil {
+		sendHotelError(w, r, err)
+		return
+	}
+	offers, err := hotelInventory.Availability(appengine.NewContext(r), stay)
+	if err != nil {
+		sendHotelError(w, r, err)
+		return
+	}
+	for _, offer := range offers {
+		quote := offer.Quote
+		rooms = append(rooms, hotelRoom{
+			RoomType:  offer.RoomType,
+			Available: offer.Available,
+			Quote:     &quote,
+			Arriving:  arriving,
+			Leaving:   leaving,
+			Guests:    stay.Guests,
+		})
+	}
+	SendJsonResponse(w, rooms)
 }
 
 func book(w http.ResponseWriter, r *http.Request) {
-	SendJsonResponse(w, map[string]string{
-		"result": "OK",
+	SetMaxAge(w, 0)
+	stay, err := hotel.ParseStay(r.FormValue("arriving"), r.FormValue("leaving"), r.FormValue("guests"), time.Now())
+	if err != nil {
+		sendHotelError(w, r, err)
+		return
+	}
+	freeNights := 0
+	if value := r.FormValue("freeNights"); value != "" {
+		if freeNights, err = strconv.Atoi(value); err != nil {
+			sendHotelError(w, r, hotel.ErrNotEnoughFreeNights)
+			return
+		}
+	}
+	ctx := appengine.NewContext(r)
+	user := hotelUser(r)
+	booking, err := hotelInventory.Book(ctx, user, r.FormValue("roomType"), stay, freeNights, time.Now())
+	if err != nil {
+		sendHotelError(w, r, err)
+		return
+	}
+	response := map[string]interface{}{
+		"result":  "OK",
+		"booking": booking,
+	}
+	if user != "" {
+		if account, err := hotelInventory.Account(ctx, user); err == nil {
+			response["freenights"] = account.FreeNights
+		}
+	}
+	SendJsonResponse(w, response)
+}
+
+// hotelUser returns the email of the user signed in via OAuth, or "". Unlike
+// signedInUser, it doesn't accept the amp-access sample's cookie, which
+// anyone can set to any email, as free nights are worth something.
+func hotelUser(r *http.Request) string {
+	if user, err := oauth.GetUser(r); err == nil {
+		return user.Email
+	}
+	return ""
+}
+
+func sendHotelError(w http.ResponseWriter, r *http.Request, err error) {
+	code, message := http.StatusBadRequest, "Sorry, something went wrong."
+	switch err {
+	case hotel.ErrInvalidDates:
+		message = "Please pick arriving and leaving dates, stays can be up to " + strconv.Itoa(hotel.MAX_STAY_NIGHTS) + " nights."
+	case hotel.ErrInvalidGuests:
+		message = "Please enter the number of guests."
+	case hotel.ErrUnknownRoomType:
+		message = "Please pick a room."
+	case hotel.ErrTooManyGuests:
+		message = "This room doesn't fit that many guests."
+	case hotel.ErrUnavailable:
+		code, message = http.StatusConflict, "Sorry, this room was just booked for your dates."
+	case hotel.ErrSignInRequired:
+		code, message = http.StatusForbidden, "Please sign in to redeem free nights."
+	case hotel.ErrNotEnoughFreeNights:
+		message = "You don't have that many free nights."
+	default:
+		code = http.StatusInternalServerError
+		log.Errorf(appengine.NewContext(r), "Failed to handle hotel request: %v", err)
+	}
+	SendJsonError(w, code, map[string]string{
+		"result":  "Error",
+		"message": message,
 	})
 }
@@ -0,0 +1,162 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package hotel
+
+import (
+	"bytes"
+	"encoding/gob"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/datastore"
+)
+
+const (
+	// Bookings are children of their room type, which has no entity, so
+	// that booking a room type happens in one entity group.
+	ROOM_TYPE_KIND = "HotelRoomType"
+	BOOKING_KIND   = "HotelBooking"
+	ACCOUNT_KIND   = "HotelAccount"
+)
+
+// DatastoreStore keeps the bookings by room type and the accounts by user.
+// Bookings are made in a transaction over the room type and the account,
+// so instances can't overbook a room or spend free nights twice.
+type DatastoreStore struct{}
+
+// The booking is gob encoded like orders, its stay is read from the dates.
+type bookingEntity struct {
+	Booking []byte `datastore:",noindex"`
+}
+
+func (s *DatastoreStore) Bookings(ctx context.Context, roomType string) ([]*Booking, error) {
+	bookings, _, err := getBookings(ctx, roomType)
+	return bookings, err
+}
+
+func (s *DatastoreStore) Account(ctx context.Context, user string) (*Account, error) {
+	return getAccount(ctx, user)
+}
+
+func (s *DatastoreStore) Book(ctx context.Context, roomType string, user string, today time.Time, book func(bookings []*Booking, account *Account) (*Booking, error)) (*Booking, error) {
+	var result *Booking
+	err := datastore.RunInTransaction(ctx, func(tc context.Context) error {
+		bookings, keys, err := getBookings(tc, roomType)
+		if err != nil {
+			return err
+		}
+		var current []*Booking
+		var past []*datastore.Key
+		for i, b := range bookings {
+			if b.stay.CheckOut.Before(today) {
+				past = append(past, keys[i])
+			} else {
+				current = append(current, b)
+			}
+		}
+		var account *Account
+		if user != "" {
+			if account, err = getAccount(tc, user); err != nil {
+				return err
+			}
+		}
+		booking, err := book(current, account)
+		if err != nil {
+			return err
+		}
+		if err := datastore.DeleteMulti(tc, past); err != nil {
+			return err
+		}
+		entity, err := newBookingEntity(booking)
+		if err != nil {
+			return err
+		}
+		key := datastore.NewKey(tc, BOOKING_KIND, booking.ID, 0, roomTypeKey(tc, roomType))
+		if _, err := datastore.Put(tc, key, entity); err != nil {
+			return err
+		}
+		if account != nil {
+			if _, err := datastore.Put(tc, accountKey(tc, user), account); err != nil {
+				return err
+			}
+		}
+		result = booking
+		return nil
+	}, &datastore.TransactionOptions{XG: true})
+	return result, err
+}
+
+func roomTypeKey(ctx context.Context, roomType string) *datastore.Key {
+	return datastore.NewKey(ctx, ROOM_TYPE_KIND, roomType, 0, nil)
+}
+
+func accountKey(ctx context.Context, user string) *datastore.Key {
+	return datastore.NewKey(ctx, ACCOUNT_KIND, user, 0, nil)
+}
+
+// getBookings returns the bookings of the room type with their keys. The
+// ancestor query is consistent and can run in a transaction.
+func getBookings(ctx context.Context, roomType string) ([]*Booking, []*datastore.Key, error) {
+	var entities []bookingEntity
+	keys, err := datastore.NewQuery(BOOKING_KIND).Ancestor(roomTypeKey(ctx, roomType)).GetAll(ctx, &entities)
+	if err != nil {
+		return nil, nil, err
+	}
+	bookings := make([]*Booking, 0, len(entities))
+	for _, entity := range entities {
+		booking, err := entity.booking()
+		if err != nil {
+			return nil, nil, err
+		}
+		bookings = append(bookings, booking)
+	}
+	return bookings, keys, nil
+}
+
+func getAccount(ctx context.Context, user string) (*Account, error) {
+	var account Account
+	err := datastore.Get(ctx, accountKey(ctx, user), &account)
+	if err == datastore.ErrNoSuchEntity {
+		return newAccount(user), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+func newBookingEntity(booking *Booking) (*bookingEntity, error) {
+	var data bytes.Buffer
+	if err := gob.NewEncoder(&data).Encode(booking); err != nil {
+		return nil, err
+	}
+	return &bookingEntity{Booking: data.Bytes()}, nil
+}
+
+func (e *bookingEntity) booking() (*Booking, error) {
+	var booking Booking
+	if err := gob.NewDecoder(bytes.NewReader(e.Booking)).Decode(&booking); err != nil {
+		return nil, err
+	}
+	checkIn, err := time.Parse(DATE_FORMAT, booking.CheckIn)
+	if err != nil {
+		return nil, err
+	}
+	checkOut, err := time.Parse(DATE_FORMAT, booking.CheckOut)
+	if err != nil {
+		return nil, err
+	}
+	booking.stay = Stay{CheckIn: checkIn, CheckOut: checkOut, Guests: booking.Guests}
+	return &booking, nil
+}
@@ -0,0 +1,304 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// Package hotel keeps the room inventory of the hotel sample. Rooms are
+// grouped in room types with nightly rates, bookings take one room of a type
+// for a stay, and guests with a loyalty account can pay nights with free
+// nights they earned.
+package hotel
+
+import (
+	"backend/money"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	DATE_FORMAT     = "2006-01-02"
+	MAX_STAY_NIGHTS = 30
+	// How far ahead stays can be booked, in days. This also limits the
+	// number of bookings kept.
+	MAX_ADVANCE_DAYS = 365
+)
+
+var (
+	ErrInvalidDates        = errors.New("hotel: invalid dates")
+	ErrInvalidGuests       = errors.New("hotel: invalid number of guests")
+	ErrUnknownRoomType     = errors.New("hotel: unknown room type")
+	ErrTooManyGuests       = errors.New("hotel: too many guests for the room type")
+	ErrUnavailable         = errors.New("hotel: no room available for the stay")
+	ErrSignInRequired      = errors.New("hotel: free nights can only be redeemed when signed in")
+	ErrNotEnoughFreeNights = errors.New("hotel: not enough free nights")
+)
+
+type RoomType struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"desc"`
+	Image       string `json:"img"`
+	PetFriendly bool   `json:"petFriendly"`
+	MaxGuests   int    `json:"maxGuests"`
+	// Number of rooms of this type.
+	Rooms int `json:"-"`
+	// Price per night, WeekendRate applies to Friday and Saturday nights if
+	// set.
+	Rate        money.Amount `json:"rate"`
+	WeekendRate money.Amount `json:"weekendRate,omitempty"`
+}
+
+// rate returns the price of the night starting on day.
+func (t *RoomType) rate(day time.Time) money.Amount {
+	if t.WeekendRate > 0 && (day.Weekday() == time.Friday || day.Weekday() == time.Saturday) {
+		return t.WeekendRate
+	}
+	return t.Rate
+}
+
+// Stay is the nights from CheckIn to the day before CheckOut. Both are
+// dates at midnight UTC.
+type Stay struct {
+	CheckIn  time.Time
+	CheckOut time.Time
+	Guests   int
+}
+
+// ParseStay reads a stay from dates formatted like DATE_FORMAT. Stays have to
+// start between today and MAX_ADVANCE_DAYS from now and be at most
+// MAX_STAY_NIGHTS long.
+func ParseStay(arriving string, leaving string, guests string, now time.Time) (Stay, error) {
+	checkIn, err := time.Parse(DATE_FORMAT, arriving)
+	if err != nil {
+		return Stay{}, ErrInvalidDates
+	}
+	checkOut, err := time.Parse(DATE_FORMAT, leaving)
+	if err != nil {
+		return Stay{}, ErrInvalidDates
+	}
+	today := day(now)
+	if checkIn.Before(today) || checkIn.After(today.AddDate(0, 0, MAX_ADVANCE_DAYS)) {
+		return Stay{}, ErrInvalidDates
+	}
+	stay := Stay{CheckIn: checkIn, CheckOut: checkOut, Guests: 1}
+	if nights := stay.Nights(); nights < 1 || nights > MAX_STAY_NIGHTS {
+		return Stay{}, ErrInvalidDates
+	}
+	if guests != "" {
+		stay.Guests, err = strconv.Atoi(guests)
+		if err != nil || stay.Guests < 1 {
+			return Stay{}, ErrInvalidGuests
+		}
+	}
+	return stay, nil
+}
+
+func (s Stay) Nights() int {
+	return int(s.CheckOut.Sub(s.CheckIn).Hours() / 24)
+}
+
+// overlaps reports whether both stays share a night.
+func (s Stay) overlaps(other Stay) bool {
+	return s.CheckIn.Before(other.CheckOut) && other.CheckIn.Before(s.CheckOut)
+}
+
+// Quote is the price of a stay in a room type.
+type Quote struct {
+	Nights   int          `json:"nights"`
+	Subtotal money.Amount `json:"subtotal"`
+	// Free nights redeemed, they pay for the most expensive nights.
+	FreeNights int          `json:"freeNights"`
+	Discount   money.Amount `json:"discount"`
+	Total      money.Amount `json:"total"`
+}
+
+func quote(t *RoomType, stay Stay, freeNights int) Quote {
+	var rates []money.Amount
+	q := Quote{Nights: stay.Nights()}
+	for night := stay.CheckIn; night.Before(stay.CheckOut); night = night.AddDate(0, 0, 1) {
+		rate := t.rate(night)
+		rates = append(rates, rate)
+		q.Subtotal += rate
+	}
+	if freeNights > len(rates) {
+		freeNights = len(rates)
+	}
+	sort.Slice(rates, func(i, j int) bool { return rates[i] > rates[j] })
+	for _, rate := range rates[:freeNights] {
+		q.Discount += rate
+	}
+	q.FreeNights = freeNights
+	q.Total = q.Subtotal - q.Discount
+	return q
+}
+
+// Offer is a room type available for a stay.
+type Offer struct {
+	RoomType
+	// Rooms left for the stay.
+	Available int   `json:"available"`
+	Quote     Quote `json:"quote"`
+}
+
+type Booking struct {
+	ID       string    `json:"id"`
+	RoomType string    `json:"roomType"`
+	User     string    `json:"-"`
+	CheckIn  string    `json:"arriving"`
+	CheckOut string    `json:"leaving"`
+	Guests   int       `json:"guests"`
+	Quote    Quote     `json:"quote"`
+	Created  time.Time `json:"created"`
+
+	stay Stay
+}
+
+// Inventory books the rooms of the room types, keeping the bookings and
+// loyalty accounts in a Store.
+type Inventory struct {
+	types map[string]*RoomType
+	order []string
+	store Store
+}
+
+func NewInventory(types []RoomType, store Store) (*Inventory, error) {
+	inventory := &Inventory{
+		types: make(map[string]*RoomType),
+		store: store,
+	}
+	for i := range types {
+		t := types[i]
+		if t.ID == "" || t.Rooms < 1 || t.MaxGuests < 1 || t.Rate <= 0 {
+			return nil, errors.New("hotel: invalid room type " + strconv.Quote(t.ID))
+		}
+		if _, ok := inventory.types[t.ID]; ok {
+			return nil, errors.New("hotel: duplicate room type " + strconv.Quote(t.ID))
+		}
+		inventory.types[t.ID] = &t
+		inventory.order = append(inventory.order, t.ID)
+	}
+	return inventory, nil
+}
+
+// RoomTypes returns all room types in the order they were defined.
+func (inv *Inventory) RoomTypes() []RoomType {
+	types := make([]RoomType, 0, len(inv.order))
+	for _, id := range inv.order {
+		types = append(types, *inv.types[id])
+	}
+	return types
+}
+
+// Availability returns the room types that have a room for the whole stay
+// and fit the guests.
+func (inv *Inventory) Availability(ctx context.Context, stay Stay) ([]Offer, error) {
+	var offers []Offer
+	for _, id := range inv.order {
+		t := inv.types[id]
+		if stay.Guests > t.MaxGuests {
+			continue
+		}
+		bookings, err := inv.store.Bookings(ctx, t.ID)
+		if err != nil {
+			return nil, err
+		}
+		if available := available(t, bookings, stay); available > 0 {
+			offers = append(offers, Offer{
+				RoomType:  *t,
+				Available: available,
+				Quote:     quote(t, stay, 0),
+			})
+		}
+	}
+	return offers, nil
+}
+
+// available returns the number of rooms of t free on every night of the
+// stay, given the bookings of t.
+func available(t *RoomType, bookings []*Booking, stay Stay) int {
+	booked := 0
+	for night := stay.CheckIn; night.Before(stay.CheckOut); night = night.AddDate(0, 0, 1) {
+		n := 0
+		for _, b := range bookings {
+			if b.stay.overlaps(Stay{CheckIn: night, CheckOut: night.AddDate(0, 0, 1)}) {
+				n++
+			}
+		}
+		if n > booked {
+			booked = n
+		}
+	}
+	return t.Rooms - booked
+}
+
+// Book reserves a room of the type for the stay. user is the signed in
+// guest, if any, and can redeem free nights from their account.
+func (inv *Inventory) Book(ctx context.Context, user string, roomType string, stay Stay, freeNights int, now time.Time) (*Booking, error) {
+	t, ok := inv.types[roomType]
+	if !ok {
+		return nil, ErrUnknownRoomType
+	}
+	if stay.Guests > t.MaxGuests {
+		return nil, ErrTooManyGuests
+	}
+	if freeNights < 0 || freeNights > stay.Nights() {
+		return nil, ErrNotEnoughFreeNights
+	}
+	if freeNights > 0 && user == "" {
+		return nil, ErrSignInRequired
+	}
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	return inv.store.Book(ctx, t.ID, user, day(now), func(bookings []*Booking, account *Account) (*Booking, error) {
+		if account != nil && freeNights > account.FreeNights {
+			return nil, ErrNotEnoughFreeNights
+		}
+		if available(t, bookings, stay) < 1 {
+			return nil, ErrUnavailable
+		}
+		if account != nil {
+			account.FreeNights -= freeNights
+			account.earn(stay.Nights() - freeNights)
+		}
+		return &Booking{
+			ID:       id,
+			RoomType: t.ID,
+			User:     user,
+			CheckIn:  stay.CheckIn.Format(DATE_FORMAT),
+			CheckOut: stay.CheckOut.Format(DATE_FORMAT),
+			Guests:   stay.Guests,
+			Quote:    quote(t, stay, freeNights),
+			Created:  now,
+			stay:     stay,
+		}, nil
+	})
+}
+
+func day(t time.Time) time.Time {
+	year, month, d := t.UTC().Date()
+	return time.Date(year, month, d, 0, 0, 0, 0, time.UTC)
+}
+
+func newID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,152 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package hotel
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+var now = time.Date(2026, 3, 2, 15, 0, 0, 0, time.UTC)
+
+func newTestInventory(t *testing.T) *Inventory {
+	inventory, err := NewInventory([]RoomType{
+		{ID: "single", MaxGuests: 1, Rooms: 1, Rate: 10000},
+		{ID: "double", MaxGuests: 2, Rooms: 2, Rate: 12000, WeekendRate: 15000},
+	}, NewMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return inventory
+}
+
+func mustParseStay(t *testing.T, arriving string, leaving string) Stay {
+	t.Helper()
+	stay, err := ParseStay(arriving, leaving, "1", now)
+	if err != nil {
+		t.Fatalf("ParseStay(%q, %q) = %v", arriving, leaving, err)
+	}
+	return stay
+}
+
+func TestBookUntilUnavailable(t *testing.T) {
+	ctx := context.Background()
+	inventory := newTestInventory(t)
+	stay := mustParseStay(t, "2026-03-10", "2026-03-12")
+
+	if _, err := inventory.Book(ctx, "", "single", stay, 0, now); err != nil {
+		t.Fatalf("Book = %v", err)
+	}
+	overlapping := mustParseStay(t, "2026-03-11", "2026-03-13")
+	if _, err := inventory.Book(ctx, "", "single", overlapping, 0, now); err != ErrUnavailable {
+		t.Errorf("Book overlapping stay = %v, want ErrUnavailable", err)
+	}
+	after := mustParseStay(t, "2026-03-12", "2026-03-13")
+	if _, err := inventory.Book(ctx, "", "single", after, 0, now); err != nil {
+		t.Errorf("Book stay from the check out day = %v, want a booking", err)
+	}
+
+	offers, err := inventory.Availability(ctx, stay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(offers) != 1 || offers[0].ID != "double" || offers[0].Available != 2 {
+		t.Errorf("Availability = %+v, want both double rooms", offers)
+	}
+}
+
+func TestBookPastStaysFreeRooms(t *testing.T) {
+	ctx := context.Background()
+	inventory := newTestInventory(t)
+	stay := mustParseStay(t, "2026-03-02", "2026-03-04")
+	if _, err := inventory.Book(ctx, "", "single", stay, 0, now); err != nil {
+		t.Fatal(err)
+	}
+	later := now.AddDate(0, 0, 3)
+	next, err := ParseStay("2026-03-05", "2026-03-06", "1", later)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := inventory.Book(ctx, "", "single", next, 0, later); err != nil {
+		t.Fatal(err)
+	}
+	bookings, err := inventory.store.Bookings(ctx, "single")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bookings) != 1 {
+		t.Errorf("%d bookings kept, want the past one removed", len(bookings))
+	}
+}
+
+func TestFreeNights(t *testing.T) {
+	ctx := context.Background()
+	inventory := newTestInventory(t)
+	// Friday to Monday, the free night pays for a weekend night.
+	stay := mustParseStay(t, "2026-03-06", "2026-03-09")
+
+	if _, err := inventory.Book(ctx, "", "double", stay, 1, now); err != ErrSignInRequired {
+		t.Errorf("Book with free nights without user = %v, want ErrSignInRequired", err)
+	}
+	if _, err := inventory.Book(ctx, "ada@example.com", "double", stay, WELCOME_FREE_NIGHTS+1, now); err != ErrNotEnoughFreeNights {
+		t.Errorf("Book with too many free nights = %v, want ErrNotEnoughFreeNights", err)
+	}
+	booking, err := inventory.Book(ctx, "ada@example.com", "double", stay, 1, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if booking.Quote.Discount != 15000 || booking.Quote.Total != 15000+12000 {
+		t.Errorf("quote %+v, want a weekend night free", booking.Quote)
+	}
+	account, err := inventory.Account(ctx, "ada@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Account{User: "ada@example.com", Status: STATUS_MEMBER, FreeNights: WELCOME_FREE_NIGHTS - 1, Nights: 2}
+	if account != want {
+		t.Errorf("account %+v, want %+v", account, want)
+	}
+
+	// Failed bookings don't touch the account.
+	full := mustParseStay(t, "2026-03-06", "2026-03-07")
+	inventory.Book(ctx, "", "double", full, 0, now)
+	if _, err := inventory.Book(ctx, "ada@example.com", "double", full, 1, now); err != ErrUnavailable {
+		t.Fatalf("Book full room = %v, want ErrUnavailable", err)
+	}
+	if account, _ := inventory.Account(ctx, "ada@example.com"); account != want {
+		t.Errorf("account %+v after a failed booking, want %+v", account, want)
+	}
+}
+
+func TestEarn(t *testing.T) {
+	tests := []struct {
+		nights     int
+		earned     int
+		wantStatus string
+	}{
+		{4, 0, STATUS_MEMBER},
+		{5, 1, STATUS_MEMBER},
+		{SILVER_NIGHTS, 2, STATUS_SILVER},
+		{GOLD_NIGHTS, 5, STATUS_GOLD},
+	}
+	for _, test := range tests {
+		account := newAccount("ada@example.com")
+		account.earn(test.nights)
+		if account.FreeNights != WELCOME_FREE_NIGHTS+test.earned || account.Status != test.wantStatus {
+			t.Errorf("earn(%d) = %d free nights, %s, want %d, %s", test.nights, account.FreeNights, account.Status, WELCOME_FREE_NIGHTS+test.earned, test.wantStatus)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package hotel
+
+import "golang.org/x/net/context"
+
+// Loyalty statuses, by the number of paid nights booked.
+const (
+	STATUS_MEMBER = "Member"
+	STATUS_SILVER = "Silver"
+	STATUS_GOLD   = "Gold"
+
+	SILVER_NIGHTS = 10
+	GOLD_NIGHTS   = 25
+	// Free nights new members start with.
+	WELCOME_FREE_NIGHTS = 2
+	// Paid nights needed to earn a free night.
+	NIGHTS_PER_FREE_NIGHT = 5
+)
+
+type Account struct {
+	User       string `json:"username"`
+	Status     string `json:"status"`
+	FreeNights int    `json:"freenights"`
+	// Paid nights booked so far.
+	Nights int `json:"nights"`
+}
+
+// earn adds paid nights to the account.
+func (a *Account) earn(nights int) {
+	a.FreeNights += (a.Nights+nights)/NIGHTS_PER_FREE_NIGHT - a.Nights/NIGHTS_PER_FREE_NIGHT
+	a.Nights += nights
+	switch {
+	case a.Nights >= GOLD_NIGHTS:
+		a.Status = STATUS_GOLD
+	case a.Nights >= SILVER_NIGHTS:
+		a.Status = STATUS_SILVER
+	default:
+		a.Status = STATUS_MEMBER
+	}
+}
+
+// Account returns the loyalty account of user. Users that haven't booked
+// yet get the account new members start with, it is only kept once they
+// book.
+func (inv *Inventory) Account(ctx context.Context, user string) (Account, error) {
+	account, err := inv.store.Account(ctx, user)
+	if err != nil {
+		return Account{}, err
+	}
+	return *account, nil
+}
+
+// newAccount returns the account new members start with.
+func newAccount(user string) *Account {
+	return &Account{
+		User:       user,
+		Status:     STATUS_MEMBER,
+		FreeNights: WELCOME_FREE_NIGHTS,
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package hotel
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// MemoryStore keeps the bookings and accounts in memory. It is meant for the
+// development server, where all requests go to one instance.
+type MemoryStore struct {
+	lock     sync.Mutex
+	bookings map[string][]*Booking
+	accounts map[string]*Account
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		bookings: make(map[string][]*Booking),
+		accounts: make(map[string]*Account),
+	}
+}
+
+func (s *MemoryStore) Bookings(ctx context.Context, roomType string) ([]*Booking, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return copyBookings(s.bookings[roomType]), nil
+}
+
+func (s *MemoryStore) Account(ctx context.Context, user string) (*Account, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.account(user), nil
+}
+
+func (s *MemoryStore) Book(ctx context.Context, roomType string, user string, today time.Time, book func(bookings []*Booking, account *Account) (*Booking, error)) (*Booking, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.removePast(roomType, today)
+	var account *Account
+	if user != "" {
+		account = s.account(user)
+	}
+	booking, err := book(copyBookings(s.bookings[roomType]), account)
+	if err != nil {
+		return nil, err
+	}
+	stored := *booking
+	s.bookings[roomType] = append(s.bookings[roomType], &stored)
+	if account != nil {
+		s.accounts[user] = account
+	}
+	return booking, nil
+}
+
+// account returns a copy of the account of user. It needs s to be locked.
+func (s *MemoryStore) account(user string) *Account {
+	if account, ok := s.accounts[user]; ok {
+		result := *account
+		return &result
+	}
+	return newAccount(user)
+}
+
+// removePast drops bookings that ended before today. It needs s to be
+// locked.
+func (s *MemoryStore) removePast(roomType string, today time.Time) {
+	bookings := s.bookings[roomType][:0]
+	for _, b := range s.bookings[roomType] {
+		if !b.stay.CheckOut.Before(today) {
+			bookings = append(bookings, b)
+		}
+	}
+	s.bookings[roomType] = bookings
+}
+
+func copyBookings(bookings []*Booking) []*Booking {
+	result := make([]*Booking, 0, len(bookings))
+	for _, b := range bookings {
+		booking := *b
+		result = append(result, &booking)
+	}
+	return result
+}
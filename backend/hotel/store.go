@@ -0,0 +1,45 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package hotel
+
+import (
+	"backend/items"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// Store keeps the bookings and loyalty accounts of an Inventory.
+type Store interface {
+	// Bookings returns the bookings of the room type.
+	Bookings(ctx context.Context, roomType string) ([]*Booking, error)
+	// Account returns the account of user, or the one new members start
+	// with if user hasn't booked yet.
+	Account(ctx context.Context, user string) (*Account, error)
+	// Book calls book with the bookings of the room type that end today or
+	// later and the account of user, nil if user is "". If book returns a
+	// booking, it is stored together with the changed account, so two
+	// bookings can't take the same room or spend the same free nights.
+	// book may be called again with fresh copies if the write conflicts
+	// with another one.
+	Book(ctx context.Context, roomType string, user string, today time.Time, book func(bookings []*Booking, account *Account) (*Booking, error)) (*Booking, error)
+}
+
+// ParseStore returns the store for spec, see items.UseDatastore.
+func ParseStore(spec string) Store {
+	if items.UseDatastore(spec) {
+		return &DatastoreStore{}
+	}
+	return NewMemoryStore()
+}
@@ -15,6 +15,7 @@
 package backend
 
 import (
+	"backend/config"
 	"fmt"
 	"math"
 	"net/http"
@@ -33,7 +34,7 @@ type MortgageForm struct {
 	Period   int
 }
 
-func InitHousingForm() {
+func InitHousingForm(cfg *config.Config) {
 	RegisterHandler(HOUSING_SAMPLE_PATH+"calculate-mortgage-xhr", calculateMortgageXHR)
 	RegisterHandler(HOUSING_SAMPLE_PATH+"calculate-mortgage", calculateMortgage)
 }
@@ -0,0 +1,50 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// Package items has what the samples that keep data per item, like
+// favorites and ratings, share: the item IDs they accept and the choice
+// between keeping the data in memory or in the datastore.
+package items
+
+import (
+	"regexp"
+
+	"google.golang.org/appengine"
+)
+
+// Store specs.
+const (
+	MEMORY    = "memory"
+	DATASTORE = "datastore"
+)
+
+// Item IDs end up in datastore key names and URLs.
+var idRegex = regexp.MustCompile(`^[A-Za-z0-9_-]{1,100}$`)
+
+// ValidID reports whether id can be used as an item ID.
+func ValidID(id string) bool {
+	return idRegex.MatchString(id)
+}
+
+// UseDatastore reports whether spec, MEMORY or DATASTORE, asks for the
+// datastore. Any other spec means the datastore in production and memory on
+// the development server.
+func UseDatastore(spec string) bool {
+	switch spec {
+	case MEMORY:
+		return false
+	case DATASTORE:
+		return true
+	}
+	return !appengine.IsDevAppServer()
+}
@@ -0,0 +1,125 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package money represents amounts as integer minor units, e.g. cents, so
+// that sums and discounts don't suffer from floating point rounding.
+package money
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Amount in minor units of the currency.
+type Amount int64
+
+var ErrInvalid = errors.New("money: invalid amount")
+
+// Parse reads amounts like "9.94", "10" or "-0.5".
+func Parse(s string) (Amount, error) {
+	s = strings.TrimSpace(s)
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	units, fraction := s, ""
+	if i := strings.Index(s, "."); i >= 0 {
+		units, fraction = s[:i], s[i+1:]
+	}
+	if units == "" && fraction == "" || len(fraction) > 2 {
+		return 0, ErrInvalid
+	}
+	for len(fraction) < 2 {
+		fraction += "0"
+	}
+	if units == "" {
+		units = "0"
+	}
+	u, err := strconv.ParseUint(units, 10, 64)
+	if err != nil {
+		return 0, ErrInvalid
+	}
+	f, err := strconv.ParseUint(fraction, 10, 8)
+	if err != nil {
+		return 0, ErrInvalid
+	}
+	// Amounts beyond the range of Amount would wrap around.
+	if u > (math.MaxInt64-f)/100 {
+		return 0, ErrInvalid
+	}
+	a := Amount(u*100 + f)
+	if negative {
+		a = -a
+	}
+	return a, nil
+}
+
+// String formats a as "9.94".
+func (a Amount) String() string {
+	sign := ""
+	if a < 0 {
+		sign = "-"
+		a = -a
+	}
+	cents := strconv.FormatInt(int64(a%100), 10)
+	if len(cents) < 2 {
+		cents = "0" + cents
+	}
+	return sign + strconv.FormatInt(int64(a/100), 10) + "." + cents
+}
+
+// Times returns a multiplied by n.
+func (a Amount) Times(n int) Amount {
+	return a * Amount(n)
+}
+
+// Percent returns p percent of a, rounded half away from zero.
+func (a Amount) Percent(p int) Amount {
+	x := int64(a) * int64(p)
+	if x < 0 {
+		return -Amount((-x + 50) / 100)
+	}
+	return Amount((x + 50) / 100)
+}
+
+// BasisPoints returns bp hundredths of a percent of a, rounded half away
+// from zero.
+func (a Amount) BasisPoints(bp int) Amount {
+	x := int64(a) * int64(bp)
+	if x < 0 {
+		return -Amount((-x + 5000) / 10000)
+	}
+	return Amount((x + 5000) / 10000)
+}
+
+// Min returns the smaller of a and b.
+func Min(a Amount, b Amount) Amount {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + a.String() + `"`), nil
+}
+
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	parsed, err := Parse(strings.Trim(string(data), `"`))
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
@@ -0,0 +1,133 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package money
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		s    string
+		want Amount
+		err  bool
+	}{
+		{"9.94", 994, false},
+		{"10", 1000, false},
+		{" 10.5 ", 1050, false},
+		{"-0.5", -50, false},
+		{".25", 25, false},
+		{"0", 0, false},
+		{"92233720368547758.07", 9223372036854775807, false},
+		{"-92233720368547758.07", -9223372036854775807, false},
+		{"92233720368547758.08", 0, true},
+		{"92233720368547759", 0, true},
+		{"18446744073709551615", 0, true},
+		{"", 0, true},
+		{".", 0, true},
+		{"-", 0, true},
+		{"1.234", 0, true},
+		{"1,5", 0, true},
+		{"+1", 0, true},
+		{"--1", 0, true},
+		{"1.-5", 0, true},
+		{"abc", 0, true},
+	}
+	for _, test := range tests {
+		got, err := Parse(test.s)
+		if test.err {
+			if err != ErrInvalid {
+				t.Errorf("Parse(%q) = %d, %v, want ErrInvalid", test.s, got, err)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("Parse(%q) = %d, %v, want %d", test.s, got, err, test.want)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		a    Amount
+		want string
+	}{
+		{994, "9.94"},
+		{5, "0.05"},
+		{0, "0.00"},
+		{-50, "-0.50"},
+		{-1205, "-12.05"},
+	}
+	for _, test := range tests {
+		if got := test.a.String(); got != test.want {
+			t.Errorf("Amount(%d).String() = %q, want %q", test.a, got, test.want)
+		}
+	}
+}
+
+func TestPercent(t *testing.T) {
+	tests := []struct {
+		a    Amount
+		p    int
+		want Amount
+	}{
+		{1000, 10, 100},
+		{999, 10, 100},   // 99.9
+		{994, 15, 149},   // 149.1
+		{990, 15, 149},   // 148.5 rounds up
+		{970, 15, 146},   // 145.5 rounds up
+		{-990, 15, -149}, // and away from zero
+		{-994, 15, -149},
+		{1, 49, 0},
+		{1, 50, 1},
+		{1234, 100, 1234},
+		{1234, 0, 0},
+	}
+	for _, test := range tests {
+		if got := test.a.Percent(test.p); got != test.want {
+			t.Errorf("Amount(%d).Percent(%d) = %d, want %d", test.a, test.p, got, test.want)
+		}
+	}
+}
+
+func TestBasisPoints(t *testing.T) {
+	tests := []struct {
+		a    Amount
+		bp   int
+		want Amount
+	}{
+		{10000, 725, 725},
+		{994, 725, 72},    // 72.065
+		{1000, 725, 73},   // 72.5 rounds up
+		{-1000, 725, -73}, // and away from zero
+		{1, 4999, 0},
+		{1, 5000, 1},
+	}
+	for _, test := range tests {
+		if got := test.a.BasisPoints(test.bp); got != test.want {
+			t.Errorf("Amount(%d).BasisPoints(%d) = %d, want %d", test.a, test.bp, got, test.want)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	var a Amount
+	if err := a.UnmarshalJSON([]byte(`"12.30"`)); err != nil || a != 1230 {
+		t.Errorf("UnmarshalJSON = %d, %v, want 1230", a, err)
+	}
+	if data, _ := a.MarshalJSON(); string(data) != `"12.30"` {
+		t.Errorf("MarshalJSON = %s, want \"12.30\"", data)
+	}
+	if err := a.UnmarshalJSON([]byte(`"1e9"`)); err == nil {
+		t.Error("UnmarshalJSON accepted 1e9")
+	}
+}
@@ -15,8 +15,9 @@
 package backend
 
 import (
+	"backend/config"
 	"backend/oauth"
-
+	"log"
 	"net/http"
 )
 
@@ -24,7 +25,7 @@ const (
 	OAUTH_BASE = "/oauth/"
 )
 
-func InitOAuth() {
+func InitOAuth(cfg *config.Config) {
 	RegisterHandler(OAUTH_BASE+"login/google", oauth.GoogleLogin)
 	RegisterHandler(OAUTH_BASE+"callback/google", oauth.GoogleCallback)
 	RegisterHandler(OAUTH_BASE+"login/github", oauth.GitHubLogin)
@@ -36,9 +37,25 @@ func InitOAuth() {
 }
 
 func oauthStatus(w http.ResponseWriter, r *http.Request) {
-	name := oauth.GetUserName(r)
+	user, err := oauth.RefreshUser(r)
+	if err != nil {
+		if err != oauth.ErrNotLoggedIn {
+			log.Printf("Failed to load OAuth user: %v", err)
+		}
+		SendJsonResponse(w, map[string]interface{}{
+			"loggedIn":  false,
+			"name":      "",
+			"email":     "",
+			"avatar":    "",
+			"providers": []string{},
+		})
+		return
+	}
 	SendJsonResponse(w, map[string]interface{}{
-		"loggedIn": name != "",
-		"name":     name,
+		"loggedIn":  true,
+		"name":      user.Name,
+		"email":     user.Email,
+		"avatar":    user.Avatar,
+		"providers": user.Providers,
 	})
 }
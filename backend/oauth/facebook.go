@@ -15,7 +15,7 @@
 package oauth
 
 import (
-	"backend/datastore"
+	"backend/secrets"
 	"encoding/json"
 
 	"net/http"
@@ -31,8 +31,7 @@ const (
 )
 
 var (
-	oauthFacebookScopes = []string{}
-	oauthFacebookConfig *oauth2.Config
+	oauthFacebookScopes = []string{"email"}
 )
 
 func FacebookLogin(w http.ResponseWriter, r *http.Request) {
@@ -58,11 +57,7 @@ func FacebookCallback(w http.ResponseWriter, r *http.Request) {
 }
 
 func fetchOauthFacebookConfig(ctx context.Context) (*oauth2.Config, error) {
-	if oauthFacebookConfig != nil {
-		return oauthFacebookConfig, nil
-	}
-
-	secretJSON, err := datastore.ReadFile(ctx, CLIENT_SECRET_FACEBOOK_FILENAME)
+	secretJSON, err := secrets.Read(ctx, CLIENT_SECRET_FACEBOOK_FILENAME)
 	if err != nil {
 		return nil, err
 	}
@@ -73,13 +68,11 @@ func fetchOauthFacebookConfig(ctx context.Context) (*oauth2.Config, error) {
 		return nil, err
 	}
 
-	oauthFacebookConfig = &oauth2.Config{
+	return &oauth2.Config{
 		ClientID:     secret["client_id"],
 		ClientSecret: secret["client_secret"],
 		RedirectURL:  secret["redirect_uri"],
 		Scopes:       oauthFacebookScopes,
 		Endpoint:     facebook.Endpoint,
-	}
-
-	return oauthFacebookConfig, nil
+	}, nil
 }
@@ -15,7 +15,7 @@
 package oauth
 
 import (
-	"backend/datastore"
+	"backend/secrets"
 	"encoding/json"
 
 	"net/http"
@@ -32,7 +32,6 @@ const (
 
 var (
 	oauthGitHubScopes = []string{"openid", "profile"}
-	oauthGitHubConfig *oauth2.Config
 )
 
 func GitHubLogin(w http.ResponseWriter, r *http.Request) {
@@ -58,11 +57,7 @@ func GitHubCallback(w http.ResponseWriter, r *http.Request) {
 }
 
 func fetchOauthGitHubConfig(ctx context.Context) (*oauth2.Config, error) {
-	if oauthGitHubConfig != nil {
-		return oauthGitHubConfig, nil
-	}
-
-	secretJSON, err := datastore.ReadFile(ctx, CLIENT_SECRET_GITHUB_FILENAME)
+	secretJSON, err := secrets.Read(ctx, CLIENT_SECRET_GITHUB_FILENAME)
 	if err != nil {
 		return nil, err
 	}
@@ -73,13 +68,11 @@ func fetchOauthGitHubConfig(ctx context.Context) (*oauth2.Config, error) {
 		return nil, err
 	}
 
-	oauthGitHubConfig = &oauth2.Config{
+	return &oauth2.Config{
 		ClientID:     secret["client_id"],
 		ClientSecret: secret["client_secret"],
 		RedirectURL:  secret["redirect_uri"],
 		Scopes:       oauthGitHubScopes,
 		Endpoint:     github.Endpoint,
-	}
-
-	return oauthGitHubConfig, nil
+	}, nil
 }
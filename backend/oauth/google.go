@@ -15,7 +15,7 @@
 package oauth
 
 import (
-	"backend/datastore"
+	"backend/secrets"
 
 	"net/http"
 
@@ -30,8 +30,7 @@ const (
 )
 
 var (
-	oauthGoogleScopes = []string{"openid", "profile"}
-	oauthGoogleConfig *oauth2.Config
+	oauthGoogleScopes = []string{"openid", "profile", "email"}
 )
 
 func GoogleLogin(w http.ResponseWriter, r *http.Request) {
@@ -57,19 +56,10 @@ func GoogleCallback(w http.ResponseWriter, r *http.Request) {
 }
 
 func fetchOauthGoogleConfig(ctx context.Context) (*oauth2.Config, error) {
-	if oauthGoogleConfig != nil {
-		return oauthGoogleConfig, nil
-	}
-
-	secret, err := datastore.ReadFile(ctx, CLIENT_SECRET_GOOGLE_FILENAME)
-	if err != nil {
-		return nil, err
-	}
-
-	oauthGoogleConfig, err = google.ConfigFromJSON(secret, oauthGoogleScopes...)
+	secret, err := secrets.Read(ctx, CLIENT_SECRET_GOOGLE_FILENAME)
 	if err != nil {
 		return nil, err
 	}
 
-	return oauthGoogleConfig, nil
+	return google.ConfigFromJSON(secret, oauthGoogleScopes...)
 }
@@ -16,24 +16,48 @@ package oauth
 
 import (
 	"backend/cookie"
+	"backend/secrets"
 	"backend/util"
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
 
 	"net/http"
 	"strconv"
+	"time"
 
 	"golang.org/x/net/context"
 	"golang.org/x/oauth2"
 	"google.golang.org/appengine"
+	"google.golang.org/appengine/datastore"
+	"google.golang.org/appengine/log"
 )
 
 const (
 	OAUTH_COOKIE = "oauth2_cookie"
+	// Profiles are fetched again from the provider after this long, see
+	// RefreshUser.
+	PROFILE_MAX_AGE = 24 * time.Hour
+	// Key of at least 32 bytes used to sign OAUTH_COOKIE.
+	COOKIE_KEY_FILENAME = "oauth_cookie_key"
 )
 
+// The key in COOKIE_KEY_FILENAME.
+var cookieKey = &secrets.Derived{
+	Names: []string{COOKIE_KEY_FILENAME},
+	Build: func(s [][]byte) (interface{}, error) {
+		key := bytes.TrimSpace(s[0])
+		if len(key) < 32 {
+			return nil, errors.New("oauth: cookie key shorter than 32 bytes")
+		}
+		return key, nil
+	},
+}
+
 var userinfoEndpoint = map[string]string{
-	"facebook": "https://graph.facebook.com/v3.1/me",
+	"facebook": "https://graph.facebook.com/v3.1/me?fields=id,name,email,picture",
 	"google":   "https://www.googleapis.com/oauth2/v3/userinfo",
 	"github":   "https://api.github.com/user",
 }
@@ -46,13 +70,15 @@ func loginForConfig(w http.ResponseWriter, r *http.Request, config *oauth2.Confi
 	}
 
 	state := util.RandomString(8)
-	url := config.AuthCodeURL(state)
+	// Ask for offline access so providers that support it issue a refresh token.
+	url := config.AuthCodeURL(state, oauth2.AccessTypeOffline)
 
 	cookieData := &oauthCookie{
 		State:     state,
 		ReturnURL: returnURL,
+		UserID:    GetUserID(r),
 	}
-	if err := cookie.Set(w, OAUTH_COOKIE, cookieData); err != nil {
+	if err := setCookie(w, r, cookieData); err != nil {
 		http.Error(w, "Failed to set cookie", http.StatusInternalServerError)
 		return
 	}
@@ -64,7 +90,7 @@ func callbackForConfig(w http.ResponseWriter, r *http.Request, config *oauth2.Co
 	query := r.URL.Query()
 
 	var cookieData oauthCookie
-	if err := cookie.Get(r, OAUTH_COOKIE, &cookieData); err != nil {
+	if err := getCookie(r, &cookieData); err != nil {
 		http.Error(w, "Invalid cookie", http.StatusInternalServerError)
 		return
 	}
@@ -93,8 +119,15 @@ func callbackForConfig(w http.ResponseWriter, r *http.Request, config *oauth2.Co
 		http.Redirect(w, r, cookieData.generateReturnURL(false), http.StatusFound)
 		return
 	}
-	name, err := nameFromToken(ctx, config, token, userinfoEndpoint[provider])
+	p, err := fetchProfile(config.Client(ctx, token), provider)
+	if err != nil {
+		cookie.Clear(w, OAUTH_COOKIE)
+		http.Redirect(w, r, cookieData.generateReturnURL(false), http.StatusFound)
+		return
+	}
+	key, user, err := linkIdentity(ctx, cookieData.UserID, provider, p, token)
 	if err != nil {
+		log.Errorf(ctx, "Failed to link %s identity: %v", provider, err)
 		cookie.Clear(w, OAUTH_COOKIE)
 		http.Redirect(w, r, cookieData.generateReturnURL(false), http.StatusFound)
 		return
@@ -103,9 +136,10 @@ func callbackForConfig(w http.ResponseWriter, r *http.Request, config *oauth2.Co
 	url := cookieData.generateReturnURL(true)
 	cookieData = oauthCookie{
 		LoggedInWith: provider,
-		Name:         name,
+		Name:         user.Name,
+		UserID:       key.IntID(),
 	}
-	if err := cookie.Set(w, OAUTH_COOKIE, &cookieData); err != nil {
+	if err := setCookie(w, r, &cookieData); err != nil {
 		http.Error(w, "Failed to set cookie", http.StatusInternalServerError)
 		return
 	}
@@ -113,32 +147,139 @@ func callbackForConfig(w http.ResponseWriter, r *http.Request, config *oauth2.Co
 	http.Redirect(w, r, url, http.StatusFound)
 }
 
-func nameFromToken(ctx context.Context, config *oauth2.Config, token *oauth2.Token, endpoint string) (string, error) {
-	client := config.Client(ctx, token)
-	resp, err := client.Get(endpoint)
+func fetchProfile(client *http.Client, provider string) (*profile, error) {
+	resp, err := client.Get(userinfoEndpoint[provider])
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oauth: %s userinfo returned %s", provider, resp.Status)
+	}
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	return parseProfile(body)
+}
+
+// parseProfile reads the userinfo responses of all supported providers.
+// Google identifies users by "sub", GitHub and Facebook by "id".
+func parseProfile(body []byte) (*profile, error) {
+	var s struct {
+		Sub       string
+		ID        json.Number
+		Name      string
+		Login     string
+		Email     string
+		Picture   json.RawMessage
+		AvatarURL string `json:"avatar_url"`
 	}
-	var s struct{ Name string }
 	if err := json.Unmarshal(body, &s); err != nil {
-		return "", err
+		return nil, err
+	}
+	p := &profile{
+		Subject: s.Sub,
+		Name:    s.Name,
+		Email:   s.Email,
+		Avatar:  s.AvatarURL,
+	}
+	if p.Subject == "" {
+		p.Subject = s.ID.String()
 	}
-	return s.Name, nil
+	if p.Subject == "" {
+		return nil, errors.New("oauth: userinfo response without user id")
+	}
+	if p.Name == "" {
+		p.Name = s.Login
+	}
+	// Google returns the picture URL, Facebook a {"data": {"url": ...}} object.
+	if p.Avatar == "" && len(s.Picture) > 0 {
+		var picture struct{ Data struct{ URL string } }
+		if err := json.Unmarshal(s.Picture, &p.Avatar); err != nil {
+			if err := json.Unmarshal(s.Picture, &picture); err == nil {
+				p.Avatar = picture.Data.URL
+			}
+		}
+	}
+	return p, nil
 }
 
 func GetUserName(r *http.Request) string {
 	var cookieData oauthCookie
-	if err := cookie.Get(r, OAUTH_COOKIE, &cookieData); err != nil {
+	if err := getCookie(r, &cookieData); err != nil {
 		return ""
 	}
 	return cookieData.Name
 }
 
+// GetUserID returns the ID of the logged in user or 0.
+func GetUserID(r *http.Request) int64 {
+	var cookieData oauthCookie
+	if err := getCookie(r, &cookieData); err != nil {
+		return 0
+	}
+	return cookieData.UserID
+}
+
+// GetUser returns the logged in user with all linked providers.
+func GetUser(r *http.Request) (*User, error) {
+	return loadUser(appengine.NewContext(r), GetUserID(r))
+}
+
+// RefreshUser returns the logged in user like GetUser. If the profile of
+// the provider the user logged in with is older than PROFILE_MAX_AGE, it is
+// fetched again first, refreshing the access token if it expired. The user
+// is returned as stored if that fails.
+func RefreshUser(r *http.Request) (*User, error) {
+	ctx := appengine.NewContext(r)
+	var cookieData oauthCookie
+	if err := getCookie(r, &cookieData); err != nil {
+		return nil, ErrNotLoggedIn
+	}
+	user, err := loadUser(ctx, cookieData.UserID)
+	if err != nil || cookieData.LoggedInWith == "" {
+		return user, err
+	}
+	key, identity, err := loadIdentity(ctx, cookieData.UserID, cookieData.LoggedInWith)
+	if err != nil {
+		log.Warningf(ctx, "Failed to load %s identity: %v", cookieData.LoggedInWith, err)
+		return user, nil
+	}
+	if time.Since(identity.Updated) < PROFILE_MAX_AGE {
+		return user, nil
+	}
+	updated, err := refreshProfile(ctx, key, identity)
+	if err != nil {
+		log.Warningf(ctx, "Failed to refresh %s profile: %v", cookieData.LoggedInWith, err)
+		return user, nil
+	}
+	return updated, nil
+}
+
+func refreshProfile(ctx context.Context, key *datastore.Key, identity *Identity) (*User, error) {
+	fetchConfig, ok := providerConfigs[identity.Provider]
+	if !ok {
+		return nil, fmt.Errorf("oauth: unknown provider %q", identity.Provider)
+	}
+	config, err := fetchConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	client, err := identityClient(ctx, config, key, identity)
+	if err != nil {
+		return nil, err
+	}
+	p, err := fetchProfile(client, identity.Provider)
+	if err != nil {
+		return nil, err
+	}
+	if p.Subject != identity.Subject {
+		return nil, fmt.Errorf("oauth: %s returned the profile of another user", identity.Provider)
+	}
+	return saveProfile(ctx, key, p)
+}
+
 func Logout(w http.ResponseWriter, r *http.Request) {
 	returnURL := r.URL.Query().Get("return")
 	if returnURL == "" {
@@ -151,11 +292,29 @@ func Logout(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, returnURL, http.StatusFound)
 }
 
+// setCookie signs the cookie, so the user ID in it can be trusted.
+func setCookie(w http.ResponseWriter, r *http.Request, data *oauthCookie) error {
+	key, err := cookieKey.Get(appengine.NewContext(r))
+	if err != nil {
+		return err
+	}
+	return cookie.SetSigned(w, OAUTH_COOKIE, data, key.([]byte))
+}
+
+func getCookie(r *http.Request, data *oauthCookie) error {
+	key, err := cookieKey.Get(appengine.NewContext(r))
+	if err != nil {
+		return err
+	}
+	return cookie.GetSigned(r, OAUTH_COOKIE, data, key.([]byte))
+}
+
 type oauthCookie struct {
 	State        string
 	ReturnURL    string
 	LoggedInWith string
 	Name         string
+	UserID       int64
 }
 
 func (c *oauthCookie) generateReturnURL(success bool) string {
@@ -0,0 +1,139 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package oauth
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+func TestParseProfile(t *testing.T) {
+	tests := []struct {
+		body string
+		want profile
+	}{
+		{
+			`{"sub": "123", "name": "Ann", "email": "ann@example.com", "picture": "https://example.com/ann.png"}`,
+			profile{"123", "Ann", "ann@example.com", "https://example.com/ann.png"},
+		},
+		{
+			`{"id": 42, "login": "bob", "avatar_url": "https://example.com/bob.png"}`,
+			profile{"42", "bob", "", "https://example.com/bob.png"},
+		},
+		{
+			`{"id": "7", "name": "Cy", "picture": {"data": {"url": "https://example.com/cy.png"}}}`,
+			profile{"7", "Cy", "", "https://example.com/cy.png"},
+		},
+	}
+	for _, test := range tests {
+		p, err := parseProfile([]byte(test.body))
+		if err != nil || *p != test.want {
+			t.Errorf("parseProfile(%s) = %+v, %v, want %+v", test.body, p, err, test.want)
+		}
+	}
+	for _, body := range []string{`{"name": "No ID"}`, `not json`} {
+		if _, err := parseProfile([]byte(body)); err == nil {
+			t.Errorf("parseProfile(%s) succeeded", body)
+		}
+	}
+}
+
+func TestUpdateProfile(t *testing.T) {
+	tests := []struct {
+		user     User
+		identity Identity
+		p        profile
+		want     User
+	}{
+		// Details from the old profile follow the new one.
+		{
+			User{Name: "Ann", Email: "ann@old.com", Avatar: "old.png"},
+			Identity{Name: "Ann", Email: "ann@old.com", Avatar: "old.png"},
+			profile{"1", "Ann B", "ann@new.com", "new.png"},
+			User{Name: "Ann B", Email: "ann@new.com", Avatar: "new.png"},
+		},
+		// Details from another provider are kept, missing ones filled in.
+		{
+			User{Name: "Ann", Email: "ann@other.com"},
+			Identity{Name: "ann", Email: ""},
+			profile{"1", "ann2", "ann@new.com", "new.png"},
+			User{Name: "Ann", Email: "ann@other.com", Avatar: "new.png"},
+		},
+		// Empty details don't clear the user's.
+		{
+			User{Name: "Ann", Email: "ann@old.com"},
+			Identity{Name: "Ann", Email: "ann@old.com"},
+			profile{"1", "", "", ""},
+			User{Name: "Ann", Email: "ann@old.com"},
+		},
+	}
+	for i, test := range tests {
+		user, identity := test.user, test.identity
+		updateProfile(&user, &identity, &test.p)
+		if !reflect.DeepEqual(user, test.want) {
+			t.Errorf("%d: user = %+v, want %+v", i, user, test.want)
+		}
+		if identity.Name != test.p.Name || identity.Email != test.p.Email || identity.Avatar != test.p.Avatar {
+			t.Errorf("%d: identity = %+v, want the profile %+v", i, identity, test.p)
+		}
+		if identity.Updated.IsZero() {
+			t.Errorf("%d: identity.Updated not set", i)
+		}
+	}
+}
+
+type fakeTokenSource struct {
+	tokens []*oauth2.Token
+	err    error
+}
+
+func (s *fakeTokenSource) Token() (*oauth2.Token, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	token := s.tokens[0]
+	s.tokens = s.tokens[1:]
+	return token, nil
+}
+
+func TestStoringTokenSource(t *testing.T) {
+	old := &oauth2.Token{AccessToken: "old"}
+	refreshed := &oauth2.Token{AccessToken: "new"}
+	var stored []string
+	ts := &storingTokenSource{
+		last:   old,
+		source: &fakeTokenSource{tokens: []*oauth2.Token{old, refreshed, refreshed}},
+		store: func(token *oauth2.Token) {
+			stored = append(stored, token.AccessToken)
+		},
+	}
+	for _, want := range []string{"old", "new", "new"} {
+		token, err := ts.Token()
+		if err != nil || token.AccessToken != want {
+			t.Errorf("Token() = %v, %v, want %s", token, err, want)
+		}
+	}
+	// Only the refresh is stored, once.
+	if !reflect.DeepEqual(stored, []string{"new"}) {
+		t.Errorf("stored %v, want [new]", stored)
+	}
+
+	ts.source = &fakeTokenSource{err: errors.New("revoked")}
+	if _, err := ts.Token(); err == nil {
+		t.Error("Token() succeeded with a failing source")
+	}
+}
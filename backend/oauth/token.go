@@ -0,0 +1,208 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+import (
+	"backend/secrets"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/datastore"
+	"google.golang.org/appengine/log"
+)
+
+const (
+	// Base64 encoded 32 byte AES key used to encrypt stored tokens.
+	TOKEN_KEY_FILENAME = "oauth_token_key"
+)
+
+var (
+	// AES-GCM with the key in TOKEN_KEY_FILENAME.
+	tokenCipher = &secrets.Derived{
+		Names: []string{TOKEN_KEY_FILENAME},
+		Build: func(s [][]byte) (interface{}, error) {
+			key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(s[0])))
+			if err != nil {
+				return nil, err
+			}
+			block, err := aes.NewCipher(key)
+			if err != nil {
+				return nil, err
+			}
+			return cipher.NewGCM(block)
+		},
+	}
+
+	providerConfigs = map[string]func(context.Context) (*oauth2.Config, error){
+		"google":   fetchOauthGoogleConfig,
+		"github":   fetchOauthGitHubConfig,
+		"facebook": fetchOauthFacebookConfig,
+	}
+)
+
+// Client returns an HTTP client authorized as the logged in user's identity
+// for provider. Expired access tokens are refreshed transparently and the
+// new token is stored.
+func Client(r *http.Request, provider string) (*http.Client, error) {
+	fetchConfig, ok := providerConfigs[provider]
+	if !ok {
+		return nil, fmt.Errorf("oauth: unknown provider %q", provider)
+	}
+	ctx := appengine.NewContext(r)
+	config, err := fetchConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	key, identity, err := loadIdentity(ctx, GetUserID(r), provider)
+	if err != nil {
+		return nil, err
+	}
+	return identityClient(ctx, config, key, identity)
+}
+
+// identityClient returns an HTTP client authorized with the tokens of the
+// identity stored under key.
+func identityClient(ctx context.Context, config *oauth2.Config, key *datastore.Key, identity *Identity) (*http.Client, error) {
+	token, err := decryptIdentityToken(ctx, identity)
+	if err != nil {
+		return nil, err
+	}
+	ts := &storingTokenSource{
+		last:   token,
+		source: config.TokenSource(ctx, token),
+		store: func(token *oauth2.Token) {
+			if err := storeToken(ctx, key, token); err != nil {
+				log.Warningf(ctx, "Failed to store refreshed token: %v", err)
+			}
+		},
+	}
+	return oauth2.NewClient(ctx, oauth2.ReuseTokenSource(token, ts)), nil
+}
+
+// storingTokenSource passes refreshed tokens to store, which writes them
+// back to the identity.
+type storingTokenSource struct {
+	last   *oauth2.Token
+	source oauth2.TokenSource
+	store  func(*oauth2.Token)
+}
+
+func (s *storingTokenSource) Token() (*oauth2.Token, error) {
+	token, err := s.source.Token()
+	if err != nil {
+		return nil, err
+	}
+	if token.AccessToken != s.last.AccessToken {
+		s.store(token)
+		s.last = token
+	}
+	return token, nil
+}
+
+func storeToken(ctx context.Context, key *datastore.Key, token *oauth2.Token) error {
+	accessToken, err := encryptToken(ctx, token.AccessToken)
+	if err != nil {
+		return err
+	}
+	refreshToken, err := encryptToken(ctx, token.RefreshToken)
+	if err != nil {
+		return err
+	}
+	return datastore.RunInTransaction(ctx, func(ctx context.Context) error {
+		var identity Identity
+		if err := datastore.Get(ctx, key, &identity); err != nil {
+			return err
+		}
+		identity.AccessToken = accessToken
+		if token.RefreshToken != "" {
+			identity.RefreshToken = refreshToken
+		}
+		identity.Expiry = token.Expiry
+		identity.Updated = time.Now()
+		_, err := datastore.Put(ctx, key, &identity)
+		return err
+	}, nil)
+}
+
+func decryptIdentityToken(ctx context.Context, identity *Identity) (*oauth2.Token, error) {
+	accessToken, err := decryptToken(ctx, identity.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := decryptToken(ctx, identity.RefreshToken)
+	if err != nil {
+		return nil, err
+	}
+	return &oauth2.Token{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		Expiry:       identity.Expiry,
+	}, nil
+}
+
+// encryptToken seals a token with AES-GCM. The nonce is prepended to the
+// result. Empty tokens stay empty.
+func encryptToken(ctx context.Context, token string) ([]byte, error) {
+	if token == "" {
+		return nil, nil
+	}
+	aead, err := fetchTokenCipher(ctx)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, []byte(token), nil), nil
+}
+
+func decryptToken(ctx context.Context, data []byte) (string, error) {
+	if len(data) == 0 {
+		return "", nil
+	}
+	aead, err := fetchTokenCipher(ctx)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < aead.NonceSize() {
+		return "", errors.New("oauth: stored token too short")
+	}
+	nonce, sealed := data[:aead.NonceSize()], data[aead.NonceSize():]
+	token, err := aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(token), nil
+}
+
+func fetchTokenCipher(ctx context.Context) (cipher.AEAD, error) {
+	aead, err := tokenCipher.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return aead.(cipher.AEAD), nil
+}
@@ -0,0 +1,233 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oauth
+
+import (
+	"errors"
+	"time"
+
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+	"google.golang.org/appengine/datastore"
+)
+
+const (
+	USER_KIND     = "OAuthUser"
+	IDENTITY_KIND = "OAuthIdentity"
+)
+
+var ErrNotLoggedIn = errors.New("oauth: not logged in")
+
+// User is an account that one or more provider identities are linked to.
+type User struct {
+	Name      string
+	Email     string
+	Avatar    string `datastore:",noindex"`
+	Providers []string
+	Created   time.Time
+}
+
+// Identity is a provider account linked to a User. It is keyed by
+// "<provider>:<subject>". Tokens are stored encrypted, see encryptToken.
+type Identity struct {
+	User         *datastore.Key
+	Provider     string
+	Subject      string
+	Name         string
+	Email        string
+	Avatar       string `datastore:",noindex"`
+	AccessToken  []byte `datastore:",noindex"`
+	RefreshToken []byte `datastore:",noindex"`
+	Expiry       time.Time
+	Updated      time.Time
+}
+
+// profile is the subset of the provider userinfo response we keep.
+type profile struct {
+	Subject string
+	Name    string
+	Email   string
+	Avatar  string
+}
+
+func identityKey(ctx context.Context, provider string, subject string) *datastore.Key {
+	return datastore.NewKey(ctx, IDENTITY_KIND, provider+":"+subject, 0, nil)
+}
+
+func userKey(ctx context.Context, id int64) *datastore.Key {
+	return datastore.NewKey(ctx, USER_KIND, "", id, nil)
+}
+
+// linkIdentity stores the identity and tokens for the given provider profile
+// and returns the user it belongs to. Identities seen for the first time are
+// linked to currentUser if someone is logged in, otherwise a new user is
+// created. An identity that is already linked keeps its user.
+func linkIdentity(ctx context.Context, currentUser int64, provider string, p *profile, token *oauth2.Token) (*datastore.Key, *User, error) {
+	accessToken, err := encryptToken(ctx, token.AccessToken)
+	if err != nil {
+		return nil, nil, err
+	}
+	refreshToken, err := encryptToken(ctx, token.RefreshToken)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var key *datastore.Key
+	var user User
+	err = datastore.RunInTransaction(ctx, func(ctx context.Context) error {
+		idKey := identityKey(ctx, provider, p.Subject)
+		var identity Identity
+		err := datastore.Get(ctx, idKey, &identity)
+		if err != nil && err != datastore.ErrNoSuchEntity {
+			return err
+		}
+
+		key = identity.User
+		if key == nil && currentUser != 0 {
+			key = userKey(ctx, currentUser)
+		}
+		if key != nil {
+			if err := datastore.Get(ctx, key, &user); err != nil && err != datastore.ErrNoSuchEntity {
+				return err
+			}
+		}
+		if key == nil || user.Created.IsZero() {
+			key = datastore.NewIncompleteKey(ctx, USER_KIND, nil)
+			user = User{Created: time.Now()}
+		}
+		mergeProfile(&user, provider, p)
+		if key, err = datastore.Put(ctx, key, &user); err != nil {
+			return err
+		}
+
+		identity.User = key
+		identity.Provider = provider
+		identity.Subject = p.Subject
+		identity.Name = p.Name
+		identity.Email = p.Email
+		identity.Avatar = p.Avatar
+		identity.AccessToken = accessToken
+		// Providers only hand out a refresh token on first consent, so keep
+		// the one we have if the new token doesn't come with one.
+		if token.RefreshToken != "" {
+			identity.RefreshToken = refreshToken
+		}
+		identity.Expiry = token.Expiry
+		identity.Updated = time.Now()
+		_, err = datastore.Put(ctx, idKey, &identity)
+		return err
+	}, &datastore.TransactionOptions{XG: true})
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, &user, nil
+}
+
+// mergeProfile fills in missing user details from a provider profile and
+// records the provider as linked.
+func mergeProfile(user *User, provider string, p *profile) {
+	if user.Name == "" {
+		user.Name = p.Name
+	}
+	if user.Email == "" {
+		user.Email = p.Email
+	}
+	if user.Avatar == "" {
+		user.Avatar = p.Avatar
+	}
+	for _, linked := range user.Providers {
+		if linked == provider {
+			return
+		}
+	}
+	user.Providers = append(user.Providers, provider)
+}
+
+// saveProfile replaces the profile of the identity stored under key with p.
+// User details that came from the old profile are replaced too.
+func saveProfile(ctx context.Context, key *datastore.Key, p *profile) (*User, error) {
+	var user User
+	err := datastore.RunInTransaction(ctx, func(ctx context.Context) error {
+		var identity Identity
+		if err := datastore.Get(ctx, key, &identity); err != nil {
+			return err
+		}
+		if err := datastore.Get(ctx, identity.User, &user); err != nil {
+			return err
+		}
+		updateProfile(&user, &identity, p)
+		if _, err := datastore.Put(ctx, identity.User, &user); err != nil {
+			return err
+		}
+		_, err := datastore.Put(ctx, key, &identity)
+		return err
+	}, &datastore.TransactionOptions{XG: true})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// updateProfile sets the profile of identity to p. Details of user that are
+// missing or were taken from the old profile follow it, details from other
+// providers are kept.
+func updateProfile(user *User, identity *Identity, p *profile) {
+	update := func(userValue *string, identityValue *string, value string) {
+		if value != "" && (*userValue == "" || *userValue == *identityValue) {
+			*userValue = value
+		}
+		*identityValue = value
+	}
+	update(&user.Name, &identity.Name, p.Name)
+	update(&user.Email, &identity.Email, p.Email)
+	update(&user.Avatar, &identity.Avatar, p.Avatar)
+	identity.Updated = time.Now()
+}
+
+func loadUser(ctx context.Context, id int64) (*User, error) {
+	if id == 0 {
+		return nil, ErrNotLoggedIn
+	}
+	var user User
+	switch err := datastore.Get(ctx, userKey(ctx, id), &user); err {
+	case nil:
+		return &user, nil
+	case datastore.ErrNoSuchEntity:
+		return nil, ErrNotLoggedIn
+	default:
+		return nil, err
+	}
+}
+
+// loadIdentity returns the identity the user has linked for provider. The
+// user has to exist.
+func loadIdentity(ctx context.Context, id int64, provider string) (*datastore.Key, *Identity, error) {
+	if _, err := loadUser(ctx, id); err != nil {
+		return nil, nil, err
+	}
+	q := datastore.NewQuery(IDENTITY_KIND).
+		Filter("User =", userKey(ctx, id)).
+		Filter("Provider =", provider).
+		Limit(1)
+	var identities []Identity
+	keys, err := q.GetAll(ctx, &identities)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(keys) == 0 {
+		return nil, nil, datastore.ErrNoSuchEntity
+	}
+	return keys[0], &identities[0], nil
+}
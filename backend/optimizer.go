@@ -0,0 +1,147 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"backend/config"
+	"backend/optimizer"
+	"backend/refreshcache"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/urlfetch"
+)
+
+const (
+	RUNTIME_CSS_CACHE_KEY = "amp-runtime-css"
+	RUNTIME_CSS_FRESH_FOR = 24 * time.Hour
+	// Query parameter overriding cfg.Features.Optimizer.
+	OPTIMIZE_PARAM = "optimize"
+)
+
+// Contents of optimizer.RUNTIME_CSS_URL, set up by initOptimizer.
+var runtimeCSS *refreshcache.Cache
+
+// Optimized documents by file path. Files in dist don't change while the
+// server is running, the modification time is only checked to support
+// local development.
+var optimizedDocuments = struct {
+	sync.Mutex
+	m map[string]*optimizedDocument
+}{m: make(map[string]*optimizedDocument)}
+
+type optimizedDocument struct {
+	modTime time.Time
+	// Whether the runtime CSS was available, documents optimized without it
+	// keep their boilerplate and are optimized again once it is.
+	withCSS bool
+	body    []byte
+}
+
+func initOptimizer(cfg *config.Config) {
+	// Background refreshes don't outlive the request on App Engine, so
+	// stale CSS is refreshed before responding, at most once a day.
+	runtimeCSS = refreshcache.New(refreshcache.Options{
+		Loader:   fetchRuntimeCSS,
+		Store:    &refreshcache.AppEngineStore{Namespace: "optimizer"},
+		FreshFor: RUNTIME_CSS_FRESH_FOR,
+		Revalidate: func(ctx context.Context, key string, stale *refreshcache.Entry) {
+			if err := runtimeCSS.Refresh(ctx, key); err != nil {
+				log.Printf("Failed to refresh the AMP runtime CSS: %v", err)
+			}
+		},
+	})
+}
+
+// shouldOptimize reports whether the AMP document requested by r is served
+// optimized. ?optimize=1 and ?optimize=0 override the configured default.
+func shouldOptimize(cfg *config.Config, r *http.Request) bool {
+	switch r.URL.Query().Get(OPTIMIZE_PARAM) {
+	case "1", "true":
+		return true
+	case "0", "false":
+		return false
+	}
+	return cfg.Features.Optimizer
+}
+
+// serveOptimized writes the optimized version of the AMP document requested
+// by r. It returns false if nothing was written, the caller should serve the
+// original document then.
+func serveOptimized(cfg *config.Config, w http.ResponseWriter, r *http.Request) bool {
+	body, err := optimizedDocumentBody(appengine.NewContext(r), distFilePath(cfg.DistDir, r.URL.Path))
+	if err != nil {
+		log.Printf("Failed to optimize [%s]: %v", r.URL.Path, err)
+		return false
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(body)
+	return true
+}
+
+func optimizedDocumentBody(ctx context.Context, filePath string) ([]byte, error) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return nil, err
+	}
+	css, err := runtimeCSS.Get(ctx, RUNTIME_CSS_CACHE_KEY)
+	if err != nil {
+		// Still worth it, only the boilerplate stays.
+		log.Printf("AMP runtime CSS unavailable: %v", err)
+	}
+
+	optimizedDocuments.Lock()
+	doc, ok := optimizedDocuments.m[filePath]
+	optimizedDocuments.Unlock()
+	if ok && doc.modTime.Equal(info.ModTime()) && doc.withCSS == (css != nil) {
+		return doc.body, nil
+	}
+
+	original, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	body, err := optimizer.Transform(original, optimizer.Options{RuntimeCSS: string(css)})
+	if err != nil {
+		return nil, err
+	}
+	optimizedDocuments.Lock()
+	optimizedDocuments.m[filePath] = &optimizedDocument{
+		modTime: info.ModTime(),
+		withCSS: css != nil,
+		body:    body,
+	}
+	optimizedDocuments.Unlock()
+	return body, nil
+}
+
+func fetchRuntimeCSS(ctx context.Context, key string) ([]byte, error) {
+	resp, err := urlfetch.Client(ctx).Get(optimizer.RUNTIME_CSS_URL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: %s", optimizer.RUNTIME_CSS_URL, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
@@ -0,0 +1,106 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package optimizer
+
+import (
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Position of the elements in the optimized head, following the AMP
+// recommendations.
+const (
+	HEAD_META_CHARSET = iota
+	HEAD_RUNTIME_STYLE
+	HEAD_META
+	HEAD_RUNTIME_SCRIPT
+	HEAD_RENDER_DELAYING_SCRIPT
+	HEAD_EXTENSION_SCRIPT
+	HEAD_RESOURCE_HINT
+	HEAD_FONT_STYLESHEET
+	HEAD_CUSTOM_STYLE
+	HEAD_OTHER
+	HEAD_BOILERPLATE
+)
+
+// reorderHead sorts the elements of head. Elements of the same kind keep
+// their order and white space between elements is dropped.
+func reorderHead(head *html.Node) {
+	var children []*html.Node
+	for c := head.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.TextNode && strings.TrimSpace(c.Data) == "" {
+			continue
+		}
+		children = append(children, c)
+	}
+	for _, c := range children {
+		if c.Parent == head {
+			head.RemoveChild(c)
+		}
+	}
+	for head.FirstChild != nil {
+		head.RemoveChild(head.FirstChild)
+	}
+	sort.SliceStable(children, func(i, j int) bool {
+		return headPosition(children[i]) < headPosition(children[j])
+	})
+	for _, c := range children {
+		head.AppendChild(c)
+	}
+}
+
+func headPosition(n *html.Node) int {
+	if n.Type != html.ElementNode {
+		return HEAD_OTHER
+	}
+	switch n.DataAtom {
+	case atom.Meta:
+		if hasAttr(n, "charset") {
+			return HEAD_META_CHARSET
+		}
+		return HEAD_META
+	case atom.Style:
+		switch {
+		case hasAttr(n, "amp-runtime"):
+			return HEAD_RUNTIME_STYLE
+		case hasAttr(n, "amp-custom"):
+			return HEAD_CUSTOM_STYLE
+		case hasAttr(n, "amp-boilerplate"):
+			return HEAD_BOILERPLATE
+		}
+	case atom.Noscript:
+		return HEAD_BOILERPLATE
+	case atom.Script:
+		switch {
+		case getAttr(n, "src") == RUNTIME_URL:
+			return HEAD_RUNTIME_SCRIPT
+		case renderDelayingExtensions[getAttr(n, "custom-element")]:
+			return HEAD_RENDER_DELAYING_SCRIPT
+		case hasAttr(n, "custom-element") || hasAttr(n, "custom-template"):
+			return HEAD_EXTENSION_SCRIPT
+		}
+	case atom.Link:
+		switch strings.ToLower(getAttr(n, "rel")) {
+		case "preload", "prefetch", "preconnect", "dns-prefetch":
+			return HEAD_RESOURCE_HINT
+		case "stylesheet":
+			return HEAD_FONT_STYLESHEET
+		}
+	}
+	return HEAD_OTHER
+}
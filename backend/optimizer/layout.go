@@ -0,0 +1,167 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package optimizer
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	LAYOUT_NODISPLAY    = "nodisplay"
+	LAYOUT_FIXED        = "fixed"
+	LAYOUT_FIXED_HEIGHT = "fixed-height"
+	LAYOUT_RESPONSIVE   = "responsive"
+	LAYOUT_CONTAINER    = "container"
+	LAYOUT_FILL         = "fill"
+	LAYOUT_FLEX_ITEM    = "flex-item"
+)
+
+var lengthRegex = regexp.MustCompile(`^(\d+(?:\.\d+)?|\.\d+)(px|em|rem|vh|vw|vmin|vmax)?$`)
+
+// Components without a layout of their own.
+var nonVisualElements = map[string]bool{
+	"amp-analytics":             true,
+	"amp-animation":             true,
+	"amp-bind-macro":            true,
+	"amp-experiment":            true,
+	"amp-install-serviceworker": true,
+	"amp-pixel":                 true,
+	"amp-state":                 true,
+	"amp-story-auto-ads":        true,
+}
+
+// Layouts with a size known before the component loaded.
+var sizeDefinedLayouts = map[string]bool{
+	LAYOUT_FIXED:        true,
+	LAYOUT_FIXED_HEIGHT: true,
+	LAYOUT_RESPONSIVE:   true,
+	LAYOUT_FILL:         true,
+	LAYOUT_FLEX_ITEM:    true,
+}
+
+type length struct {
+	value float64
+	unit  string
+}
+
+func (l length) String() string {
+	return strconv.FormatFloat(l.value, 'f', -1, 64) + l.unit
+}
+
+// parseLength reads a CSS length. ok is false for missing and "auto".
+func parseLength(s string) (length, bool) {
+	groups := lengthRegex.FindStringSubmatch(strings.TrimSpace(s))
+	if groups == nil {
+		return length{}, false
+	}
+	value, err := strconv.ParseFloat(groups[1], 64)
+	if err != nil {
+		return length{}, false
+	}
+	unit := groups[2]
+	if unit == "" {
+		unit = "px"
+	}
+	return length{value, unit}, true
+}
+
+// renderLayouts applies the layout of every AMP component below n like the
+// runtime would. It reports whether all components could be rendered, which
+// is needed to remove the boilerplate.
+func renderLayouts(n *html.Node) bool {
+	safe := true
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode || c.Data == "template" {
+			continue
+		}
+		if isAMPElement(c) && !nonVisualElements[c.Data] && !hasAttr(c, LAYOUT_ATTRIBUTE) {
+			if !renderLayout(c) {
+				safe = false
+			}
+		}
+		if !renderLayouts(c) {
+			safe = false
+		}
+	}
+	return safe
+}
+
+// renderLayout sets the layout classes, sizes and sizer of a component.
+func renderLayout(n *html.Node) bool {
+	// These depend on media queries evaluated by the runtime.
+	if hasAttr(n, "heights") || hasAttr(n, "media") || hasAttr(n, "sizes") {
+		return false
+	}
+	width, hasWidth := parseLength(getAttr(n, "width"))
+	height, hasHeight := parseLength(getAttr(n, "height"))
+	layout := strings.ToLower(getAttr(n, "layout"))
+	if layout == "" {
+		switch {
+		case !hasAttr(n, "width") && !hasAttr(n, "height"):
+			layout = LAYOUT_CONTAINER
+		case hasHeight && (!hasAttr(n, "width") || getAttr(n, "width") == "auto"):
+			layout = LAYOUT_FIXED_HEIGHT
+		default:
+			layout = LAYOUT_FIXED
+		}
+	}
+
+	var style string
+	switch layout {
+	case LAYOUT_NODISPLAY:
+		setAttr(n, "hidden", "")
+	case LAYOUT_FIXED:
+		if !hasWidth || !hasHeight {
+			return false
+		}
+		style = "width:" + width.String() + ";height:" + height.String() + ";"
+	case LAYOUT_FIXED_HEIGHT:
+		if !hasHeight {
+			return false
+		}
+		style = "height:" + height.String() + ";"
+	case LAYOUT_RESPONSIVE:
+		if !hasWidth || !hasHeight || width.unit != height.unit || width.value == 0 {
+			return false
+		}
+		padding := strconv.FormatFloat(height.value/width.value*100, 'f', 4, 64)
+		padding = strings.TrimRight(strings.TrimRight(padding, "0"), ".")
+		sizer := &html.Node{Type: html.ElementNode, Data: "i-amphtml-sizer"}
+		sizer.Attr = []html.Attribute{{Key: "style", Val: "display:block;padding-top:" + padding + "%;"}}
+		n.InsertBefore(sizer, n.FirstChild)
+	case LAYOUT_CONTAINER, LAYOUT_FILL, LAYOUT_FLEX_ITEM:
+	default:
+		// intrinsic needs an image sizer, unknown layouts are invalid.
+		return false
+	}
+
+	classes := "i-amphtml-layout-" + layout
+	if sizeDefinedLayouts[layout] {
+		classes += " i-amphtml-layout-size-defined"
+	}
+	if existing := getAttr(n, "class"); existing != "" {
+		classes = existing + " " + classes
+	}
+	setAttr(n, "class", classes)
+	if style != "" {
+		setAttr(n, "style", style+getAttr(n, "style"))
+	}
+	setAttr(n, LAYOUT_ATTRIBUTE, layout)
+	return true
+}
@@ -0,0 +1,206 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package optimizer applies the AMP optimizer transformations to a
+// document: the head is reordered, the runtime and extensions are
+// preloaded, layouts are rendered on the server and the boilerplate is
+// removed if that is safe.
+package optimizer
+
+import (
+	"bytes"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const (
+	TRANSFORMED        = "self;v=1"
+	RUNTIME_URL        = "https://cdn.ampproject.org/v0.js"
+	RUNTIME_CSS_URL    = "https://cdn.ampproject.org/v0.css"
+	NO_BOILERPLATE     = "i-amphtml-no-boilerplate"
+	LAYOUT_ATTRIBUTE   = "i-amphtml-layout"
+	AMP_ELEMENT_PREFIX = "amp-"
+)
+
+// Extensions that hide the document until they ran, the boilerplate has to
+// stay for them.
+var renderDelayingExtensions = map[string]bool{
+	"amp-dynamic-css-classes": true,
+	"amp-experiment":          true,
+	"amp-story":               true,
+}
+
+type Options struct {
+	// Contents of v0.css. The boilerplate is only removed if this is set.
+	RuntimeCSS string
+}
+
+// Transform returns the optimized document. Documents that were transformed
+// already are returned as they are.
+func Transform(doc []byte, opts Options) ([]byte, error) {
+	root, err := html.Parse(bytes.NewReader(doc))
+	if err != nil {
+		return nil, err
+	}
+	htmlNode := findElement(root, atom.Html)
+	head := findElement(root, atom.Head)
+	body := findElement(root, atom.Body)
+	if htmlNode == nil || head == nil || body == nil || hasAttr(htmlNode, "transformed") {
+		return doc, nil
+	}
+
+	safe := renderLayouts(body)
+	extensions := extensionScripts(head)
+	for _, ext := range extensions {
+		if renderDelayingExtensions[getAttr(ext, "custom-element")] {
+			safe = false
+		}
+	}
+	if safe && opts.RuntimeCSS != "" {
+		removeBoilerplate(head)
+		insertRuntimeCSS(head, opts.RuntimeCSS)
+		setAttr(htmlNode, NO_BOILERPLATE, "")
+	}
+	preloadScripts(head, extensions)
+	reorderHead(head)
+	setAttr(htmlNode, "transformed", TRANSFORMED)
+
+	var out bytes.Buffer
+	if err := html.Render(&out, root); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func findElement(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findElement(c, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func isAMPElement(n *html.Node) bool {
+	return n.Type == html.ElementNode && strings.HasPrefix(n.Data, AMP_ELEMENT_PREFIX)
+}
+
+func getAttr(n *html.Node, key string) string {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+func hasAttr(n *html.Node, key string) bool {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+func setAttr(n *html.Node, key string, value string) {
+	for i, attr := range n.Attr {
+		if attr.Key == key {
+			n.Attr[i].Val = value
+			return
+		}
+	}
+	n.Attr = append(n.Attr, html.Attribute{Key: key, Val: value})
+}
+
+func newElement(a atom.Atom, attrs ...string) *html.Node {
+	n := &html.Node{Type: html.ElementNode, DataAtom: a, Data: a.String()}
+	for i := 0; i+1 < len(attrs); i += 2 {
+		n.Attr = append(n.Attr, html.Attribute{Key: attrs[i], Val: attrs[i+1]})
+	}
+	return n
+}
+
+// extensionScripts returns the extension and template scripts in head.
+func extensionScripts(head *html.Node) []*html.Node {
+	var scripts []*html.Node
+	for c := head.FirstChild; c != nil; c = c.NextSibling {
+		if c.DataAtom == atom.Script && (hasAttr(c, "custom-element") || hasAttr(c, "custom-template")) {
+			scripts = append(scripts, c)
+		}
+	}
+	return scripts
+}
+
+// removeBoilerplate removes <style amp-boilerplate> and the <noscript>
+// around its fallback.
+func removeBoilerplate(head *html.Node) {
+	for c := head.FirstChild; c != nil; {
+		next := c.NextSibling
+		switch {
+		case c.DataAtom == atom.Style && hasAttr(c, "amp-boilerplate"):
+			head.RemoveChild(c)
+		case c.DataAtom == atom.Noscript && strings.Contains(textContent(c), "amp-boilerplate"):
+			// With scripting enabled, the parser keeps the contents of
+			// <noscript> as text.
+			head.RemoveChild(c)
+		}
+		c = next
+	}
+}
+
+func textContent(n *html.Node) string {
+	var s bytes.Buffer
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.TextNode {
+			s.WriteString(c.Data)
+		} else {
+			s.WriteString(textContent(c))
+		}
+	}
+	return s.String()
+}
+
+// insertRuntimeCSS inlines v0.css, which the runtime would otherwise add
+// once it loaded.
+func insertRuntimeCSS(head *html.Node, css string) {
+	style := newElement(atom.Style, "amp-runtime", "")
+	style.AppendChild(&html.Node{Type: html.TextNode, Data: css})
+	head.AppendChild(style)
+}
+
+// preloadScripts adds <link rel=preload> for the runtime and extensions.
+func preloadScripts(head *html.Node, extensions []*html.Node) {
+	urls := []string{RUNTIME_URL}
+	for _, ext := range extensions {
+		urls = append(urls, getAttr(ext, "src"))
+	}
+	preloaded := make(map[string]bool)
+	for c := head.FirstChild; c != nil; c = c.NextSibling {
+		if c.DataAtom == atom.Link && strings.EqualFold(getAttr(c, "rel"), "preload") {
+			preloaded[getAttr(c, "href")] = true
+		}
+	}
+	for _, url := range urls {
+		if url != "" && !preloaded[url] {
+			head.AppendChild(newElement(atom.Link, "rel", "preload", "href", url, "as", "script"))
+			preloaded[url] = true
+		}
+	}
+}
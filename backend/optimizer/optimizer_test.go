@@ -0,0 +1,122 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package optimizer
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Run "go test -update" after changing the optimizer and review the diff of
+// the .golden files.
+var update = flag.Bool("update", false, "update the .golden files")
+
+const testRuntimeCSS = "html{overflow-x:hidden!important}"
+
+func TestTransformGolden(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "*.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) == 0 {
+		t.Fatal("no test documents in testdata")
+	}
+	for _, input := range inputs {
+		doc, err := ioutil.ReadFile(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := Transform(doc, Options{RuntimeCSS: testRuntimeCSS})
+		if err != nil {
+			t.Errorf("%s: %v", input, err)
+			continue
+		}
+		golden := strings.TrimSuffix(input, ".html") + ".golden"
+		if *update {
+			if err := ioutil.WriteFile(golden, got, 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		want, err := ioutil.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: got\n%s\nwant\n%s", input, got, want)
+		}
+	}
+}
+
+// The golden files are the only place the boilerplate decision shows up, so
+// check it explicitly as well.
+func TestBoilerplateRemoval(t *testing.T) {
+	tests := []struct {
+		input   string
+		opts    Options
+		removed bool
+	}{
+		{"ssr-layouts.html", Options{RuntimeCSS: testRuntimeCSS}, true},
+		// Without v0.css the runtime styles can't be inlined.
+		{"ssr-layouts.html", Options{}, false},
+		{"head-reordering.html", Options{RuntimeCSS: testRuntimeCSS}, false},
+		{"boilerplate-kept-sizes.html", Options{RuntimeCSS: testRuntimeCSS}, false},
+		{"boilerplate-kept-story.html", Options{RuntimeCSS: testRuntimeCSS}, false},
+		{"boilerplate-kept-intrinsic.html", Options{RuntimeCSS: testRuntimeCSS}, false},
+	}
+	for _, test := range tests {
+		doc, err := ioutil.ReadFile(filepath.Join("testdata", test.input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := Transform(doc, test.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		removed := !bytes.Contains(out, []byte("amp-boilerplate"))
+		if removed != test.removed || bytes.Contains(out, []byte(NO_BOILERPLATE)) != test.removed ||
+			bytes.Contains(out, []byte("<style amp-runtime")) != test.removed {
+			t.Errorf("%s with %+v: boilerplate removed %v, want %v", test.input, test.opts, removed, test.removed)
+		}
+		if !bytes.Contains(out, []byte(`transformed="`+TRANSFORMED+`"`)) {
+			t.Errorf("%s: transformed attribute missing", test.input)
+		}
+	}
+}
+
+func TestParseLength(t *testing.T) {
+	tests := []struct {
+		s    string
+		want length
+		ok   bool
+	}{
+		{"100", length{100, "px"}, true},
+		{" 1.5em ", length{1.5, "em"}, true},
+		{".5vw", length{0.5, "vw"}, true},
+		{"auto", length{}, false},
+		{"", length{}, false},
+		{"10%", length{}, false},
+		{"-1", length{}, false},
+	}
+	for _, test := range tests {
+		got, ok := parseLength(test.s)
+		if got != test.want || ok != test.ok {
+			t.Errorf("parseLength(%q) = %v, %v, want %v, %v", test.s, got, ok, test.want, test.ok)
+		}
+	}
+}
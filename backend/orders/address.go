@@ -0,0 +1,117 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// Package orders validates addresses, prices carts with tax and shipping
+// and keeps the orders placed in the checkout sample.
+package orders
+
+import (
+	"regexp"
+	"strings"
+)
+
+type Address struct {
+	Name    string `json:"name"`
+	Street  string `json:"street"`
+	City    string `json:"city"`
+	State   string `json:"state"`
+	Zip     string `json:"zip"`
+	Country string `json:"country"`
+}
+
+// FieldError is a problem with one field of a form.
+type FieldError struct {
+	Name    string `json:"name"`
+	Message string `json:"message"`
+}
+
+// Country names users commonly enter, by ISO 3166 code.
+var countryNames = map[string]string{
+	"US":             "US",
+	"USA":            "US",
+	"UNITED STATES":  "US",
+	"CA":             "CA",
+	"CANADA":         "CA",
+	"GB":             "GB",
+	"UK":             "GB",
+	"UNITED KINGDOM": "GB",
+	"DE":             "DE",
+	"GERMANY":        "DE",
+	"FR":             "FR",
+	"FRANCE":         "FR",
+}
+
+var postalCodes = map[string]*regexp.Regexp{
+	"US": regexp.MustCompile(`^\d{5}(-\d{4})?$`),
+	"CA": regexp.MustCompile(`^[A-Z]\d[A-Z] ?\d[A-Z]\d$`),
+	"GB": regexp.MustCompile(`^[A-Z]{1,2}\d[A-Z\d]? ?\d[A-Z]{2}$`),
+	"DE": regexp.MustCompile(`^\d{5}$`),
+	"FR": regexp.MustCompile(`^\d{5}$`),
+}
+
+var usStates = toSet("AL AK AZ AR CA CO CT DE DC FL GA HI ID IL IN IA KS KY LA ME MD MA MI MN MS MO MT NE NV NH NJ NM NY NC ND OH OK OR PA RI SC SD TN TX UT VT VA WA WV WI WY AS GU MP PR VI")
+
+func toSet(s string) map[string]bool {
+	set := make(map[string]bool)
+	for _, v := range strings.Fields(s) {
+		set[v] = true
+	}
+	return set
+}
+
+// Normalize trims all fields and replaces country names by their code.
+func (a *Address) Normalize() {
+	a.Name = strings.TrimSpace(a.Name)
+	a.Street = strings.TrimSpace(a.Street)
+	a.City = strings.TrimSpace(a.City)
+	a.State = strings.ToUpper(strings.TrimSpace(a.State))
+	a.Zip = strings.ToUpper(strings.TrimSpace(a.Zip))
+	a.Country = strings.ToUpper(strings.TrimSpace(a.Country))
+	if code, ok := countryNames[a.Country]; ok {
+		a.Country = code
+	}
+}
+
+// Validate normalizes a and returns its problems. FieldError.Name is the
+// lower case field name, e.g. "zip".
+func (a *Address) Validate() []FieldError {
+	a.Normalize()
+	var errors []FieldError
+	required := []struct {
+		name  string
+		value string
+	}{
+		{"street", a.Street},
+		{"city", a.City},
+		{"zip", a.Zip},
+		{"country", a.Country},
+	}
+	for _, field := range required {
+		if field.value == "" {
+			errors = append(errors, FieldError{field.name, "Please fill in this field."})
+		}
+	}
+	if a.Country == "" {
+		return errors
+	}
+	if _, ok := postalCodes[a.Country]; !ok {
+		return append(errors, FieldError{"country", "Sorry, we don't ship to " + a.Country + "."})
+	}
+	if a.Zip != "" && !postalCodes[a.Country].MatchString(a.Zip) {
+		errors = append(errors, FieldError{"zip", "This isn't a valid postal code for " + a.Country + "."})
+	}
+	if a.Country == "US" && !usStates[a.State] {
+		errors = append(errors, FieldError{"state", "Please enter a two letter state code, e.g. NY."})
+	}
+	return errors
+}
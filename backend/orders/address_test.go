@@ -0,0 +1,90 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package orders
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		address Address
+		want    Address
+		errors  []FieldError
+	}{
+		{
+			Address{Street: " 1 Main St ", City: "Springfield", State: "ny", Zip: "12345", Country: "usa"},
+			Address{Street: "1 Main St", City: "Springfield", State: "NY", Zip: "12345", Country: "US"},
+			nil,
+		},
+		{
+			Address{Street: "1 Main St", City: "Springfield", State: "NY", Zip: "12345-6789", Country: "US"},
+			Address{Street: "1 Main St", City: "Springfield", State: "NY", Zip: "12345-6789", Country: "US"},
+			nil,
+		},
+		{
+			Address{Street: "10 Downing St", City: "London", Zip: "sw1a 2aa", Country: "United Kingdom"},
+			Address{Street: "10 Downing St", City: "London", Zip: "SW1A 2AA", Country: "GB"},
+			nil,
+		},
+		{
+			Address{Street: "1 Rue", City: "Toronto", Zip: "M5V3L9", Country: "canada"},
+			Address{Street: "1 Rue", City: "Toronto", Zip: "M5V3L9", Country: "CA"},
+			nil,
+		},
+		{
+			Address{Street: "1 Main St", City: "Springfield", State: "New York", Zip: "1234", Country: "US"},
+			Address{Street: "1 Main St", City: "Springfield", State: "NEW YORK", Zip: "1234", Country: "US"},
+			[]FieldError{
+				{"zip", "This isn't a valid postal code for US."},
+				{"state", "Please enter a two letter state code, e.g. NY."},
+			},
+		},
+		{
+			Address{Street: "1 Main St", City: "Tokyo", Zip: "100-0001", Country: "Japan"},
+			Address{Street: "1 Main St", City: "Tokyo", Zip: "100-0001", Country: "JAPAN"},
+			[]FieldError{{"country", "Sorry, we don't ship to JAPAN."}},
+		},
+		{
+			Address{Street: "  ", Country: "DE"},
+			Address{Country: "DE"},
+			[]FieldError{
+				{"street", "Please fill in this field."},
+				{"city", "Please fill in this field."},
+				{"zip", "Please fill in this field."},
+			},
+		},
+		{
+			Address{},
+			Address{},
+			[]FieldError{
+				{"street", "Please fill in this field."},
+				{"city", "Please fill in this field."},
+				{"zip", "Please fill in this field."},
+				{"country", "Please fill in this field."},
+			},
+		},
+	}
+	for _, test := range tests {
+		address := test.address
+		errors := address.Validate()
+		if !reflect.DeepEqual(errors, test.errors) {
+			t.Errorf("Validate(%+v) = %v, want %v", test.address, errors, test.errors)
+		}
+		if address != test.want {
+			t.Errorf("Validate(%+v) normalized to %+v, want %+v", test.address, address, test.want)
+		}
+	}
+}
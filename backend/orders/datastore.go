@@ -0,0 +1,178 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package orders
+
+import (
+	"bytes"
+	"encoding/gob"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/datastore"
+)
+
+const (
+	ORDER_KIND     = "Order"
+	ORDER_KEY_KIND = "OrderIdempotencyKey"
+	// Time after which a key whose order was never stored, e.g. because the
+	// instance placing it went away, can be used again.
+	PENDING_TIMEOUT = time.Minute
+)
+
+// DatastoreStore keeps orders by ID and reserves idempotency keys in a
+// transaction before the order is created, so that only one instance
+// creates the order for a key.
+type DatastoreStore struct{}
+
+// The order is gob encoded, as datastore can't store its nested slices.
+type orderEntity struct {
+	Order   []byte `datastore:",noindex"`
+	Created time.Time
+}
+
+type keyEntity struct {
+	OrderID     string `datastore:",noindex"`
+	Fingerprint string `datastore:",noindex"`
+	// Whether the order was stored.
+	Placed  bool      `datastore:",noindex"`
+	Created time.Time `datastore:",noindex"`
+}
+
+func (s *DatastoreStore) Place(ctx context.Context, key string, fingerprint string, create func() (*Order, error)) (*Order, bool, error) {
+	id, err := newID()
+	if err != nil {
+		return nil, false, err
+	}
+	if key == "" {
+		order, err := create()
+		if err != nil {
+			return nil, false, err
+		}
+		order.ID = id
+		order.Created = time.Now()
+		_, err = datastore.Put(ctx, orderKey(ctx, id), newOrderEntity(order))
+		return order, false, err
+	}
+
+	reservationKey := datastore.NewKey(ctx, ORDER_KEY_KIND, key, 0, nil)
+	var reservation keyEntity
+	replayed := false
+	err = datastore.RunInTransaction(ctx, func(tc context.Context) error {
+		replayed = false
+		err := datastore.Get(tc, reservationKey, &reservation)
+		switch {
+		case err == datastore.ErrNoSuchEntity:
+		case err != nil:
+			return err
+		case reservation.Fingerprint != fingerprint:
+			return ErrConflict
+		case reservation.Placed || time.Since(reservation.Created) < PENDING_TIMEOUT:
+			replayed = true
+			return nil
+		}
+		reservation = keyEntity{OrderID: id, Fingerprint: fingerprint, Created: time.Now()}
+		_, err = datastore.Put(tc, reservationKey, &reservation)
+		return err
+	}, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	if replayed {
+		if !reservation.Placed {
+			return nil, false, ErrPending
+		}
+		order, err := s.Get(ctx, reservation.OrderID)
+		return order, err == nil, err
+	}
+
+	order, err := create()
+	if err != nil {
+		// Let the key be used again, unless another request took it over.
+		datastore.RunInTransaction(ctx, func(tc context.Context) error {
+			var current keyEntity
+			if err := datastore.Get(tc, reservationKey, &current); err != nil || current.OrderID != id {
+				return err
+			}
+			return datastore.Delete(tc, reservationKey)
+		}, nil)
+		return nil, false, err
+	}
+	order.ID = id
+	order.Created = time.Now()
+	reservation.Placed = true
+	err = datastore.RunInTransaction(ctx, func(tc context.Context) error {
+		if _, err := datastore.Put(tc, orderKey(tc, id), newOrderEntity(order)); err != nil {
+			return err
+		}
+		_, err := datastore.Put(tc, reservationKey, &reservation)
+		return err
+	}, &datastore.TransactionOptions{XG: true})
+	if err != nil {
+		return nil, false, err
+	}
+	return order, false, nil
+}
+
+func (s *DatastoreStore) Get(ctx context.Context, id string) (*Order, error) {
+	return getOrder(ctx, id)
+}
+
+func (s *DatastoreStore) Update(ctx context.Context, id string, update func(*Order)) (*Order, error) {
+	var result *Order
+	err := datastore.RunInTransaction(ctx, func(tc context.Context) error {
+		order, err := getOrder(tc, id)
+		if err != nil {
+			return err
+		}
+		update(order)
+		if _, err := datastore.Put(tc, orderKey(tc, id), newOrderEntity(order)); err != nil {
+			return err
+		}
+		result = order
+		return nil
+	}, nil)
+	return result, err
+}
+
+func orderKey(ctx context.Context, id string) *datastore.Key {
+	return datastore.NewKey(ctx, ORDER_KIND, id, 0, nil)
+}
+
+func newOrderEntity(order *Order) *orderEntity {
+	var data bytes.Buffer
+	// Orders only hold types gob can encode.
+	if err := gob.NewEncoder(&data).Encode(order); err != nil {
+		panic(err)
+	}
+	return &orderEntity{Order: data.Bytes(), Created: order.Created}
+}
+
+func getOrder(ctx context.Context, id string) (*Order, error) {
+	if id == "" {
+		return nil, ErrNotFound
+	}
+	var entity orderEntity
+	err := datastore.Get(ctx, orderKey(ctx, id), &entity)
+	if err == datastore.ErrNoSuchEntity {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var order Order
+	if err := gob.NewDecoder(bytes.NewReader(entity.Order)).Decode(&order); err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
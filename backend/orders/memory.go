@@ -0,0 +1,118 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package orders
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// MemoryStore keeps the latest orders in memory and remembers the
+// idempotency key each was placed with. It is meant for the development
+// server, where all requests go to one instance.
+type MemoryStore struct {
+	MaxOrders int
+
+	lock   sync.Mutex
+	orders map[string]*Order
+	// Order IDs, oldest first.
+	ids  []string
+	keys map[string]placed
+}
+
+type placed struct {
+	orderID     string
+	fingerprint string
+}
+
+func NewMemoryStore(maxOrders int) *MemoryStore {
+	return &MemoryStore{
+		MaxOrders: maxOrders,
+		orders:    make(map[string]*Order),
+		keys:      make(map[string]placed),
+	}
+}
+
+// Place creates the order while the store is locked, so requests with the
+// same key wait for each other. Keys are forgotten with their order.
+func (s *MemoryStore) Place(ctx context.Context, key string, fingerprint string, create func() (*Order, error)) (order *Order, replayed bool, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if p, ok := s.keys[key]; ok && key != "" {
+		if p.fingerprint != fingerprint {
+			return nil, false, ErrConflict
+		}
+		if order, ok := s.orders[p.orderID]; ok {
+			copy := *order
+			return &copy, true, nil
+		}
+	}
+
+	order, err = create()
+	if err != nil {
+		return nil, false, err
+	}
+	order.ID, err = newID()
+	if err != nil {
+		return nil, false, err
+	}
+	order.Created = time.Now()
+	s.orders[order.ID] = order
+	s.ids = append(s.ids, order.ID)
+	if key != "" {
+		s.keys[key] = placed{order.ID, fingerprint}
+	}
+	for s.MaxOrders > 0 && len(s.ids) > s.MaxOrders {
+		s.evict(s.ids[0])
+		s.ids = s.ids[1:]
+	}
+	copy := *order
+	return &copy, false, nil
+}
+
+// evict needs s to be locked.
+func (s *MemoryStore) evict(id string) {
+	delete(s.orders, id)
+	for key, p := range s.keys {
+		if p.orderID == id {
+			delete(s.keys, key)
+		}
+	}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id string) (*Order, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	order, ok := s.orders[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	copy := *order
+	return &copy, nil
+}
+
+// Update calls update while the store is locked, so it is only called once.
+func (s *MemoryStore) Update(ctx context.Context, id string, update func(*Order)) (*Order, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	order, ok := s.orders[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	update(order)
+	copy := *order
+	return &copy, nil
+}
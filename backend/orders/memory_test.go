@@ -0,0 +1,148 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package orders
+
+import (
+	"errors"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+// creator returns orders for Place and counts the calls.
+type creator struct {
+	calls int
+	err   error
+}
+
+func (c *creator) create() (*Order, error) {
+	c.calls++
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &Order{Name: "Ada", Total: 1000}, nil
+}
+
+func TestPlaceReplay(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(10)
+	c := &creator{}
+
+	first, replayed, err := store.Place(ctx, "client:key", "form", c.create)
+	if err != nil || replayed {
+		t.Fatalf("Place = %v, %v, want a new order", replayed, err)
+	}
+	if first.ID == "" || first.Created.IsZero() {
+		t.Errorf("order ID %q created %v, want both set", first.ID, first.Created)
+	}
+	second, replayed, err := store.Place(ctx, "client:key", "form", c.create)
+	if err != nil || !replayed || second.ID != first.ID {
+		t.Errorf("Place again = %v, %v, %v, want order %s replayed", second, replayed, err, first.ID)
+	}
+	if c.calls != 1 {
+		t.Errorf("create called %d times, want 1", c.calls)
+	}
+
+	// Replays are copies.
+	second.Name = "changed"
+	if stored, _ := store.Get(ctx, first.ID); stored.Name != "Ada" {
+		t.Errorf("stored order changed through a replay to %q", stored.Name)
+	}
+
+	// Without a key, every call places an order.
+	for i := 0; i < 2; i++ {
+		if _, replayed, err := store.Place(ctx, "", "form", c.create); err != nil || replayed {
+			t.Errorf("Place without key = %v, %v, want a new order", replayed, err)
+		}
+	}
+	if c.calls != 3 {
+		t.Errorf("create called %d times, want 3", c.calls)
+	}
+}
+
+func TestPlaceConflict(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(10)
+	c := &creator{}
+	if _, _, err := store.Place(ctx, "client:key", "form", c.create); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := store.Place(ctx, "client:key", "other form", c.create); err != ErrConflict {
+		t.Errorf("Place with another fingerprint = %v, want ErrConflict", err)
+	}
+	if _, replayed, err := store.Place(ctx, "other:key", "other form", c.create); err != nil || replayed {
+		t.Errorf("Place with another key = %v, %v, want a new order", replayed, err)
+	}
+}
+
+func TestPlaceCreateError(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(10)
+	failure := errors.New("code used up")
+	c := &creator{err: failure}
+	if _, _, err := store.Place(ctx, "client:key", "form", c.create); err != failure {
+		t.Fatalf("Place = %v, want %v", err, failure)
+	}
+	// The key can be used again once create succeeds.
+	c.err = nil
+	if _, replayed, err := store.Place(ctx, "client:key", "form", c.create); err != nil || replayed {
+		t.Errorf("Place after failure = %v, %v, want a new order", replayed, err)
+	}
+}
+
+func TestPlaceEviction(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(2)
+	c := &creator{}
+	var ids []string
+	for _, key := range []string{"a", "b", "c"} {
+		order, _, err := store.Place(ctx, key, "form", c.create)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, order.ID)
+	}
+	if _, err := store.Get(ctx, ids[0]); err != ErrNotFound {
+		t.Errorf("Get(oldest) = %v, want ErrNotFound", err)
+	}
+	for _, id := range ids[1:] {
+		if _, err := store.Get(ctx, id); err != nil {
+			t.Errorf("Get(%s) = %v", id, err)
+		}
+	}
+	// The key of an evicted order is forgotten with it.
+	order, replayed, err := store.Place(ctx, "a", "other form", c.create)
+	if err != nil || replayed || order.ID == ids[0] {
+		t.Errorf("Place with evicted key = %v, %v, want a new order", replayed, err)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(10)
+	order, _, err := store.Place(ctx, "", "", (&creator{}).create)
+	if err != nil {
+		t.Fatal(err)
+	}
+	updated, err := store.Update(ctx, order.ID, func(o *Order) { o.PaymentStatus = "succeeded" })
+	if err != nil || updated.PaymentStatus != "succeeded" {
+		t.Fatalf("Update = %v, %v", updated, err)
+	}
+	if stored, _ := store.Get(ctx, order.ID); stored.PaymentStatus != "succeeded" {
+		t.Errorf("stored status %q, want succeeded", stored.PaymentStatus)
+	}
+	if _, err := store.Update(ctx, "missing", func(o *Order) { t.Error("update called for a missing order") }); err != ErrNotFound {
+		t.Errorf("Update(missing) = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package orders
+
+import (
+	"backend/money"
+)
+
+// Rules price the shipping and tax of an order, see config.CheckoutConfig.
+type Rules struct {
+	// Basis points by "<country>-<region>", "<country>" or "*".
+	TaxRates map[string]int
+	// Cost by country or "*".
+	ShippingRates    map[string]money.Amount
+	FreeShippingOver money.Amount
+}
+
+// Shipping returns the shipping cost to country for an order with
+// subtotal. ok is false if country isn't shipped to.
+func (r *Rules) Shipping(country string, subtotal money.Amount) (cost money.Amount, ok bool) {
+	cost, ok = r.ShippingRates[country]
+	if !ok {
+		cost, ok = r.ShippingRates["*"]
+	}
+	if !ok {
+		return 0, false
+	}
+	if r.FreeShippingOver > 0 && subtotal >= r.FreeShippingOver {
+		return 0, true
+	}
+	return cost, true
+}
+
+// TaxRate returns the rate in basis points for the address, the most
+// specific rule wins.
+func (r *Rules) TaxRate(a *Address) int {
+	for _, key := range []string{a.Country + "-" + a.State, a.Country, "*"} {
+		if rate, ok := r.TaxRates[key]; ok {
+			return rate
+		}
+	}
+	return 0
+}
+
+// Tax returns the tax on amount shipped to a.
+func (r *Rules) Tax(a *Address, amount money.Amount) money.Amount {
+	return amount.BasisPoints(r.TaxRate(a))
+}
@@ -0,0 +1,81 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package orders
+
+import (
+	"backend/money"
+	"testing"
+)
+
+var testRules = &Rules{
+	TaxRates: map[string]int{
+		"US-NY": 400,
+		"DE":    1900,
+		"*":     100,
+	},
+	ShippingRates: map[string]money.Amount{
+		"US": 499,
+		"*":  1499,
+	},
+	FreeShippingOver: 5000,
+}
+
+func TestShipping(t *testing.T) {
+	tests := []struct {
+		rules    *Rules
+		country  string
+		subtotal money.Amount
+		cost     money.Amount
+		ok       bool
+	}{
+		{testRules, "US", 1000, 499, true},
+		{testRules, "DE", 1000, 1499, true},
+		{testRules, "US", 4999, 499, true},
+		{testRules, "US", 5000, 0, true},
+		{testRules, "DE", 9000, 0, true},
+		{&Rules{ShippingRates: map[string]money.Amount{"US": 499}}, "DE", 1000, 0, false},
+		{&Rules{ShippingRates: map[string]money.Amount{"US": 499}}, "US", 100000, 499, true},
+		{&Rules{}, "US", 1000, 0, false},
+	}
+	for _, test := range tests {
+		cost, ok := test.rules.Shipping(test.country, test.subtotal)
+		if cost != test.cost || ok != test.ok {
+			t.Errorf("Shipping(%s, %v) = %v, %v, want %v, %v", test.country, test.subtotal, cost, ok, test.cost, test.ok)
+		}
+	}
+}
+
+func TestTaxRate(t *testing.T) {
+	tests := []struct {
+		rules   *Rules
+		address Address
+		rate    int
+	}{
+		{testRules, Address{Country: "US", State: "NY"}, 400},
+		{testRules, Address{Country: "US", State: "CA"}, 100},
+		{testRules, Address{Country: "DE", State: "BY"}, 1900},
+		{testRules, Address{Country: "DE"}, 1900},
+		{testRules, Address{Country: "FR"}, 100},
+		{&Rules{TaxRates: map[string]int{"US-NY": 400}}, Address{Country: "US"}, 0},
+		{&Rules{}, Address{Country: "US", State: "NY"}, 0},
+	}
+	for _, test := range tests {
+		if rate := test.rules.TaxRate(&test.address); rate != test.rate {
+			t.Errorf("TaxRate(%+v) = %d, want %d", test.address, rate, test.rate)
+		}
+	}
+	if tax := testRules.Tax(&Address{Country: "US", State: "NY"}, 2500); tax != 100 {
+		t.Errorf("Tax = %v, want 100", tax)
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package orders
+
+import (
+	"backend/items"
+	"backend/money"
+	"backend/promotions"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+var (
+	// ErrConflict means an idempotency key was used again for a different
+	// request.
+	ErrConflict = errors.New("orders: idempotency key reused for a different order")
+	// ErrPending means the order for an idempotency key is still being
+	// placed by another request.
+	ErrPending  = errors.New("orders: order is being placed")
+	ErrNotFound = errors.New("orders: not found")
+)
+
+type Order struct {
+	ID              string                `json:"id"`
+	ClientID        string                `json:"-"`
+	Name            string                `json:"name"`
+	Email           string                `json:"email"`
+	ShippingAddress Address               `json:"shippingAddress"`
+	BillingAddress  Address               `json:"billingAddress"`
+	Items           []promotions.Item     `json:"items"`
+	Discounts       []promotions.Discount `json:"discounts"`
+	Subtotal        money.Amount          `json:"subtotal"`
+	Discount        money.Amount          `json:"discount"`
+	Shipping        money.Amount          `json:"shipping"`
+	Tax             money.Amount          `json:"tax"`
+	Total           money.Amount          `json:"total"`
+	Created         time.Time             `json:"created"`
+	// Payment intent charging the order, see package payments.
+	PaymentIntent string `json:"paymentIntent,omitempty"`
+	PaymentStatus string `json:"paymentStatus,omitempty"`
+	// Why the last payment attempt failed, shown to the customer.
+	PaymentError string `json:"paymentError,omitempty"`
+	// Whether the discount codes count as used. They are given back while
+	// the payment fails.
+	CodesRedeemed bool `json:"-"`
+}
+
+type Store interface {
+	// Place stores the order returned by create and returns a copy of it.
+	// If key was used before with the same fingerprint, the order placed
+	// then is returned instead and replayed is true, so that submitting a
+	// form twice creates one order. An empty key disables the check.
+	Place(ctx context.Context, key string, fingerprint string, create func() (*Order, error)) (order *Order, replayed bool, err error)
+	// Get returns a copy of the order with id, or ErrNotFound.
+	Get(ctx context.Context, id string) (*Order, error)
+	// Update calls update with the order with id, stores the result and
+	// returns a copy of it. update may be called again with a fresh copy
+	// if the write conflicts with another one, so it should only change
+	// the order.
+	Update(ctx context.Context, id string, update func(*Order)) (*Order, error)
+}
+
+// ParseStore returns the order store for spec, see items.UseDatastore. The
+// memory store keeps the latest maxOrders orders.
+func ParseStore(spec string, maxOrders int) Store {
+	if items.UseDatastore(spec) {
+		return &DatastoreStore{}
+	}
+	return NewMemoryStore(maxOrders)
+}
+
+// newID returns a random ID, order IDs are enough to look at an order.
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
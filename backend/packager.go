@@ -15,32 +15,173 @@
 package backend
 
 import (
+	"backend/config"
+	"backend/secrets"
+	"backend/sxg"
+	"bytes"
+	"io/ioutil"
 	"log"
+	"mime"
 	"net/http"
-	"net/http/httputil"
-	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
+	"golang.org/x/net/context"
 	"google.golang.org/appengine"
-	"google.golang.org/appengine/urlfetch"
 )
 
-func InitPackager() {
-	http.HandleFunc("/amppkg/", func(w http.ResponseWriter, r *http.Request) {
-		u, err := url.Parse(PACKAGER_PREFIX)
-		if err != nil {
-			log.Fatal(err)
+const (
+	PACKAGER_PATH = "/amppkg/"
+	CERT_PATH     = PACKAGER_PATH + "cert/"
+	VALIDITY_PATH = PACKAGER_PATH + "validity"
+	// Placeholder OCSP response used if none is configured. Browsers only
+	// accept it with certificate errors ignored, i.e. for local testing.
+	PLACEHOLDER_OCSP = "ocsp"
+)
+
+var (
+	// Built from the secrets in cfg.SignedExchange, see fetchSigner.
+	signer     *secrets.Derived
+	signerLock sync.Mutex
+)
+
+func InitPackager(cfg *config.Config) {
+	http.HandleFunc(CERT_PATH, func(w http.ResponseWriter, r *http.Request) {
+		serveCertChain(cfg, w, r)
+	})
+	http.HandleFunc(VALIDITY_PATH, serveValidity)
+}
+
+// fetchSigner returns a signer for the certificate, key and OCSP response in
+// the secrets configured in cfg.SignedExchange. It is built again when they
+// change, so renewed OCSP responses and certificates are picked up after the
+// secrets cache expires or /secrets/reload.
+func fetchSigner(ctx context.Context, cfg *config.Config) (*sxg.Signer, error) {
+	signerLock.Lock()
+	if signer == nil {
+		signer = &secrets.Derived{
+			Names: []string{
+				cfg.SignedExchange.CertSecret,
+				cfg.SignedExchange.KeySecret,
+				cfg.SignedExchange.OCSPSecret,
+			},
+			Optional: true,
+			Build: func(s [][]byte) (interface{}, error) {
+				return newSigner(cfg, s[0], s[1], s[2])
+			},
 		}
-		p := httputil.NewSingleHostReverseProxy(u)
-		// Need to fiddle with Transport; on GAE this needs to change on every
-		// request. Might not be necessary under Go 1.11:
-		// https://cloud.google.com/blog/products/application-development/go-1-11-is-now-available-on-app-engine
-		p.Transport = &urlfetch.Transport{
-			Context: appengine.NewContext(r),
+	}
+	signerLock.Unlock()
+	s, err := signer.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.(*sxg.Signer), nil
+}
+
+func newSigner(cfg *config.Config, certPEM []byte, keyPEM []byte, ocsp []byte) (*sxg.Signer, error) {
+	if certPEM == nil || keyPEM == nil {
+		return nil, secrets.ErrNotFound
+	}
+	s, err := sxg.NewSigner(certPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	s.OCSP = ocsp
+	if s.OCSP == nil {
+		log.Printf("No OCSP response found, signed exchanges only work for testing")
+		s.OCSP = []byte(PLACEHOLDER_OCSP)
+	}
+	s.CertURL = cfg.Host + CERT_PATH + s.CertID()
+	s.ValidityURL = cfg.Host + VALIDITY_PATH
+	return s, nil
+}
+
+func serveCertChain(cfg *config.Config, w http.ResponseWriter, r *http.Request) {
+	s, err := fetchSigner(appengine.NewContext(r), cfg)
+	if err != nil {
+		log.Printf("Failed to load signed exchange certificate: %v", err)
+		http.NotFound(w, r)
+		return
+	}
+	if strings.TrimPrefix(r.URL.Path, CERT_PATH) != s.CertID() {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", sxg.CERT_CHAIN_CONTENT_TYPE)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	SetDefaultMaxAge(w)
+	var chain bytes.Buffer
+	if err := s.WriteCertChain(&chain); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Write(chain.Bytes())
+}
+
+// Validity data isn't used by browsers yet, an empty CBOR map is fine.
+func serveValidity(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/cbor")
+	SetDefaultMaxAge(w)
+	w.Write([]byte{0xa0})
+}
+
+// serveSignedExchange signs the file in distDir requested by r. It returns
+// false without writing anything if the file can't be signed, so the caller
+// can fall back to serving it unsigned.
+func serveSignedExchange(cfg *config.Config, w http.ResponseWriter, r *http.Request) bool {
+	ctx := appengine.NewContext(r)
+	s, err := fetchSigner(ctx, cfg)
+	if err != nil {
+		log.Printf("Failed to load signed exchange certificate: %v", err)
+		return false
+	}
+	filePath := distFilePath(cfg.DistDir, r.URL.Path)
+	body, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return false
+	}
+	// Signed exchanges are cached by URL, so they ignore ?optimize.
+	if cfg.Features.Optimizer {
+		if optimized, err := optimizedDocumentBody(ctx, filePath); err == nil {
+			body = optimized
+		} else {
+			log.Printf("Failed to optimize [%s]: %v", r.URL.Path, err)
 		}
-		log.Printf("Proxying request for [%s] to [%s]", r.URL.String(), PACKAGER_PREFIX)
-		p.ServeHTTP(w, r)
-	})
-	// Blocking /priv/doc is one of the "productionizing" steps:
-	// https://github.com/ampproject/amppackager#productionizing
-	http.HandleFunc("/priv/doc", http.NotFound)
+	}
+
+	header := http.Header{}
+	contentType := mime.TypeByExtension(filepath.Ext(filePath))
+	if contentType == "" {
+		contentType = http.DetectContentType(body)
+	}
+	header.Set("Content-Type", contentType)
+	if cacheControl := w.Header().Get("Cache-Control"); cacheControl != "" {
+		header.Set("Cache-Control", cacheControl)
+	}
+	header.Set("X-Content-Type-Options", "nosniff")
+
+	var exchange bytes.Buffer
+	if err := s.Sign(&exchange, cfg.Host+r.URL.Path, http.StatusOK, header, body, time.Now()); err != nil {
+		log.Printf("Failed to sign [%s]: %v", r.URL.Path, err)
+		return false
+	}
+	w.Header().Set("Content-Type", sxg.CONTENT_TYPE)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Write(exchange.Bytes())
+	return true
+}
+
+// distFilePath maps a request path to a file in distDir, resolving
+// directories to their index.html.
+func distFilePath(distDir string, urlPath string) string {
+	filePath := filepath.Join(distDir, filepath.FromSlash(path.Clean("/"+urlPath)))
+	if info, err := os.Stat(filePath); err == nil && info.IsDir() {
+		filePath = filepath.Join(filePath, "index.html")
+	}
+	return filePath
 }
@@ -15,9 +15,10 @@
 package backend
 
 import (
+	"backend/config"
+	"backend/pagination"
 	"fmt"
 	"net/http"
-	"strconv"
 )
 
 const (
@@ -36,13 +37,28 @@ type PagedResponse struct {
 	CurrentPage int              `json:"currentPage"`
 	PageCount   int              `json:"pageCount"`
 	Products    []ProductListing `json:"products"`
+	Next        string           `json:"next,omitempty"`
+	Prev        string           `json:"prev,omitempty"`
 }
 
 type AmpListResponse struct {
 	Items PagedResponse `json:"items"`
 }
 
-func GeneratePagedResponse(page int) AmpListResponse {
+func GeneratePagedResponse(page *pagination.Page) AmpListResponse {
+	response := PagedResponse{
+		CurrentPage: page.Number,
+		PageCount:   page.Count,
+		Products:    generateProductListings(page.Start, page.End),
+		Next:        page.Next,
+		Prev:        page.Prev,
+	}
+	return AmpListResponse{
+		Items: response,
+	}
+}
+
+func generateProductListings(start int, end int) []ProductListing {
 	IMAGES := []string{
 		"/img/product1_640x426.jpg",
 		"/img/product2_640x426.jpg",
@@ -51,44 +67,59 @@ func GeneratePagedResponse(page int) AmpListResponse {
 		"/img/product5_640x408.jpg",
 		"/img/product6_640x424.jpg",
 	}
-
-	response := PagedResponse{}
-	response.CurrentPage = page
-	response.PageCount = MAX_PAGE_COUNT
-	response.Products = make([]ProductListing, 0)
-
-	for i := 0; i < ITEMS_PER_PAGE; i++ {
-		itemIndex := ITEMS_PER_PAGE*(page-1) + i + 1
-		item := ProductListing{
+	listings := make([]ProductListing, 0)
+	for i := start; i < end; i++ {
+		itemIndex := i + 1
+		listings = append(listings, ProductListing{
 			Image: IMAGES[itemIndex%len(IMAGES)],
 			Title: fmt.Sprintf("Food %d", itemIndex),
 			Copy:  fmt.Sprintf("Lorem ipsum dolor sit %d amet consequitur sine nice fun", itemIndex),
-		}
-		response.Products = append(response.Products, item)
+		})
 	}
+	return listings
+}
 
-	ampListResponse := AmpListResponse{
-		Items: response,
+func InitPagedListSample(cfg *config.Config) {
+	RegisterHandler(PAGED_LIST_SAMPLE_PATH+"search", handlePagedListSearch)
+	RegisterHandler(PAGED_LIST_SAMPLE_PATH+"more", handlePagedListMore)
+}
+
+// handlePagedListSearch returns the page of the page parameter, counted from
+// 1.
+func handlePagedListSearch(w http.ResponseWriter, r *http.Request) {
+	page, ok := pagedListPage(w, r)
+	if !ok {
+		return
 	}
+	response := GeneratePagedResponse(page)
+	SendJsonResponse(w, &response)
+}
 
-	return ampListResponse
+// handlePagedListMore returns the same pages for amp-list with load-more.
+func handlePagedListMore(w http.ResponseWriter, r *http.Request) {
+	page, ok := pagedListPage(w, r)
+	if !ok {
+		return
+	}
+	SendJsonResponse(w, pagination.NewLoadMore(generateProductListings(page.Start, page.End), page))
 }
 
-func InitPagedListSample() {
-	RegisterHandler(PAGED_LIST_SAMPLE_PATH+"search", func(w http.ResponseWriter, r *http.Request) {
-		pageString := r.URL.Query().Get("page")
-		if pageString == "" {
-			pageString = "1"
-		}
-		page, _ := strconv.Atoi(pageString)
+func pagedListPage(w http.ResponseWriter, r *http.Request) (*pagination.Page, bool) {
+	pager := pagination.NewPager(r, GetHost(r), "page")
+	pager.FirstPage = 1
+	page, err := pager.Offset(MAX_PAGE_COUNT*ITEMS_PER_PAGE, ITEMS_PER_PAGE)
+	if err != nil {
+		sendPaginationError(w, r, err)
+		return nil, false
+	}
+	return page, true
+}
 
-		if page <= MAX_PAGE_COUNT && page > 0 {
-			response := GeneratePagedResponse(page)
-			SendJsonResponse(w, &response)
-		} else {
-			SendJsonResponse(w, map[string]string{
-				"error": "Invalid page",
-			})
-		}
-	})
+// sendPaginationError responds to requests for pages that don't exist.
+func sendPaginationError(w http.ResponseWriter, r *http.Request, err error) {
+	if err == pagination.ErrNoSuchPage {
+		SendError(w, r, http.StatusNotFound, "No such page.")
+		return
+	}
+	SendError(w, r, http.StatusBadRequest, "Invalid page.")
 }
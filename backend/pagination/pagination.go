@@ -0,0 +1,221 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// Package pagination splits lists into pages for amp-list endpoints, either
+// by page number or by an opaque cursor, and links each page to the next and
+// previous one.
+package pagination
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const (
+	// Field amp-list with load-more reads the URL of the next page from.
+	LOAD_MORE_FIELD = "load-more-src"
+)
+
+var (
+	// The requested page isn't a page number or a cursor.
+	ErrInvalidPage = errors.New("pagination: invalid page")
+	// The requested page is out of bounds, or its cursor doesn't point to an
+	// item anymore.
+	ErrNoSuchPage = errors.New("pagination: no such page")
+)
+
+// Pager pages through a list for one request.
+type Pager struct {
+	// Query parameter with the page number or cursor.
+	Param string
+	// The requested page number or cursor, "" for the first page.
+	Value string
+	// Number of the first page, usually 0 or 1.
+	FirstPage int
+	// Absolute URL of the request. Links to other pages keep its query, in
+	// particular __amp_source_origin for AMP CORS requests.
+	URL *url.URL
+}
+
+// Page is the part of a list shown on one page.
+type Page struct {
+	// Number of the page, counted from FirstPage. Cursor pages are numbered
+	// by position.
+	Number int
+	// Number of pages.
+	Count int
+	// The page shows items[Start:End].
+	Start int
+	End   int
+	// URLs of the next and previous page, "" on the last and first page.
+	Next string
+	Prev string
+}
+
+// LoadMore is the response format of amp-list with load-more: amp-list
+// appends Items and loads the next page from LoadMoreSrc, which is left out
+// on the last page.
+type LoadMore struct {
+	Items       interface{} `json:"items"`
+	LoadMoreSrc string      `json:"load-more-src,omitempty"`
+}
+
+// NewPager returns the pager for r, whose page is in the param query
+// parameter. host is the scheme and host links point to.
+func NewPager(r *http.Request, host string, param string) *Pager {
+	u, err := url.Parse(host)
+	if err != nil {
+		u = &url.URL{}
+	}
+	u.Path = r.URL.Path
+	u.RawQuery = r.URL.RawQuery
+	return &Pager{
+		Param: param,
+		Value: r.URL.Query().Get(param),
+		URL:   u,
+	}
+}
+
+// Offset returns the requested page of total items, size per page. There's
+// always at least one page, possibly empty.
+func (p *Pager) Offset(total int, size int) (*Page, error) {
+	size = max(size, 1)
+	count := pageCount(total, size)
+	number := p.FirstPage
+	if p.Value != "" {
+		n, err := strconv.Atoi(p.Value)
+		if err != nil {
+			return nil, ErrInvalidPage
+		}
+		number = n
+	}
+	index := number - p.FirstPage
+	if index < 0 || index >= count {
+		return nil, ErrNoSuchPage
+	}
+	page := p.page(index, count, total, size)
+	if index+1 < count {
+		page.Next = p.link(strconv.Itoa(number + 1))
+	}
+	if index > 0 {
+		page.Prev = p.link(strconv.Itoa(number - 1))
+	}
+	return page, nil
+}
+
+// Cursor returns the requested page of the items with keys, size per page.
+// Its cursor encodes the key of its first item, so pages don't shift when
+// items are added before it.
+func (p *Pager) Cursor(keys []string, size int) (*Page, error) {
+	size = max(size, 1)
+	start := 0
+	if p.Value != "" {
+		key, err := DecodeCursor(p.Value)
+		if err != nil {
+			return nil, ErrInvalidPage
+		}
+		start = -1
+		for i, k := range keys {
+			if k == key {
+				start = i
+				break
+			}
+		}
+		if start < 0 {
+			return nil, ErrNoSuchPage
+		}
+	}
+	page := p.page(0, pageCount(len(keys), size), len(keys), size)
+	page.Number = p.FirstPage + (start+size-1)/size
+	page.Start = start
+	page.End = min(start+size, len(keys))
+	if page.End < len(keys) {
+		page.Next = p.link(EncodeCursor(keys[page.End]))
+	}
+	switch {
+	case start > size:
+		page.Prev = p.link(EncodeCursor(keys[start-size]))
+	case start > 0:
+		page.Prev = p.link("")
+	}
+	return page, nil
+}
+
+// EncodeCursor returns the cursor of the page starting with key.
+func EncodeCursor(key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(key))
+}
+
+// DecodeCursor returns the key of the first item of the cursor's page.
+func DecodeCursor(cursor string) (string, error) {
+	key, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", ErrInvalidPage
+	}
+	return string(key), nil
+}
+
+// NewLoadMore returns the items of page for amp-list with load-more.
+func NewLoadMore(items interface{}, page *Page) LoadMore {
+	return LoadMore{
+		Items:       items,
+		LoadMoreSrc: page.Next,
+	}
+}
+
+func (p *Pager) page(index int, count int, total int, size int) *Page {
+	start := min(index*size, total)
+	return &Page{
+		Number: p.FirstPage + index,
+		Count:  count,
+		Start:  start,
+		End:    min(start+size, total),
+	}
+}
+
+// link returns the URL of the page with value, the first page if it's "".
+func (p *Pager) link(value string) string {
+	u := *p.URL
+	query := u.Query()
+	if value == "" {
+		query.Del(p.Param)
+	} else {
+		query.Set(p.Param, value)
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+func pageCount(total int, size int) int {
+	if total <= 0 {
+		return 1
+	}
+	return (total + size - 1) / size
+}
+
+func min(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,138 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package pagination
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+const testURL = "https://example.com/list?__amp_source_origin=https%3A%2F%2Fexample.com"
+
+func newTestPager(value string, firstPage int) *Pager {
+	target := testURL
+	if value != "" {
+		target += "&page=" + value
+	}
+	p := NewPager(httptest.NewRequest("GET", target, nil), "https://example.com", "page")
+	p.FirstPage = firstPage
+	return p
+}
+
+// link is the URL of the page with value, the first page if it's "".
+func link(value string) string {
+	if value == "" {
+		return testURL
+	}
+	return testURL + "&page=" + value
+}
+
+func TestOffset(t *testing.T) {
+	tests := []struct {
+		total  int
+		value  string
+		number int
+		count  int
+		start  int
+		end    int
+		next   string
+		prev   string
+		err    error
+	}{
+		{7, "", 1, 3, 0, 3, link("2"), "", nil},
+		{7, "1", 1, 3, 0, 3, link("2"), "", nil},
+		{7, "2", 2, 3, 3, 6, link("3"), link("1"), nil},
+		{7, "3", 3, 3, 6, 7, "", link("2"), nil},
+		// The last page is full.
+		{6, "2", 2, 2, 3, 6, "", link("1"), nil},
+		// An empty list has one empty page.
+		{0, "", 1, 1, 0, 0, "", "", nil},
+		{7, "4", 0, 0, 0, 0, "", "", ErrNoSuchPage},
+		{7, "0", 0, 0, 0, 0, "", "", ErrNoSuchPage},
+		{0, "2", 0, 0, 0, 0, "", "", ErrNoSuchPage},
+		{7, "two", 0, 0, 0, 0, "", "", ErrInvalidPage},
+	}
+	for _, test := range tests {
+		page, err := newTestPager(test.value, 1).Offset(test.total, 3)
+		if err != test.err {
+			t.Errorf("Offset(%d) of page %q: %v, want %v", test.total, test.value, err, test.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		want := Page{test.number, test.count, test.start, test.end, test.next, test.prev}
+		if *page != want {
+			t.Errorf("Offset(%d) of page %q = %+v, want %+v", test.total, test.value, *page, want)
+		}
+	}
+}
+
+func TestCursor(t *testing.T) {
+	keys := []string{"a", "b", "c", "d", "e", "f", "g"}
+	tests := []struct {
+		value  string
+		number int
+		start  int
+		end    int
+		next   string
+		prev   string
+		err    error
+	}{
+		{"", 0, 0, 3, link(EncodeCursor("d")), "", nil},
+		// The second page goes back to the first without a cursor.
+		{EncodeCursor("d"), 1, 3, 6, link(EncodeCursor("g")), link(""), nil},
+		{EncodeCursor("g"), 2, 6, 7, "", link(EncodeCursor("d")), nil},
+		// Items were removed before the page: it starts off the grid, and
+		// the previous page can't go back further than the first item.
+		{EncodeCursor("c"), 1, 2, 5, link(EncodeCursor("f")), link(""), nil},
+		{EncodeCursor("f"), 2, 5, 7, "", link(EncodeCursor("c")), nil},
+		{EncodeCursor("b"), 1, 1, 4, link(EncodeCursor("e")), link(""), nil},
+		{EncodeCursor("z"), 0, 0, 0, "", "", ErrNoSuchPage},
+		{"not*base64", 0, 0, 0, "", "", ErrInvalidPage},
+	}
+	for _, test := range tests {
+		page, err := newTestPager(test.value, 0).Cursor(keys, 3)
+		if err != test.err {
+			t.Errorf("Cursor of page %q: %v, want %v", test.value, err, test.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		want := Page{test.number, 3, test.start, test.end, test.next, test.prev}
+		if *page != want {
+			t.Errorf("Cursor of page %q = %+v, want %+v", test.value, *page, want)
+		}
+	}
+}
+
+func TestCursorEmpty(t *testing.T) {
+	page, err := newTestPager("", 0).Cursor(nil, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Page{0, 1, 0, 0, "", ""}); *page != want {
+		t.Errorf("Cursor of no items = %+v, want %+v", *page, want)
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	for _, key := range []string{"", "a", "item/42", "ünïcode", "a b&c=d"} {
+		got, err := DecodeCursor(EncodeCursor(key))
+		if err != nil || got != key {
+			t.Errorf("DecodeCursor(EncodeCursor(%q)) = %q, %v", key, got, err)
+		}
+	}
+}
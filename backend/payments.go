@@ -0,0 +1,139 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package backend
+
+import (
+	"backend/config"
+	"backend/orders"
+	"backend/payments"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/appengine"
+)
+
+const (
+	PAYMENTS_WEBHOOK_PATH = CHECKOUT_PATH_PREFIX + "/payments/webhook"
+	PAYMENTS_CURRENCY     = "USD"
+	MAX_WEBHOOK_BYTES     = 64 << 10
+)
+
+// Tokens of the cards logged in users can pick, by ID. The cards are
+// listed in /json/credit-cards.json.
+var savedCards = map[string]string{
+	"1": payments.TOKEN_SUCCESS,
+	"2": payments.TOKEN_SUCCESS,
+}
+
+var paymentProvider payments.PaymentProvider
+var webhookSecret string
+
+func InitPayments(cfg *config.Config) {
+	// The fake provider runs in this instance, so it signs its events with a
+	// secret shared in memory and posts them straight to the webhook handler.
+	webhookSecret = randomSecret()
+	provider, err := payments.ParseProvider(cfg.Payments.Provider, payments.FakeOptions{
+		WebhookURL:    cfg.Host + PAYMENTS_WEBHOOK_PATH,
+		WebhookSecret: webhookSecret,
+		CaptureDelay:  time.Duration(cfg.Payments.CaptureDelaySeconds) * time.Second,
+		Client: func(context.Context) *http.Client {
+			return &http.Client{Transport: handlerTransport{http.DefaultServeMux}}
+		},
+	})
+	if err != nil {
+		panic(err)
+	}
+	paymentProvider = provider
+	if fake, ok := provider.(*payments.FakeProvider); ok {
+		http.Handle(payments.FAKE_PATH_PREFIX, Recover(fake.Handler(appengine.NewContext)))
+	}
+	http.HandleFunc(PAYMENTS_WEBHOOK_PATH, onlyPost(handlePaymentWebhook))
+}
+
+func handlePaymentWebhook(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, MAX_WEBHOOK_BYTES))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := payments.VerifySignature(webhookSecret, body, r.Header.Get(payments.SIGNATURE_HEADER), time.Now()); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	var event payments.Event
+	if err := json.Unmarshal(body, &event); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	switch _, err := recordPayment(appengine.NewContext(r), &event.Intent); err {
+	case nil:
+	case orders.ErrNotFound:
+		// Orders are evicted from memory eventually, there's nothing to
+		// update then.
+		log.Printf("Received %s %s for unknown order %s", event.Type, event.ID, event.Intent.OrderID)
+	default:
+		// The provider retries failed webhooks.
+		log.Printf("Failed to record %s %s for order %s: %v", event.Type, event.ID, event.Intent.OrderID, err)
+		http.Error(w, "Failed to record the payment", http.StatusInternalServerError)
+		return
+	}
+	w.Write([]byte("OK"))
+}
+
+// recordPayment copies the status of intent to its order. Updates from
+// other intents and after the payment succeeded are ignored, as events can
+// arrive late.
+func recordPayment(ctx context.Context, intent *payments.Intent) (*orders.Order, error) {
+	return updateReleasingCodes(ctx, intent.OrderID, func(order *orders.Order) bool {
+		if order.PaymentIntent != intent.ID || order.PaymentStatus == payments.STATUS_SUCCEEDED {
+			return false
+		}
+		order.PaymentStatus = intent.Status
+		order.PaymentError = ""
+		if intent.LastDecline != nil {
+			order.PaymentError = intent.LastDecline.Message
+		}
+		// Declined and canceled payments don't use up the codes.
+		if intent.Status == payments.STATUS_CANCELED || (intent.Status == payments.STATUS_REQUIRES_PAYMENT_METHOD && intent.LastDecline != nil) {
+			return markCodesReleased(order)
+		}
+		return false
+	})
+}
+
+// handlerTransport serves requests with a handler instead of sending them.
+type handlerTransport struct {
+	handler http.Handler
+}
+
+func (t handlerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	w := httptest.NewRecorder()
+	t.handler.ServeHTTP(w, r)
+	return w.Result(), nil
+}
+
+func randomSecret() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,471 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package payments
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	// Challenge pages and the processing endpoint are served below this path.
+	FAKE_PATH_PREFIX      = "/payments/fake/"
+	DEFAULT_CAPTURE_DELAY = 30 * time.Second
+	DEFAULT_MAX_INTENTS   = 1000
+	MAX_DELIVERY_ATTEMPTS = 5
+	// Intents older than this can be evicted whatever their status.
+	MAX_INTENT_AGE = 24 * time.Hour
+)
+
+// Test tokens accepted by FakeProvider.
+const (
+	TOKEN_SUCCESS            = "tok_visa"
+	TOKEN_CHALLENGE          = "tok_threeDSecure"
+	TOKEN_DECLINED           = "tok_chargeDeclined"
+	TOKEN_INSUFFICIENT_FUNDS = "tok_insufficientFunds"
+	TOKEN_DELAYED_CAPTURE    = "tok_delayedCapture"
+)
+
+// Test card numbers and the tokens they stand for.
+var TestCards = map[string]string{
+	"4242424242424242": TOKEN_SUCCESS,
+	"4000000000003220": TOKEN_CHALLENGE,
+	"4000000000000002": TOKEN_DECLINED,
+	"4000000000009995": TOKEN_INSUFFICIENT_FUNDS,
+	"4000000000000077": TOKEN_DELAYED_CAPTURE,
+}
+
+var challengeTemplate = template.Must(template.New("challenge").Parse(`<!doctype html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <meta name="viewport" content="width=device-width,initial-scale=1">
+  <title>Confirm your payment</title>
+</head>
+<body>
+  <h1>Fake bank</h1>
+  <p>Confirm the payment of {{.Currency}} {{.Amount}}? This page simulates a 3-D Secure challenge.</p>
+  <form method="post">
+    <button name="result" value="approve">Confirm</button>
+    <button name="result" value="fail">Fail authentication</button>
+  </form>
+</body>
+</html>
+`))
+
+type FakeOptions struct {
+	// Events are posted here, nothing is posted if empty.
+	WebhookURL    string
+	WebhookSecret string
+	// Time until payments made with TOKEN_DELAYED_CAPTURE are captured.
+	CaptureDelay time.Duration
+	// Intents kept in memory, DEFAULT_MAX_INTENTS if 0. Beyond that, the
+	// oldest succeeded or canceled intents and those older than
+	// MAX_INTENT_AGE are forgotten.
+	MaxIntents int
+	// Returns the client for posting events, http.DefaultClient if nil.
+	Client func(ctx context.Context) *http.Client
+	// time.Now if nil.
+	Now func() time.Time
+}
+
+// FakeProvider simulates a payment provider in memory. Payment methods are
+// the test tokens, see TestCards. Delayed captures and failed webhook
+// deliveries are handled by ProcessDue, which also runs on every Get.
+type FakeProvider struct {
+	opts FakeOptions
+
+	lock    sync.Mutex
+	intents map[string]*fakeIntent
+	// Intent IDs, oldest first.
+	ids    []string
+	keys   map[string]string
+	outbox []*delivery
+}
+
+type fakeIntent struct {
+	Intent
+	returnURL      string
+	idempotencyKey string
+	captureAt      time.Time
+}
+
+type delivery struct {
+	event    Event
+	attempts int
+}
+
+func NewFakeProvider(opts FakeOptions) *FakeProvider {
+	if opts.CaptureDelay == 0 {
+		opts.CaptureDelay = DEFAULT_CAPTURE_DELAY
+	}
+	if opts.MaxIntents == 0 {
+		opts.MaxIntents = DEFAULT_MAX_INTENTS
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	if opts.Client == nil {
+		opts.Client = func(context.Context) *http.Client { return http.DefaultClient }
+	}
+	return &FakeProvider{
+		opts:    opts,
+		intents: make(map[string]*fakeIntent),
+		keys:    make(map[string]string),
+	}
+}
+
+// Tokenize returns the token of a test card number. Real providers
+// tokenize cards on the client, the fake only knows TestCards.
+func Tokenize(cardNumber string) (string, error) {
+	number := strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' {
+			return -1
+		}
+		return r
+	}, cardNumber)
+	token, ok := TestCards[number]
+	if !ok {
+		return "", ErrInvalidToken
+	}
+	return token, nil
+}
+
+func (p *FakeProvider) CreateIntent(ctx context.Context, params IntentParams) (*Intent, error) {
+	if params.Amount <= 0 {
+		return nil, fmt.Errorf("payments: invalid amount %s", params.Amount)
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if id, ok := p.keys[params.IdempotencyKey]; ok && params.IdempotencyKey != "" {
+		intent := p.intents[id].Intent
+		return &intent, nil
+	}
+	id, err := newID("pi_")
+	if err != nil {
+		return nil, err
+	}
+	intent := &fakeIntent{
+		Intent: Intent{
+			ID:       id,
+			Amount:   params.Amount,
+			Currency: params.Currency,
+			OrderID:  params.OrderID,
+			Status:   STATUS_REQUIRES_PAYMENT_METHOD,
+			Created:  p.opts.Now(),
+		},
+		returnURL:      params.ReturnURL,
+		idempotencyKey: params.IdempotencyKey,
+	}
+	p.intents[id] = intent
+	p.ids = append(p.ids, id)
+	if params.IdempotencyKey != "" {
+		p.keys[params.IdempotencyKey] = id
+	}
+	p.evict()
+	result := intent.Intent
+	return &result, nil
+}
+
+// evict forgets the oldest intents that are done with until at most
+// MaxIntents are left. Intents that may still change are kept unless they
+// are older than MAX_INTENT_AGE. evict needs p to be locked.
+func (p *FakeProvider) evict() {
+	excess := len(p.ids) - p.opts.MaxIntents
+	if excess <= 0 {
+		return
+	}
+	now := p.opts.Now()
+	var kept []string
+	for _, id := range p.ids {
+		intent := p.intents[id]
+		done := intent.Status == STATUS_SUCCEEDED || intent.Status == STATUS_CANCELED
+		if excess > 0 && (done || now.Sub(intent.Created) > MAX_INTENT_AGE) {
+			delete(p.intents, id)
+			if intent.idempotencyKey != "" {
+				delete(p.keys, intent.idempotencyKey)
+			}
+			excess--
+			continue
+		}
+		kept = append(kept, id)
+	}
+	p.ids = kept
+}
+
+func (p *FakeProvider) Confirm(ctx context.Context, intentID string, token string) (*Intent, error) {
+	p.lock.Lock()
+	intent, ok := p.intents[intentID]
+	if !ok {
+		p.lock.Unlock()
+		return nil, ErrNotFound
+	}
+	if intent.Status != STATUS_REQUIRES_PAYMENT_METHOD {
+		p.lock.Unlock()
+		return nil, ErrUnexpectedStatus
+	}
+
+	var err error
+	var eventType string
+	switch token {
+	case TOKEN_SUCCESS:
+		p.capture(intent)
+		eventType = EVENT_SUCCEEDED
+	case TOKEN_CHALLENGE:
+		intent.Status = STATUS_REQUIRES_ACTION
+		intent.ChallengeURL = FAKE_PATH_PREFIX + "challenge/" + intent.ID
+		eventType = EVENT_REQUIRES_ACTION
+	case TOKEN_DECLINED:
+		err = p.decline(intent, "card_declined", "Your card was declined.")
+		eventType = EVENT_PAYMENT_FAILED
+	case TOKEN_INSUFFICIENT_FUNDS:
+		err = p.decline(intent, "insufficient_funds", "Your card has insufficient funds.")
+		eventType = EVENT_PAYMENT_FAILED
+	case TOKEN_DELAYED_CAPTURE:
+		intent.Status = STATUS_PROCESSING
+		intent.captureAt = p.opts.Now().Add(p.opts.CaptureDelay)
+		eventType = EVENT_PROCESSING
+	default:
+		p.lock.Unlock()
+		return nil, ErrInvalidToken
+	}
+	result := intent.Intent
+	p.enqueue(eventType, intent)
+	p.lock.Unlock()
+
+	p.deliver(ctx)
+	return &result, err
+}
+
+func (p *FakeProvider) Get(ctx context.Context, intentID string) (*Intent, error) {
+	p.ProcessDue(ctx)
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	intent, ok := p.intents[intentID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	result := intent.Intent
+	return &result, nil
+}
+
+func (p *FakeProvider) Cancel(ctx context.Context, intentID string) (*Intent, error) {
+	p.lock.Lock()
+	intent, ok := p.intents[intentID]
+	if !ok {
+		p.lock.Unlock()
+		return nil, ErrNotFound
+	}
+	if intent.Status == STATUS_SUCCEEDED || intent.Status == STATUS_CANCELED {
+		p.lock.Unlock()
+		return nil, ErrUnexpectedStatus
+	}
+	intent.Status = STATUS_CANCELED
+	result := intent.Intent
+	p.enqueue(EVENT_CANCELED, intent)
+	p.lock.Unlock()
+
+	p.deliver(ctx)
+	return &result, nil
+}
+
+// CompleteChallenge finishes the challenge of an intent and returns where
+// to send the customer.
+func (p *FakeProvider) CompleteChallenge(ctx context.Context, intentID string, approve bool) (string, error) {
+	p.lock.Lock()
+	intent, ok := p.intents[intentID]
+	if !ok {
+		p.lock.Unlock()
+		return "", ErrNotFound
+	}
+	if intent.Status != STATUS_REQUIRES_ACTION {
+		p.lock.Unlock()
+		return "", ErrUnexpectedStatus
+	}
+	intent.ChallengeURL = ""
+	if approve {
+		p.capture(intent)
+		p.enqueue(EVENT_SUCCEEDED, intent)
+	} else {
+		p.decline(intent, "authentication_failed", "The payment couldn't be authenticated.")
+		p.enqueue(EVENT_PAYMENT_FAILED, intent)
+	}
+	returnURL := intent.returnURL
+	p.lock.Unlock()
+
+	p.deliver(ctx)
+	return returnURL, nil
+}
+
+// ProcessDue captures delayed payments that are due and retries failed
+// webhook deliveries.
+func (p *FakeProvider) ProcessDue(ctx context.Context) {
+	p.lock.Lock()
+	now := p.opts.Now()
+	for _, intent := range p.intents {
+		if intent.Status == STATUS_PROCESSING && !now.Before(intent.captureAt) {
+			p.capture(intent)
+			p.enqueue(EVENT_SUCCEEDED, intent)
+		}
+	}
+	p.lock.Unlock()
+	p.deliver(ctx)
+}
+
+// capture needs p to be locked.
+func (p *FakeProvider) capture(intent *fakeIntent) {
+	intent.Status = STATUS_SUCCEEDED
+	intent.LastDecline = nil
+	captured := p.opts.Now()
+	intent.Captured = &captured
+}
+
+// decline needs p to be locked. The intent can be confirmed again.
+func (p *FakeProvider) decline(intent *fakeIntent, code string, message string) error {
+	decline := &DeclineError{Code: code, Message: message}
+	intent.Status = STATUS_REQUIRES_PAYMENT_METHOD
+	intent.LastDecline = decline
+	return decline
+}
+
+// enqueue needs p to be locked.
+func (p *FakeProvider) enqueue(eventType string, intent *fakeIntent) {
+	id, err := newID("evt_")
+	if err != nil {
+		log.Printf("Failed to create event for %s: %v", intent.ID, err)
+		return
+	}
+	p.outbox = append(p.outbox, &delivery{event: Event{
+		ID:      id,
+		Type:    eventType,
+		Intent:  intent.Intent,
+		Created: p.opts.Now(),
+	}})
+}
+
+// deliver posts the pending events in order. Events that failed
+// MAX_DELIVERY_ATTEMPTS times are dropped.
+func (p *FakeProvider) deliver(ctx context.Context) {
+	p.lock.Lock()
+	pending := p.outbox
+	p.outbox = nil
+	p.lock.Unlock()
+
+	var failed []*delivery
+	for _, d := range pending {
+		if err := p.post(ctx, d.event); err != nil {
+			d.attempts++
+			log.Printf("Failed to deliver %s %s (attempt %d): %v", d.event.Type, d.event.ID, d.attempts, err)
+			if d.attempts < MAX_DELIVERY_ATTEMPTS {
+				failed = append(failed, d)
+			}
+		}
+	}
+	if len(failed) > 0 {
+		p.lock.Lock()
+		p.outbox = append(failed, p.outbox...)
+		p.lock.Unlock()
+	}
+}
+
+func (p *FakeProvider) post(ctx context.Context, event Event) error {
+	if p.opts.WebhookURL == "" {
+		return nil
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", p.opts.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SIGNATURE_HEADER, Sign(p.opts.WebhookSecret, body, p.opts.Now()))
+	resp, err := p.opts.Client(ctx).Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return nil
+}
+
+// Handler serves the challenge pages below FAKE_PATH_PREFIX and
+// FAKE_PATH_PREFIX+"process", which runs ProcessDue. ctx returns the
+// context of a request.
+func (p *FakeProvider) Handler(ctx func(*http.Request) context.Context) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rest := strings.TrimPrefix(r.URL.Path, FAKE_PATH_PREFIX)
+		switch {
+		case rest == "process" && r.Method == "POST":
+			p.ProcessDue(ctx(r))
+			w.Write([]byte("Processed"))
+		case strings.HasPrefix(rest, "challenge/"):
+			p.serveChallenge(ctx(r), w, r, strings.TrimPrefix(rest, "challenge/"))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+func (p *FakeProvider) serveChallenge(ctx context.Context, w http.ResponseWriter, r *http.Request, id string) {
+	p.lock.Lock()
+	intent, ok := p.intents[id]
+	var current Intent
+	if ok {
+		current = intent.Intent
+	}
+	p.lock.Unlock()
+	if !ok || current.Status != STATUS_REQUIRES_ACTION {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != "POST" {
+		w.Header().Set("Cache-Control", "no-store")
+		challengeTemplate.Execute(w, current)
+		return
+	}
+	returnURL, err := p.CompleteChallenge(ctx, id, r.FormValue("result") == "approve")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if returnURL == "" {
+		w.Write([]byte("Done"))
+		return
+	}
+	http.Redirect(w, r, returnURL, http.StatusSeeOther)
+}
+
+func newID(prefix string) (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return prefix + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,222 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package payments
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+type testClock struct {
+	lock sync.Mutex
+	now  time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	c.now = c.now.Add(d)
+	c.lock.Unlock()
+}
+
+// webhook records the events posted to it and checks their signatures.
+type webhook struct {
+	t      *testing.T
+	clock  *testClock
+	status int
+	events []Event
+	server *httptest.Server
+}
+
+func (h *webhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	if err := VerifySignature("secret", body, r.Header.Get(SIGNATURE_HEADER), h.clock.Now()); err != nil {
+		h.t.Errorf("webhook signature: %v", err)
+	}
+	if h.status != 0 {
+		w.WriteHeader(h.status)
+		return
+	}
+	var event Event
+	if err := json.Unmarshal(body, &event); err != nil {
+		h.t.Error(err)
+	}
+	h.events = append(h.events, event)
+}
+
+func (h *webhook) Close() {
+	h.server.Close()
+}
+
+func (h *webhook) types() []string {
+	var types []string
+	for _, event := range h.events {
+		types = append(types, event.Type+":"+event.Intent.Status)
+	}
+	return types
+}
+
+func newTestProvider(t *testing.T, maxIntents int) (*FakeProvider, *testClock, *webhook) {
+	clock := &testClock{now: time.Unix(1546300800, 0)}
+	hook := &webhook{t: t, clock: clock}
+	hook.server = httptest.NewServer(hook)
+	provider := NewFakeProvider(FakeOptions{
+		WebhookURL:    hook.server.URL,
+		WebhookSecret: "secret",
+		CaptureDelay:  time.Minute,
+		MaxIntents:    maxIntents,
+		Now:           clock.Now,
+	})
+	return provider, clock, hook
+}
+
+func createIntent(t *testing.T, p *FakeProvider, key string) *Intent {
+	intent, err := p.CreateIntent(context.Background(), IntentParams{
+		Amount:         1000,
+		Currency:       "USD",
+		OrderID:        "order-" + key,
+		ReturnURL:      "/checkout/orders/order-" + key,
+		IdempotencyKey: key,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return intent
+}
+
+func TestFakeDeclineAndRetry(t *testing.T) {
+	ctx := context.Background()
+	p, _, hook := newTestProvider(t, 0)
+	defer hook.Close()
+	intent := createIntent(t, p, "a")
+	if again := createIntent(t, p, "a"); again.ID != intent.ID {
+		t.Errorf("CreateIntent with the same key = %s, want %s", again.ID, intent.ID)
+	}
+
+	declined, err := p.Confirm(ctx, intent.ID, TOKEN_DECLINED)
+	decline, ok := err.(*DeclineError)
+	if !ok || decline.Code != "card_declined" {
+		t.Fatalf("Confirm(declined) error = %v, want a card_declined DeclineError", err)
+	}
+	if declined.Status != STATUS_REQUIRES_PAYMENT_METHOD || declined.LastDecline == nil {
+		t.Errorf("declined intent = %+v", declined)
+	}
+	paid, err := p.Confirm(ctx, intent.ID, TOKEN_SUCCESS)
+	if err != nil || paid.Status != STATUS_SUCCEEDED || paid.LastDecline != nil || paid.Captured == nil {
+		t.Errorf("Confirm after decline = %+v, %v", paid, err)
+	}
+	if _, err := p.Confirm(ctx, intent.ID, TOKEN_SUCCESS); err != ErrUnexpectedStatus {
+		t.Errorf("Confirm after success = %v, want ErrUnexpectedStatus", err)
+	}
+	if _, err := p.Confirm(ctx, "pi_missing", TOKEN_SUCCESS); err != ErrNotFound {
+		t.Errorf("Confirm(missing) = %v, want ErrNotFound", err)
+	}
+	want := []string{EVENT_PAYMENT_FAILED + ":" + STATUS_REQUIRES_PAYMENT_METHOD, EVENT_SUCCEEDED + ":" + STATUS_SUCCEEDED}
+	if got := hook.types(); len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("events %v, want %v", got, want)
+	}
+}
+
+func TestFakeDelayedCapture(t *testing.T) {
+	ctx := context.Background()
+	p, clock, hook := newTestProvider(t, 0)
+	defer hook.Close()
+	intent := createIntent(t, p, "a")
+	if processing, err := p.Confirm(ctx, intent.ID, TOKEN_DELAYED_CAPTURE); err != nil || processing.Status != STATUS_PROCESSING {
+		t.Fatalf("Confirm(delayed) = %+v, %v", processing, err)
+	}
+	clock.Advance(59 * time.Second)
+	if current, _ := p.Get(ctx, intent.ID); current.Status != STATUS_PROCESSING {
+		t.Errorf("status before the capture delay = %s", current.Status)
+	}
+	clock.Advance(time.Second)
+	if current, _ := p.Get(ctx, intent.ID); current.Status != STATUS_SUCCEEDED {
+		t.Errorf("status after the capture delay = %s", current.Status)
+	}
+	if len(hook.events) != 2 || hook.events[1].Type != EVENT_SUCCEEDED {
+		t.Errorf("events %v", hook.types())
+	}
+}
+
+func TestFakeWebhookRetries(t *testing.T) {
+	ctx := context.Background()
+	p, _, hook := newTestProvider(t, 0)
+	defer hook.Close()
+	hook.status = http.StatusInternalServerError
+	intent := createIntent(t, p, "a")
+	p.Confirm(ctx, intent.ID, TOKEN_SUCCESS)
+	hook.status = 0
+	p.ProcessDue(ctx)
+	if len(hook.events) != 1 || hook.events[0].Type != EVENT_SUCCEEDED {
+		t.Errorf("events after retry %v", hook.types())
+	}
+
+	// Events are dropped after MAX_DELIVERY_ATTEMPTS.
+	hook.status = http.StatusInternalServerError
+	intent = createIntent(t, p, "b")
+	p.Confirm(ctx, intent.ID, TOKEN_SUCCESS)
+	for i := 1; i < MAX_DELIVERY_ATTEMPTS; i++ {
+		p.ProcessDue(ctx)
+	}
+	hook.status = 0
+	p.ProcessDue(ctx)
+	if len(hook.events) != 1 {
+		t.Errorf("events after giving up %v", hook.types())
+	}
+}
+
+func TestFakeEviction(t *testing.T) {
+	ctx := context.Background()
+	p, clock, hook := newTestProvider(t, 2)
+	defer hook.Close()
+	paid := createIntent(t, p, "paid")
+	p.Confirm(ctx, paid.ID, TOKEN_SUCCESS)
+	open := createIntent(t, p, "open")
+	third := createIntent(t, p, "third")
+
+	// Only the finished intent is dropped, with its idempotency key.
+	if _, err := p.Get(ctx, paid.ID); err != ErrNotFound {
+		t.Errorf("Get(succeeded) = %v, want ErrNotFound", err)
+	}
+	if again := createIntent(t, p, "paid"); again.ID == paid.ID {
+		t.Error("idempotency key of an evicted intent still returns it")
+	}
+	if _, err := p.Get(ctx, open.ID); err != nil {
+		t.Errorf("Get(open) = %v, want the intent", err)
+	}
+
+	// Intents that were never finished go after MAX_INTENT_AGE.
+	clock.Advance(MAX_INTENT_AGE + time.Second)
+	createIntent(t, p, "fourth")
+	for _, intent := range []*Intent{open, third} {
+		if _, err := p.Get(ctx, intent.ID); err != ErrNotFound {
+			t.Errorf("Get(%s) = %v, want ErrNotFound", intent.OrderID, err)
+		}
+	}
+	if len(p.intents) != 2 || len(p.ids) != 2 || len(p.keys) != 2 {
+		t.Errorf("%d intents, %d IDs and %d keys kept, want 2", len(p.intents), len(p.ids), len(p.keys))
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// Package payments charges orders through a PaymentProvider. Payments are
+// modeled as intents: an intent is created for an amount, confirmed with a
+// tokenized payment method, may need the customer to pass a challenge, and
+// is eventually captured or fails. Providers report changes with signed
+// webhook events.
+package payments
+
+import (
+	"backend/money"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// Intent statuses.
+const (
+	// Waiting for Confirm, also after a declined payment method.
+	STATUS_REQUIRES_PAYMENT_METHOD = "requires_payment_method"
+	// The customer has to pass a challenge at ChallengeURL.
+	STATUS_REQUIRES_ACTION = "requires_action"
+	// Authorized, the capture happens later.
+	STATUS_PROCESSING = "processing"
+	STATUS_SUCCEEDED  = "succeeded"
+	STATUS_CANCELED   = "canceled"
+)
+
+// Webhook event types.
+const (
+	EVENT_SUCCEEDED       = "payment_intent.succeeded"
+	EVENT_PROCESSING      = "payment_intent.processing"
+	EVENT_PAYMENT_FAILED  = "payment_intent.payment_failed"
+	EVENT_REQUIRES_ACTION = "payment_intent.requires_action"
+	EVENT_CANCELED        = "payment_intent.canceled"
+)
+
+const (
+	SIGNATURE_HEADER = "Payments-Signature"
+	// Webhooks signed longer ago are rejected to prevent replays.
+	SIGNATURE_TOLERANCE = 5 * time.Minute
+)
+
+var (
+	ErrNotFound         = errors.New("payments: no such intent")
+	ErrInvalidToken     = errors.New("payments: invalid payment method token")
+	ErrUnexpectedStatus = errors.New("payments: intent is not in the right status")
+	ErrBadSignature     = errors.New("payments: invalid webhook signature")
+)
+
+// DeclineError is returned by Confirm if the payment method was declined.
+type DeclineError struct {
+	Code string
+	// Shown to the customer.
+	Message string
+}
+
+func (e *DeclineError) Error() string {
+	return "payments: declined (" + e.Code + "): " + e.Message
+}
+
+type Intent struct {
+	ID       string       `json:"id"`
+	Amount   money.Amount `json:"amount"`
+	Currency string       `json:"currency"`
+	// Reference to the order, passed back in events.
+	OrderID      string `json:"orderId"`
+	Status       string `json:"status"`
+	ChallengeURL string `json:"challengeUrl,omitempty"`
+	// Reason of the last decline, if any.
+	LastDecline *DeclineError `json:"lastDecline,omitempty"`
+	Created     time.Time     `json:"created"`
+	// When the payment succeeded, nil until then.
+	Captured *time.Time `json:"captured,omitempty"`
+}
+
+type IntentParams struct {
+	Amount   money.Amount
+	Currency string
+	OrderID  string
+	// Where the customer is sent after a challenge.
+	ReturnURL string
+	// Creating an intent with a key used before returns the same intent.
+	IdempotencyKey string
+}
+
+type PaymentProvider interface {
+	CreateIntent(ctx context.Context, params IntentParams) (*Intent, error)
+	// Confirm charges the payment method behind token. It returns a
+	// *DeclineError if the payment method was declined, the intent can be
+	// confirmed again with another one then.
+	Confirm(ctx context.Context, intentID string, token string) (*Intent, error)
+	Get(ctx context.Context, intentID string) (*Intent, error)
+	Cancel(ctx context.Context, intentID string) (*Intent, error)
+}
+
+// Event is posted to the webhook URL when an intent changes.
+type Event struct {
+	ID      string    `json:"id"`
+	Type    string    `json:"type"`
+	Intent  Intent    `json:"intent"`
+	Created time.Time `json:"created"`
+}
+
+// Sign returns the signature header value for a webhook body.
+func Sign(secret string, body []byte, t time.Time) string {
+	timestamp := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + timestamp + ",v1=" + signature(secret, timestamp, body)
+}
+
+func signature(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature checks a signature header made by Sign.
+func VerifySignature(secret string, body []byte, header string, now time.Time) error {
+	var timestamp, sig string
+	for _, part := range strings.Split(header, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "t":
+			timestamp = kv[1]
+		case "v1":
+			sig = kv[1]
+		}
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || sig == "" {
+		return ErrBadSignature
+	}
+	age := now.Sub(time.Unix(seconds, 0))
+	if age > SIGNATURE_TOLERANCE || age < -SIGNATURE_TOLERANCE {
+		return ErrBadSignature
+	}
+	if !hmac.Equal([]byte(sig), []byte(signature(secret, timestamp, body))) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+// ParseProvider returns the provider named by spec. Only "fake" is
+// supported, see FakeProvider.
+func ParseProvider(spec string, opts FakeOptions) (PaymentProvider, error) {
+	switch spec {
+	case "", "fake":
+		return NewFakeProvider(opts), nil
+	}
+	return nil, fmt.Errorf("payments: unknown provider %q", spec)
+}
@@ -0,0 +1,79 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package payments
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVerifySignature(t *testing.T) {
+	signed := time.Unix(1546300800, 0)
+	body := []byte(`{"id":"evt_1","type":"payment_intent.succeeded"}`)
+	header := Sign("secret", body, signed)
+	tests := []struct {
+		secret string
+		body   string
+		header string
+		now    time.Time
+		ok     bool
+	}{
+		{"secret", string(body), header, signed, true},
+		{"secret", string(body), header, signed.Add(SIGNATURE_TOLERANCE), true},
+		{"secret", string(body), header, signed.Add(-SIGNATURE_TOLERANCE), true},
+		{"secret", string(body), header, signed.Add(SIGNATURE_TOLERANCE + time.Second), false},
+		{"secret", string(body), header, signed.Add(-SIGNATURE_TOLERANCE - time.Second), false},
+		{"secret", `{"id":"evt_1","type":"payment_intent.canceled"}`, header, signed, false},
+		{"secret", string(body) + " ", header, signed, false},
+		{"other secret", string(body), header, signed, false},
+		{"secret", string(body), " v1=" + header[len("t=1546300800,v1="):] + " , t=1546300800 ", signed, true},
+		{"secret", string(body), "t=1546300800", signed, false},
+		{"secret", string(body), "v1=" + header[len("t=1546300800,v1="):], signed, false},
+		{"secret", string(body), "t=now,v1=" + header[len("t=1546300800,v1="):], signed, false},
+		{"secret", string(body), "", signed, false},
+	}
+	for _, test := range tests {
+		err := VerifySignature(test.secret, []byte(test.body), test.header, test.now)
+		if test.ok && err != nil {
+			t.Errorf("VerifySignature(%q, %q, %q, %v) = %v, want nil", test.secret, test.body, test.header, test.now.Sub(signed), err)
+		}
+		if !test.ok && err != ErrBadSignature {
+			t.Errorf("VerifySignature(%q, %q, %q, %v) = %v, want ErrBadSignature", test.secret, test.body, test.header, test.now.Sub(signed), err)
+		}
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		number string
+		token  string
+		err    error
+	}{
+		{"4242424242424242", TOKEN_SUCCESS, nil},
+		{"4242 4242 4242 4242", TOKEN_SUCCESS, nil},
+		{"4000-0000-0000-3220", TOKEN_CHALLENGE, nil},
+		{"4000000000000002", TOKEN_DECLINED, nil},
+		{"4000000000009995", TOKEN_INSUFFICIENT_FUNDS, nil},
+		{"4000000000000077", TOKEN_DELAYED_CAPTURE, nil},
+		{"4242424242424241", "", ErrInvalidToken},
+		{"4242.4242.4242.4242", "", ErrInvalidToken},
+		{"", "", ErrInvalidToken},
+	}
+	for _, test := range tests {
+		token, err := Tokenize(test.number)
+		if token != test.token || err != test.err {
+			t.Errorf("Tokenize(%q) = %q, %v, want %q, %v", test.number, token, err, test.token, test.err)
+		}
+	}
+}
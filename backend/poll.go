@@ -15,6 +15,7 @@
 package backend
 
 import (
+	"backend/config"
 	"errors"
 	"fmt"
 	"golang.org/x/net/context"
@@ -77,11 +78,11 @@ type ClientId struct {
 var questions []string
 var pollQuestions PollQuestions
 
-func InitPollSample() {
+func InitPollSample(cfg *config.Config) {
 	questions = []string{"Penguins", "Ostriches", "Kiwis", "Wekas"}
 	pollQuestions = PollQuestions{questions}
 	RegisterHandler(POLL_SAMPLE_PATH+"submit", submitPoll)
-	RegisterSample(CATEGORY_SAMPLE_TEMPLATES+"/poll", handlePoll)
+	RegisterSample(cfg, CATEGORY_SAMPLE_TEMPLATES+"/poll", handlePoll)
 }
 
 func handlePoll(w http.ResponseWriter, r *http.Request, page Page) {
@@ -15,17 +15,22 @@
 package backend
 
 import (
+	"backend/config"
+	"backend/pagination"
 	"bytes"
 	"encoding/json"
 	"fmt"
 	"html/template"
 	"io"
 	"io/ioutil"
+	"log"
 	"net/http"
+	"os"
 	"path"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -77,17 +82,20 @@ type JsonRoot struct {
 
 var products []Product
 var cartCache *LRUCache
+
+// Guards cartCache and the carts in it.
+var cartLock sync.Mutex
 var productsRoot JsonRoot
 
-func InitProductBrowse() {
-	initProducts(DIST_FOLDER + "/json/related_products.json")
-	RegisterSample(SHOPPING_CART, gotToShoppingCart)
-	RegisterSample("samples_templates/product_browse_page", renderProductBrowsePage)
-	RegisterSample("samples_templates/product_page", renderProduct)
+func InitProductBrowse(cfg *config.Config) {
+	initProducts(cfg.DistDir + "/json/related_products.json")
+	RegisterSample(cfg, SHOPPING_CART, gotToShoppingCart)
+	RegisterSample(cfg, "samples_templates/product_browse_page", renderProductBrowsePage)
+	RegisterSample(cfg, "samples_templates/product_page", renderProduct)
 	RegisterSampleEndpoint("samples_templates/product_browse_page", SEARCH, handleSearchRequest)
 	RegisterHandler("/samples_templates/products", handleProductsRequest)
 	RegisterHandler("/samples_templates/products_autosuggest", handleProductsAutosuggestRequest)
-	RegisterHandler(SHOW_MORE_PATH, handleLoadMoreRequest)
+	RegisterHandler(SHOW_MORE_PATH, handleLoadMoreRequest(cfg.DistDir))
 	RegisterHandler(ADD_TO_CART_PATH, onlyPost(addToCart))
 	cartCache = NewLRUCache(100)
 }
@@ -104,6 +112,8 @@ func addToCart(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("AMP-Redirect-To", GetHost(r)+"/shopping_cart/?clientid="+clientId)
 
 	// create a new shopping cart if one doesn't exist yet
+	cartLock.Lock()
+	defer cartLock.Unlock()
 	value, shoppingCartIsInCache := cartCache.Get(clientId)
 	var shoppingCart map[ShoppingCartItem]int
 	if shoppingCartIsInCache {
@@ -119,7 +129,11 @@ func addToCart(w http.ResponseWriter, r *http.Request) {
 	size := r.FormValue("size")
 	// update the quantity
 	quantity, err := strconv.Atoi(r.FormValue("quantity"))
-	if err != nil {
+	if err != nil || quantity <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if _, err := parsePrice(price); err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
@@ -164,7 +178,10 @@ func renderShoppingCart(w http.ResponseWriter, r *http.Request, page Page, clien
 		w.WriteHeader(http.StatusBadRequest)
 		response := fmt.Sprintf("{\"error\":\"%s\"}", err)
 		w.Write([]byte(response))
+		return
 	}
+	cartLock.Lock()
+	defer cartLock.Unlock()
 	shoppingCart, exists := cartCache.Get(cookie.Value)
 	if !exists {
 		http.Error(w, http.StatusText(404), 404)
@@ -255,28 +272,50 @@ func handleSearchRequest(w http.ResponseWriter, r *http.Request, page Page) {
 	http.Redirect(w, r, route, http.StatusSeeOther)
 }
 
-func handleLoadMoreRequest(w http.ResponseWriter, r *http.Request) {
-	moreItemsPageIndex := r.URL.Query().Get("moreItemsPageIndex")
-	productsFile, err := ioutil.ReadFile(buildShowMorePath(moreItemsPageIndex))
-	if err != nil {
-		w.WriteHeader(http.StatusNotFound)
-	}
-	var productsRoot JsonRoot
-	err = json.Unmarshal(productsFile, &productsRoot)
-	if err != nil {
-		panic(err)
+// handleLoadMoreRequest serves the pages of related products in
+// dist/json/more_related_products_page<N>.json, counted from 0.
+func handleLoadMoreRequest(distDir string) http.HandlerFunc {
+	var pageCount int
+	for {
+		if _, err := os.Stat(buildShowMorePath(distDir, strconv.Itoa(pageCount))); err != nil {
+			break
+		}
+		pageCount++
 	}
-	if moreItemsPageIndex == "1" {
-		productsRoot.HasMorePages = false
-	} else {
-		productsRoot.HasMorePages = true
+	return func(w http.ResponseWriter, r *http.Request) {
+		pager := pagination.NewPager(r, GetHost(r), "moreItemsPageIndex")
+		// A page per file.
+		page, err := pager.Offset(pageCount, 1)
+		if err != nil {
+			sendPaginationError(w, r, err)
+			return
+		}
+		productsFile, err := ioutil.ReadFile(buildShowMorePath(distDir, strconv.Itoa(page.Number)))
+		if err != nil {
+			SendError(w, r, http.StatusNotFound, "No such page of products.")
+			return
+		}
+		var productsRoot JsonRoot
+		err = json.Unmarshal(productsFile, &productsRoot)
+		if err != nil {
+			log.Printf("Failed to parse products page %d: %v", page.Number, err)
+			SendError(w, r, http.StatusInternalServerError, "Failed to load products.")
+			return
+		}
+		// The show more button reads hasMorePages, amp-list with load-more
+		// the URL of the next page.
+		SendJsonResponse(w, struct {
+			pagination.LoadMore
+			HasMorePages bool `json:"hasMorePages"`
+		}{
+			pagination.NewLoadMore(productsRoot.Products, page),
+			page.Next != "",
+		})
 	}
-
-	SendJsonResponse(w, productsRoot)
 }
 
-func buildShowMorePath(moreItemsPageIndex string) string {
-	list := []string{DIST_FOLDER, SHOW_MORE_PATH, moreItemsPageIndex, ".json"}
+func buildShowMorePath(distDir string, moreItemsPageIndex string) string {
+	list := []string{distDir, SHOW_MORE_PATH, moreItemsPageIndex, ".json"}
 	var path bytes.Buffer
 
 	for _, l := range list {
@@ -0,0 +1,429 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package promotions applies discount codes to a cart. Codes give a
+// percentage or a fixed amount off, free shipping, or free items when buying
+// several of a kind. They can be limited in time and number of uses, and
+// only stackable codes can be combined.
+package promotions
+
+import (
+	"backend/money"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kinds of promotions.
+const (
+	PERCENTAGE    = "percentage"
+	FIXED_AMOUNT  = "fixed-amount"
+	FREE_SHIPPING = "free-shipping"
+	BUY_X_GET_Y   = "buy-x-get-y"
+)
+
+// Reasons for rejecting a code.
+const (
+	REJECT_UNKNOWN         = "unknown"
+	REJECT_NOT_STARTED     = "not-started"
+	REJECT_EXPIRED         = "expired"
+	REJECT_USED_UP         = "used-up"
+	REJECT_ALREADY_USED    = "already-used"
+	REJECT_ALREADY_APPLIED = "already-applied"
+	REJECT_MIN_SUBTOTAL    = "min-subtotal"
+	REJECT_NOT_APPLICABLE  = "not-applicable"
+	REJECT_NOT_STACKABLE   = "not-stackable"
+)
+
+type Promotion struct {
+	Code        string `json:"code"`
+	Kind        string `json:"kind"`
+	Description string `json:"description"`
+	// Percentage off the subtotal, for PERCENTAGE.
+	Percent int `json:"percent,omitempty"`
+	// Amount off the subtotal, for FIXED_AMOUNT.
+	Amount money.Amount `json:"amount,omitempty"`
+	// For BUY_X_GET_Y, every Buy items of SKU in the cart make Get more of
+	// them free. The free items are part of the Buy + Get.
+	SKU string `json:"sku,omitempty"`
+	Buy int    `json:"buy,omitempty"`
+	Get int    `json:"get,omitempty"`
+	// Subtotal needed for the code to apply.
+	MinSubtotal money.Amount `json:"minSubtotal,omitempty"`
+	// Validity window, zero values are unbounded.
+	Starts time.Time `json:"starts,omitempty"`
+	Ends   time.Time `json:"ends,omitempty"`
+	// Redemptions allowed in total and per customer, 0 is unlimited.
+	MaxUses            int `json:"maxUses,omitempty"`
+	MaxUsesPerCustomer int `json:"maxUsesPerCustomer,omitempty"`
+	// Stackable codes can be combined with other stackable codes. Other
+	// codes have to be used alone.
+	Stackable bool `json:"stackable,omitempty"`
+}
+
+// Item is a cart line.
+type Item struct {
+	SKU      string       `json:"sku"`
+	Name     string       `json:"name"`
+	Price    money.Amount `json:"price"`
+	Quantity int          `json:"quantity"`
+}
+
+type Cart struct {
+	Items    []Item
+	Shipping money.Amount
+}
+
+// Subtotal is the price of all items.
+func (c *Cart) Subtotal() money.Amount {
+	var subtotal money.Amount
+	for _, item := range c.Items {
+		subtotal += item.Price.Times(item.Quantity)
+	}
+	return subtotal
+}
+
+// Discount is the effect of one code on the cart.
+type Discount struct {
+	Code        string       `json:"code"`
+	Description string       `json:"description"`
+	Amount      money.Amount `json:"amount"`
+}
+
+// Result is the cart total after applying codes.
+type Result struct {
+	Subtotal  money.Amount `json:"subtotal"`
+	Discounts []Discount   `json:"discounts"`
+	// Sum of the discounts off the subtotal. Free shipping is reflected in
+	// Shipping instead.
+	Discount money.Amount `json:"discount"`
+	Shipping money.Amount `json:"shipping"`
+	Total    money.Amount `json:"total"`
+}
+
+// RejectedError explains why a code can't be used.
+type RejectedError struct {
+	Code   string
+	Reason string
+	// Shown to the user.
+	Message string
+}
+
+func (e *RejectedError) Error() string {
+	return fmt.Sprintf("promotions: %s rejected (%s): %s", e.Code, e.Reason, e.Message)
+}
+
+func reject(p *Promotion, code string, reason string, format string, args ...interface{}) *RejectedError {
+	if p != nil {
+		code = p.Code
+	}
+	return &RejectedError{Code: code, Reason: reason, Message: fmt.Sprintf(format, args...)}
+}
+
+// Engine knows the promotions and counts their redemptions. Counts are kept
+// in memory.
+type Engine struct {
+	promotions map[string]*Promotion
+	// Used for validity windows, time.Now if nil.
+	Now func() time.Time
+
+	lock         sync.Mutex
+	uses         map[string]int
+	customerUses map[string]int
+}
+
+// NewEngine returns an engine for promotions. Codes are case insensitive.
+func NewEngine(promotions []Promotion) (*Engine, error) {
+	e := &Engine{
+		promotions:   make(map[string]*Promotion),
+		uses:         make(map[string]int),
+		customerUses: make(map[string]int),
+	}
+	for i := range promotions {
+		p := promotions[i]
+		if err := p.validate(); err != nil {
+			return nil, err
+		}
+		key := normalize(p.Code)
+		if _, ok := e.promotions[key]; ok {
+			return nil, fmt.Errorf("promotions: duplicate code %q", p.Code)
+		}
+		e.promotions[key] = &p
+	}
+	return e, nil
+}
+
+func (p *Promotion) validate() error {
+	if normalize(p.Code) == "" {
+		return fmt.Errorf("promotions: empty code")
+	}
+	switch p.Kind {
+	case PERCENTAGE:
+		if p.Percent <= 0 || p.Percent > 100 {
+			return fmt.Errorf("promotions: %s: percent must be between 1 and 100", p.Code)
+		}
+	case FIXED_AMOUNT:
+		if p.Amount <= 0 {
+			return fmt.Errorf("promotions: %s: amount must be positive", p.Code)
+		}
+	case FREE_SHIPPING:
+	case BUY_X_GET_Y:
+		if p.SKU == "" || p.Buy <= 0 || p.Get <= 0 {
+			return fmt.Errorf("promotions: %s: needs sku, buy and get", p.Code)
+		}
+	default:
+		return fmt.Errorf("promotions: %s: unknown kind %q", p.Code, p.Kind)
+	}
+	if !p.Starts.IsZero() && !p.Ends.IsZero() && !p.Ends.After(p.Starts) {
+		return fmt.Errorf("promotions: %s: ends before it starts", p.Code)
+	}
+	return nil
+}
+
+func normalize(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func (e *Engine) now() time.Time {
+	if e.Now != nil {
+		return e.Now()
+	}
+	return time.Now()
+}
+
+// Lookup returns the promotion for code.
+func (e *Engine) Lookup(code string) (*Promotion, bool) {
+	p, ok := e.promotions[normalize(code)]
+	return p, ok
+}
+
+// Check reports why code can't be added by customer to a cart that has the
+// applied codes already, or nil if it can.
+func (e *Engine) Check(cart *Cart, applied []string, code string, customer string) error {
+	p, ok := e.Lookup(code)
+	if !ok {
+		return reject(nil, code, REJECT_UNKNOWN, "The code %s doesn't exist.", code)
+	}
+	for _, c := range applied {
+		if normalize(c) == normalize(code) {
+			return reject(p, code, REJECT_ALREADY_APPLIED, "The code %s is applied already.", p.Code)
+		}
+	}
+	if err := e.checkWindow(p); err != nil {
+		return err
+	}
+	e.lock.Lock()
+	uses, customerUses := e.uses[p.Code], e.customerUses[customerKey(p.Code, customer)]
+	e.lock.Unlock()
+	if p.MaxUses > 0 && uses >= p.MaxUses {
+		return reject(p, code, REJECT_USED_UP, "The code %s has been used up.", p.Code)
+	}
+	if p.MaxUsesPerCustomer > 0 && customerUses >= p.MaxUsesPerCustomer {
+		return reject(p, code, REJECT_ALREADY_USED, "You have used the code %s already.", p.Code)
+	}
+	for _, c := range applied {
+		other, ok := e.Lookup(c)
+		if !ok {
+			continue
+		}
+		if !p.Stackable || !other.Stackable {
+			return reject(p, code, REJECT_NOT_STACKABLE, "The code %s can't be combined with %s.", p.Code, other.Code)
+		}
+	}
+	return e.checkCart(p, cart)
+}
+
+func (e *Engine) checkWindow(p *Promotion) error {
+	now := e.now()
+	if !p.Starts.IsZero() && now.Before(p.Starts) {
+		return reject(p, "", REJECT_NOT_STARTED, "The code %s is valid from %s.", p.Code, p.Starts.Format("January 2, 2006"))
+	}
+	if !p.Ends.IsZero() && !now.Before(p.Ends) {
+		return reject(p, "", REJECT_EXPIRED, "The code %s expired on %s.", p.Code, p.Ends.Format("January 2, 2006"))
+	}
+	return nil
+}
+
+func (e *Engine) checkCart(p *Promotion, cart *Cart) error {
+	if subtotal := cart.Subtotal(); subtotal < p.MinSubtotal {
+		return reject(p, "", REJECT_MIN_SUBTOTAL, "The code %s needs a subtotal of at least $%s, add $%s more.",
+			p.Code, p.MinSubtotal, p.MinSubtotal-subtotal)
+	}
+	switch p.Kind {
+	case BUY_X_GET_Y:
+		if quantity(cart, p.SKU) < p.Buy+p.Get {
+			return reject(p, "", REJECT_NOT_APPLICABLE, "The code %s needs %d items of %s in the cart.",
+				p.Code, p.Buy+p.Get, itemName(cart, p.SKU))
+		}
+	case FREE_SHIPPING:
+		if cart.Shipping == 0 {
+			return reject(p, "", REJECT_NOT_APPLICABLE, "Shipping is free already.")
+		}
+	}
+	return nil
+}
+
+// Redeem counts a use of code by customer. It fails if that exceeds the
+// limits of the code.
+func (e *Engine) Redeem(code string, customer string) error {
+	return e.RedeemAll([]string{code}, customer)
+}
+
+// RedeemAll counts a use of every code by customer. If that exceeds the
+// limits of any code, none of them is counted.
+func (e *Engine) RedeemAll(codes []string, customer string) error {
+	var promotions []*Promotion
+	for _, code := range codes {
+		p, ok := e.Lookup(code)
+		if !ok {
+			return reject(nil, code, REJECT_UNKNOWN, "The code %s doesn't exist.", code)
+		}
+		promotions = append(promotions, p)
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	redeemed := make(map[string]int)
+	for _, p := range promotions {
+		redeemed[p.Code]++
+		if p.MaxUses > 0 && e.uses[p.Code]+redeemed[p.Code] > p.MaxUses {
+			return reject(p, "", REJECT_USED_UP, "The code %s has been used up.", p.Code)
+		}
+		key := customerKey(p.Code, customer)
+		if p.MaxUsesPerCustomer > 0 && e.customerUses[key]+redeemed[p.Code] > p.MaxUsesPerCustomer {
+			return reject(p, "", REJECT_ALREADY_USED, "You have used the code %s already.", p.Code)
+		}
+	}
+	for _, p := range promotions {
+		e.uses[p.Code]++
+		e.customerUses[customerKey(p.Code, customer)]++
+	}
+	return nil
+}
+
+// Release gives back uses counted by RedeemAll, e.g. when the order they
+// were redeemed for isn't paid.
+func (e *Engine) Release(codes []string, customer string) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	for _, code := range codes {
+		p, ok := e.Lookup(code)
+		if !ok {
+			continue
+		}
+		if e.uses[p.Code] > 0 {
+			e.uses[p.Code]--
+		}
+		key := customerKey(p.Code, customer)
+		if e.customerUses[key] > 1 {
+			e.customerUses[key]--
+		} else {
+			delete(e.customerUses, key)
+		}
+	}
+}
+
+// Apply computes the cart total with the codes. Codes that stopped being
+// valid, e.g. because items were removed, are skipped. Item discounts are
+// applied first, then percentages, then fixed amounts, so that the result
+// doesn't depend on the order the codes were entered in. The discount never
+// exceeds the subtotal.
+func (e *Engine) Apply(cart *Cart, codes []string) Result {
+	result := Result{
+		Subtotal:  cart.Subtotal(),
+		Discounts: []Discount{},
+		Shipping:  cart.Shipping,
+	}
+	var promotions []*Promotion
+	for _, code := range codes {
+		p, ok := e.Lookup(code)
+		if !ok || e.checkWindow(p) != nil || e.checkCart(p, cart) != nil {
+			continue
+		}
+		promotions = append(promotions, p)
+	}
+	sort.SliceStable(promotions, func(i, j int) bool {
+		return kindOrder[promotions[i].Kind] < kindOrder[promotions[j].Kind]
+	})
+
+	remaining := result.Subtotal
+	for _, p := range promotions {
+		var amount money.Amount
+		switch p.Kind {
+		case BUY_X_GET_Y:
+			free := quantity(cart, p.SKU) / (p.Buy + p.Get) * p.Get
+			amount = price(cart, p.SKU).Times(free)
+		case PERCENTAGE:
+			amount = remaining.Percent(p.Percent)
+		case FIXED_AMOUNT:
+			amount = p.Amount
+		case FREE_SHIPPING:
+			amount = result.Shipping
+			result.Shipping = 0
+			result.Discounts = append(result.Discounts, Discount{p.Code, p.Description, amount})
+			continue
+		}
+		amount = money.Min(amount, remaining)
+		remaining -= amount
+		result.Discount += amount
+		result.Discounts = append(result.Discounts, Discount{p.Code, p.Description, amount})
+	}
+	result.Total = result.Subtotal - result.Discount + result.Shipping
+	return result
+}
+
+var kindOrder = map[string]int{
+	BUY_X_GET_Y:   0,
+	PERCENTAGE:    1,
+	FIXED_AMOUNT:  2,
+	FREE_SHIPPING: 3,
+}
+
+func customerKey(code string, customer string) string {
+	return code + "\x00" + customer
+}
+
+func quantity(cart *Cart, sku string) int {
+	n := 0
+	for _, item := range cart.Items {
+		if item.SKU == sku {
+			n += item.Quantity
+		}
+	}
+	return n
+}
+
+// price is the lowest price of sku in the cart.
+func price(cart *Cart, sku string) money.Amount {
+	var lowest money.Amount = -1
+	for _, item := range cart.Items {
+		if item.SKU == sku && (lowest < 0 || item.Price < lowest) {
+			lowest = item.Price
+		}
+	}
+	if lowest < 0 {
+		return 0
+	}
+	return lowest
+}
+
+func itemName(cart *Cart, sku string) string {
+	for _, item := range cart.Items {
+		if item.SKU == sku {
+			return item.Name
+		}
+	}
+	return sku
+}
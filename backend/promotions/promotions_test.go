@@ -0,0 +1,204 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package promotions
+
+import (
+	"backend/money"
+	"testing"
+	"time"
+)
+
+var testPromotions = []Promotion{
+	{Code: "TEN", Kind: PERCENTAGE, Percent: 10, Stackable: true},
+	{Code: "FIFTEEN", Kind: PERCENTAGE, Percent: 15},
+	{Code: "FIVE", Kind: FIXED_AMOUNT, Amount: 500, Stackable: true},
+	{Code: "SHIP", Kind: FREE_SHIPPING, Stackable: true},
+	{Code: "SOCKS", Kind: BUY_X_GET_Y, SKU: "socks", Buy: 2, Get: 1, Stackable: true},
+	{Code: "BIG", Kind: FIXED_AMOUNT, Amount: 1000, MinSubtotal: 5000, Stackable: true},
+	{Code: "ONCE", Kind: PERCENTAGE, Percent: 5, MaxUses: 1, Stackable: true},
+	{Code: "SPRING", Kind: PERCENTAGE, Percent: 20, Stackable: true,
+		Starts: time.Date(2019, 3, 1, 0, 0, 0, 0, time.UTC),
+		Ends:   time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)},
+}
+
+func newTestEngine(t *testing.T) *Engine {
+	e, err := NewEngine(testPromotions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Now = func() time.Time {
+		return time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return e
+}
+
+func testCart() *Cart {
+	return &Cart{
+		Items: []Item{
+			{SKU: "shirt", Name: "Shirt", Price: 1999, Quantity: 1},
+			{SKU: "socks", Name: "Socks", Price: 499, Quantity: 3},
+		},
+		Shipping: 599,
+	}
+}
+
+func TestCheck(t *testing.T) {
+	e := newTestEngine(t)
+	tests := []struct {
+		applied []string
+		code    string
+		reason  string
+	}{
+		{nil, "ten", ""},
+		{nil, " Fifteen ", ""},
+		{[]string{"TEN"}, "FIVE", ""},
+		{[]string{"TEN", "FIVE"}, "SHIP", ""},
+		{nil, "NOPE", REJECT_UNKNOWN},
+		{[]string{"TEN"}, "ten", REJECT_ALREADY_APPLIED},
+		// Codes that aren't stackable can't be added to others, and
+		// nothing can be added to them.
+		{[]string{"TEN"}, "FIFTEEN", REJECT_NOT_STACKABLE},
+		{[]string{"FIFTEEN"}, "TEN", REJECT_NOT_STACKABLE},
+		{[]string{"FIVE", "SHIP"}, "FIFTEEN", REJECT_NOT_STACKABLE},
+		{nil, "BIG", REJECT_MIN_SUBTOTAL},
+		{nil, "SPRING", REJECT_NOT_STARTED},
+	}
+	for _, test := range tests {
+		err := e.Check(testCart(), test.applied, test.code, "alice")
+		switch {
+		case test.reason == "" && err != nil:
+			t.Errorf("Check(%v, %q) = %v, want nil", test.applied, test.code, err)
+		case test.reason != "" && err == nil:
+			t.Errorf("Check(%v, %q) = nil, want %s", test.applied, test.code, test.reason)
+		case test.reason != "" && err.(*RejectedError).Reason != test.reason:
+			t.Errorf("Check(%v, %q) = %v, want %s", test.applied, test.code, err, test.reason)
+		}
+	}
+}
+
+func TestCheckExpired(t *testing.T) {
+	e := newTestEngine(t)
+	e.Now = func() time.Time {
+		return time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+	}
+	err := e.Check(testCart(), nil, "SPRING", "alice")
+	if rejected, ok := err.(*RejectedError); !ok || rejected.Reason != REJECT_EXPIRED {
+		t.Errorf("Check(SPRING) = %v, want %s", err, REJECT_EXPIRED)
+	}
+}
+
+func TestApply(t *testing.T) {
+	e := newTestEngine(t)
+	tests := []struct {
+		codes    []string
+		discount money.Amount
+		shipping money.Amount
+	}{
+		{nil, 0, 599},
+		// 10% of 34.96 is 3.496.
+		{[]string{"TEN"}, 350, 599},
+		// The free pair of socks comes first, then 10% of 29.97.
+		{[]string{"TEN", "SOCKS"}, 499 + 300, 599},
+		{[]string{"SOCKS", "TEN"}, 499 + 300, 599},
+		// Percentages before fixed amounts, whatever the order.
+		{[]string{"FIVE", "TEN"}, 350 + 500, 599},
+		{[]string{"SHIP"}, 0, 0},
+		// Codes that don't apply to the cart are skipped.
+		{[]string{"BIG", "TEN"}, 350, 599},
+		{[]string{"NOPE"}, 0, 599},
+	}
+	for _, test := range tests {
+		result := e.Apply(testCart(), test.codes)
+		if result.Subtotal != 3496 {
+			t.Errorf("Apply(%v).Subtotal = %s, want 34.96", test.codes, result.Subtotal)
+		}
+		if result.Discount != test.discount || result.Shipping != test.shipping {
+			t.Errorf("Apply(%v) = discount %s, shipping %s, want %s, %s",
+				test.codes, result.Discount, result.Shipping, test.discount, test.shipping)
+		}
+		if want := result.Subtotal - result.Discount + result.Shipping; result.Total != want {
+			t.Errorf("Apply(%v).Total = %s, want %s", test.codes, result.Total, want)
+		}
+	}
+}
+
+func TestApplyCapsDiscount(t *testing.T) {
+	e := newTestEngine(t)
+	cart := &Cart{Items: []Item{{SKU: "pin", Name: "Pin", Price: 300, Quantity: 1}}}
+	result := e.Apply(cart, []string{"FIVE"})
+	if result.Discount != 300 || result.Total != 0 {
+		t.Errorf("Apply(FIVE) = discount %s, total %s, want 3.00, 0.00", result.Discount, result.Total)
+	}
+}
+
+func TestRedeem(t *testing.T) {
+	e := newTestEngine(t)
+	if err := e.Redeem("ONCE", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	err := e.Redeem("once", "bob")
+	if rejected, ok := err.(*RejectedError); !ok || rejected.Reason != REJECT_USED_UP {
+		t.Errorf("second Redeem(ONCE) = %v, want %s", err, REJECT_USED_UP)
+	}
+	err = e.Check(testCart(), nil, "ONCE", "bob")
+	if rejected, ok := err.(*RejectedError); !ok || rejected.Reason != REJECT_USED_UP {
+		t.Errorf("Check(ONCE) after use = %v, want %s", err, REJECT_USED_UP)
+	}
+}
+
+func TestNewEngineErrors(t *testing.T) {
+	tests := [][]Promotion{
+		{{Code: "", Kind: FREE_SHIPPING}},
+		{{Code: "A", Kind: PERCENTAGE, Percent: 101}},
+		{{Code: "A", Kind: FIXED_AMOUNT}},
+		{{Code: "A", Kind: BUY_X_GET_Y, SKU: "x", Buy: 1}},
+		{{Code: "A", Kind: "bogus"}},
+		{{Code: "a", Kind: FREE_SHIPPING}, {Code: "A", Kind: FREE_SHIPPING}},
+	}
+	for _, promotions := range tests {
+		if _, err := NewEngine(promotions); err == nil {
+			t.Errorf("NewEngine(%+v) succeeded, want an error", promotions)
+		}
+	}
+}
+
+func TestRedeemAll(t *testing.T) {
+	e := newTestEngine(t)
+	if err := e.Redeem("ONCE", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	// ONCE is used up, so TEN mustn't be counted either.
+	err := e.RedeemAll([]string{"TEN", "ONCE"}, "bob")
+	if rejected, ok := err.(*RejectedError); !ok || rejected.Reason != REJECT_USED_UP {
+		t.Fatalf("RedeemAll(TEN, ONCE) = %v, want %s", err, REJECT_USED_UP)
+	}
+	if e.uses["TEN"] != 0 {
+		t.Errorf("TEN counted %d uses after a failed RedeemAll", e.uses["TEN"])
+	}
+	if err := e.RedeemAll([]string{"TEN", "NOPE"}, "bob"); err == nil {
+		t.Error("RedeemAll succeeded with an unknown code")
+	}
+	// The same code twice counts twice.
+	if err := e.RedeemAll([]string{"ONCE", "ONCE"}, "bob"); err == nil {
+		t.Error("RedeemAll(ONCE, ONCE) succeeded")
+	}
+
+	e.Release([]string{"ONCE"}, "alice")
+	if err := e.RedeemAll([]string{"TEN", "ONCE"}, "bob"); err != nil {
+		t.Errorf("RedeemAll(TEN, ONCE) after Release = %v", err)
+	}
+	if e.uses["TEN"] != 1 || e.uses["ONCE"] != 1 {
+		t.Errorf("uses = %v, want TEN and ONCE once", e.uses)
+	}
+}
@@ -15,20 +15,128 @@
 package backend
 
 import (
+	"backend/config"
+	"backend/items"
+	"backend/ratings"
+	"log"
 	"net/http"
+	"strconv"
+
+	"google.golang.org/appengine"
 )
 
 const (
 	RATING_SAMPLE_PATH = "/" + CATEGORY_SAMPLE_TEMPLATES + "/rating/"
+	// Identifies users that aren't signed in.
+	AMP_RATING_USER_COOKIE = "amp-rating-user"
+	// Item rated with the star rating sample if the request doesn't name one.
+	RATING_DEFAULT_ITEM = "star-rating"
 )
 
-func InitRatingSample() {
+var ratingStore ratings.Store
+
+// AggregateRating is a schema.org AggregateRating, which can be embedded in
+// the structured data of a product, with the histogram and the rating of the
+// user added for amp-list.
+type AggregateRating struct {
+	Context     string          `json:"@context"`
+	Type        string          `json:"@type"`
+	RatingValue string          `json:"ratingValue"`
+	RatingCount int             `json:"ratingCount"`
+	BestRating  int             `json:"bestRating"`
+	WorstRating int             `json:"worstRating"`
+	Item        string          `json:"item"`
+	Histogram   []RatingBarData `json:"histogram"`
+	// Rating of the user, 0 if they didn't rate the item.
+	Rating int `json:"rating"`
+}
+
+type RatingBarData struct {
+	Rating int `json:"rating"`
+	Count  int `json:"count"`
+	// Share of all ratings, rounded to whole percents.
+	Percent int `json:"percent"`
+}
+
+func InitRatingSample(cfg *config.Config) {
+	ratingStore = ratings.ParseStore(cfg.RatingStore)
 	RegisterHandler(RATING_SAMPLE_PATH+"set", onlyPost(submitRatingXHR))
+	RegisterHandler(RATING_SAMPLE_PATH+"aggregate", handleAggregateRating)
 }
 
+// submitRatingXHR rates the item, or updates the rating of the user.
 func submitRatingXHR(w http.ResponseWriter, r *http.Request) {
-	rating := r.FormValue("rating")
-	SendJsonResponse(w, map[string]string{
-		"rating": rating,
-	})
+	SetMaxAge(w, 0)
+	item, ok := ratingItem(w, r)
+	if !ok {
+		return
+	}
+	value, err := strconv.Atoi(r.FormValue("rating"))
+	if err != nil || !ratings.ValidRating(value) {
+		SendError(w, r, http.StatusBadRequest, "Please choose between "+strconv.Itoa(ratings.MIN_RATING)+" and "+strconv.Itoa(ratings.MAX_RATING)+" stars.")
+		return
+	}
+	user := sampleUser(w, r, AMP_RATING_USER_COOKIE, true)
+	rating, err := ratingStore.Rate(appengine.NewContext(r), user, item, value)
+	if err != nil {
+		log.Printf("Failed to rate %s: %v", item, err)
+		SendError(w, r, http.StatusInternalServerError, "Could not save the rating.")
+		return
+	}
+	SendJsonResponse(w, newAggregateRating(rating))
+}
+
+// handleAggregateRating returns the AggregateRating of the item.
+func handleAggregateRating(w http.ResponseWriter, r *http.Request) {
+	SetMaxAge(w, 0)
+	item, ok := ratingItem(w, r)
+	if !ok {
+		return
+	}
+	user := sampleUser(w, r, AMP_RATING_USER_COOKIE, false)
+	rating, err := ratingStore.Get(appengine.NewContext(r), user, item)
+	if err != nil {
+		log.Printf("Failed to load the rating of %s: %v", item, err)
+		SendError(w, r, http.StatusInternalServerError, "Could not load the rating.")
+		return
+	}
+	SendJsonResponse(w, newAggregateRating(rating))
+}
+
+func ratingItem(w http.ResponseWriter, r *http.Request) (string, bool) {
+	item := r.FormValue("item")
+	if item == "" {
+		item = RATING_DEFAULT_ITEM
+	}
+	if !items.ValidID(item) {
+		SendError(w, r, http.StatusBadRequest, "Invalid item.")
+		return "", false
+	}
+	return item, true
+}
+
+func newAggregateRating(rating *ratings.Rating) AggregateRating {
+	count := rating.Count()
+	result := AggregateRating{
+		Context:     "http://schema.org/",
+		Type:        "AggregateRating",
+		RatingValue: strconv.FormatFloat(rating.Average(), 'f', 1, 64),
+		RatingCount: count,
+		BestRating:  ratings.MAX_RATING,
+		WorstRating: ratings.MIN_RATING,
+		Item:        rating.Item,
+		Rating:      rating.Value,
+	}
+	// Best ratings first, like the stars of the sample.
+	for value := ratings.MAX_RATING; value >= ratings.MIN_RATING; value-- {
+		bar := RatingBarData{
+			Rating: value,
+			Count:  rating.Histogram[value-ratings.MIN_RATING],
+		}
+		if count > 0 {
+			bar.Percent = (bar.Count*100 + count/2) / count
+		}
+		result.Histogram = append(result.Histogram, bar)
+	}
+	return result
 }
@@ -0,0 +1,141 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package ratings
+
+import (
+	"backend/items"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/datastore"
+)
+
+const (
+	RATING_KIND                 = "Rating"
+	RATING_HISTOGRAM_SHARD_KIND = "RatingHistogramShard"
+	// Histogram shards per item, each can take about one write a second.
+	HISTOGRAM_SHARDS = 10
+	// Tries of a rating that conflicts with others, each on another shard.
+	RATE_ATTEMPTS = 5
+)
+
+// DatastoreStore keeps the rating of each user as an entity keyed by item
+// and user, and the histogram of an item split over HISTOGRAM_SHARDS shard
+// entities, so that many users can rate an item at once. Rate replaces the
+// user's rating and moves it between the buckets of a random shard in one
+// cross-group transaction.
+type DatastoreStore struct{}
+
+type ratingEntity struct {
+	Value   int       `datastore:",noindex"`
+	Updated time.Time `datastore:",noindex"`
+}
+
+// Buckets of a shard may go below zero, only their sum counts.
+type histogramEntity struct {
+	Histogram []int `datastore:",noindex"`
+}
+
+func (s *DatastoreStore) Get(ctx context.Context, user string, item string) (*Rating, error) {
+	if !items.ValidID(item) {
+		return nil, ErrInvalidItem
+	}
+	return get(ctx, user, item)
+}
+
+func (s *DatastoreStore) Rate(ctx context.Context, user string, item string, value int) (*Rating, error) {
+	if err := validate(item, value); err != nil {
+		return nil, err
+	}
+	ratingKey := datastore.NewKey(ctx, RATING_KIND, item+"/"+user, 0, nil)
+	err := datastore.RunInTransaction(ctx, func(tc context.Context) error {
+		var previous ratingEntity
+		if err := datastore.Get(tc, ratingKey, &previous); err != nil && err != datastore.ErrNoSuchEntity {
+			return err
+		}
+		if previous.Value == value {
+			return nil
+		}
+		shardKey := histogramShardKey(tc, item, rand.Intn(HISTOGRAM_SHARDS))
+		var entity histogramEntity
+		if err := datastore.Get(tc, shardKey, &entity); err != nil && err != datastore.ErrNoSuchEntity {
+			return err
+		}
+		shard := Aggregate{}
+		copy(shard.Histogram[:], entity.Histogram)
+		shard.add(previous.Value, -1)
+		shard.add(value, 1)
+		if _, err := datastore.Put(tc, ratingKey, &ratingEntity{Value: value, Updated: time.Now()}); err != nil {
+			return err
+		}
+		_, err := datastore.Put(tc, shardKey, &histogramEntity{shard.Histogram[:]})
+		return err
+	}, &datastore.TransactionOptions{XG: true, Attempts: RATE_ATTEMPTS})
+	if err != nil {
+		return nil, err
+	}
+	rating, err := get(ctx, "", item)
+	if err != nil {
+		return nil, err
+	}
+	rating.Value = value
+	return rating, nil
+}
+
+func histogramShardKey(ctx context.Context, item string, shard int) *datastore.Key {
+	return datastore.NewKey(ctx, RATING_HISTOGRAM_SHARD_KIND, item+"/"+strconv.Itoa(shard), 0, nil)
+}
+
+func get(ctx context.Context, user string, item string) (*Rating, error) {
+	keys := make([]*datastore.Key, HISTOGRAM_SHARDS)
+	for shard := range keys {
+		keys[shard] = histogramShardKey(ctx, item, shard)
+	}
+	shards := make([]histogramEntity, HISTOGRAM_SHARDS)
+	if err := datastore.GetMulti(ctx, keys, shards); err != nil {
+		errs, ok := err.(appengine.MultiError)
+		if !ok {
+			return nil, err
+		}
+		for _, err := range errs {
+			if err != nil && err != datastore.ErrNoSuchEntity {
+				return nil, err
+			}
+		}
+	}
+	rating := &Rating{}
+	rating.Item = item
+	for _, shard := range shards {
+		for i, n := range shard.Histogram {
+			if i < len(rating.Histogram) {
+				rating.Histogram[i] += n
+			}
+		}
+	}
+	if user == "" {
+		return rating, nil
+	}
+	var entity ratingEntity
+	switch err := datastore.Get(ctx, datastore.NewKey(ctx, RATING_KIND, item+"/"+user, 0, nil), &entity); err {
+	case nil:
+		rating.Value = entity.Value
+	case datastore.ErrNoSuchEntity:
+	default:
+		return nil, err
+	}
+	return rating, nil
+}
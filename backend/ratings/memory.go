@@ -0,0 +1,75 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package ratings
+
+import (
+	"backend/items"
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+// MemoryStore keeps ratings in memory, for development.
+type MemoryStore struct {
+	lock sync.Mutex
+	// Rating by item and user.
+	ratings    map[string]map[string]int
+	aggregates map[string]Aggregate
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		ratings:    make(map[string]map[string]int),
+		aggregates: make(map[string]Aggregate),
+	}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, user string, item string) (*Rating, error) {
+	if !items.ValidID(item) {
+		return nil, ErrInvalidItem
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.rating(user, item), nil
+}
+
+func (s *MemoryStore) Rate(ctx context.Context, user string, item string, value int) (*Rating, error) {
+	if err := validate(item, value); err != nil {
+		return nil, err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	users, ok := s.ratings[item]
+	if !ok {
+		users = make(map[string]int)
+		s.ratings[item] = users
+	}
+	aggregate := s.aggregates[item]
+	aggregate.Item = item
+	aggregate.add(users[user], -1)
+	aggregate.add(value, 1)
+	s.aggregates[item] = aggregate
+	users[user] = value
+	return s.rating(user, item), nil
+}
+
+// rating needs s to be locked.
+func (s *MemoryStore) rating(user string, item string) *Rating {
+	rating := &Rating{
+		Aggregate: s.aggregates[item],
+		Value:     s.ratings[item][user],
+	}
+	rating.Item = item
+	return rating
+}
@@ -0,0 +1,105 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// Package ratings stores one rating per user and item, and keeps the number
+// of ratings of each value per item to compute the average rating from.
+package ratings
+
+import (
+	"backend/items"
+	"errors"
+	"fmt"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	MIN_RATING = 1
+	MAX_RATING = 5
+)
+
+var (
+	ErrInvalidItem   = errors.New("ratings: invalid item ID")
+	ErrInvalidRating = fmt.Errorf("ratings: rating must be between %d and %d", MIN_RATING, MAX_RATING)
+)
+
+// Aggregate summarizes the ratings of an item.
+type Aggregate struct {
+	Item string
+	// Number of ratings by value, the first counts MIN_RATING.
+	Histogram [MAX_RATING - MIN_RATING + 1]int
+}
+
+// Count returns the number of ratings.
+func (a *Aggregate) Count() int {
+	count := 0
+	for _, n := range a.Histogram {
+		count += n
+	}
+	return count
+}
+
+// Average returns the mean rating, or 0 if the item hasn't been rated.
+func (a *Aggregate) Average() float64 {
+	count, sum := 0, 0
+	for i, n := range a.Histogram {
+		count += n
+		sum += n * (MIN_RATING + i)
+	}
+	if count == 0 {
+		return 0
+	}
+	return float64(sum) / float64(count)
+}
+
+// add counts value, or uncounts it if n is negative.
+func (a *Aggregate) add(value int, n int) {
+	if ValidRating(value) {
+		a.Histogram[value-MIN_RATING] += n
+	}
+}
+
+type Rating struct {
+	Aggregate
+	// The rating of the user, 0 if they didn't rate the item.
+	Value int
+}
+
+type Store interface {
+	Get(ctx context.Context, user string, item string) (*Rating, error)
+	// Rate sets the rating of user for item, replacing an earlier one.
+	Rate(ctx context.Context, user string, item string, value int) (*Rating, error)
+}
+
+// ValidRating reports whether value is between MIN_RATING and MAX_RATING.
+func ValidRating(value int) bool {
+	return value >= MIN_RATING && value <= MAX_RATING
+}
+
+func validate(item string, value int) error {
+	if !items.ValidID(item) {
+		return ErrInvalidItem
+	}
+	if !ValidRating(value) {
+		return ErrInvalidRating
+	}
+	return nil
+}
+
+// ParseStore returns the ratings store for spec, see items.UseDatastore.
+func ParseStore(spec string) Store {
+	if items.UseDatastore(spec) {
+		return &DatastoreStore{}
+	}
+	return NewMemoryStore()
+}
@@ -0,0 +1,162 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redirect
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	DEFAULT_RELOAD_INTERVAL = 10 * time.Second
+)
+
+// Engine serves the redirects from a rules file. The file is checked for
+// changes at most every ReloadInterval while requests come in; a file that
+// fails to load is logged and the previous rules are kept.
+type Engine struct {
+	Path           string
+	Host           string
+	ReloadInterval time.Duration
+
+	lock      sync.RWMutex
+	table     *Table
+	modTime   time.Time
+	lastCheck time.Time
+
+	// Hits by rule source since the engine was created. Counts survive
+	// reloads as long as the source stays the same.
+	hitsLock sync.Mutex
+	hits     map[string]uint64
+	started  time.Time
+}
+
+// Stats are the hit counts of all current rules on this instance.
+type Stats struct {
+	Since time.Time  `json:"since"`
+	Rules []RuleHits `json:"rules"`
+}
+
+type RuleHits struct {
+	Rule
+	Hits uint64 `json:"hits"`
+}
+
+// NewEngine loads the rules from path. Relative targets and loop detection
+// use host.
+func NewEngine(path string, host string) (*Engine, error) {
+	e := &Engine{
+		Path:           path,
+		Host:           host,
+		ReloadInterval: DEFAULT_RELOAD_INTERVAL,
+		hits:           make(map[string]uint64),
+		started:        time.Now(),
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.load(info.ModTime()); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *Engine) load(modTime time.Time) error {
+	table, err := Load(e.Path)
+	if err != nil {
+		return err
+	}
+	chains, err := table.Check(e.Host)
+	if err != nil {
+		return err
+	}
+	for _, chain := range chains {
+		log.Printf("Redirect chain: %s", chain)
+	}
+	log.Printf("Loaded %d redirects from %s", len(table.Rules), e.Path)
+
+	e.lock.Lock()
+	e.table = table
+	e.modTime = modTime
+	e.lock.Unlock()
+	return nil
+}
+
+func (e *Engine) reloadIfChanged() {
+	e.lock.Lock()
+	if time.Since(e.lastCheck) < e.ReloadInterval {
+		e.lock.Unlock()
+		return
+	}
+	e.lastCheck = time.Now()
+	modTime := e.modTime
+	e.lock.Unlock()
+
+	info, err := os.Stat(e.Path)
+	if err != nil || info.ModTime().Equal(modTime) {
+		return
+	}
+	if err := e.load(info.ModTime()); err != nil {
+		log.Printf("Keeping previous redirects, failed to reload %s: %v", e.Path, err)
+	}
+}
+
+// Lookup returns the redirect target and status code for a request.
+func (e *Engine) Lookup(r *http.Request) (string, int, bool) {
+	e.reloadIfChanged()
+	e.lock.RLock()
+	table := e.table
+	e.lock.RUnlock()
+
+	rule, target, ok := table.Match(r.URL.Path)
+	if !ok {
+		return "", 0, false
+	}
+	e.hitsLock.Lock()
+	e.hits[rule.Source]++
+	e.hitsLock.Unlock()
+	return Resolve(e.Host, target, r.URL), rule.Status, true
+}
+
+// Stats returns the rules in file order with the number of requests they
+// redirected.
+func (e *Engine) Stats() *Stats {
+	e.lock.RLock()
+	table := e.table
+	e.lock.RUnlock()
+
+	e.hitsLock.Lock()
+	defer e.hitsLock.Unlock()
+	stats := &Stats{Since: e.started}
+	for _, c := range table.Rules {
+		stats.Rules = append(stats.Rules, RuleHits{c.Rule, e.hits[c.Source]})
+	}
+	return stats
+}
+
+// Handler redirects matching requests and passes all others to next.
+func (e *Engine) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if target, status, ok := e.Lookup(r); ok {
+			http.Redirect(w, r, target, status)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,119 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redirect
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	PROBLEM_INVALID   = "invalid"
+	PROBLEM_DUPLICATE = "duplicate"
+	PROBLEM_SHADOWED  = "shadowed"
+	PROBLEM_CHAIN     = "chain"
+	PROBLEM_LOOP      = "loop"
+	PROBLEM_MISSING   = "missing"
+)
+
+// Problem is an issue with a single rule found by Analyze.
+type Problem struct {
+	Rule    Rule
+	Index   int
+	Kind    string
+	Message string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("#%d %s: %s: %s", p.Index, p.Rule.Source, p.Kind, p.Message)
+}
+
+// Analyze reports duplicate and invalid rules, rules shadowed by other rules
+// and targets on host that redirect again. If exists is set, it is called
+// with the final path of every target on host and targets it doesn't find
+// are reported as missing.
+func Analyze(rules []Rule, host string, exists func(path string) bool) []Problem {
+	var problems []Problem
+	report := func(index int, kind string, format string, args ...interface{}) {
+		problems = append(problems, Problem{
+			Rule:    rules[index],
+			Index:   index,
+			Kind:    kind,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	// Drop the rules that would keep the table from loading so the rest can
+	// still be checked.
+	var valid []Rule
+	var indexes []int
+	first := make(map[string]int)
+	for i, rule := range rules {
+		if _, err := compile(rule, i); err != nil {
+			report(i, PROBLEM_INVALID, "%v", err)
+			continue
+		}
+		key := strings.TrimSuffix(rule.Source, "*")
+		if j, ok := first[key]; ok {
+			report(i, PROBLEM_DUPLICATE, "same source as #%d", j)
+			continue
+		}
+		first[key] = i
+		valid = append(valid, rule)
+		indexes = append(indexes, i)
+	}
+	t, err := NewTable(valid)
+	if err != nil {
+		// Not expected after the checks above.
+		panic(err)
+	}
+
+	for _, c := range t.Rules {
+		index := indexes[c.Index]
+		if strings.HasPrefix(c.Source, "^") {
+			// There's no telling which paths a regular expression is meant for.
+		} else if other, _, ok := t.Match(samplePath(c)); ok && other != c {
+			report(index, PROBLEM_SHADOWED, "requests for %s go to #%d %s", samplePath(c), indexes[other.Index], other.Source)
+		}
+		hops, target, err := t.follow(c, host)
+		if err != nil {
+			report(index, PROBLEM_LOOP, "%v", err)
+			continue
+		}
+		if len(hops) > 1 {
+			report(index, PROBLEM_CHAIN, "%s -> %s", strings.Join(hops, " -> "), target)
+		}
+		if exists == nil || c.re != nil || c.splat {
+			continue
+		}
+		if path, ok := localPath(host, target); ok && !exists(path) {
+			report(index, PROBLEM_MISSING, "%s not found", path)
+		}
+	}
+	return problems
+}
+
+// samplePath returns a path the rule is meant to match.
+func samplePath(c *compiledRule) string {
+	switch {
+	case c.prefix != "":
+		return c.prefix
+	case c.re != nil:
+		path := namedSegmentRegex.ReplaceAllString(c.Source, "/example")
+		return strings.TrimSuffix(path, "*")
+	default:
+		return c.Source
+	}
+}
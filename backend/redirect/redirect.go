@@ -0,0 +1,307 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package redirect matches request paths against a table of redirect rules.
+//
+// A rule's source is one of:
+//
+//	/exact.html           matches only this path
+//	/folder/              matches the folder and everything below it, like a
+//	                      http.ServeMux pattern; the longest match wins
+//	/folder/*             same, the rest of the path replaces * in the target
+//	/components/:name/    :name matches a single path segment and replaces
+//	                      :name in the target
+//	^/regexp/(.*)$        a regular expression; $1 or ${name} in the target
+//	                      are replaced by the captured groups
+//
+// Exact rules take precedence over patterns and regular expressions, which
+// take precedence over folders.
+package redirect
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const (
+	MAX_CHAIN_LENGTH = 10
+)
+
+var namedSegmentRegex = regexp.MustCompile(`/:([A-Za-z_][A-Za-z0-9_]*)`)
+
+type Rule struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	// 301 (default), 302 or 308.
+	Status int `json:"status,omitempty"`
+}
+
+// compiledRule is a Rule prepared for matching.
+type compiledRule struct {
+	Rule
+	// Position of the rule in the file.
+	Index int
+	// Set for folder rules.
+	prefix string
+	splat  bool
+	// Set for pattern and regular expression rules.
+	re     *regexp.Regexp
+	target string
+}
+
+// Table is a parsed set of rules.
+type Table struct {
+	Rules    []*compiledRule
+	exact    map[string]*compiledRule
+	prefixes map[string]*compiledRule
+	patterns []*compiledRule
+}
+
+// ParseRules reads rules from JSON without checking them.
+func ParseRules(data []byte) ([]Rule, error) {
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// Parse reads rules from JSON and prepares them for matching.
+func Parse(data []byte) (*Table, error) {
+	rules, err := ParseRules(data)
+	if err != nil {
+		return nil, err
+	}
+	return NewTable(rules)
+}
+
+// Load reads the rules from a JSON file.
+func Load(path string) (*Table, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// NewTable prepares rules for matching.
+func NewTable(rules []Rule) (*Table, error) {
+	t := &Table{
+		exact:    make(map[string]*compiledRule),
+		prefixes: make(map[string]*compiledRule),
+	}
+	for i, rule := range rules {
+		c, err := compile(rule, i)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case c.re != nil:
+			t.patterns = append(t.patterns, c)
+		case c.prefix != "":
+			if other, ok := t.prefixes[c.prefix]; ok {
+				return nil, fmt.Errorf("redirect: %q and %q match the same folder", other.Source, c.Source)
+			}
+			t.prefixes[c.prefix] = c
+		default:
+			if _, ok := t.exact[c.Source]; ok {
+				return nil, fmt.Errorf("redirect: duplicate source %q", c.Source)
+			}
+			t.exact[c.Source] = c
+		}
+		t.Rules = append(t.Rules, c)
+	}
+	return t, nil
+}
+
+func compile(rule Rule, index int) (*compiledRule, error) {
+	if rule.Status == 0 {
+		rule.Status = http.StatusMovedPermanently
+	}
+	switch rule.Status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusPermanentRedirect:
+	default:
+		return nil, fmt.Errorf("redirect: unsupported status %d for %q", rule.Status, rule.Source)
+	}
+	if rule.Target == "" {
+		return nil, fmt.Errorf("redirect: missing target for %q", rule.Source)
+	}
+	c := &compiledRule{Rule: rule, Index: index, target: rule.Target}
+
+	source := rule.Source
+	switch {
+	case strings.HasPrefix(source, "^"):
+		re, err := regexp.Compile(source)
+		if err != nil {
+			return nil, fmt.Errorf("redirect: %q: %v", source, err)
+		}
+		c.re = re
+	case namedSegmentRegex.MatchString(source):
+		// Turn /components/:name/* into ^/components/(?P<name>[^/]+)/(?P<splat>.*)$
+		pattern := regexp.QuoteMeta(source)
+		pattern = namedSegmentRegex.ReplaceAllString(pattern, `/(?P<$1>[^/]+)`)
+		target := namedSegmentRegex.ReplaceAllString(rule.Target, `/$${$1}`)
+		if strings.HasSuffix(source, "/*") {
+			pattern = strings.TrimSuffix(pattern, `\*`) + `(?P<splat>.*)`
+			target = strings.Replace(target, "*", "${splat}", -1)
+		}
+		re, err := regexp.Compile("^" + pattern + "$")
+		if err != nil {
+			return nil, fmt.Errorf("redirect: %q: %v", source, err)
+		}
+		c.re = re
+		c.target = target
+	case strings.HasSuffix(source, "/*"):
+		c.prefix = strings.TrimSuffix(source, "*")
+		c.splat = true
+	case strings.HasSuffix(source, "/"):
+		c.prefix = source
+	case !strings.HasPrefix(source, "/"):
+		return nil, fmt.Errorf("redirect: source %q must start with /", source)
+	}
+	return c, nil
+}
+
+// Match returns the rule for path and its target with captures replaced.
+func (t *Table) Match(path string) (*compiledRule, string, bool) {
+	if c, ok := t.exact[path]; ok {
+		return c, c.target, true
+	}
+	for _, c := range t.patterns {
+		match := c.re.FindStringSubmatchIndex(path)
+		if match == nil {
+			continue
+		}
+		return c, string(c.re.ExpandString(nil, c.target, path, match)), true
+	}
+	// Walk up the folders, longest first. A folder rule also matches the
+	// folder without the trailing slash.
+	prefix := path
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	for {
+		i := strings.LastIndex(prefix, "/")
+		if i < 0 {
+			break
+		}
+		prefix = prefix[:i+1]
+		if c, ok := t.prefixes[prefix]; ok {
+			target := c.target
+			if c.splat {
+				rest := ""
+				if len(path) > len(prefix) {
+					rest = path[len(prefix):]
+				}
+				target = strings.Replace(target, "*", rest, 1)
+			}
+			return c, target, true
+		}
+		prefix = prefix[:i]
+	}
+	return nil, "", false
+}
+
+// Resolve returns the absolute URL for a redirect from a request to
+// requestURL. Relative targets are resolved against host and the request's
+// query string is merged into the target's, ahead of any fragment.
+func Resolve(host string, target string, requestURL *url.URL) string {
+	if !strings.HasPrefix(target, "http://") && !strings.HasPrefix(target, "https://") {
+		target = host + target
+	}
+	if requestURL.RawQuery == "" {
+		return target
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return target
+	}
+	if u.RawQuery == "" {
+		u.RawQuery = requestURL.RawQuery
+	} else {
+		u.RawQuery += "&" + requestURL.RawQuery
+	}
+	return u.String()
+}
+
+// Check follows the targets on host through the table and returns an error
+// for loops and a description of every chain of redirects.
+func (t *Table) Check(host string) ([]string, error) {
+	var chains []string
+	for _, c := range t.Rules {
+		hops, target, err := t.follow(c, host)
+		if err != nil {
+			return nil, err
+		}
+		if len(hops) > 1 {
+			chains = append(chains, strings.Join(hops, " -> ")+" -> "+target)
+		}
+	}
+	return chains, nil
+}
+
+// follow returns the paths visited when redirecting from the rule's source
+// and the final target. Rules whose target depends on the request path are
+// not followed.
+func (t *Table) follow(c *compiledRule, host string) ([]string, string, error) {
+	hops := []string{c.Source}
+	if c.re != nil || c.splat {
+		return hops, c.target, nil
+	}
+	seen := map[string]bool{c.Source: true}
+	target := c.target
+	for {
+		next, ok := localPath(host, target)
+		if !ok {
+			break
+		}
+		if seen[next] {
+			return nil, "", fmt.Errorf("redirect: loop %s -> %s", strings.Join(hops, " -> "), next)
+		}
+		_, nextTarget, ok := t.Match(next)
+		if !ok {
+			break
+		}
+		seen[next] = true
+		hops = append(hops, next)
+		target = nextTarget
+		if len(hops) > MAX_CHAIN_LENGTH {
+			return nil, "", fmt.Errorf("redirect: chain too long %s", strings.Join(hops, " -> "))
+		}
+	}
+	return hops, target, nil
+}
+
+// localPath returns the path of target if it points to host.
+func localPath(host string, target string) (string, bool) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", false
+	}
+	if u.Host != "" {
+		h, err := url.Parse(host)
+		if err != nil || h.Host != u.Host {
+			return "", false
+		}
+	}
+	if u.Path == "" {
+		return "/", true
+	}
+	return u.Path, true
+}
@@ -0,0 +1,124 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package redirect
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	table, err := NewTable([]Rule{
+		{Source: "/components/amp-foo/", Target: "/components/amp-bar/"},
+		{Source: "/components/amp-foo/exact.html", Target: "/exact/"},
+		{Source: "/components/", Target: "/docs/components/"},
+		{Source: "/samples/*", Target: "/documentation/examples/*"},
+		{Source: "/samples/:name/preview/", Target: "/preview/:name/"},
+		{Source: "^/old-(\\d+)\\.html$", Target: "/new/$1/"},
+		{Source: "/old-1.html", Target: "/exact-old/", Status: 302},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path   string
+		target string
+		status int
+	}{
+		// Exact rules win over patterns and folders.
+		{"/components/amp-foo/exact.html", "/exact/", 301},
+		{"/old-1.html", "/exact-old/", 302},
+		// Regular expressions.
+		{"/old-42.html", "/new/42/", 301},
+		// Named segments win over folders.
+		{"/samples/carousel/preview/", "/preview/carousel/", 301},
+		// Splats carry the rest of the path.
+		{"/samples/carousel/", "/documentation/examples/carousel/", 301},
+		{"/samples/", "/documentation/examples/", 301},
+		{"/samples", "/documentation/examples/", 301},
+		// The longest folder wins, with or without the trailing slash.
+		{"/components/amp-foo/", "/components/amp-bar/", 301},
+		{"/components/amp-foo", "/components/amp-bar/", 301},
+		{"/components/amp-foo/page.html", "/components/amp-bar/", 301},
+		{"/components/amp-other", "/docs/components/", 301},
+		{"/components", "/docs/components/", 301},
+	}
+	for _, test := range tests {
+		rule, target, ok := table.Match(test.path)
+		if !ok {
+			t.Errorf("Match(%q) didn't match", test.path)
+			continue
+		}
+		if target != test.target || rule.Status != test.status {
+			t.Errorf("Match(%q) = %q %d, want %q %d", test.path, target, rule.Status, test.target, test.status)
+		}
+	}
+	for _, path := range []string{"/", "/component", "/old-x.html", "/componentsfoo"} {
+		if _, target, ok := table.Match(path); ok {
+			t.Errorf("Match(%q) = %q, want no match", path, target)
+		}
+	}
+}
+
+func TestNewTableErrors(t *testing.T) {
+	tests := [][]Rule{
+		{{Source: "/a", Target: "/b"}, {Source: "/a", Target: "/c"}},
+		{{Source: "/a/", Target: "/b"}, {Source: "/a/*", Target: "/c"}},
+		{{Source: "/a", Target: "/b", Status: 307}},
+		{{Source: "/a"}},
+		{{Source: "a", Target: "/b"}},
+		{{Source: "^/(", Target: "/b"}},
+	}
+	for _, rules := range tests {
+		if _, err := NewTable(rules); err == nil {
+			t.Errorf("NewTable(%v) succeeded, want an error", rules)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		target string
+		url    string
+		want   string
+	}{
+		{"/b/", "/a/", "https://example.com/b/"},
+		{"/b/", "/a/?x=1", "https://example.com/b/?x=1"},
+		{"/b/?y=2", "/a/?x=1", "https://example.com/b/?y=2&x=1"},
+		{"https://other.com/", "/a/?x=1", "https://other.com/?x=1"},
+		{"/b/#top", "/a/?x=1", "https://example.com/b/?x=1#top"},
+		{"/b/?y=2#top", "/a/?x=1", "https://example.com/b/?y=2&x=1#top"},
+		{"/b/#top", "/a/", "https://example.com/b/#top"},
+		{"/b/%C3%A9/", "/a/?x=%2F", "https://example.com/b/%C3%A9/?x=%2F"},
+	}
+	for _, test := range tests {
+		u, _ := url.Parse(test.url)
+		if got := Resolve("https://example.com", test.target, u); got != test.want {
+			t.Errorf("Resolve(%q, %q) = %q, want %q", test.target, test.url, got, test.want)
+		}
+	}
+}
+
+func TestCheckLoops(t *testing.T) {
+	table, err := NewTable([]Rule{
+		{Source: "/a", Target: "/b"},
+		{Source: "/b", Target: "/a"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := table.Check("https://example.com"); err == nil {
+		t.Error("Check succeeded for a loop")
+	}
+}
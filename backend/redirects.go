@@ -15,48 +15,35 @@
 package backend
 
 import (
-	"encoding/json"
-	"io/ioutil"
+	"backend/config"
+	"backend/redirect"
 	"log"
 	"net/http"
-	"strings"
 )
 
-const HOST = "https://ampbyexample.com"
+const (
+	// Restricted to admins in app.yaml.
+	REDIRECT_STATS_PATH = "/redirects/stats"
+)
 
-type Redirect struct {
-	Source string `json:"source"`
-	Target string `json:"target"`
-}
+var redirects *redirect.Engine
 
-func InitRedirects() {
-	redirects, err := parseRedirects("backend/redirects-amp.dev.json")
+func InitRedirects(cfg *config.Config) {
+	log.Printf("Setting up redirects")
+	engine, err := redirect.NewEngine(cfg.Redirects, cfg.Host)
 	if err != nil {
 		panic(err)
 	}
-
-	log.Printf("Setting up redirects")
-	for _, redirect := range redirects {
-		source := redirect.Source
-		target := redirect.Target
-		if !strings.HasPrefix(target, "http") {
-			target = HOST + target
-		}
-
-		//log.Printf("Redirect %s -> %s", source, target)
-		http.Handle(source, http.RedirectHandler(target, 301))
+	redirects = engine
+	http.HandleFunc(REDIRECT_STATS_PATH, serveRedirectStats)
+	// InitStatic serves "/" itself and falls back to the redirects.
+	if !cfg.Features.Static {
+		http.Handle("/", Recover(redirects.Handler(http.HandlerFunc(NotFound))))
 	}
 }
 
-func parseRedirects(configPath string) ([]Redirect, error) {
-	data, err := ioutil.ReadFile(configPath)
-	if err != nil {
-		return nil, err
-	}
-	var redirects []Redirect
-	err = json.Unmarshal(data, &redirects)
-	if err != nil {
-		return nil, err
-	}
-	return redirects, nil
+// serveRedirectStats lists the hits per rule on this instance, so that rules
+// nobody uses anymore can be removed.
+func serveRedirectStats(w http.ResponseWriter, r *http.Request) {
+	SendJsonResponse(w, redirects.Stats())
 }
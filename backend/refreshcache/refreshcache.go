@@ -0,0 +1,239 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package refreshcache keeps remotely loaded values in memory (L1) and in a
+// persistent store shared by all instances (L2). Values that are older than
+// FreshFor are still served while they are refreshed in the background.
+// Concurrent loads of the same key on an instance are merged, and failing
+// loaders are retried with exponential backoff.
+package refreshcache
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	DEFAULT_MIN_BACKOFF = 10 * time.Second
+	DEFAULT_MAX_BACKOFF = 10 * time.Minute
+)
+
+// ErrMiss is returned by stores that don't have a key.
+var ErrMiss = errors.New("refreshcache: miss")
+
+// Entry is a cached value and the time it was loaded.
+type Entry struct {
+	Value   []byte `datastore:",noindex"`
+	Fetched time.Time
+}
+
+// Store is the persistent tier.
+type Store interface {
+	Get(ctx context.Context, key string) (*Entry, error)
+	Set(ctx context.Context, key string, entry *Entry) error
+}
+
+// Loader loads the current value for key from its origin.
+type Loader func(ctx context.Context, key string) ([]byte, error)
+
+type Options struct {
+	// Loads values that are missing or stale.
+	Loader Loader
+	// Persistent tier, nil to only keep values in memory.
+	Store Store
+	// How long a value is served without refreshing it.
+	FreshFor time.Duration
+	// How long a value is served while it is refreshed in the background
+	// once FreshFor has passed. After that, Get waits for the refresh. Zero
+	// means stale values are always served.
+	MaxStale time.Duration
+	// Backoff after failed loads, defaults to DEFAULT_MIN_BACKOFF and
+	// DEFAULT_MAX_BACKOFF.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// Starts a background refresh of a stale entry, which has to call
+	// Refresh eventually. Request contexts end with the request on App
+	// Engine, so use a task queue there. Defaults to a goroutine.
+	Revalidate func(ctx context.Context, key string, stale *Entry)
+	// Returns the current time, defaults to time.Now.
+	Now func() time.Time
+}
+
+type Cache struct {
+	opts Options
+
+	lock    sync.Mutex
+	entries map[string]*Entry
+	calls   map[string]*call
+	backoff map[string]*backoff
+}
+
+// call is a load in progress.
+type call struct {
+	wg    sync.WaitGroup
+	entry *Entry
+	err   error
+}
+
+type backoff struct {
+	failures int
+	retryAt  time.Time
+	err      error
+}
+
+func New(opts Options) *Cache {
+	if opts.MinBackoff == 0 {
+		opts.MinBackoff = DEFAULT_MIN_BACKOFF
+	}
+	if opts.MaxBackoff == 0 {
+		opts.MaxBackoff = DEFAULT_MAX_BACKOFF
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return &Cache{
+		opts:    opts,
+		entries: make(map[string]*Entry),
+		calls:   make(map[string]*call),
+		backoff: make(map[string]*backoff),
+	}
+}
+
+// Get returns the value for key, loading it if it isn't cached or too old.
+// Stale values are returned if loading fails.
+func (c *Cache) Get(ctx context.Context, key string) ([]byte, error) {
+	entry := c.lookup(ctx, key)
+	now := c.opts.Now()
+	switch {
+	case entry == nil:
+	case now.Sub(entry.Fetched) < c.opts.FreshFor:
+		return entry.Value, nil
+	case c.opts.MaxStale == 0 || now.Sub(entry.Fetched) < c.opts.FreshFor+c.opts.MaxStale:
+		c.revalidate(ctx, key, entry)
+		return entry.Value, nil
+	}
+
+	loaded, err := c.load(ctx, key)
+	if err != nil {
+		if entry != nil {
+			return entry.Value, nil
+		}
+		return nil, err
+	}
+	return loaded.Value, nil
+}
+
+// Refresh loads key now, unless another load is in progress or the loader
+// is backing off, and stores the result in both tiers.
+func (c *Cache) Refresh(ctx context.Context, key string) error {
+	_, err := c.load(ctx, key)
+	return err
+}
+
+// lookup returns the L1 entry if it is fresh, otherwise the newer of the L1
+// and L2 entries. Another instance may have refreshed the value already.
+func (c *Cache) lookup(ctx context.Context, key string) *Entry {
+	c.lock.Lock()
+	entry := c.entries[key]
+	c.lock.Unlock()
+	if c.opts.Store == nil || (entry != nil && c.opts.Now().Sub(entry.Fetched) < c.opts.FreshFor) {
+		return entry
+	}
+	stored, err := c.opts.Store.Get(ctx, key)
+	if err != nil || (entry != nil && !stored.Fetched.After(entry.Fetched)) {
+		return entry
+	}
+	c.lock.Lock()
+	if current := c.entries[key]; current == nil || current.Fetched.Before(stored.Fetched) {
+		c.entries[key] = stored
+	}
+	c.lock.Unlock()
+	return stored
+}
+
+func (c *Cache) revalidate(ctx context.Context, key string, stale *Entry) {
+	c.lock.Lock()
+	_, loading := c.calls[key]
+	b := c.backoff[key]
+	c.lock.Unlock()
+	if loading || (b != nil && c.opts.Now().Before(b.retryAt)) {
+		return
+	}
+	if c.opts.Revalidate != nil {
+		c.opts.Revalidate(ctx, key, stale)
+		return
+	}
+	go c.Refresh(ctx, key)
+}
+
+// load calls the loader once per key at a time.
+func (c *Cache) load(ctx context.Context, key string) (*Entry, error) {
+	c.lock.Lock()
+	if b := c.backoff[key]; b != nil && c.opts.Now().Before(b.retryAt) {
+		c.lock.Unlock()
+		return nil, b.err
+	}
+	if cl, ok := c.calls[key]; ok {
+		c.lock.Unlock()
+		cl.wg.Wait()
+		return cl.entry, cl.err
+	}
+	cl := &call{}
+	cl.wg.Add(1)
+	c.calls[key] = cl
+	c.lock.Unlock()
+
+	value, err := c.opts.Loader(ctx, key)
+	if err == nil {
+		cl.entry = &Entry{Value: value, Fetched: c.opts.Now()}
+		if c.opts.Store != nil {
+			// The value is still good for this instance.
+			c.opts.Store.Set(ctx, key, cl.entry)
+		}
+	}
+	cl.err = err
+
+	c.lock.Lock()
+	if err == nil {
+		c.entries[key] = cl.entry
+		delete(c.backoff, key)
+	} else {
+		b := c.backoff[key]
+		if b == nil {
+			b = &backoff{}
+			c.backoff[key] = b
+		}
+		b.failures++
+		b.err = err
+		b.retryAt = c.opts.Now().Add(c.backoffDelay(b.failures))
+	}
+	delete(c.calls, key)
+	c.lock.Unlock()
+	cl.wg.Done()
+	return cl.entry, cl.err
+}
+
+func (c *Cache) backoffDelay(failures int) time.Duration {
+	delay := c.opts.MinBackoff
+	for i := 1; i < failures && delay < c.opts.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > c.opts.MaxBackoff {
+		delay = c.opts.MaxBackoff
+	}
+	return delay
+}
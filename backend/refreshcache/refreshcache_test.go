@@ -0,0 +1,296 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package refreshcache
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// clock is a manually advanced time source.
+type clock struct {
+	lock sync.Mutex
+	now  time.Time
+}
+
+func newClock() *clock {
+	return &clock{now: time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *clock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+func (c *clock) Advance(d time.Duration) {
+	c.lock.Lock()
+	c.now = c.now.Add(d)
+	c.lock.Unlock()
+}
+
+// loader counts calls and returns "<key>-<call>" unless err is set.
+type loader struct {
+	lock  sync.Mutex
+	calls int
+	err   error
+}
+
+func (l *loader) Load(ctx context.Context, key string) ([]byte, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.calls++
+	if l.err != nil {
+		return nil, l.err
+	}
+	return []byte(fmt.Sprintf("%s-%d", key, l.calls)), nil
+}
+
+func (l *loader) Calls() int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.calls
+}
+
+func (l *loader) Fail(err error) {
+	l.lock.Lock()
+	l.err = err
+	l.lock.Unlock()
+}
+
+func expectValue(t *testing.T, cache *Cache, key string, want string) {
+	t.Helper()
+	got, err := cache.Get(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Get(%q) failed: %v", key, err)
+	}
+	if string(got) != want {
+		t.Errorf("Get(%q) = %q, want %q", key, got, want)
+	}
+}
+
+func TestSingleFlight(t *testing.T) {
+	started := make(chan bool)
+	release := make(chan bool)
+	var lock sync.Mutex
+	calls := 0
+	cache := New(Options{
+		Loader: func(ctx context.Context, key string) ([]byte, error) {
+			lock.Lock()
+			calls++
+			lock.Unlock()
+			started <- true
+			<-release
+			return []byte("value"), nil
+		},
+		FreshFor: time.Minute,
+		Now:      newClock().Now,
+	})
+
+	const n = 10
+	var wg sync.WaitGroup
+	results := make(chan string, n)
+	get := func() {
+		defer wg.Done()
+		value, err := cache.Get(context.Background(), "key")
+		if err != nil {
+			t.Error(err)
+		}
+		results <- string(value)
+	}
+	wg.Add(n)
+	go get()
+	<-started
+	for i := 1; i < n; i++ {
+		go get()
+	}
+	close(release)
+	wg.Wait()
+	close(results)
+
+	for value := range results {
+		if value != "value" {
+			t.Errorf("Get = %q, want %q", value, "value")
+		}
+	}
+	if calls != 1 {
+		t.Errorf("loader called %d times, want 1", calls)
+	}
+}
+
+func TestStaleWhileRevalidate(t *testing.T) {
+	now := newClock()
+	l := &loader{}
+	var revalidated []string
+	cache := New(Options{
+		Loader:   l.Load,
+		FreshFor: time.Minute,
+		MaxStale: time.Hour,
+		Revalidate: func(ctx context.Context, key string, stale *Entry) {
+			revalidated = append(revalidated, string(stale.Value))
+		},
+		Now: now.Now,
+	})
+
+	expectValue(t, cache, "a", "a-1")
+	now.Advance(30 * time.Second)
+	expectValue(t, cache, "a", "a-1")
+	if l.Calls() != 1 || len(revalidated) != 0 {
+		t.Fatalf("fresh value reloaded: %d loads, revalidated %v", l.Calls(), revalidated)
+	}
+
+	// Stale values are served right away and refreshed in the background.
+	now.Advance(time.Minute)
+	expectValue(t, cache, "a", "a-1")
+	if l.Calls() != 1 {
+		t.Errorf("stale value loaded synchronously")
+	}
+	if len(revalidated) != 1 || revalidated[0] != "a-1" {
+		t.Errorf("revalidated %v, want [a-1]", revalidated)
+	}
+	if err := cache.Refresh(context.Background(), "a"); err != nil {
+		t.Fatal(err)
+	}
+	expectValue(t, cache, "a", "a-2")
+
+	// Past MaxStale, Get waits for the loader.
+	now.Advance(2 * time.Hour)
+	expectValue(t, cache, "a", "a-3")
+	if len(revalidated) != 1 {
+		t.Errorf("revalidated %v past MaxStale", revalidated)
+	}
+}
+
+func TestStaleServedOnError(t *testing.T) {
+	now := newClock()
+	l := &loader{}
+	cache := New(Options{
+		Loader:   l.Load,
+		FreshFor: time.Minute,
+		MaxStale: time.Minute,
+		Now:      now.Now,
+	})
+	expectValue(t, cache, "a", "a-1")
+	l.Fail(errors.New("origin down"))
+	now.Advance(time.Hour)
+	expectValue(t, cache, "a", "a-1")
+}
+
+func TestBackoff(t *testing.T) {
+	now := newClock()
+	l := &loader{}
+	failure := errors.New("origin down")
+	l.Fail(failure)
+	cache := New(Options{
+		Loader:     l.Load,
+		FreshFor:   time.Minute,
+		MinBackoff: 10 * time.Second,
+		MaxBackoff: 30 * time.Second,
+		Now:        now.Now,
+	})
+	ctx := context.Background()
+
+	// Delays double from MinBackoff up to MaxBackoff.
+	for i, delay := range []time.Duration{10 * time.Second, 20 * time.Second, 30 * time.Second, 30 * time.Second} {
+		if _, err := cache.Get(ctx, "a"); err != failure {
+			t.Fatalf("Get error = %v, want %v", err, failure)
+		}
+		if l.Calls() != i+1 {
+			t.Fatalf("loader called %d times, want %d", l.Calls(), i+1)
+		}
+		now.Advance(delay - time.Second)
+		if _, err := cache.Get(ctx, "a"); err != failure {
+			t.Fatalf("Get error while backing off = %v, want %v", err, failure)
+		}
+		if l.Calls() != i+1 {
+			t.Fatalf("loader called while backing off %v", delay)
+		}
+		now.Advance(time.Second)
+	}
+
+	// A successful load resets the backoff.
+	l.Fail(nil)
+	expectValue(t, cache, "a", "a-5")
+	l.Fail(failure)
+	cache.Refresh(ctx, "a")
+	now.Advance(10 * time.Second)
+	cache.Refresh(ctx, "a")
+	if l.Calls() != 7 {
+		t.Errorf("loader called %d times after reset, want 7", l.Calls())
+	}
+}
+
+func TestBackoffSkipsRevalidation(t *testing.T) {
+	now := newClock()
+	l := &loader{}
+	revalidations := 0
+	cache := New(Options{
+		Loader:     l.Load,
+		FreshFor:   time.Minute,
+		MinBackoff: time.Minute,
+		Revalidate: func(ctx context.Context, key string, stale *Entry) {
+			revalidations++
+		},
+		Now: now.Now,
+	})
+	expectValue(t, cache, "a", "a-1")
+	l.Fail(errors.New("origin down"))
+	now.Advance(2 * time.Minute)
+	cache.Refresh(context.Background(), "a")
+	expectValue(t, cache, "a", "a-1")
+	if revalidations != 0 {
+		t.Errorf("revalidated %d times while backing off", revalidations)
+	}
+	now.Advance(time.Minute)
+	expectValue(t, cache, "a", "a-1")
+	if revalidations != 1 {
+		t.Errorf("revalidated %d times after the backoff, want 1", revalidations)
+	}
+}
+
+func TestSharedStore(t *testing.T) {
+	now := newClock()
+	store := NewMemoryStore()
+	l := &loader{}
+	options := Options{
+		Loader:   l.Load,
+		Store:    store,
+		FreshFor: time.Minute,
+		MaxStale: time.Hour,
+		Revalidate: func(ctx context.Context, key string, stale *Entry) {
+			t.Errorf("revalidated %q", stale.Value)
+		},
+		Now: now.Now,
+	}
+	first, second := New(options), New(options)
+
+	expectValue(t, first, "a", "a-1")
+	expectValue(t, second, "a", "a-1")
+	if l.Calls() != 1 {
+		t.Errorf("loader called %d times, want 1", l.Calls())
+	}
+
+	// A refresh on one instance is picked up by the other one once its
+	// copy goes stale.
+	now.Advance(2 * time.Minute)
+	if err := first.Refresh(context.Background(), "a"); err != nil {
+		t.Fatal(err)
+	}
+	expectValue(t, second, "a", "a-2")
+}
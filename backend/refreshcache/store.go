@@ -0,0 +1,100 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package refreshcache
+
+import (
+	"sync"
+
+	"golang.org/x/net/context"
+	"google.golang.org/appengine/datastore"
+	"google.golang.org/appengine/log"
+	"google.golang.org/appengine/memcache"
+)
+
+const (
+	ENTRY_KIND = "RefreshCacheEntry"
+)
+
+// MemoryStore keeps entries in a map. It is meant for tests and local
+// development where there's no App Engine backend.
+type MemoryStore struct {
+	lock    sync.Mutex
+	entries map[string]*Entry
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]*Entry)}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) (*Entry, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	entry, ok := s.entries[key]
+	if !ok {
+		return nil, ErrMiss
+	}
+	return entry, nil
+}
+
+func (s *MemoryStore) Set(ctx context.Context, key string, entry *Entry) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.entries[key] = entry
+	return nil
+}
+
+// AppEngineStore keeps entries in datastore with memcache in front of it.
+// Keys are prefixed with Namespace.
+type AppEngineStore struct {
+	Namespace string
+}
+
+func (s *AppEngineStore) name(key string) string {
+	return s.Namespace + ":" + key
+}
+
+func (s *AppEngineStore) Get(ctx context.Context, key string) (*Entry, error) {
+	var entry Entry
+	_, err := memcache.Gob.Get(ctx, s.name(key), &entry)
+	if err == nil {
+		return &entry, nil
+	}
+	if err != memcache.ErrCacheMiss {
+		log.Warningf(ctx, "Error reading %s from memcache: %v", s.name(key), err)
+	}
+
+	err = datastore.Get(ctx, datastore.NewKey(ctx, ENTRY_KIND, s.name(key), 0, nil), &entry)
+	if err == datastore.ErrNoSuchEntity {
+		return nil, ErrMiss
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := memcache.Gob.Set(ctx, &memcache.Item{Key: s.name(key), Object: &entry}); err != nil {
+		log.Warningf(ctx, "Error adding %s to memcache: %v", s.name(key), err)
+	}
+	return &entry, nil
+}
+
+func (s *AppEngineStore) Set(ctx context.Context, key string, entry *Entry) error {
+	if _, err := datastore.Put(ctx, datastore.NewKey(ctx, ENTRY_KIND, s.name(key), 0, nil), entry); err != nil {
+		log.Warningf(ctx, "Error adding %s to datastore: %v", s.name(key), err)
+		return err
+	}
+	if err := memcache.Gob.Set(ctx, &memcache.Item{Key: s.name(key), Object: entry}); err != nil {
+		log.Warningf(ctx, "Error adding %s to memcache: %v", s.name(key), err)
+	}
+	return nil
+}
@@ -15,6 +15,7 @@
 package backend
 
 import (
+	"backend/faults"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -22,15 +23,14 @@ import (
 	"strings"
 )
 
-const NEW_ADDRESS = "https://ampbyexample.com"
 const DEFAULT_MAX_AGE = 60
 
 func RegisterHandler(pattern string, handler http.HandlerFunc) {
-	http.HandleFunc(pattern, EnableCors(handler))
+	http.HandleFunc(pattern, Recover(EnableCors(InjectFaults(handler))))
 }
 
-func RedirectToSecureVersion(w http.ResponseWriter, r *http.Request) {
-	http.Redirect(w, r, NEW_ADDRESS+r.URL.Path, http.StatusMovedPermanently)
+func RedirectToSecureVersion(w http.ResponseWriter, r *http.Request, host string) {
+	http.Redirect(w, r, host+r.URL.Path, http.StatusMovedPermanently)
 }
 
 func IsInsecureRequest(r *http.Request) bool {
@@ -50,7 +50,7 @@ func EnableCors(next http.HandlerFunc) http.HandlerFunc {
 		origin := GetOrigin(r)
 		w.Header().Set("Access-Control-Allow-Origin", origin)
 		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, "+faults.HEADER)
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
 		sourceOrigin := GetSourceOrigin(r)
 		if sourceOrigin == "" {
@@ -86,13 +86,12 @@ func GetHost(r *http.Request) string {
 	return "https://" + r.Host
 }
 
-func SetVary(h http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		canonical(w.Header(), "vary")
-		add(w.Header(), "vary", "Accept")
-		add(w.Header(), "vary", "AMP-Cache-Transform")
-		h.ServeHTTP(w, r)
-	})
+// SetVary marks a response as negotiated by the headers asking for signed
+// exchanges.
+func SetVary(h http.Header) {
+	canonical(h, "vary")
+	add(h, "vary", "Accept")
+	add(h, "vary", "AMP-Cache-Transform")
 }
 
 func SetContentTypeJson(w http.ResponseWriter) {
@@ -15,9 +15,20 @@
 package backend
 
 import (
+	"backend/config"
+	"backend/money"
+	"backend/seats"
+	"backend/venues"
 	"encoding/json"
 	"io/ioutil"
+	"log"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/appengine"
 )
 
 type Seat struct {
@@ -30,22 +41,62 @@ type Seat struct {
 	Height       float64 `json:"height"`
 	Width        float64 `json:"width"`
 	Wheelchair   bool    `json:"wheelchair"`
-	Availability bool    `json:"availability"`
+	Availability bool    `json:"available"`
+	// Price zone of the seat, see venues.Zone.
+	Zone  string       `json:"zone,omitempty"`
+	Price money.Amount `json:"price"`
+	// One of the seats.STATUS_* constants.
+	Status string `json:"status,omitempty"`
+	// CSS class of seats that can't be selected.
+	Unavailable string `json:"unavailable,omitempty"`
+	// Held by the client asking.
+	Mine bool `json:"mine,omitempty"`
 }
 
 type SeatJsonRoot struct {
-	Seats  []Seat  `json:"seats"`
-	Height float64 `json:"height"`
-	Width  float64 `json:"width"`
+	Venue  string        `json:"venue,omitempty"`
+	Name   string        `json:"name,omitempty"`
+	Zones  []venues.Zone `json:"zones,omitempty"`
+	Seats  []Seat        `json:"seats"`
+	Height float64       `json:"height"`
+	Width  float64       `json:"width"`
+	// The seats held by the client asking.
+	Hold *seats.Hold `json:"hold,omitempty"`
+}
+
+const (
+	SEATMAP_SAMPLE_PATH = "/" + CATEGORY_ADVANCED + "/seatmap/"
+	SEAT_HOLD_TTL       = 5 * time.Minute
+	// Bookings are released again so that the sample stays usable.
+	SEAT_BOOKING_TTL = time.Hour
+	// The venue of seats.json, which has a single price zone.
+	SEATMAP_DEFAULT_VENUE = "default"
+	SEATMAP_DEFAULT_PRICE = money.Amount(2500)
+)
+
+// seatVenue is a seat map with its reservations.
+type seatVenue struct {
+	SeatJsonRoot
+	reservations seats.Store
+	prices       map[string]money.Amount
 }
 
-var seats []Seat
 var seatsRoot SeatJsonRoot
+var seatVenues = make(map[string]*seatVenue)
 
-func InitSeatmapPage() {
-	initSeatmap(DIST_FOLDER + "/json/seats.json")
-	RegisterSample("advanced/seatmap", renderSeatmap)
-	RegisterSample("advanced/seatmap_multiple_selection", renderSeatmap)
+// Venue IDs in the order they were defined.
+var seatVenueIds []string
+
+func InitSeatmapPage(cfg *config.Config) {
+	initSeatmap(cfg.DistDir+"/json/seats.json", cfg.SeatStore)
+	initVenues(cfg.DistDir+"/json/venues.json", cfg.SeatStore)
+	RegisterSample(cfg, "advanced/seatmap", renderSeatmap)
+	RegisterSample(cfg, "advanced/seatmap_multiple_selection", renderSeatmap)
+	RegisterHandler(SEATMAP_SAMPLE_PATH+"venues", handleVenues)
+	RegisterHandler(SEATMAP_SAMPLE_PATH+"seats", handleSeats)
+	RegisterHandler(SEATMAP_SAMPLE_PATH+"hold", onlyPost(handleSeatHold))
+	RegisterHandler(SEATMAP_SAMPLE_PATH+"confirm", onlyPost(handleSeatConfirm))
+	RegisterHandler(SEATMAP_SAMPLE_PATH+"release", onlyPost(handleSeatRelease))
 }
 
 func renderSeatmap(w http.ResponseWriter, r *http.Request, page Page) {
@@ -56,7 +107,198 @@ func renderSeatmap(w http.ResponseWriter, r *http.Request, page Page) {
 	})
 }
 
-func initSeatmap(path string) {
+// handleVenues lists the venues and their price zones.
+func handleVenues(w http.ResponseWriter, r *http.Request) {
+	list := []map[string]interface{}{}
+	for _, id := range seatVenueIds {
+		venue := seatVenues[id]
+		list = append(list, map[string]interface{}{
+			"id":    venue.Venue,
+			"name":  venue.Name,
+			"zones": venue.Zones,
+		})
+	}
+	SendJsonResponse(w, map[string]interface{}{
+		"items": list,
+	})
+}
+
+// handleSeats returns the seat map of a venue with the live status of each
+// seat.
+func handleSeats(w http.ResponseWriter, r *http.Request) {
+	SetMaxAge(w, 0)
+	venue, ok := requestedVenue(w, r)
+	if !ok {
+		return
+	}
+	clientId := r.FormValue("clientId")
+	ctx := appengine.NewContext(r)
+	now := time.Now()
+	status, err := venue.reservations.Status(ctx, clientId, now)
+	if err != nil {
+		sendSeatError(w, err)
+		return
+	}
+	root := venue.SeatJsonRoot
+	root.Seats = make([]Seat, len(venue.Seats))
+	for i, seat := range venue.Seats {
+		seat.Status = status[seat.Id]
+		seat.Availability = seat.Status == seats.STATUS_AVAILABLE || seat.Status == seats.STATUS_MINE
+		seat.Mine = seat.Status == seats.STATUS_MINE
+		seat.Unavailable = ""
+		if !seat.Availability {
+			seat.Unavailable = "unavailable"
+		}
+		root.Seats[i] = seat
+	}
+	if clientId != "" {
+		root.Hold, _ = venue.reservations.Current(ctx, clientId, now)
+	}
+	SendJsonResponse(w, root)
+}
+
+// handleSeatHold holds the comma separated seats for the client, replacing
+// its previous selection in the venue.
+func handleSeatHold(w http.ResponseWriter, r *http.Request) {
+	clientId, ok := seatClientId(w, r)
+	if !ok {
+		return
+	}
+	venue, ok := requestedVenue(w, r)
+	if !ok {
+		return
+	}
+	var ids []string
+	for _, value := range r.Form["seats"] {
+		ids = append(ids, strings.Split(value, ",")...)
+	}
+	hold, err := venue.reservations.Hold(appengine.NewContext(r), clientId, ids, time.Now())
+	switch e := err.(type) {
+	case nil:
+	case *seats.UnavailableError:
+		SendJsonError(w, http.StatusConflict, map[string]interface{}{
+			"message": "Sorry, these seats were just taken: " + strings.Join(e.Seats, ", ") + ".",
+			"seats":   e.Seats,
+		})
+		return
+	default:
+		if err != seats.ErrUnknownSeat && err != seats.ErrTooManySeats {
+			sendSeatError(w, err)
+			return
+		}
+		message := "Please select seats on the seat map."
+		if err == seats.ErrTooManySeats {
+			message = "Please select fewer seats."
+		}
+		SendJsonError(w, http.StatusBadRequest, map[string]string{
+			"message": message,
+		})
+		return
+	}
+	if hold == nil {
+		SendJsonResponse(w, map[string]interface{}{"seats": []string{}})
+		return
+	}
+	SendJsonResponse(w, map[string]interface{}{
+		"venue":            venue.Venue,
+		"seats":            hold.Seats,
+		"total":            venue.total(hold.Seats),
+		"expires":          hold.Expires,
+		"expiresInMinutes": int(SEAT_HOLD_TTL.Minutes()),
+	})
+}
+
+func handleSeatConfirm(w http.ResponseWriter, r *http.Request) {
+	clientId, ok := seatClientId(w, r)
+	if !ok {
+		return
+	}
+	venue, ok := requestedVenue(w, r)
+	if !ok {
+		return
+	}
+	booking, err := venue.reservations.Confirm(appengine.NewContext(r), clientId, time.Now())
+	if err != nil && err != seats.ErrNoHold {
+		sendSeatError(w, err)
+		return
+	}
+	if err != nil {
+		SendJsonError(w, http.StatusConflict, map[string]string{
+			"message": "Your seats aren't held anymore, please select them again.",
+		})
+		return
+	}
+	SendJsonResponse(w, map[string]interface{}{
+		"venue": venue.Venue,
+		"seats": booking.Seats,
+		"total": venue.total(booking.Seats),
+	})
+}
+
+func handleSeatRelease(w http.ResponseWriter, r *http.Request) {
+	clientId, ok := seatClientId(w, r)
+	if !ok {
+		return
+	}
+	venue, ok := requestedVenue(w, r)
+	if !ok {
+		return
+	}
+	if err := venue.reservations.Release(appengine.NewContext(r), clientId, time.Now()); err != nil {
+		sendSeatError(w, err)
+		return
+	}
+	SendJsonResponse(w, map[string]interface{}{"seats": []string{}})
+}
+
+// sendSeatError reports a failure of the reservations store.
+func sendSeatError(w http.ResponseWriter, err error) {
+	log.Printf("Seat reservations failed: %v", err)
+	SendJsonError(w, http.StatusInternalServerError, map[string]string{
+		"message": "Something went wrong, please try again.",
+	})
+}
+
+func seatClientId(w http.ResponseWriter, r *http.Request) (string, bool) {
+	SetMaxAge(w, 0)
+	// Also parses multipart forms, as sent by amp-form, into r.Form.
+	clientId := r.FormValue("clientId")
+	if clientId == "" {
+		SendJsonError(w, http.StatusBadRequest, map[string]string{
+			"message": "Missing client ID.",
+		})
+		return "", false
+	}
+	return clientId, true
+}
+
+// requestedVenue returns the venue named by the venue parameter,
+// SEATMAP_DEFAULT_VENUE if there's none.
+func requestedVenue(w http.ResponseWriter, r *http.Request) (*seatVenue, bool) {
+	id := r.FormValue("venue")
+	if id == "" {
+		id = SEATMAP_DEFAULT_VENUE
+	}
+	venue, ok := seatVenues[id]
+	if !ok {
+		SendJsonError(w, http.StatusNotFound, map[string]string{
+			"message": "Unknown venue.",
+		})
+		return nil, false
+	}
+	return venue, true
+}
+
+// total returns the price of the seats with ids.
+func (v *seatVenue) total(ids []string) money.Amount {
+	var total money.Amount
+	for _, id := range ids {
+		total += v.prices[id]
+	}
+	return total
+}
+
+func initSeatmap(path string, store string) {
 	seatmapFile, err := ioutil.ReadFile(path)
 	if err != nil {
 		panic(err)
@@ -67,5 +309,84 @@ func initSeatmap(path string) {
 		panic(err)
 	}
 	seatsRoot = root
-	seats = root.Seats
+	root.Venue = SEATMAP_DEFAULT_VENUE
+	root.Name = "Seat map"
+	root.Zones = []venues.Zone{{ID: "standard", Name: "Standard", Price: SEATMAP_DEFAULT_PRICE}}
+	for i := range root.Seats {
+		root.Seats[i].Zone = "standard"
+		root.Seats[i].Price = SEATMAP_DEFAULT_PRICE
+	}
+	addSeatVenue(root, store)
+}
+
+// initVenues lays out the venue definitions at path, which is optional.
+func initVenues(path string, store string) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		log.Printf("No venues at %s", path)
+		return
+	}
+	if err != nil {
+		panic(err)
+	}
+	definitions, err := venues.Parse(data)
+	if err != nil {
+		panic(err)
+	}
+	for i := range definitions {
+		venue := &definitions[i]
+		seatMap, err := venues.Layout(venue)
+		if err != nil {
+			panic(err)
+		}
+		root := SeatJsonRoot{
+			Venue:  venue.ID,
+			Name:   venue.Name,
+			Zones:  venue.Zones,
+			Height: seatMap.Height,
+			Width:  seatMap.Width,
+		}
+		for _, s := range seatMap.Seats {
+			price, _ := venue.ZonePrice(s.Zone)
+			radius := strconv.FormatFloat(s.Radius, 'f', -1, 64)
+			root.Seats = append(root.Seats, Seat{
+				Id:           s.ID,
+				Standard:     !s.Accessible,
+				X:            s.X,
+				Y:            s.Y,
+				Rx:           radius,
+				Ry:           radius,
+				Height:       s.Height,
+				Width:        s.Width,
+				Wheelchair:   s.Accessible,
+				Availability: !s.Booked,
+				Zone:         s.Zone,
+				Price:        price,
+			})
+		}
+		addSeatVenue(root, store)
+	}
+}
+
+// addSeatVenue adds the venue, keeping its reservations in store, see
+// seats.ParseStore.
+func addSeatVenue(root SeatJsonRoot, store string) {
+	if _, ok := seatVenues[root.Venue]; ok {
+		panic("duplicate venue " + root.Venue)
+	}
+	venue := &seatVenue{
+		SeatJsonRoot: root,
+		prices:       make(map[string]money.Amount),
+	}
+	var ids, booked []string
+	for _, seat := range root.Seats {
+		ids = append(ids, seat.Id)
+		venue.prices[seat.Id] = seat.Price
+		if !seat.Availability {
+			booked = append(booked, seat.Id)
+		}
+	}
+	venue.reservations = seats.ParseStore(store, root.Venue, ids, booked, SEAT_HOLD_TTL, SEAT_BOOKING_TTL)
+	seatVenues[root.Venue] = venue
+	seatVenueIds = append(seatVenueIds, root.Venue)
 }
@@ -0,0 +1,295 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package seats
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/datastore"
+)
+
+const (
+	// Seats and holds are keyed by "<venue>/<seat>" and "<venue>/<client>".
+	SEAT_KIND = "Seat"
+	HOLD_KIND = "SeatHold"
+)
+
+// DatastoreStore keeps every seat that isn't available as an entity of its
+// own. Holds change the seats they take and release in a cross-group
+// transaction, so instances can't hold a seat twice, and MAX_SEATS_PER_HOLD
+// keeps them within the entity groups a transaction may touch.
+type DatastoreStore struct {
+	Venue      string
+	HoldTTL    time.Duration
+	BookingTTL time.Duration
+
+	// Seats of the venue, and whether they are booked for good.
+	seats map[string]bool
+}
+
+// seatEntity is a seat that is held or booked. Seats without one are
+// available, unless the venue has them booked for good.
+type seatEntity struct {
+	Venue   string
+	Status  string    `datastore:",noindex"`
+	Client  string    `datastore:",noindex"`
+	Expires time.Time `datastore:",noindex"`
+}
+
+type holdEntity struct {
+	Seats   []string  `datastore:",noindex"`
+	Expires time.Time `datastore:",noindex"`
+}
+
+// NewDatastoreStore returns the store for the seats of the venue with ids,
+// booked are booked for good.
+func NewDatastoreStore(venue string, ids []string, booked []string, holdTTL time.Duration, bookingTTL time.Duration) *DatastoreStore {
+	s := &DatastoreStore{
+		Venue:      venue,
+		HoldTTL:    holdTTL,
+		BookingTTL: bookingTTL,
+		seats:      make(map[string]bool),
+	}
+	for _, id := range ids {
+		s.seats[id] = false
+	}
+	for _, id := range booked {
+		if _, ok := s.seats[id]; ok {
+			s.seats[id] = true
+		}
+	}
+	return s
+}
+
+func (s *DatastoreStore) Hold(ctx context.Context, client string, ids []string, now time.Time) (*Hold, error) {
+	ids = unique(ids)
+	if len(ids) > MAX_SEATS_PER_HOLD {
+		return nil, ErrTooManySeats
+	}
+	for _, id := range ids {
+		if _, ok := s.seats[id]; !ok {
+			return nil, ErrUnknownSeat
+		}
+	}
+	var hold *Hold
+	err := datastore.RunInTransaction(ctx, func(tc context.Context) error {
+		hold = nil
+		previous, err := s.getHold(tc, client, now)
+		if err != nil {
+			return err
+		}
+		selected := make(map[string]bool)
+		for _, id := range ids {
+			selected[id] = true
+		}
+		all := append([]string(nil), ids...)
+		if previous != nil {
+			for _, id := range previous.Seats {
+				if !selected[id] {
+					all = append(all, id)
+				}
+			}
+		}
+		entities, err := s.getSeats(tc, all)
+		if err != nil {
+			return err
+		}
+		var unavailable []string
+		for i, id := range ids {
+			if status := s.status(id, entities[i], now); status != STATUS_AVAILABLE && !(status == STATUS_HELD && entities[i].Client == client) {
+				unavailable = append(unavailable, id)
+			}
+		}
+		if len(unavailable) > 0 {
+			return &UnavailableError{unavailable}
+		}
+
+		// Release the seats of the previous hold that aren't selected again.
+		var released []*datastore.Key
+		for i := len(ids); i < len(all); i++ {
+			if entities[i].Status == STATUS_HELD && entities[i].Client == client {
+				released = append(released, s.seatKey(tc, all[i]))
+			}
+		}
+		if err := datastore.DeleteMulti(tc, released); err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return datastore.Delete(tc, s.holdKey(tc, client))
+		}
+		expires := now.Add(s.HoldTTL)
+		keys := make([]*datastore.Key, len(ids))
+		held := make([]seatEntity, len(ids))
+		for i, id := range ids {
+			keys[i] = s.seatKey(tc, id)
+			held[i] = seatEntity{Venue: s.Venue, Status: STATUS_HELD, Client: client, Expires: expires}
+		}
+		if _, err := datastore.PutMulti(tc, keys, held); err != nil {
+			return err
+		}
+		if _, err := datastore.Put(tc, s.holdKey(tc, client), &holdEntity{Seats: ids, Expires: expires}); err != nil {
+			return err
+		}
+		hold = &Hold{Client: client, Seats: ids, Expires: expires}
+		return nil
+	}, &datastore.TransactionOptions{XG: true})
+	if err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
+func (s *DatastoreStore) Confirm(ctx context.Context, client string, now time.Time) (*Hold, error) {
+	var booking *Hold
+	err := datastore.RunInTransaction(ctx, func(tc context.Context) error {
+		hold, err := s.getHold(tc, client, now)
+		if err != nil {
+			return err
+		}
+		if hold == nil {
+			return ErrNoHold
+		}
+		booking = &Hold{Client: client, Seats: hold.Seats}
+		if s.BookingTTL > 0 {
+			booking.Expires = now.Add(s.BookingTTL)
+		}
+		keys := make([]*datastore.Key, len(hold.Seats))
+		booked := make([]seatEntity, len(hold.Seats))
+		for i, id := range hold.Seats {
+			keys[i] = s.seatKey(tc, id)
+			booked[i] = seatEntity{Venue: s.Venue, Status: STATUS_BOOKED, Client: client, Expires: booking.Expires}
+		}
+		if _, err := datastore.PutMulti(tc, keys, booked); err != nil {
+			return err
+		}
+		return datastore.Delete(tc, s.holdKey(tc, client))
+	}, &datastore.TransactionOptions{XG: true})
+	if err != nil {
+		return nil, err
+	}
+	return booking, nil
+}
+
+func (s *DatastoreStore) Release(ctx context.Context, client string, now time.Time) error {
+	return datastore.RunInTransaction(ctx, func(tc context.Context) error {
+		hold, err := s.getHold(tc, client, now)
+		if err != nil || hold == nil {
+			return err
+		}
+		entities, err := s.getSeats(tc, hold.Seats)
+		if err != nil {
+			return err
+		}
+		var released []*datastore.Key
+		for i, id := range hold.Seats {
+			if entities[i].Status == STATUS_HELD && entities[i].Client == client {
+				released = append(released, s.seatKey(tc, id))
+			}
+		}
+		if err := datastore.DeleteMulti(tc, released); err != nil {
+			return err
+		}
+		return datastore.Delete(tc, s.holdKey(tc, client))
+	}, &datastore.TransactionOptions{XG: true})
+}
+
+func (s *DatastoreStore) Current(ctx context.Context, client string, now time.Time) (*Hold, error) {
+	return s.getHold(ctx, client, now)
+}
+
+// Status reads the seats with a query, which may miss the latest holds for
+// a moment. Holding seats checks them again.
+func (s *DatastoreStore) Status(ctx context.Context, client string, now time.Time) (map[string]string, error) {
+	status := make(map[string]string, len(s.seats))
+	for id, booked := range s.seats {
+		status[id] = STATUS_AVAILABLE
+		if booked {
+			status[id] = STATUS_BOOKED
+		}
+	}
+	var entities []seatEntity
+	keys, err := datastore.NewQuery(SEAT_KIND).Filter("Venue =", s.Venue).GetAll(ctx, &entities)
+	if err != nil {
+		return nil, err
+	}
+	prefix := s.Venue + "/"
+	for i, key := range keys {
+		id := key.StringID()[len(prefix):]
+		if _, ok := s.seats[id]; !ok {
+			continue
+		}
+		status[id] = s.status(id, entities[i], now)
+		if status[id] == STATUS_HELD && entities[i].Client == client {
+			status[id] = STATUS_MINE
+		}
+	}
+	return status, nil
+}
+
+// status returns the status of the seat with id and entity at now. Expired
+// holds and bookings are available again.
+func (s *DatastoreStore) status(id string, entity seatEntity, now time.Time) string {
+	if s.seats[id] {
+		return STATUS_BOOKED
+	}
+	if entity.Status == "" || !entity.Expires.IsZero() && !now.Before(entity.Expires) {
+		return STATUS_AVAILABLE
+	}
+	return entity.Status
+}
+
+func (s *DatastoreStore) seatKey(ctx context.Context, id string) *datastore.Key {
+	return datastore.NewKey(ctx, SEAT_KIND, s.Venue+"/"+id, 0, nil)
+}
+
+func (s *DatastoreStore) holdKey(ctx context.Context, client string) *datastore.Key {
+	return datastore.NewKey(ctx, HOLD_KIND, s.Venue+"/"+client, 0, nil)
+}
+
+// getSeats returns the entities of the seats with ids, the zero entity for
+// available seats.
+func (s *DatastoreStore) getSeats(ctx context.Context, ids []string) ([]seatEntity, error) {
+	keys := make([]*datastore.Key, len(ids))
+	for i, id := range ids {
+		keys[i] = s.seatKey(ctx, id)
+	}
+	entities := make([]seatEntity, len(ids))
+	err := datastore.GetMulti(ctx, keys, entities)
+	if errs, ok := err.(appengine.MultiError); ok {
+		for i, err := range errs {
+			if err == datastore.ErrNoSuchEntity {
+				entities[i] = seatEntity{}
+			} else if err != nil {
+				return nil, err
+			}
+		}
+		return entities, nil
+	}
+	return entities, err
+}
+
+// getHold returns the hold of client, nil if it has none or it expired.
+func (s *DatastoreStore) getHold(ctx context.Context, client string, now time.Time) (*Hold, error) {
+	var entity holdEntity
+	err := datastore.Get(ctx, s.holdKey(ctx, client), &entity)
+	if err == datastore.ErrNoSuchEntity || err == nil && !now.Before(entity.Expires) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Hold{Client: client, Seats: entity.Seats, Expires: entity.Expires}, nil
+}
@@ -0,0 +1,174 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package seats
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+type seat struct {
+	status string
+	client string
+	// Zero for seats booked for good.
+	expires time.Time
+}
+
+// MemoryStore keeps the seat statuses in memory. It is meant for the
+// development server, where all requests go to one instance.
+type MemoryStore struct {
+	// How long seats are held for.
+	HoldTTL time.Duration
+	// How long bookings last, zero for ever.
+	BookingTTL time.Duration
+
+	lock  sync.Mutex
+	seats map[string]*seat
+	holds map[string]*Hold
+}
+
+// NewMemoryStore returns the store for the seats with ids, booked are
+// booked for good.
+func NewMemoryStore(ids []string, booked []string, holdTTL time.Duration, bookingTTL time.Duration) *MemoryStore {
+	r := &MemoryStore{
+		HoldTTL:    holdTTL,
+		BookingTTL: bookingTTL,
+		seats:      make(map[string]*seat),
+		holds:      make(map[string]*Hold),
+	}
+	for _, id := range ids {
+		r.seats[id] = &seat{status: STATUS_AVAILABLE}
+	}
+	for _, id := range booked {
+		if s, ok := r.seats[id]; ok {
+			s.status = STATUS_BOOKED
+		}
+	}
+	return r
+}
+
+func (r *MemoryStore) Hold(ctx context.Context, client string, ids []string, now time.Time) (*Hold, error) {
+	ids = unique(ids)
+	if len(ids) > MAX_SEATS_PER_HOLD {
+		return nil, ErrTooManySeats
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.expire(now)
+	var unavailable []string
+	for _, id := range ids {
+		s, ok := r.seats[id]
+		if !ok {
+			return nil, ErrUnknownSeat
+		}
+		if s.status != STATUS_AVAILABLE && !(s.status == STATUS_HELD && s.client == client) {
+			unavailable = append(unavailable, id)
+		}
+	}
+	if len(unavailable) > 0 {
+		return nil, &UnavailableError{unavailable}
+	}
+
+	r.release(client)
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	hold := &Hold{Client: client, Seats: ids, Expires: now.Add(r.HoldTTL)}
+	for _, id := range ids {
+		*r.seats[id] = seat{status: STATUS_HELD, client: client, expires: hold.Expires}
+	}
+	r.holds[client] = hold
+	return hold.copy(), nil
+}
+
+func (r *MemoryStore) Confirm(ctx context.Context, client string, now time.Time) (*Hold, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.expire(now)
+	hold, ok := r.holds[client]
+	if !ok {
+		return nil, ErrNoHold
+	}
+	delete(r.holds, client)
+	booking := &Hold{Client: client, Seats: hold.Seats}
+	if r.BookingTTL > 0 {
+		booking.Expires = now.Add(r.BookingTTL)
+	}
+	for _, id := range hold.Seats {
+		*r.seats[id] = seat{status: STATUS_BOOKED, client: client, expires: booking.Expires}
+	}
+	return booking, nil
+}
+
+func (r *MemoryStore) Release(ctx context.Context, client string, now time.Time) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.expire(now)
+	r.release(client)
+	return nil
+}
+
+func (r *MemoryStore) Current(ctx context.Context, client string, now time.Time) (*Hold, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.expire(now)
+	hold, ok := r.holds[client]
+	if !ok {
+		return nil, nil
+	}
+	return hold.copy(), nil
+}
+
+func (r *MemoryStore) Status(ctx context.Context, client string, now time.Time) (map[string]string, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.expire(now)
+	status := make(map[string]string, len(r.seats))
+	for id, s := range r.seats {
+		status[id] = s.status
+		if s.status == STATUS_HELD && s.client == client {
+			status[id] = STATUS_MINE
+		}
+	}
+	return status, nil
+}
+
+// release needs r to be locked.
+func (r *MemoryStore) release(client string) {
+	hold, ok := r.holds[client]
+	if !ok {
+		return
+	}
+	for _, id := range hold.Seats {
+		*r.seats[id] = seat{status: STATUS_AVAILABLE}
+	}
+	delete(r.holds, client)
+}
+
+// expire frees the seats of expired holds and bookings. It needs r to be
+// locked.
+func (r *MemoryStore) expire(now time.Time) {
+	for _, s := range r.seats {
+		if s.status != STATUS_AVAILABLE && !s.expires.IsZero() && !now.Before(s.expires) {
+			*s = seat{status: STATUS_AVAILABLE}
+		}
+	}
+	for client, hold := range r.holds {
+		if !now.Before(hold.Expires) {
+			delete(r.holds, client)
+		}
+	}
+}
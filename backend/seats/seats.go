@@ -0,0 +1,107 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// Package seats reserves seats of a seat map. A client first holds the seats
+// it selected, which keeps others from taking them until the hold expires,
+// and then confirms the hold to book them. Holds of several seats succeed or
+// fail as a whole.
+package seats
+
+import (
+	"backend/items"
+	"errors"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// Seat statuses as seen by a client.
+const (
+	STATUS_AVAILABLE = "available"
+	// Held by another client.
+	STATUS_HELD = "held"
+	// Held by the client asking.
+	STATUS_MINE   = "mine"
+	STATUS_BOOKED = "booked"
+
+	MAX_SEATS_PER_HOLD = 10
+)
+
+var (
+	ErrUnknownSeat  = errors.New("seats: unknown seat")
+	ErrTooManySeats = errors.New("seats: too many seats")
+	ErrNoHold       = errors.New("seats: no hold or hold expired")
+)
+
+// UnavailableError is returned by Hold if some seats are held by another
+// client or booked.
+type UnavailableError struct {
+	Seats []string
+}
+
+func (e *UnavailableError) Error() string {
+	return "seats: not available: " + strings.Join(e.Seats, ", ")
+}
+
+// Hold is the seats held or booked by a client.
+type Hold struct {
+	Client  string    `json:"-"`
+	Seats   []string  `json:"seats"`
+	Expires time.Time `json:"expires"`
+}
+
+// Store keeps the seat statuses and holds of a venue.
+type Store interface {
+	// Hold holds the seats for client, replacing the client's previous
+	// hold. Either all seats are held or none. Holding no seats releases the
+	// hold.
+	Hold(ctx context.Context, client string, ids []string, now time.Time) (*Hold, error)
+	// Confirm books the seats held by client.
+	Confirm(ctx context.Context, client string, now time.Time) (*Hold, error)
+	// Release gives up the seats held by client.
+	Release(ctx context.Context, client string, now time.Time) error
+	// Current returns the seats held by client, nil if there are none.
+	Current(ctx context.Context, client string, now time.Time) (*Hold, error)
+	// Status returns the status of every seat as seen by client.
+	Status(ctx context.Context, client string, now time.Time) (map[string]string, error)
+}
+
+// ParseStore returns the store for the seats of the venue for spec, see
+// items.UseDatastore. The seats with ids are available, except booked,
+// which are booked for good. Holds last holdTTL and bookings bookingTTL,
+// zero for ever; demo bookings expire so that the seat map doesn't fill up.
+func ParseStore(spec string, venue string, ids []string, booked []string, holdTTL time.Duration, bookingTTL time.Duration) Store {
+	if items.UseDatastore(spec) {
+		return NewDatastoreStore(venue, ids, booked, holdTTL, bookingTTL)
+	}
+	return NewMemoryStore(ids, booked, holdTTL, bookingTTL)
+}
+
+func (h *Hold) copy() *Hold {
+	c := *h
+	c.Seats = append([]string(nil), h.Seats...)
+	return &c
+}
+
+func unique(ids []string) []string {
+	seen := make(map[string]bool)
+	var result []string
+	for _, id := range ids {
+		if id != "" && !seen[id] {
+			seen[id] = true
+			result = append(result, id)
+		}
+	}
+	return result
+}
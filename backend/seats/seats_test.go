@@ -0,0 +1,172 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package seats
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+var testNow = time.Date(2019, 5, 1, 12, 0, 0, 0, time.UTC)
+
+var ctx = context.Background()
+
+func TestHold(t *testing.T) {
+	r := NewMemoryStore([]string{"A1", "A2", "A3", "A4", "B1"}, []string{"B1"}, 10*time.Minute, 0)
+	tests := []struct {
+		client      string
+		ids         []string
+		err         error
+		unavailable []string
+		// Seats that are STATUS_MINE for client afterwards.
+		mine []string
+	}{
+		{"alice", []string{"A1", "A2"}, nil, nil, []string{"A1", "A2"}},
+		// One taken seat fails the whole hold.
+		{"bob", []string{"A3", "A2"}, nil, []string{"A2"}, nil},
+		{"bob", []string{"A3", "A1", "B1"}, nil, []string{"A1", "B1"}, nil},
+		{"bob", []string{"A3", "Z9"}, ErrUnknownSeat, nil, nil},
+		{"bob", []string{"A3", "A3", "A4"}, nil, nil, []string{"A3", "A4"}},
+		// A new hold replaces the previous one, seats in both are kept.
+		{"alice", []string{"A2", "A3"}, nil, []string{"A3"}, []string{"A1", "A2"}},
+		{"alice", []string{"A2"}, nil, nil, []string{"A2"}},
+		{"bob", []string{"A1", "A4"}, nil, nil, []string{"A1", "A4"}},
+		// Holding nothing releases the hold.
+		{"alice", nil, nil, nil, nil},
+		{"carol", []string{"A1", "A2", "A3", "A4", "B1", "C1", "C2", "C3", "C4", "C5", "C6"}, ErrTooManySeats, nil, nil},
+	}
+	for i, test := range tests {
+		_, err := r.Hold(ctx, test.client, test.ids, testNow)
+		if test.unavailable != nil {
+			unavailable, ok := err.(*UnavailableError)
+			if !ok || !reflect.DeepEqual(unavailable.Seats, test.unavailable) {
+				t.Errorf("%d: Hold(%s, %v) = %v, want %v unavailable", i, test.client, test.ids, err, test.unavailable)
+			}
+		} else if err != test.err {
+			t.Errorf("%d: Hold(%s, %v) = %v, want %v", i, test.client, test.ids, err, test.err)
+		}
+		if mine := seatsWithStatus(status(t, r, test.client, testNow), STATUS_MINE); !reflect.DeepEqual(mine, test.mine) {
+			t.Errorf("%d: %s holds %v, want %v", i, test.client, mine, test.mine)
+		}
+	}
+}
+
+func TestHoldExpires(t *testing.T) {
+	r := NewMemoryStore([]string{"A1", "A2"}, nil, 10*time.Minute, time.Hour)
+	if _, err := r.Hold(ctx, "alice", []string{"A1", "A2"}, testNow); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Hold(ctx, "bob", []string{"A1"}, testNow.Add(9*time.Minute)); err == nil {
+		t.Error("bob held A1 before alice's hold expired")
+	}
+	if _, err := r.Hold(ctx, "bob", []string{"A1"}, testNow.Add(10*time.Minute)); err != nil {
+		t.Errorf("bob couldn't hold A1 after alice's hold expired: %v", err)
+	}
+	if _, err := r.Confirm(ctx, "alice", testNow.Add(10*time.Minute)); err != ErrNoHold {
+		t.Errorf("Confirm of an expired hold = %v, want ErrNoHold", err)
+	}
+}
+
+func TestConfirm(t *testing.T) {
+	r := NewMemoryStore([]string{"A1", "A2", "A3"}, nil, 10*time.Minute, time.Hour)
+	if _, err := r.Hold(ctx, "alice", []string{"A1", "A2"}, testNow); err != nil {
+		t.Fatal(err)
+	}
+	booking, err := r.Confirm(ctx, "alice", testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(booking.Seats, []string{"A1", "A2"}) || !booking.Expires.Equal(testNow.Add(time.Hour)) {
+		t.Errorf("Confirm = %+v", booking)
+	}
+	if hold, _ := r.Current(ctx, "alice", testNow); hold != nil {
+		t.Error("alice still has a hold after confirming it")
+	}
+	if booked := seatsWithStatus(status(t, r, "bob", testNow), STATUS_BOOKED); !reflect.DeepEqual(booked, []string{"A1", "A2"}) {
+		t.Errorf("booked seats = %v, want A1 A2", booked)
+	}
+	// Demo bookings expire too.
+	if booked := seatsWithStatus(status(t, r, "bob", testNow.Add(time.Hour)), STATUS_BOOKED); booked != nil {
+		t.Errorf("booked seats after BookingTTL = %v, want none", booked)
+	}
+}
+
+// TestHoldConcurrent has clients race for overlapping pairs of seats. Every
+// seat may end up with one client at most, and every hold must be whole.
+func TestHoldConcurrent(t *testing.T) {
+	var ids []string
+	for i := 0; i < 20; i++ {
+		ids = append(ids, fmt.Sprintf("S%d", i))
+	}
+	r := NewMemoryStore(ids, nil, 10*time.Minute, 0)
+	var wg sync.WaitGroup
+	for c := 0; c < 50; c++ {
+		wg.Add(1)
+		go func(c int) {
+			defer wg.Done()
+			client := fmt.Sprintf("client%d", c)
+			r.Hold(ctx, client, []string{ids[c%20], ids[(c+1)%20]}, testNow)
+		}(c)
+	}
+	wg.Wait()
+
+	owners := make(map[string]string)
+	for c := 0; c < 50; c++ {
+		client := fmt.Sprintf("client%d", c)
+		hold, err := r.Current(ctx, client, testNow)
+		if err != nil || hold == nil {
+			continue
+		}
+		if len(hold.Seats) != 2 {
+			t.Errorf("%s holds %v, want a pair", client, hold.Seats)
+		}
+		for _, id := range hold.Seats {
+			if owner, ok := owners[id]; ok {
+				t.Errorf("%s is held by %s and %s", id, owner, client)
+			}
+			owners[id] = client
+		}
+	}
+	held := seatsWithStatus(status(t, r, "", testNow), STATUS_HELD)
+	if len(held) != len(owners) {
+		t.Errorf("%d seats held, but holds cover %d", len(held), len(owners))
+	}
+}
+
+func status(t *testing.T, r Store, client string, now time.Time) map[string]string {
+	t.Helper()
+	status, err := r.Status(ctx, client, now)
+	if err != nil {
+		t.Fatalf("Status(%s) = %v", client, err)
+	}
+	return status
+}
+
+// seatsWithStatus returns the sorted ids of the seats with status want.
+func seatsWithStatus(status map[string]string, want string) []string {
+	var ids []string
+	for id, s := range status {
+		if s == want {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
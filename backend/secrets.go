@@ -0,0 +1,36 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backend
+
+import (
+	"backend/config"
+	"backend/secrets"
+	"net/http"
+)
+
+const (
+	// Restricted to admins in app.yaml.
+	SECRETS_RELOAD_PATH = "/secrets/reload"
+)
+
+func InitSecrets(cfg *config.Config) {
+	secrets.SetDefault(secrets.NewStore(secrets.ParseBackend(cfg.SecretsBackend), secrets.DEFAULT_TTL))
+	http.HandleFunc(SECRETS_RELOAD_PATH, onlyPost(reloadSecrets))
+}
+
+func reloadSecrets(w http.ResponseWriter, r *http.Request) {
+	secrets.Reload()
+	w.Write([]byte("Reloaded secrets"))
+}
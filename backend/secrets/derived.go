@@ -0,0 +1,73 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package secrets
+
+import (
+	"bytes"
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+// Derived caches a value built from secrets, like a cipher or a signer.
+// The secrets are read through the default store on every Get, so the value
+// is built again when they change after the TTL or a Reload.
+type Derived struct {
+	Names []string
+	// Pass missing secrets to Build as nil instead of failing.
+	Optional bool
+	Build    func(secrets [][]byte) (interface{}, error)
+
+	mu      sync.Mutex
+	secrets [][]byte
+	value   interface{}
+}
+
+// Get returns the value for the current secrets.
+func (d *Derived) Get(ctx context.Context) (interface{}, error) {
+	current := make([][]byte, len(d.Names))
+	for i, name := range d.Names {
+		data, err := Read(ctx, name)
+		if err == ErrNotFound && d.Optional {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		current[i] = data
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.value != nil && equal(d.secrets, current) {
+		return d.value, nil
+	}
+	value, err := d.Build(current)
+	if err != nil {
+		return nil, err
+	}
+	d.secrets, d.value = current, value
+	return value, nil
+}
+
+func equal(a [][]byte, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,54 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secrets
+
+import (
+	"os"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+const DEFAULT_ENV_PREFIX = "SECRET_"
+
+// EnvBackend reads secrets from environment variables. The secret
+// "google_client_secret.json" is read from SECRET_GOOGLE_CLIENT_SECRET_JSON.
+type EnvBackend struct {
+	Prefix string
+}
+
+func (b *EnvBackend) Read(ctx context.Context, name string) ([]byte, error) {
+	value, ok := os.LookupEnv(b.variable(name))
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return []byte(value), nil
+}
+
+func (b *EnvBackend) variable(name string) string {
+	prefix := b.Prefix
+	if prefix == "" {
+		prefix = DEFAULT_ENV_PREFIX
+	}
+	return prefix + strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' {
+			return r - 'a' + 'A'
+		}
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, name)
+}
@@ -0,0 +1,69 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secrets
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/net/context"
+)
+
+// FileBackend reads secrets from the local file system. If Path is a
+// directory, each secret is a file in it. Otherwise Path is a JSON file
+// mapping secret names to either strings or JSON values.
+type FileBackend struct {
+	Path string
+}
+
+func (b *FileBackend) Read(ctx context.Context, name string) ([]byte, error) {
+	info, err := os.Stat(b.Path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return readFile(filepath.Join(b.Path, filepath.Base(name)))
+	}
+
+	data, err := ioutil.ReadFile(b.Path)
+	if err != nil {
+		return nil, err
+	}
+	var secrets map[string]json.RawMessage
+	if err := json.Unmarshal(data, &secrets); err != nil {
+		return nil, err
+	}
+	value, ok := secrets[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	var s string
+	if err := json.Unmarshal(value, &s); err == nil {
+		return []byte(s), nil
+	}
+	return value, nil
+}
+
+func readFile(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
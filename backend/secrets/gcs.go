@@ -0,0 +1,63 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secrets
+
+import (
+	"io/ioutil"
+
+	"cloud.google.com/go/storage"
+	"golang.org/x/net/context"
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/file"
+)
+
+// GCSBackend reads secrets from objects in a Cloud Storage bucket. An empty
+// Bucket means the app's default bucket.
+type GCSBackend struct {
+	Bucket string
+}
+
+func (b *GCSBackend) Read(ctx context.Context, name string) ([]byte, error) {
+	bucketName := b.Bucket
+	if bucketName == "" {
+		var err error
+		bucketName, err = file.DefaultBucketName(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The client is bound to the request context on App Engine, so it can't
+	// be shared. Store caches the result, which keeps this off the hot path.
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	rc, err := client.Bucket(bucketName).Object(name).NewReader(ctx)
+	if err == storage.ErrObjectNotExist {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	return ioutil.ReadAll(rc)
+}
+
+func isDevServer() bool {
+	return appengine.IsDevAppServer()
+}
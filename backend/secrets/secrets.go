@@ -0,0 +1,158 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package secrets loads credentials like OAuth client secrets from a
+// pluggable backend and caches them.
+package secrets
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	DEFAULT_TTL = 10 * time.Minute
+	// Local directory used during development.
+	DEFAULT_LOCAL_DIR = "secrets"
+)
+
+var ErrNotFound = errors.New("secrets: not found")
+
+// Backend reads a named secret.
+type Backend interface {
+	Read(ctx context.Context, name string) ([]byte, error)
+}
+
+// Store caches secrets read from a backend for a limited time.
+type Store struct {
+	backend Backend
+	ttl     time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	data    []byte
+	fetched time.Time
+}
+
+func NewStore(backend Backend, ttl time.Duration) *Store {
+	return &Store{
+		backend: backend,
+		ttl:     ttl,
+		entries: make(map[string]cacheEntry),
+	}
+}
+
+// Read returns the cached secret or reads it from the backend if it is
+// missing or older than the TTL.
+func (s *Store) Read(ctx context.Context, name string) ([]byte, error) {
+	s.mu.Lock()
+	entry, ok := s.entries[name]
+	s.mu.Unlock()
+	if ok && time.Since(entry.fetched) < s.ttl {
+		return entry.data, nil
+	}
+
+	data, err := s.backend.Read(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.entries[name] = cacheEntry{data, time.Now()}
+	s.mu.Unlock()
+	return data, nil
+}
+
+// Reload drops all cached secrets so they are read again on next access.
+func (s *Store) Reload() {
+	s.mu.Lock()
+	s.entries = make(map[string]cacheEntry)
+	s.mu.Unlock()
+}
+
+var defaultStore *Store
+var defaultStoreLock sync.Mutex
+
+// SetDefault replaces the store used by Read and Reload.
+func SetDefault(store *Store) {
+	defaultStoreLock.Lock()
+	defaultStore = store
+	defaultStoreLock.Unlock()
+}
+
+// Read reads a secret from the default store. Unless configured otherwise,
+// secrets come from environment variables first and then from
+// DEFAULT_LOCAL_DIR on the dev server or the default GCS bucket in production.
+func Read(ctx context.Context, name string) ([]byte, error) {
+	defaultStoreLock.Lock()
+	if defaultStore == nil {
+		defaultStore = NewStore(ParseBackend(""), DEFAULT_TTL)
+	}
+	store := defaultStore
+	defaultStoreLock.Unlock()
+	return store.Read(ctx, name)
+}
+
+// Reload drops all secrets cached by the default store.
+func Reload() {
+	defaultStoreLock.Lock()
+	store := defaultStore
+	defaultStoreLock.Unlock()
+	if store != nil {
+		store.Reload()
+	}
+}
+
+// ParseBackend returns the backend described by spec, e.g. "env",
+// "file:secrets.json" or "gcs:my-bucket". An empty spec selects the default.
+func ParseBackend(spec string) Backend {
+	kind, arg := spec, ""
+	if i := strings.Index(spec, ":"); i >= 0 {
+		kind, arg = spec[:i], spec[i+1:]
+	}
+	switch kind {
+	case "env":
+		return &EnvBackend{}
+	case "file":
+		if arg == "" {
+			arg = DEFAULT_LOCAL_DIR
+		}
+		return &FileBackend{Path: arg}
+	case "gcs":
+		return &GCSBackend{Bucket: arg}
+	}
+	if isDevServer() {
+		return Chain{&EnvBackend{}, &FileBackend{Path: DEFAULT_LOCAL_DIR}}
+	}
+	return Chain{&EnvBackend{}, &GCSBackend{}}
+}
+
+// Chain tries each backend in order and returns the first secret found.
+type Chain []Backend
+
+func (c Chain) Read(ctx context.Context, name string) ([]byte, error) {
+	for _, backend := range c {
+		data, err := backend.Read(ctx, name)
+		if err != ErrNotFound {
+			return data, err
+		}
+	}
+	return nil, ErrNotFound
+}
@@ -16,6 +16,7 @@
 package backend
 
 import (
+	"backend/config"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -28,20 +29,28 @@ const (
 	SLOW_IFRAME_SAMPLE_PATH          = "/" + CATEGORY_SAMPLE_TEMPLATES + "/slow-iframe/"
 )
 
-func InitSlowResponseSample() {
+// Cap of ?delay=, the same as of injected delays.
+var maxSlowResponseDelay time.Duration
+
+func InitSlowResponseSample(cfg *config.Config) {
+	maxSlowResponseDelay = maxFaultDelay(cfg)
 	RegisterHandler(SLOW_JSON_SAMPLE_PATH+"", slowJson)
-	RegisterHandler(SLOW_JSON_WITH_ITEMS_SAMPLE_PATH+"", slowJsonWithItems)
+	RegisterHandler(SLOW_JSON_WITH_ITEMS_SAMPLE_PATH+"", slowJsonWithItems(cfg.DistDir))
 	RegisterHandler(SLOW_IFRAME_SAMPLE_PATH+"", slowIframe)
 }
 
 func addDelay(r *http.Request) {
-	delay := getDelay(r)
-	duration := time.Duration(delay) * time.Millisecond
+	duration := time.Duration(getDelay(r)) * time.Millisecond
 	time.Sleep(duration)
 }
 
+// getDelay returns the requested delay in milliseconds, at most
+// maxSlowResponseDelay.
 func getDelay(r *http.Request) uint64 {
 	delay, _ := strconv.ParseUint(r.URL.Query().Get("delay"), 0, 64)
+	if max := uint64(maxSlowResponseDelay / time.Millisecond); delay > max {
+		return max
+	}
 	return delay
 }
 
@@ -52,9 +61,11 @@ func slowJson(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func slowJsonWithItems(w http.ResponseWriter, r *http.Request) {
-	addDelay(r)
-	SendJsonFile(w, DIST_FOLDER+"/json/related_products.json")
+func slowJsonWithItems(distDir string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		addDelay(r)
+		SendJsonFile(w, distDir+"/json/related_products.json")
+	}
 }
 
 func slowIframe(w http.ResponseWriter, r *http.Request) {
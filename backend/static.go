@@ -15,83 +15,137 @@
 package backend
 
 import (
-	"log"
+	"backend/assets"
+	"backend/config"
+	"backend/sxg"
+	"encoding/json"
+	"io"
+	"io/ioutil"
 	"net/http"
-	"net/http/httputil"
-	"net/url"
 	"os"
+	"path/filepath"
+	"regexp"
 	"strings"
-
-	"google.golang.org/appengine"
-	"google.golang.org/appengine/urlfetch"
+	"sync"
 )
 
 const (
 	MAX_AGE_IN_SECONDS = 180 // three minutes
-	OLD_ADDRESS        = "amp-by-example.appspot.com"
-	DIST_DIR           = "dist"
+	// How much of a document is read to find the <html> tag.
+	AMP_SNIFF_LENGTH = 4096
 )
 
-func InitStatic() {
-	fileserver := http.FileServer(http.Dir(DIST_DIR))
-	http.Handle("/", serveStaticFiles(handleNotFound(fileserver)))
+// Matches <html ⚡> and <html amp>, but not the AMP4ADS or AMP4EMAIL formats.
+var ampHtmlTagRegex = regexp.MustCompile(`(?is)<html\b[^>]*?\s(?:⚡|amp)(?:[\s=/>])`)
+
+// Results of isAMPFile by file path. Files in dist don't change while the
+// server is running.
+var ampDocuments = struct {
+	sync.Mutex
+	m map[string]bool
+}{m: make(map[string]bool)}
+
+// URL paths of AMP documents if cfg.AMPManifest is set.
+var ampManifest map[string]bool
+
+func InitStatic(cfg *config.Config) {
+	if cfg.AMPManifest != "" {
+		manifest, err := loadAMPManifest(cfg.AMPManifest)
+		if err != nil {
+			panic(err)
+		}
+		ampManifest = manifest
+	}
+	initOptimizer(cfg)
+	fileserver := assets.FileServer(cfg.DistDir, NotFound)
+	http.Handle("/", Recover(redirects.Handler(serveStaticFiles(cfg, handleNotFound(cfg.DistDir, fileserver)))))
 }
 
-func handleNotFound(h http.Handler) http.HandlerFunc {
+func handleNotFound(distDir string, h http.Handler) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if strings.HasSuffix(r.URL.Path, "/") && !exists(DIST_DIR+r.URL.Path+"index.html") {
-			http.NotFound(w, r)
+		if strings.HasSuffix(r.URL.Path, "/") && !exists(distDir+r.URL.Path+"index.html") {
+			NotFound(w, r)
 			return
 		}
 		h.ServeHTTP(w, r)
 	})
 }
 
-func serveStaticFiles(h http.Handler) http.Handler {
-	return SetVary(EnableCors(
+func serveStaticFiles(cfg *config.Config, h http.Handler) http.Handler {
+	return EnableCors(
 		func(w http.ResponseWriter, r *http.Request) {
-			if r.Host == OLD_ADDRESS || IsInsecureRequest(r) {
-				RedirectToSecureVersion(w, r)
+			if cfg.IsLegacyHost(r.Host) || IsInsecureRequest(r) {
+				RedirectToSecureVersion(w, r, cfg.Host)
 				return
 			}
-			if isAMP(r) && shouldProxy(r) {
-				p := proxyGAE(PACKAGER_PREFIX, r)
-				t := r.URL.String()
-				r.URL.RawQuery = "sign=" + url.QueryEscape(NEW_ADDRESS+r.URL.Path)
-				r.URL.Path = "/priv/doc"
-				log.Printf("Proxying request for [%s] to [%s]", t, r.URL.String())
-				p.ServeHTTP(w, r)
-			} else {
-				if strings.HasSuffix(r.URL.Path, ".json") {
-					w.Header().Set("Content-Type", "application/json")
+			SetDefaultMaxAge(w)
+			if cfg.Features.SignedExchange && isAMP(cfg, r) {
+				// The response depends on these headers whether or not
+				// we end up signing it.
+				SetVary(w.Header())
+				if sxg.ShouldServe(r) && serveSignedExchange(cfg, w, r) {
+					return
 				}
-				SetDefaultMaxAge(w)
-				h.ServeHTTP(w, r)
 			}
-		}))
+			if shouldOptimize(cfg, r) && isAMP(cfg, r) && serveOptimized(cfg, w, r) {
+				return
+			}
+			h.ServeHTTP(w, r)
+		})
 }
 
-func proxyGAE(prefix string, r *http.Request) *httputil.ReverseProxy {
-	u, err := url.Parse(prefix)
-	if err != nil {
-		log.Fatal(err)
+// isAMP reports whether r is for an AMP document, either listed in the
+// manifest or detected by looking at its <html> tag.
+func isAMP(cfg *config.Config, r *http.Request) bool {
+	if ampManifest != nil {
+		return ampManifest[r.URL.Path]
 	}
-	p := httputil.NewSingleHostReverseProxy(u)
-	// Fiddling with the transport might not be necessary with the Go 1.11 runtime:
-	// https://cloud.google.com/blog/products/application-development/go-1-11-is-now-available-on-app-engine
-	p.Transport = &urlfetch.Transport{
-		Context: appengine.NewContext(r),
-	}
-	return p
+	return isAMPFile(distFilePath(cfg.DistDir, r.URL.Path))
 }
 
-func shouldProxy(r *http.Request) bool {
-	return r.Header.Get("amp-cache-transform") != ""
+func isAMPFile(filePath string) bool {
+	ext := filepath.Ext(filePath)
+	if ext != ".html" && ext != ".htm" {
+		return false
+	}
+	ampDocuments.Lock()
+	result, ok := ampDocuments.m[filePath]
+	ampDocuments.Unlock()
+	if ok {
+		return result
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	head, err := ioutil.ReadAll(io.LimitReader(f, AMP_SNIFF_LENGTH))
+	if err != nil {
+		return false
+	}
+	result = ampHtmlTagRegex.Match(head)
+	ampDocuments.Lock()
+	ampDocuments.m[filePath] = result
+	ampDocuments.Unlock()
+	return result
 }
 
-func isAMP(r *http.Request) bool {
-	// TODO Improve heuristics...
-	return !strings.HasSuffix(r.URL.Path, ".json")
+// loadAMPManifest reads a JSON array of the URL paths of all AMP documents.
+func loadAMPManifest(manifestPath string) (map[string]bool, error) {
+	data, err := ioutil.ReadFile(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	if err := json.Unmarshal(data, &paths); err != nil {
+		return nil, err
+	}
+	manifest := make(map[string]bool)
+	for _, p := range paths {
+		manifest[p] = true
+	}
+	return manifest, nil
 }
 
 func exists(path string) bool {
@@ -0,0 +1,103 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sxg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+)
+
+// Just enough CBOR (RFC 7049) to write signed exchange headers and cert
+// chains. Maps are written in canonical order as required by the spec.
+
+const (
+	cborByteString = 2
+	cborTextString = 3
+	cborArray      = 4
+	cborMap        = 5
+)
+
+type cborEncoder struct {
+	bytes.Buffer
+}
+
+func (e *cborEncoder) writeHeader(major byte, n uint64) {
+	major <<= 5
+	switch {
+	case n < 24:
+		e.WriteByte(major | byte(n))
+	case n <= 0xff:
+		e.WriteByte(major | 24)
+		e.WriteByte(byte(n))
+	case n <= 0xffff:
+		e.WriteByte(major | 25)
+		binary.Write(e, binary.BigEndian, uint16(n))
+	case n <= 0xffffffff:
+		e.WriteByte(major | 26)
+		binary.Write(e, binary.BigEndian, uint32(n))
+	default:
+		e.WriteByte(major | 27)
+		binary.Write(e, binary.BigEndian, n)
+	}
+}
+
+func (e *cborEncoder) writeBytes(b []byte) {
+	e.writeHeader(cborByteString, uint64(len(b)))
+	e.Write(b)
+}
+
+func (e *cborEncoder) writeText(s string) {
+	e.writeHeader(cborTextString, uint64(len(s)))
+	e.WriteString(s)
+}
+
+func (e *cborEncoder) writeArrayHeader(n int) {
+	e.writeHeader(cborArray, uint64(n))
+}
+
+// cborMapEntry is a map entry whose key and value are already encoded.
+type cborMapEntry struct {
+	key   []byte
+	value []byte
+}
+
+// writeMap writes entries sorted by their encoded keys, shorter keys first.
+func (e *cborEncoder) writeMap(entries []cborMapEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i].key, entries[j].key
+		if len(a) != len(b) {
+			return len(a) < len(b)
+		}
+		return bytes.Compare(a, b) < 0
+	})
+	e.writeHeader(cborMap, uint64(len(entries)))
+	for _, entry := range entries {
+		e.Write(entry.key)
+		e.Write(entry.value)
+	}
+}
+
+func encodeBytes(b []byte) []byte {
+	var e cborEncoder
+	e.writeBytes(b)
+	return e.Bytes()
+}
+
+func encodeText(s string) []byte {
+	var e cborEncoder
+	e.writeText(s)
+	return e.Bytes()
+}
@@ -0,0 +1,61 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sxg
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+)
+
+const (
+	MI_RECORD_SIZE = 16384
+	MI_ENCODING    = "mi-sha256-03"
+)
+
+// miEncode applies the Merkle Integrity content encoding
+// (draft-thomson-http-mice-03) to body and returns the encoded body and the
+// value of its Digest header.
+func miEncode(body []byte, recordSize int) ([]byte, string) {
+	var records [][]byte
+	for len(body) > recordSize {
+		records = append(records, body[:recordSize])
+		body = body[recordSize:]
+	}
+	records = append(records, body)
+
+	// Proofs are computed from the last record backwards.
+	proofs := make([][]byte, len(records))
+	last := sha256.Sum256(append(append([]byte{}, records[len(records)-1]...), 0))
+	proofs[len(records)-1] = last[:]
+	for i := len(records) - 2; i >= 0; i-- {
+		h := sha256.New()
+		h.Write(records[i])
+		h.Write(proofs[i+1])
+		h.Write([]byte{1})
+		proofs[i] = h.Sum(nil)
+	}
+
+	var out bytes.Buffer
+	binary.Write(&out, binary.BigEndian, uint64(recordSize))
+	for i, record := range records {
+		out.Write(record)
+		if i+1 < len(records) {
+			out.Write(proofs[i+1])
+		}
+	}
+	return out.Bytes(), MI_ENCODING + "=" + base64.StdEncoding.EncodeToString(proofs[0])
+}
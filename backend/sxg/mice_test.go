@@ -0,0 +1,123 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package sxg
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const watermelon = "When I grow up, I want to be a watermelon"
+
+// The examples of draft-thomson-http-mice-03.
+func TestMIEncodeDraftExamples(t *testing.T) {
+	tests := []struct {
+		recordSize int
+		digest     string
+	}{
+		// One record.
+		{0x29, "mi-sha256-03=dcRDgR2GM35DluAV13PzgnG6+pvQwPywfFvAu1UeFrs="},
+		// Three records.
+		{0x10, "mi-sha256-03=IVa9shfs0nyKEhHqtB3WVNANJ2Njm5KjQLjRtnbkYJ4="},
+	}
+	for _, test := range tests {
+		encoded, digest := miEncode([]byte(watermelon), test.recordSize)
+		if digest != test.digest {
+			t.Errorf("record size %d: digest %s, want %s", test.recordSize, digest, test.digest)
+		}
+		if err := miVerify(encoded, digest); err != nil {
+			t.Errorf("record size %d: %v", test.recordSize, err)
+		}
+	}
+}
+
+func TestMIEncodeRecords(t *testing.T) {
+	tests := []struct {
+		size       int
+		recordSize int
+		records    int
+	}{
+		{0, 16, 1},
+		{1, 16, 1},
+		{15, 16, 1},
+		{16, 16, 1},
+		{17, 16, 2},
+		{32, 16, 2},
+		{33, 16, 3},
+		{100000, MI_RECORD_SIZE, 7},
+	}
+	for _, test := range tests {
+		body := bytes.Repeat([]byte("x"), test.size)
+		encoded, digest := miEncode(body, test.recordSize)
+		// Every record but the last is followed by a proof.
+		want := 8 + test.size + (test.records-1)*sha256.Size
+		if len(encoded) != want {
+			t.Errorf("%d bytes in records of %d: encoded to %d bytes, want %d", test.size, test.recordSize, len(encoded), want)
+		}
+		if err := miVerify(encoded, digest); err != nil {
+			t.Errorf("%d bytes in records of %d: %v", test.size, test.recordSize, err)
+		}
+		// A changed byte in any record must fail the proofs.
+		if test.size > 0 {
+			encoded[len(encoded)-1] ^= 1
+			if err := miVerify(encoded, digest); err == nil {
+				t.Errorf("%d bytes in records of %d: tampered body verified", test.size, test.recordSize)
+			}
+		}
+	}
+}
+
+// miVerify checks encoded against digest record by record, the way a client
+// reading the stream would.
+func miVerify(encoded []byte, digest string) error {
+	if !strings.HasPrefix(digest, MI_ENCODING+"=") {
+		return fmt.Errorf("digest %q isn't %s", digest, MI_ENCODING)
+	}
+	proof, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(digest, MI_ENCODING+"="))
+	if err != nil {
+		return err
+	}
+	if len(encoded) < 8 {
+		return fmt.Errorf("no record size")
+	}
+	recordSize := int(binary.BigEndian.Uint64(encoded))
+	rest := encoded[8:]
+	for {
+		h := sha256.New()
+		if len(rest) <= recordSize {
+			h.Write(rest)
+			h.Write([]byte{0})
+			if !bytes.Equal(h.Sum(nil), proof) {
+				return fmt.Errorf("last record doesn't match its proof")
+			}
+			return nil
+		}
+		if len(rest) < recordSize+sha256.Size {
+			return fmt.Errorf("truncated proof")
+		}
+		record, next := rest[:recordSize], rest[recordSize:recordSize+sha256.Size]
+		h.Write(record)
+		h.Write(next)
+		h.Write([]byte{1})
+		if !bytes.Equal(h.Sum(nil), proof) {
+			return fmt.Errorf("record doesn't match its proof")
+		}
+		proof, rest = next, rest[recordSize+sha256.Size:]
+	}
+}
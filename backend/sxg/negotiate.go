@@ -0,0 +1,204 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sxg
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Version of the AMP cache transforms supported by the signed documents.
+	TRANSFORM_VERSION = 1
+)
+
+// Caches we sign for. "any" means the requester accepts any cache.
+var supportedTransforms = map[string]bool{
+	"any":    true,
+	"google": true,
+}
+
+// Transform is an item of the AMP-Cache-Transform header, e.g.
+// google;v="1..2".
+type Transform struct {
+	Identifier string
+	Params     map[string]string
+}
+
+// ParseAMPCacheTransform parses the AMP-Cache-Transform structured header
+// (a parameterised list, see
+// https://github.com/ampproject/amphtml/blob/master/spec/amp-cache-transform.md).
+func ParseAMPCacheTransform(value string) ([]Transform, error) {
+	var result []Transform
+	for _, item := range splitList(value, ',') {
+		parts := splitList(item, ';')
+		if len(parts) == 0 || !isToken(parts[0]) {
+			return nil, errors.New("sxg: invalid AMP-Cache-Transform item: " + item)
+		}
+		t := Transform{Identifier: parts[0], Params: map[string]string{}}
+		for _, param := range parts[1:] {
+			key, value := param, ""
+			if i := strings.IndexByte(param, '='); i >= 0 {
+				key, value = strings.TrimSpace(param[:i]), strings.TrimSpace(param[i+1:])
+				if strings.HasPrefix(value, `"`) {
+					unquoted, err := strconv.Unquote(value)
+					if err != nil {
+						return nil, errors.New("sxg: invalid AMP-Cache-Transform parameter: " + param)
+					}
+					value = unquoted
+				}
+			}
+			if !isToken(key) {
+				return nil, errors.New("sxg: invalid AMP-Cache-Transform parameter: " + param)
+			}
+			t.Params[key] = value
+		}
+		result = append(result, t)
+	}
+	return result, nil
+}
+
+// IsSupported reports whether a document signed for TRANSFORM_VERSION may be
+// served to the requester. The "v" parameter is a list of versions or
+// version ranges like "1..3", and defaults to any version.
+func (t Transform) IsSupported() bool {
+	if !supportedTransforms[t.Identifier] {
+		return false
+	}
+	versions, ok := t.Params["v"]
+	if !ok {
+		return true
+	}
+	for _, v := range splitList(versions, ',') {
+		from, to := v, v
+		if i := strings.Index(v, ".."); i >= 0 {
+			from, to = v[:i], v[i+2:]
+		}
+		min, errMin := strconv.Atoi(from)
+		max, errMax := strconv.Atoi(to)
+		if errMin == nil && errMax == nil && min <= TRANSFORM_VERSION && TRANSFORM_VERSION <= max {
+			return true
+		}
+	}
+	return false
+}
+
+// AcceptsTransform reports whether the AMP-Cache-Transform request header
+// asks for a transform we can satisfy.
+func AcceptsTransform(value string) bool {
+	if value == "" {
+		return false
+	}
+	transforms, err := ParseAMPCacheTransform(value)
+	if err != nil {
+		return false
+	}
+	for _, t := range transforms {
+		if t.IsSupported() {
+			return true
+		}
+	}
+	return false
+}
+
+// AcceptsSignedExchange reports whether the Accept header prefers
+// application/signed-exchange;v=b3 at least as much as text/html.
+func AcceptsSignedExchange(accept string) bool {
+	sxgQuality, htmlQuality := 0.0, 0.0
+	for _, item := range splitList(accept, ',') {
+		parts := splitList(item, ';')
+		if len(parts) == 0 {
+			continue
+		}
+		mediaType := strings.ToLower(parts[0])
+		quality := 1.0
+		version := ""
+		for _, param := range parts[1:] {
+			i := strings.IndexByte(param, '=')
+			if i < 0 {
+				continue
+			}
+			key, value := strings.ToLower(strings.TrimSpace(param[:i])), strings.TrimSpace(param[i+1:])
+			switch key {
+			case "q":
+				q, err := strconv.ParseFloat(value, 64)
+				if err != nil || q < 0 || q > 1 {
+					q = 0
+				}
+				quality = q
+			case "v":
+				version = strings.Trim(value, `"`)
+			}
+		}
+		switch mediaType {
+		case "application/signed-exchange":
+			if version == "b3" && quality > sxgQuality {
+				sxgQuality = quality
+			}
+		case "text/html", "text/*", "*/*":
+			if quality > htmlQuality {
+				htmlQuality = quality
+			}
+		}
+	}
+	return sxgQuality > 0 && sxgQuality >= htmlQuality
+}
+
+// ShouldServe reports whether r asks for a signed exchange. Both headers
+// need to agree, so browsers that only accept SXG in general keep getting
+// HTML.
+func ShouldServe(r *http.Request) bool {
+	return AcceptsTransform(r.Header.Get("AMP-Cache-Transform")) &&
+		AcceptsSignedExchange(r.Header.Get("Accept"))
+}
+
+// splitList splits s at sep, ignoring separators inside quoted strings, and
+// trims the items. Empty items are dropped.
+func splitList(s string, sep byte) []string {
+	var result []string
+	quoted := false
+	start := 0
+	for i := 0; i <= len(s); i++ {
+		if i < len(s) {
+			switch {
+			case s[i] == '"' && (i == 0 || s[i-1] != '\\'):
+				quoted = !quoted
+				continue
+			case s[i] != sep || quoted:
+				continue
+			}
+		}
+		if item := strings.TrimSpace(s[start:i]); item != "" {
+			result = append(result, item)
+		}
+		start = i + 1
+	}
+	return result
+}
+
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_' || c == '-' || c == '.' || c == '*') {
+			return false
+		}
+	}
+	return true
+}
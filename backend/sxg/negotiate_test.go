@@ -0,0 +1,143 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package sxg
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestParseAMPCacheTransform(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []Transform
+		err   bool
+	}{
+		{"", nil, false},
+		{"google", []Transform{{"google", map[string]string{}}}, false},
+		{`google;v="1..2"`, []Transform{{"google", map[string]string{"v": "1..2"}}}, false},
+		{`any, google ; v="1,3"`, []Transform{
+			{"any", map[string]string{}},
+			{"google", map[string]string{"v": "1,3"}},
+		}, false},
+		{"google;flag", []Transform{{"google", map[string]string{"flag": ""}}}, false},
+		{"Google", nil, true},
+		{`"google"`, nil, true},
+		{`google;v="1`, nil, true},
+		{"google;=1", nil, true},
+		{"google;V=1", nil, true},
+	}
+	for _, test := range tests {
+		got, err := ParseAMPCacheTransform(test.value)
+		if (err != nil) != test.err {
+			t.Errorf("ParseAMPCacheTransform(%q) error = %v, want error %v", test.value, err, test.err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParseAMPCacheTransform(%q) = %v, want %v", test.value, got, test.want)
+		}
+	}
+}
+
+func TestAcceptsTransform(t *testing.T) {
+	tests := []struct {
+		value string
+		want  bool
+	}{
+		{"", false},
+		{"any", true},
+		{"google", true},
+		{"bing", false},
+		{"bing, google", true},
+		{`google;v="1"`, true},
+		{`google;v="1..2"`, true},
+		{`google;v="2..3"`, false},
+		{`google;v="0,1"`, true},
+		{`google;v="x..y"`, false},
+		{`google;v="1`, false},
+	}
+	for _, test := range tests {
+		if got := AcceptsTransform(test.value); got != test.want {
+			t.Errorf("AcceptsTransform(%q) = %v, want %v", test.value, got, test.want)
+		}
+	}
+}
+
+func TestAcceptsSignedExchange(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   bool
+	}{
+		{"", false},
+		{"*/*", false},
+		{"text/html", false},
+		{"application/signed-exchange;v=b3", true},
+		{`application/signed-exchange;v="b3"`, true},
+		{"Application/Signed-Exchange;V=b3", true},
+		{"application/signed-exchange;v=b2", false},
+		{"application/signed-exchange", false},
+		{"application/signed-exchange;v", false},
+		{"application/signed-exchange;v=b3;q=0", false},
+		{"application/signed-exchange;v=b3;q=2", false},
+		{"application/signed-exchange;v=b3;q=x", false},
+		{"application/signed-exchange;v=b3,*/*;q=0.8", true},
+		{"application/signed-exchange;v=b3;q=0.8,*/*", false},
+		{"text/html;q=0.9,application/signed-exchange;v=b3", true},
+		{"text/html,application/signed-exchange;v=b3", true},
+		{"text/*;q=0.5,application/signed-exchange;v=b2,application/signed-exchange;v=b3;q=0.5", true},
+		// Chrome's navigation header: SXG is accepted but HTML is preferred.
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.9", false},
+		// Googlebot prefers SXG.
+		{"text/html;q=0.9,application/signed-exchange;v=b3,*/*;q=0.8", true},
+		{",;,application/signed-exchange;v=b3", true},
+	}
+	for _, test := range tests {
+		if got := AcceptsSignedExchange(test.accept); got != test.want {
+			t.Errorf("AcceptsSignedExchange(%q) = %v, want %v", test.accept, got, test.want)
+		}
+	}
+}
+
+func TestShouldServe(t *testing.T) {
+	tests := []struct {
+		accept    string
+		transform string
+		want      bool
+	}{
+		{"application/signed-exchange;v=b3", "google", true},
+		{"application/signed-exchange;v=b3", "", false},
+		{"", "google", false},
+		{"application/signed-exchange;v=b2", "google", false},
+		{"application/signed-exchange;v=b3;q=0", "any", false},
+		{"application/signed-exchange;v=b3", `google;v="2"`, false},
+		{"application/signed-exchange;v=b3", "google;", true},
+		{"application/signed-exchange;v=b3", "google;v=\"", false},
+	}
+	for _, test := range tests {
+		r, err := http.NewRequest("GET", "https://example.com/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.accept != "" {
+			r.Header.Set("Accept", test.accept)
+		}
+		if test.transform != "" {
+			r.Header.Set("AMP-Cache-Transform", test.transform)
+		}
+		if got := ShouldServe(r); got != test.want {
+			t.Errorf("ShouldServe(Accept: %q, AMP-Cache-Transform: %q) = %v, want %v", test.accept, test.transform, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sxg creates signed exchanges (version b3) as described in
+// https://tools.ietf.org/html/draft-yasskin-http-origin-signed-responses-05.
+package sxg
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	CONTENT_TYPE            = "application/signed-exchange;v=b3"
+	CERT_CHAIN_CONTENT_TYPE = "application/cert-chain+cbor"
+
+	magic          = "sxg1-b3\x00"
+	signatureLabel = "HTTP Exchange 1 b3"
+	// Browsers reject signatures valid for more than seven days.
+	maxValidity = 7 * 24 * time.Hour
+)
+
+// Headers that must not be part of a signed exchange, see
+// https://wicg.github.io/webpackage/loading.html#stateful-response-header
+var statefulHeaders = map[string]bool{
+	"authentication-control":    true,
+	"authentication-info":       true,
+	"clear-site-data":           true,
+	"optional-www-authenticate": true,
+	"proxy-authenticate":        true,
+	"proxy-authentication-info": true,
+	"public-key-pins":           true,
+	"sec-websocket-accept":      true,
+	"set-cookie":                true,
+	"set-cookie2":               true,
+	"setprofile":                true,
+	"strict-transport-security": true,
+	"www-authenticate":          true,
+}
+
+// Signer signs exchanges with a P-256 key. CertURL is where the cert chain
+// written by WriteCertChain is served, ValidityURL must be on the same origin
+// as the signed URLs.
+type Signer struct {
+	Certs       []*x509.Certificate
+	Key         *ecdsa.PrivateKey
+	CertURL     string
+	ValidityURL string
+	// OCSP response for the leaf certificate. Browsers require a valid one,
+	// a placeholder is enough for local testing.
+	OCSP []byte
+}
+
+// NewSigner parses the PEM encoded certificate chain, leaf first, and the
+// PEM encoded private key of the leaf.
+func NewSigner(certPEM []byte, keyPEM []byte) (*Signer, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, certPEM = pem.Decode(certPEM)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("sxg: no certificate found")
+	}
+	key, err := parsePrivateKey(keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	if key.Curve != elliptic.P256() {
+		return nil, errors.New("sxg: key must use the P-256 curve")
+	}
+	return &Signer{Certs: certs, Key: key}, nil
+}
+
+func parsePrivateKey(keyPEM []byte) (*ecdsa.PrivateKey, error) {
+	for {
+		var block *pem.Block
+		block, keyPEM = pem.Decode(keyPEM)
+		if block == nil {
+			return nil, errors.New("sxg: no private key found")
+		}
+		switch block.Type {
+		case "EC PRIVATE KEY":
+			return x509.ParseECPrivateKey(block.Bytes)
+		case "PRIVATE KEY":
+			key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			ecKey, ok := key.(*ecdsa.PrivateKey)
+			if !ok {
+				return nil, errors.New("sxg: private key is not an ECDSA key")
+			}
+			return ecKey, nil
+		}
+	}
+}
+
+// CertID returns a stable identifier of the leaf certificate for use in
+// CertURL.
+func (s *Signer) CertID() string {
+	sum := sha256.Sum256(s.Certs[0].Raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// Sign writes a signed exchange for a GET request of requestURL answered
+// with status, header and body. The signature is valid from date for seven
+// days, or until the leaf certificate expires.
+func (s *Signer) Sign(w io.Writer, requestURL string, status int, header http.Header, body []byte, date time.Time) error {
+	encodedBody, digest := miEncode(body, MI_RECORD_SIZE)
+	responseHeaders := s.encodeResponseHeaders(status, header, digest)
+
+	expires := date.Add(maxValidity)
+	if notAfter := s.Certs[0].NotAfter; notAfter.Before(expires) {
+		expires = notAfter
+	}
+	if !expires.After(date) {
+		return errors.New("sxg: certificate expired")
+	}
+	signature, err := s.signature(requestURL, responseHeaders, date, expires)
+	if err != nil {
+		return err
+	}
+	if len(requestURL) > 0xffff {
+		return errors.New("sxg: request URL too long")
+	}
+	if len(signature) > 0xffffff || len(responseHeaders) > 0xffffff {
+		return errors.New("sxg: headers too long")
+	}
+
+	var out bytes.Buffer
+	out.WriteString(magic)
+	binary.Write(&out, binary.BigEndian, uint16(len(requestURL)))
+	out.WriteString(requestURL)
+	writeUint24(&out, len(signature))
+	writeUint24(&out, len(responseHeaders))
+	out.WriteString(signature)
+	out.Write(responseHeaders)
+	out.Write(encodedBody)
+	_, err = out.WriteTo(w)
+	return err
+}
+
+func (s *Signer) encodeResponseHeaders(status int, header http.Header, digest string) []byte {
+	entries := []cborMapEntry{
+		{encodeBytes([]byte(":status")), encodeBytes([]byte(strconv.Itoa(status)))},
+		{encodeBytes([]byte("content-encoding")), encodeBytes([]byte(MI_ENCODING))},
+		{encodeBytes([]byte("digest")), encodeBytes([]byte(digest))},
+	}
+	for name, values := range header {
+		name = strings.ToLower(name)
+		if statefulHeaders[name] || name == "content-encoding" || name == "digest" || name == "content-length" {
+			continue
+		}
+		entries = append(entries, cborMapEntry{
+			encodeBytes([]byte(name)),
+			encodeBytes([]byte(strings.Join(values, ","))),
+		})
+	}
+	var e cborEncoder
+	e.writeMap(entries)
+	return e.Bytes()
+}
+
+// signature returns the value of the Signature header.
+func (s *Signer) signature(requestURL string, responseHeaders []byte, date time.Time, expires time.Time) (string, error) {
+	certSHA256 := sha256.Sum256(s.Certs[0].Raw)
+
+	var message bytes.Buffer
+	message.Write(bytes.Repeat([]byte{0x20}, 64))
+	message.WriteString(signatureLabel)
+	message.WriteByte(0)
+	message.WriteByte(byte(len(certSHA256)))
+	message.Write(certSHA256[:])
+	writeBytesWithLength(&message, []byte(s.ValidityURL))
+	binary.Write(&message, binary.BigEndian, uint64(date.Unix()))
+	binary.Write(&message, binary.BigEndian, uint64(expires.Unix()))
+	writeBytesWithLength(&message, []byte(requestURL))
+	writeBytesWithLength(&message, responseHeaders)
+
+	hash := sha256.Sum256(message.Bytes())
+	r, ss, err := ecdsa.Sign(rand.Reader, s.Key, hash[:])
+	if err != nil {
+		return "", err
+	}
+	sig, err := asn1.Marshal(struct{ R, S *big.Int }{r, ss})
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("sig1;sig=*%s*;integrity=\"digest/%s\";cert-url=\"%s\";cert-sha256=*%s*;validity-url=\"%s\";date=%d;expires=%d",
+		base64.StdEncoding.EncodeToString(sig),
+		MI_ENCODING,
+		s.CertURL,
+		base64.StdEncoding.EncodeToString(certSHA256[:]),
+		s.ValidityURL,
+		date.Unix(),
+		expires.Unix()), nil
+}
+
+// WriteCertChain writes the application/cert-chain+cbor representation of
+// the signer's certificates.
+func (s *Signer) WriteCertChain(w io.Writer) error {
+	var e cborEncoder
+	e.writeArrayHeader(len(s.Certs) + 1)
+	e.writeText("\U0001F4DC\u26D3") // "📜⛓"
+	for i, cert := range s.Certs {
+		entries := []cborMapEntry{
+			{encodeText("cert"), encodeBytes(cert.Raw)},
+		}
+		if i == 0 {
+			entries = append(entries, cborMapEntry{encodeText("ocsp"), encodeBytes(s.OCSP)})
+		}
+		e.writeMap(entries)
+	}
+	_, err := e.WriteTo(w)
+	return err
+}
+
+func writeUint24(w *bytes.Buffer, n int) {
+	w.WriteByte(byte(n >> 16))
+	w.WriteByte(byte(n >> 8))
+	w.WriteByte(byte(n))
+}
+
+func writeBytesWithLength(w *bytes.Buffer, b []byte) {
+	binary.Write(w, binary.BigEndian, uint64(len(b)))
+	w.Write(b)
+}
@@ -0,0 +1,242 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package sxg
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+)
+
+var signDate = time.Date(2019, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// newTestSigner returns a signer with a self-signed P-256 certificate valid
+// until notAfter, like the one used for local testing.
+func newTestSigner(t *testing.T, notAfter time.Time) *Signer {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		DNSNames:     []string{"example.com"},
+		NotBefore:    signDate.Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := NewSigner(
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer.CertURL = "https://example.com/cert/" + signer.CertID()
+	signer.ValidityURL = "https://example.com/resource.validity"
+	return signer
+}
+
+// exchange is a parsed application/signed-exchange;v=b3 response.
+type exchange struct {
+	requestURL string
+	signature  string
+	headers    []byte
+	body       []byte
+}
+
+func parseExchange(t *testing.T, data []byte) *exchange {
+	if !bytes.HasPrefix(data, []byte(magic)) {
+		t.Fatalf("exchange doesn't start with %q", magic)
+	}
+	data = data[len(magic):]
+	urlLength := int(binary.BigEndian.Uint16(data))
+	data = data[2:]
+	e := &exchange{requestURL: string(data[:urlLength])}
+	data = data[urlLength:]
+	uint24 := func(b []byte) int {
+		return int(b[0])<<16 | int(b[1])<<8 | int(b[2])
+	}
+	signatureLength, headersLength := uint24(data), uint24(data[3:])
+	data = data[6:]
+	e.signature = string(data[:signatureLength])
+	e.headers = data[signatureLength : signatureLength+headersLength]
+	e.body = data[signatureLength+headersLength:]
+	return e
+}
+
+// cborBytes encodes a byte string of less than 256 bytes.
+func cborBytes(s string) []byte {
+	if len(s) < 24 {
+		return append([]byte{0x40 | byte(len(s))}, s...)
+	}
+	return append([]byte{0x58, byte(len(s))}, s...)
+}
+
+func TestSign(t *testing.T) {
+	tests := []struct {
+		notAfter time.Time
+		expires  time.Time
+	}{
+		{signDate.Add(90 * 24 * time.Hour), signDate.Add(7 * 24 * time.Hour)},
+		// The signature can't outlive the certificate.
+		{signDate.Add(48 * time.Hour), signDate.Add(48 * time.Hour)},
+	}
+	for _, test := range tests {
+		signer := newTestSigner(t, test.notAfter)
+		header := http.Header{}
+		header.Set("Content-Type", "text/html")
+		header.Set("Set-Cookie", "session=secret")
+		header.Set("Content-Length", "42")
+		body := []byte("<!doctype html><html amp><body>Hello</body></html>")
+
+		var out bytes.Buffer
+		requestURL := "https://example.com/resource"
+		if err := signer.Sign(&out, requestURL, 200, header, body, signDate); err != nil {
+			t.Fatal(err)
+		}
+		e := parseExchange(t, out.Bytes())
+		if e.requestURL != requestURL {
+			t.Errorf("request URL %q, want %q", e.requestURL, requestURL)
+		}
+
+		// The body is mi-sha256 encoded and covered by the digest header.
+		_, digest := miEncode(body, MI_RECORD_SIZE)
+		if err := miVerify(e.body, digest); err != nil {
+			t.Error(err)
+		}
+
+		// Canonical CBOR: shorter keys first, stateful and length headers
+		// left out.
+		var want bytes.Buffer
+		want.WriteByte(0xa4)
+		for _, entry := range [][2]string{
+			{"digest", digest},
+			{":status", "200"},
+			{"content-type", "text/html"},
+			{"content-encoding", MI_ENCODING},
+		} {
+			want.Write(cborBytes(entry[0]))
+			want.Write(cborBytes(entry[1]))
+		}
+		if !bytes.Equal(e.headers, want.Bytes()) {
+			t.Errorf("headers\n%x\nwant\n%x", e.headers, want.Bytes())
+		}
+
+		verifySignature(t, signer, e, test.expires)
+	}
+}
+
+// verifySignature checks the Signature header against the signed message
+// as a browser would.
+func verifySignature(t *testing.T, signer *Signer, e *exchange, expires time.Time) {
+	params := make(map[string]string)
+	for _, m := range regexp.MustCompile(`([a-z0-9-]+)=("[^"]*"|\*[^*]*\*|[0-9]+)`).FindAllStringSubmatch(e.signature, -1) {
+		params[m[1]] = m[2]
+	}
+	certSHA256 := sha256.Sum256(signer.Certs[0].Raw)
+	wantParams := map[string]string{
+		"integrity":    `"digest/` + MI_ENCODING + `"`,
+		"cert-url":     `"` + signer.CertURL + `"`,
+		"cert-sha256":  "*" + base64.StdEncoding.EncodeToString(certSHA256[:]) + "*",
+		"validity-url": `"` + signer.ValidityURL + `"`,
+		"date":         strconv.FormatInt(signDate.Unix(), 10),
+		"expires":      strconv.FormatInt(expires.Unix(), 10),
+	}
+	for name, want := range wantParams {
+		if params[name] != want {
+			t.Errorf("signature %s = %s, want %s", name, params[name], want)
+		}
+	}
+
+	var message bytes.Buffer
+	message.Write(bytes.Repeat([]byte{0x20}, 64))
+	message.WriteString("HTTP Exchange 1 b3\x00")
+	message.WriteByte(32)
+	message.Write(certSHA256[:])
+	withLength := func(b []byte) {
+		binary.Write(&message, binary.BigEndian, uint64(len(b)))
+		message.Write(b)
+	}
+	withLength([]byte(signer.ValidityURL))
+	binary.Write(&message, binary.BigEndian, uint64(signDate.Unix()))
+	binary.Write(&message, binary.BigEndian, uint64(expires.Unix()))
+	withLength([]byte(e.requestURL))
+	withLength(e.headers)
+
+	sig, err := base64.StdEncoding.DecodeString(params["sig"][1 : len(params["sig"])-1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rs struct{ R, S *big.Int }
+	if _, err := asn1.Unmarshal(sig, &rs); err != nil {
+		t.Fatal(err)
+	}
+	hash := sha256.Sum256(message.Bytes())
+	if !ecdsa.Verify(&signer.Key.PublicKey, hash[:], rs.R, rs.S) {
+		t.Error("signature doesn't verify")
+	}
+	// Changed headers mustn't verify.
+	message.Bytes()[message.Len()-1] ^= 1
+	hash = sha256.Sum256(message.Bytes())
+	if ecdsa.Verify(&signer.Key.PublicKey, hash[:], rs.R, rs.S) {
+		t.Error("signature verifies changed headers")
+	}
+}
+
+func TestSignExpiredCertificate(t *testing.T) {
+	signer := newTestSigner(t, signDate.Add(-time.Minute))
+	if err := signer.Sign(&bytes.Buffer{}, "https://example.com/", 200, http.Header{}, nil, signDate); err == nil {
+		t.Error("Sign succeeded with an expired certificate")
+	}
+}
+
+func TestNewSignerRejectsOtherCurves(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), NotAfter: signDate}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	_, err = NewSigner(
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	if err == nil {
+		t.Error("NewSigner accepted a P-384 key")
+	}
+}
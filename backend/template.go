@@ -15,6 +15,7 @@
 package backend
 
 import (
+	"backend/config"
 	"html/template"
 	"io"
 	"net/http"
@@ -36,10 +37,10 @@ var MODES = [...]string{"", "/embed", "/source", "/preview", "/preview/embed"}
 
 // RegisterSample adds routes for different sample modes, e.g. (my_sample/embed, my_sample/preview,..).
 // Use it whenever a sample requires a custom backend logic.
-func RegisterSample(samplePath string, handler func(http.ResponseWriter, *http.Request, Page)) {
+func RegisterSample(cfg *config.Config, samplePath string, handler func(http.ResponseWriter, *http.Request, Page)) {
 	/*
 		for _, mode := range MODES {
-			registerSampleHandler(samplePath, mode, handler)
+			registerSampleHandler(cfg, samplePath, mode, handler)
 		}
 	*/
 }
@@ -54,7 +55,7 @@ func RegisterSampleEndpoint(samplePath string, name string,
 }
 
 // RegisterTemplate configures a handler for requests rendering a template.
-func RegisterTemplate(route string, mode string, templatePath string,
+func RegisterTemplate(cfg *config.Config, route string, mode string, templatePath string,
 	handler func(http.ResponseWriter, *http.Request, Page)) {
 	page := Page{
 		Mode:     mode,
@@ -63,7 +64,7 @@ func RegisterTemplate(route string, mode string, templatePath string,
 	}
 	RegisterHandler(route, func(w http.ResponseWriter, r *http.Request) {
 		if IsInsecureRequest(r) {
-			RedirectToSecureVersion(w, r)
+			RedirectToSecureVersion(w, r, cfg.Host)
 			return
 		}
 		handler(w, r, page)
@@ -82,19 +83,26 @@ func registerSampleEndpointHandler(samplePath string, mode string, endpoint stri
 	})
 }
 
-func registerSampleHandler(samplePath string, mode string, handler func(http.ResponseWriter, *http.Request, Page)) {
-	templatePath := path.Join(DIST_FOLDER, samplePath, mode, "index.html")
+func registerSampleHandler(cfg *config.Config, samplePath string, mode string, handler func(http.ResponseWriter, *http.Request, Page)) {
+	templatePath := path.Join(cfg.DistDir, samplePath, mode, "index.html")
 	if _, err := os.Stat(templatePath); err != nil {
 		return
 	}
 	route := path.Join("/", samplePath, mode) + "/"
-	RegisterTemplate(route, mode, templatePath, handler)
+	RegisterTemplate(cfg, route, mode, templatePath, handler)
 }
 
 func parseTemplate(filePath string) *template.Template {
-	template, err := template.New(path.Base(filePath)).Delims("[[", "]]").ParseFiles(filePath)
+	template, err := loadTemplate(filePath)
 	if err != nil {
 		panic(err)
 	}
 	return template
 }
+
+func loadTemplate(filePath string) (*template.Template, error) {
+	return template.New(path.Base(filePath)).
+		Delims("[[", "]]").
+		Funcs(template.FuncMap{"asset": assetPath}).
+		ParseFiles(filePath)
+}
@@ -15,6 +15,7 @@
 package backend
 
 import (
+	"backend/config"
 	"net/http"
 	"time"
 )
@@ -23,7 +24,7 @@ const (
 	BIND_SAMPLE_PATH = "/" + CATEGORY_COMPONENTS + "/time/"
 )
 
-func InitStateRefreshSection() {
+func InitStateRefreshSection(cfg *config.Config) {
 	RegisterHandler(BIND_SAMPLE_PATH, getTime)
 }
 
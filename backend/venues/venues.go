@@ -0,0 +1,265 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// Package venues lays out seat maps from venue definitions. A venue has
+// sections of lettered rows with numbered seats, price zones assigned by
+// section or row, and accessible seats. Layout turns a definition into seat
+// rectangles for an SVG seat map.
+package venues
+
+import (
+	"backend/money"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Seat numbering directions, seen from the stage.
+const (
+	LEFT_TO_RIGHT = "left-to-right"
+	RIGHT_TO_LEFT = "right-to-left"
+)
+
+type Venue struct {
+	ID       string    `json:"id"`
+	Name     string    `json:"name"`
+	Seat     SeatStyle `json:"seat"`
+	Zones    []Zone    `json:"zones"`
+	Sections []Section `json:"sections"`
+}
+
+// SeatStyle sizes the seats and the space between them.
+type SeatStyle struct {
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+	// Between seats of a row.
+	Gap float64 `json:"gap"`
+	// Between rows.
+	RowGap float64 `json:"rowGap"`
+	// Width of an aisle.
+	Aisle  float64 `json:"aisle"`
+	Radius float64 `json:"radius"`
+}
+
+// Zone is a price category.
+type Zone struct {
+	ID    string       `json:"id"`
+	Name  string       `json:"name"`
+	Price money.Amount `json:"price"`
+}
+
+type Section struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Top left corner of the section.
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+	// Row labels front to back, a range like "A-K" or a list like "AA,BB".
+	Rows string `json:"rows"`
+	// Seats per row, RowSeats overrides it by row label. Shorter rows are
+	// centered.
+	Seats    int            `json:"seats"`
+	RowSeats map[string]int `json:"rowSeats"`
+	// LEFT_TO_RIGHT by default.
+	Numbering string `json:"numbering"`
+	// Positions from the left after which there's an aisle.
+	AislesAfter []int  `json:"aislesAfter"`
+	Zone        string `json:"zone"`
+	// Zones by row label, overriding Zone.
+	RowZones map[string]string `json:"rowZones"`
+	// Seats by row label and number, e.g. "A1".
+	Accessible []string `json:"accessible"`
+	Booked     []string `json:"booked"`
+	Missing    []string `json:"missing"`
+}
+
+// Seat is a seat laid out on the seat map.
+type Seat struct {
+	ID         string  `json:"id"`
+	Section    string  `json:"section"`
+	Row        string  `json:"row"`
+	Number     int     `json:"number"`
+	Zone       string  `json:"zone"`
+	X          float64 `json:"x"`
+	Y          float64 `json:"y"`
+	Width      float64 `json:"width"`
+	Height     float64 `json:"height"`
+	Radius     float64 `json:"radius"`
+	Accessible bool    `json:"accessible"`
+	Booked     bool    `json:"booked"`
+}
+
+type SeatMap struct {
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+	Seats  []Seat  `json:"seats"`
+}
+
+// Parse reads a JSON object with a "venues" array.
+func Parse(data []byte) ([]Venue, error) {
+	var file struct {
+		Venues []Venue `json:"venues"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	return file.Venues, nil
+}
+
+// ZonePrice returns the price of the zone with id.
+func (v *Venue) ZonePrice(id string) (money.Amount, bool) {
+	for _, zone := range v.Zones {
+		if zone.ID == id {
+			return zone.Price, true
+		}
+	}
+	return 0, false
+}
+
+// Layout places the seats of v. Seat IDs are the section ID, the row label
+// and the seat number, e.g. "stalls-A1".
+func Layout(v *Venue) (*SeatMap, error) {
+	style := v.Seat
+	if style.Width <= 0 || style.Height <= 0 {
+		return nil, fmt.Errorf("venues: %s: seats need a size", v.ID)
+	}
+	if style.Aisle == 0 {
+		style.Aisle = style.Width
+	}
+	seatMap := &SeatMap{}
+	ids := make(map[string]bool)
+	for _, section := range v.Sections {
+		seats, err := layoutSection(v, &section, &style)
+		if err != nil {
+			return nil, fmt.Errorf("venues: %s: section %s: %v", v.ID, section.ID, err)
+		}
+		for _, seat := range seats {
+			if ids[seat.ID] {
+				return nil, fmt.Errorf("venues: %s: duplicate seat %s", v.ID, seat.ID)
+			}
+			ids[seat.ID] = true
+			seatMap.Width = math.Max(seatMap.Width, round(seat.X+seat.Width))
+			seatMap.Height = math.Max(seatMap.Height, round(seat.Y+seat.Height))
+		}
+		seatMap.Seats = append(seatMap.Seats, seats...)
+	}
+	return seatMap, nil
+}
+
+func layoutSection(v *Venue, section *Section, style *SeatStyle) ([]Seat, error) {
+	rows, err := parseRows(section.Rows)
+	if err != nil {
+		return nil, err
+	}
+	if section.Numbering != "" && section.Numbering != LEFT_TO_RIGHT && section.Numbering != RIGHT_TO_LEFT {
+		return nil, fmt.Errorf("unknown numbering %q", section.Numbering)
+	}
+	maxSeats := section.Seats
+	for _, row := range rows {
+		if n, ok := section.RowSeats[row]; ok && n > maxSeats {
+			maxSeats = n
+		}
+	}
+	accessible := set(section.Accessible)
+	booked := set(section.Booked)
+	missing := set(section.Missing)
+
+	var seats []Seat
+	for r, row := range rows {
+		n := section.Seats
+		if rowSeats, ok := section.RowSeats[row]; ok {
+			n = rowSeats
+		}
+		zone := section.Zone
+		if rowZone, ok := section.RowZones[row]; ok {
+			zone = rowZone
+		}
+		if _, ok := v.ZonePrice(zone); !ok {
+			return nil, fmt.Errorf("row %s: unknown zone %q", row, zone)
+		}
+		// Shorter rows are centered by starting them further right.
+		indent := float64(maxSeats-n) / 2
+		y := section.Y + float64(r)*(style.Height+style.RowGap)
+		for position := 0; position < n; position++ {
+			number := position + 1
+			if section.Numbering == RIGHT_TO_LEFT {
+				number = n - position
+			}
+			label := row + strconv.Itoa(number)
+			if missing[label] {
+				continue
+			}
+			x := section.X + (indent+float64(position))*(style.Width+style.Gap)
+			for _, after := range section.AislesAfter {
+				if position >= after {
+					x += style.Aisle
+				}
+			}
+			seats = append(seats, Seat{
+				ID:         section.ID + "-" + label,
+				Section:    section.ID,
+				Row:        row,
+				Number:     number,
+				Zone:       zone,
+				X:          round(x),
+				Y:          round(y),
+				Width:      style.Width,
+				Height:     style.Height,
+				Radius:     style.Radius,
+				Accessible: accessible[label],
+				Booked:     booked[label],
+			})
+		}
+	}
+	return seats, nil
+}
+
+// parseRows expands "A-D" to A, B, C, D and splits lists like "AA,BB".
+func parseRows(rows string) ([]string, error) {
+	var labels []string
+	for _, part := range strings.Split(rows, ",") {
+		part = strings.TrimSpace(part)
+		bounds := strings.Split(part, "-")
+		switch {
+		case part == "":
+			continue
+		case len(bounds) == 1:
+			labels = append(labels, part)
+		case len(bounds) == 2 && len(bounds[0]) == 1 && len(bounds[1]) == 1 && bounds[0] <= bounds[1]:
+			for c := bounds[0][0]; c <= bounds[1][0]; c++ {
+				labels = append(labels, string(c))
+			}
+		default:
+			return nil, fmt.Errorf("invalid rows %q", part)
+		}
+	}
+	if len(labels) == 0 {
+		return nil, fmt.Errorf("no rows")
+	}
+	return labels, nil
+}
+
+func set(values []string) map[string]bool {
+	result := make(map[string]bool, len(values))
+	for _, value := range values {
+		result[value] = true
+	}
+	return result
+}
+
+// round rounds to a tenth, which is precise enough for SVG coordinates.
+func round(f float64) float64 {
+	return math.Floor(f*10+0.5) / 10
+}
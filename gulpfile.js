@@ -147,6 +147,7 @@ gulp.task('deploy:prod', callback => {
   return gulp.series('clean',
       'robots:allow',
       'build',
+      'fetch:validator-rules',
       'deploy:site:prod',
       'deploy:api:prod',
       'build:sxg',
@@ -160,6 +161,7 @@ gulp.task('deploy:staging', callback => {
   return gulp.series('clean',
       'robots:disallow',
       'build',
+      'fetch:validator-rules',
       'deploy:site:staging')(callback);
 });
 
@@ -269,6 +271,12 @@ gulp.task('copy:api', () => {
       .pipe(gulp.dest(paths.api.dist));
 });
 
+// The API app renders the same error pages as the main app.
+gulp.task('copy:api-templates', () => {
+  return gulp.src('templates/error.html')
+      .pipe(gulp.dest(paths.api.dir + '/templates'));
+});
+
 function isHtml(file) {
   return file.path.endsWith('.html');
 }
@@ -519,6 +527,10 @@ gulp.task('robots:allow', () => {
       `);
 });
 
+gulp.task('fetch:validator-rules', () => {
+  return run('go run tools/validatorrules/main.go').exec();
+});
+
 gulp.task('build:playground', () => {
   const playgroundDist = '../dist/' + paths.playground;
   return run(
@@ -596,6 +608,7 @@ gulp.task('build', gulp.parallel(
     'copy:json',
     'copy:css',
     'copy:api',
+    'copy:api-templates',
     'copy:fonts',
     'copy:node-modules',
     'copy:license',
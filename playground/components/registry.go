@@ -0,0 +1,152 @@
+/**
+ * Copyright 2018 The AMP HTML Authors. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS-IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package components lists the released versions of the AMP extensions.
+package components
+
+import (
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	extensionPathRegex = regexp.MustCompile(`^extensions/(amp-[^/]+)/([0-9]+(?:\.[0-9]+)+)$`)
+	// Experiment ids in tools/experiments/experiments.js.
+	experimentIdRegex = regexp.MustCompile(`id:\s*['"](amp-[^'"]+)['"]`)
+)
+
+type Component struct {
+	Name string `json:"name"`
+	// All versions, lowest first.
+	Versions []string `json:"versions"`
+	Latest   string   `json:"latest"`
+	// Implementation detail of another component, like the ad network
+	// implementations of amp-ad. Not meant to be used directly.
+	Impl bool `json:"impl"`
+	// Needs an experiment to be enabled.
+	Experimental bool `json:"experimental"`
+}
+
+// Registry holds the components sorted by name.
+type Registry struct {
+	Components []*Component `json:"components"`
+	byName     map[string]*Component
+}
+
+// NewRegistry sorts the components and their versions.
+func NewRegistry(components []*Component) *Registry {
+	r := &Registry{
+		Components: components,
+		byName:     make(map[string]*Component),
+	}
+	sort.Slice(components, func(i, j int) bool {
+		return components[i].Name < components[j].Name
+	})
+	for _, c := range components {
+		sortVersions(c.Versions)
+		if len(c.Versions) > 0 {
+			c.Latest = c.Versions[len(c.Versions)-1]
+		}
+		r.byName[c.Name] = c
+	}
+	return r
+}
+
+// ParseRegistry reads a registry written with json.Marshal.
+func ParseRegistry(data []byte) (*Registry, error) {
+	var r Registry
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+	return NewRegistry(r.Components), nil
+}
+
+// FromPaths builds the registry from the paths of an amphtml checkout. Every
+// extensions/<name>/<version> folder is a version of a component.
+// experiments is the source of tools/experiments/experiments.js, if known.
+func FromPaths(paths []string, experiments string) *Registry {
+	experimental := make(map[string]bool)
+	for _, groups := range experimentIdRegex.FindAllStringSubmatch(experiments, -1) {
+		experimental[groups[1]] = true
+	}
+	byName := make(map[string]*Component)
+	var components []*Component
+	for _, path := range paths {
+		groups := extensionPathRegex.FindStringSubmatch(path)
+		if groups == nil {
+			continue
+		}
+		name, version := groups[1], groups[2]
+		c, ok := byName[name]
+		if !ok {
+			c = &Component{
+				Name:         name,
+				Impl:         strings.HasSuffix(name, "-impl"),
+				Experimental: experimental[name],
+			}
+			byName[name] = c
+			components = append(components, c)
+		}
+		c.Versions = append(c.Versions, version)
+	}
+	return NewRegistry(components)
+}
+
+func (r *Registry) Get(name string) (*Component, bool) {
+	c, ok := r.byName[name]
+	return c, ok
+}
+
+// LatestVersions maps the name of every component to its latest version.
+// Implementation details are included, documents may still need to import
+// them.
+func (r *Registry) LatestVersions() map[string]string {
+	latest := make(map[string]string)
+	for _, c := range r.Components {
+		latest[c.Name] = c.Latest
+	}
+	return latest
+}
+
+// Listed returns the components to offer in a picker, leaving out the
+// implementation details.
+func (r *Registry) Listed() []*Component {
+	var listed []*Component
+	for _, c := range r.Components {
+		if !c.Impl {
+			listed = append(listed, c)
+		}
+	}
+	return listed
+}
+
+// sortVersions orders versions lowest first. Versions that don't parse come
+// first in lexical order.
+func sortVersions(versions []string) {
+	sort.SliceStable(versions, func(i, j int) bool {
+		a, errA := ParseVersion(versions[i])
+		b, errB := ParseVersion(versions[j])
+		switch {
+		case errA != nil && errB != nil:
+			return versions[i] < versions[j]
+		case errA != nil || errB != nil:
+			return errA != nil
+		}
+		return a.Compare(b) < 0
+	})
+}
@@ -0,0 +1,162 @@
+/**
+ * Copyright 2018 The AMP HTML Authors. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS-IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package components
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	GITHUB_TREE_URL        = "https://api.github.com/repos/ampproject/amphtml/git/trees/master?recursive=1"
+	GITHUB_EXPERIMENTS_URL = "https://raw.githubusercontent.com/ampproject/amphtml/master/tools/experiments/experiments.js"
+	EXPERIMENTS_PATH       = "tools/experiments/experiments.js"
+)
+
+// Source loads the registry from somewhere.
+type Source interface {
+	Load() (*Registry, error)
+}
+
+// ParseSource returns the source for spec, which is one of
+//
+//	github        the amphtml repository on GitHub (default)
+//	dir:<path>    a local amphtml checkout
+//	file:<path>   a JSON file in the format served for all components
+//
+// client and token are used for GitHub, token may be empty.
+func ParseSource(spec string, client *http.Client, token string) (Source, error) {
+	switch {
+	case spec == "" || spec == "github":
+		return &GitHubSource{Client: client, Token: token}, nil
+	case strings.HasPrefix(spec, "dir:"):
+		return &DirSource{Dir: strings.TrimPrefix(spec, "dir:")}, nil
+	case strings.HasPrefix(spec, "file:"):
+		return &FileSource{Path: strings.TrimPrefix(spec, "file:")}, nil
+	}
+	return nil, fmt.Errorf("components: unknown source %q", spec)
+}
+
+// GitHubSource lists the extensions folder through the GitHub API. Set Token
+// to avoid the rate limits for unauthenticated requests.
+type GitHubSource struct {
+	Client *http.Client
+	Token  string
+}
+
+type gitHubTree struct {
+	Tree []struct {
+		Path string `json:"path"`
+		Type string `json:"type"`
+	} `json:"tree"`
+	Truncated bool `json:"truncated"`
+}
+
+func (s *GitHubSource) Load() (*Registry, error) {
+	var tree gitHubTree
+	if err := s.getJSON(GITHUB_TREE_URL, &tree); err != nil {
+		return nil, err
+	}
+	if tree.Truncated {
+		return nil, fmt.Errorf("components: GitHub tree truncated")
+	}
+	var paths []string
+	for _, entry := range tree.Tree {
+		if entry.Type == "tree" {
+			paths = append(paths, entry.Path)
+		}
+	}
+	// Without the experiments, components just aren't flagged.
+	experiments, _ := s.get(GITHUB_EXPERIMENTS_URL)
+	return FromPaths(paths, string(experiments)), nil
+}
+
+func (s *GitHubSource) get(url string) ([]byte, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if s.Token != "" {
+		req.Header.Set("Authorization", "token "+s.Token)
+	}
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("components: %s returned %s", url, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+func (s *GitHubSource) getJSON(url string, v interface{}) error {
+	data, err := s.get(url)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// DirSource lists the extensions folder of a local amphtml checkout.
+type DirSource struct {
+	Dir string
+}
+
+func (s *DirSource) Load() (*Registry, error) {
+	extensions, err := ioutil.ReadDir(filepath.Join(s.Dir, "extensions"))
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, extension := range extensions {
+		if !extension.IsDir() {
+			continue
+		}
+		versions, err := ioutil.ReadDir(filepath.Join(s.Dir, "extensions", extension.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, version := range versions {
+			if version.IsDir() {
+				paths = append(paths, "extensions/"+extension.Name()+"/"+version.Name())
+			}
+		}
+	}
+	experiments, err := ioutil.ReadFile(filepath.Join(s.Dir, filepath.FromSlash(EXPERIMENTS_PATH)))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return FromPaths(paths, string(experiments)), nil
+}
+
+// FileSource reads a registry saved as JSON, e.g. for working offline.
+type FileSource struct {
+	Path string
+}
+
+func (s *FileSource) Load() (*Registry, error) {
+	data, err := ioutil.ReadFile(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseRegistry(data)
+}
@@ -0,0 +1,68 @@
+/**
+ * Copyright 2018 The AMP HTML Authors. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS-IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package components
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a dotted component version like 0.1 or 1.0, compared number by
+// number so that 0.10 comes after 0.2.
+type Version []int
+
+func ParseVersion(s string) (Version, error) {
+	fields := strings.Split(s, ".")
+	v := make(Version, len(fields))
+	for i, field := range fields {
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("components: invalid version %q", s)
+		}
+		v[i] = n
+	}
+	return v, nil
+}
+
+// Compare returns -1, 0 or 1 if v is lower than, equal to or higher than
+// other. Missing numbers count as zero, so 1 equals 1.0.
+func (v Version) Compare(other Version) int {
+	for i := 0; i < len(v) || i < len(other); i++ {
+		var a, b int
+		if i < len(v) {
+			a = v[i]
+		}
+		if i < len(other) {
+			b = other[i]
+		}
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+	}
+	return 0
+}
+
+func (v Version) String() string {
+	fields := make([]string, len(v))
+	for i, n := range v {
+		fields[i] = strconv.Itoa(n)
+	}
+	return strings.Join(fields, ".")
+}
@@ -0,0 +1,200 @@
+/**
+ * Copyright 2018 The AMP HTML Authors. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS-IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package playground
+
+import (
+	"backend/config"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/log"
+	"google.golang.org/appengine/memcache"
+	"google.golang.org/appengine/urlfetch"
+)
+
+const (
+	FETCH_MAX_REDIRECTS    = 5
+	FETCH_MEMCACHE_PREFIX  = "playground-fetch:"
+	FETCH_DEFAULT_TYPE     = "application/octet-stream"
+	FETCH_USER_AGENT       = "AMPByExample-Playground/1.0"
+	MEMCACHE_MAX_ITEM_SIZE = 1000000
+)
+
+var errResponseTooLarge = errors.New("response too large")
+
+// fetchedDocument is an upstream response kept in memcache. Only responses
+// with a validator are cached, they are revalidated on every request.
+type fetchedDocument struct {
+	URL          string
+	ETag         string
+	LastModified string
+	ContentType  string
+	Body         []byte
+}
+
+// handleFetch proxies GET requests for documents on the allowed origins so
+// that the playground can load them despite CORS.
+func handleFetch(cfg *config.Config) http.HandlerFunc {
+	origins := make(map[string]bool)
+	for _, origin := range cfg.Playground.FetchOrigins {
+		origins[origin] = true
+	}
+	maxBytes := cfg.Playground.FetchMaxBytes
+	timeout := time.Duration(cfg.Playground.FetchTimeoutSeconds) * time.Second
+	userAgent := fmt.Sprintf("%s (+%s%s/)", FETCH_USER_AGENT, cfg.Host, PLAYGROUND_PATH_PREFIX)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "only GET request supported", http.StatusBadRequest)
+			return
+		}
+		if r.Header.Get("x-requested-by") != "playground" {
+			http.Error(w, "x-requested-by invalid", http.StatusBadRequest)
+			return
+		}
+		param, _ := r.URL.Query()["url"]
+		if len(param) <= 0 {
+			http.Error(w, "No URL provided via 'url' query parameter", http.StatusBadRequest)
+			return
+		}
+		u, err := url.Parse(param[0])
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			http.Error(w, "Invalid URL scheme", http.StatusBadRequest)
+			return
+		}
+		// only allow URLs from trusted domains
+		if !origins[u.Host] {
+			http.Error(w, "Untrusted origin", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(appengine.NewContext(r), timeout)
+		defer cancel()
+		client := urlfetch.Client(ctx)
+		client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			if len(via) >= FETCH_MAX_REDIRECTS {
+				return errors.New("too many redirects")
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" || !origins[req.URL.Host] {
+				return fmt.Errorf("redirect to untrusted origin %s", req.URL.Host)
+			}
+			return nil
+		}
+
+		doc, status, err := fetchDocument(ctx, client, u.String(), userAgent, maxBytes)
+		if err == errResponseTooLarge {
+			http.Error(w, fmt.Sprintf("Response larger than %d bytes", maxBytes), http.StatusBadGateway)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Bad gateway (%v)", err.Error()), http.StatusBadGateway)
+			return
+		}
+
+		// The document is served from our origin, make sure browsers
+		// don't run it.
+		w.Header().Set("Content-Type", doc.ContentType)
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Content-Security-Policy", "default-src 'none'; sandbox")
+		w.WriteHeader(status)
+		w.Write(doc.Body)
+	}
+}
+
+// fetchDocument requests rawurl, revalidating a cached copy if there is one.
+func fetchDocument(ctx context.Context, client *http.Client, rawurl string, userAgent string, maxBytes int64) (*fetchedDocument, int, error) {
+	key := fetchMemcacheKey(rawurl)
+	var cached fetchedDocument
+	if _, err := memcache.Gob.Get(ctx, key, &cached); err != nil {
+		if err != memcache.ErrCacheMiss {
+			log.Warningf(ctx, "Error reading %s from memcache: %v", rawurl, err)
+		}
+		cached = fetchedDocument{}
+	}
+
+	req, err := http.NewRequest("GET", rawurl, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	if cached.ETag != "" {
+		req.Header.Set("If-None-Match", cached.ETag)
+	}
+	if cached.LastModified != "" {
+		req.Header.Set("If-Modified-Since", cached.LastModified)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && cached.URL == rawurl {
+		return &cached, http.StatusOK, nil
+	}
+	if resp.ContentLength > maxBytes {
+		return nil, 0, errResponseTooLarge
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		return nil, 0, err
+	}
+	if int64(len(body)) > maxBytes {
+		return nil, 0, errResponseTooLarge
+	}
+
+	doc := &fetchedDocument{
+		URL:          rawurl,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		ContentType:  resp.Header.Get("Content-Type"),
+		Body:         body,
+	}
+	if doc.ContentType == "" {
+		doc.ContentType = FETCH_DEFAULT_TYPE
+	}
+	if isCacheable(resp) && (doc.ETag != "" || doc.LastModified != "") && len(body) < MEMCACHE_MAX_ITEM_SIZE {
+		item := &memcache.Item{Key: key, Object: doc}
+		if err := memcache.Gob.Set(ctx, item); err != nil {
+			log.Warningf(ctx, "Error adding %s to memcache: %v", rawurl, err)
+		}
+	}
+	return doc, resp.StatusCode, nil
+}
+
+func isCacheable(resp *http.Response) bool {
+	if resp.StatusCode != http.StatusOK {
+		return false
+	}
+	cacheControl := strings.ToLower(resp.Header.Get("Cache-Control"))
+	return !strings.Contains(cacheControl, "no-store") && !strings.Contains(cacheControl, "private")
+}
+
+// Memcache keys are limited to 250 bytes, URLs are not.
+func fetchMemcacheKey(rawurl string) string {
+	sum := sha256.Sum256([]byte(rawurl))
+	return FETCH_MEMCACHE_PREFIX + hex.EncodeToString(sum[:])
+}
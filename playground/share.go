@@ -0,0 +1,188 @@
+/**
+ * Copyright 2018 The AMP HTML Authors. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS-IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package playground
+
+import (
+	"backend/config"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"playground/snippets"
+	"strings"
+	"time"
+
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/log"
+	"google.golang.org/appengine/memcache"
+)
+
+const (
+	SAVE_PATH              = PLAYGROUND_PATH_PREFIX + "/save"
+	SNIPPET_PATH_PREFIX    = PLAYGROUND_PATH_PREFIX + "/s/"
+	SAVE_RATE_LIMIT_PREFIX = "playground-save:"
+	// Parents listed in the response for a snippet.
+	MAX_LINEAGE = 10
+)
+
+type saveRequest struct {
+	Html   string `json:"html"`
+	Parent string `json:"parent"`
+}
+
+type snippetResponse struct {
+	ID      string    `json:"id"`
+	Url     string    `json:"url"`
+	Html    string    `json:"html,omitempty"`
+	Parent  string    `json:"parent,omitempty"`
+	Lineage []string  `json:"lineage,omitempty"`
+	Created time.Time `json:"created"`
+}
+
+func initSnippets(cfg *config.Config) {
+	store := snippets.ParseStore(cfg.Playground.SnippetStore)
+	http.HandleFunc(SAVE_PATH, handleSave(cfg, store))
+	http.HandleFunc(SNIPPET_PATH_PREFIX, handleSnippet(cfg, store))
+}
+
+// handleSave stores the posted document and responds with its ID. Documents
+// are content-addressed, saving the same document again returns the
+// existing snippet.
+func handleSave(cfg *config.Config, store snippets.Store) http.HandlerFunc {
+	maxBytes := cfg.Playground.SnippetMaxBytes
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "only POST request supported", http.StatusBadRequest)
+			return
+		}
+		if r.Header.Get("x-requested-by") != "playground" {
+			http.Error(w, "x-requested-by invalid", http.StatusBadRequest)
+			return
+		}
+		ctx := appengine.NewContext(r)
+		if !allowSave(ctx, r, cfg.Playground.SaveRateLimit) {
+			http.Error(w, "Too many saves, try again in a minute", http.StatusTooManyRequests)
+			return
+		}
+
+		// Leave some room for the JSON around the document.
+		r.Body = http.MaxBytesReader(w, r.Body, maxBytes+1024)
+		var req saveRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		if strings.TrimSpace(req.Html) == "" {
+			http.Error(w, "No document provided", http.StatusBadRequest)
+			return
+		}
+		if int64(len(req.Html)) > maxBytes {
+			http.Error(w, fmt.Sprintf("Document larger than %d bytes", maxBytes), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if req.Parent != "" {
+			if _, err := store.Get(ctx, req.Parent); err != nil {
+				http.Error(w, "Unknown parent", http.StatusBadRequest)
+				return
+			}
+		}
+
+		content := []byte(req.Html)
+		id := snippets.ID(content, req.Parent)
+		snippet, err := store.Get(ctx, id)
+		if err == snippets.ErrNotFound {
+			snippet = &snippets.Snippet{
+				ID:      id,
+				Content: content,
+				Parent:  req.Parent,
+				Created: time.Now(),
+			}
+			err = store.Put(ctx, snippet)
+		}
+		if err != nil {
+			log.Errorf(ctx, "Error saving snippet %s: %v", id, err)
+			http.Error(w, "Error saving document", http.StatusInternalServerError)
+			return
+		}
+		sendSnippet(w, &snippetResponse{
+			ID:      snippet.ID,
+			Url:     cfg.Host + SNIPPET_PATH_PREFIX + snippet.ID,
+			Parent:  snippet.Parent,
+			Created: snippet.Created,
+		})
+	}
+}
+
+// handleSnippet responds with a saved document and the snippets it was
+// forked from.
+func handleSnippet(cfg *config.Config, store snippets.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "only GET request supported", http.StatusBadRequest)
+			return
+		}
+		ctx := appengine.NewContext(r)
+		id := strings.TrimPrefix(r.URL.Path, SNIPPET_PATH_PREFIX)
+		snippet, err := store.Get(ctx, id)
+		if err == snippets.ErrNotFound {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			log.Errorf(ctx, "Error loading snippet %s: %v", id, err)
+			http.Error(w, "Error loading document", http.StatusInternalServerError)
+			return
+		}
+		// Snippets never change.
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		sendSnippet(w, &snippetResponse{
+			ID:      snippet.ID,
+			Url:     cfg.Host + SNIPPET_PATH_PREFIX + snippet.ID,
+			Html:    string(snippet.Content),
+			Parent:  snippet.Parent,
+			Lineage: snippets.Lineage(ctx, store, snippet, MAX_LINEAGE),
+			Created: snippet.Created,
+		})
+	}
+}
+
+func sendSnippet(w http.ResponseWriter, snippet *snippetResponse) {
+	data, err := json.Marshal(snippet)
+	if err != nil {
+		http.Error(w, "Error encoding document", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-type", "application/json")
+	w.Write(data)
+}
+
+// allowSave counts the saves per client IP in the current minute. Saves are
+// allowed if memcache isn't available.
+func allowSave(ctx context.Context, r *http.Request, limit int) bool {
+	minute := time.Now().Unix() / 60
+	key := fmt.Sprintf("%s%s:%d", SAVE_RATE_LIMIT_PREFIX, r.RemoteAddr, minute)
+	item := &memcache.Item{Key: key, Value: []byte("0"), Expiration: time.Minute}
+	if err := memcache.Add(ctx, item); err != nil && err != memcache.ErrNotStored {
+		log.Warningf(ctx, "Error adding %s to memcache: %v", key, err)
+		return true
+	}
+	count, err := memcache.Increment(ctx, key, 1, 0)
+	if err != nil {
+		log.Warningf(ctx, "Error incrementing %s in memcache: %v", key, err)
+		return true
+	}
+	return count <= uint64(limit)
+}
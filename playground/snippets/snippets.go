@@ -0,0 +1,115 @@
+/**
+ * Copyright 2018 The AMP HTML Authors. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS-IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package snippets stores documents saved in the playground under an ID
+// derived from their content and parent.
+package snippets
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"google.golang.org/appengine"
+)
+
+const (
+	// Bytes of the content hash used for the ID, encoded as 11 characters.
+	ID_BYTES = 8
+	// Local directory used during development.
+	DEFAULT_LOCAL_DIR = "playground-snippets"
+)
+
+var (
+	ErrNotFound = errors.New("snippets: not found")
+	idRegex     = regexp.MustCompile(`^[A-Za-z0-9_-]{11}$`)
+)
+
+type Snippet struct {
+	ID      string
+	Content []byte
+	// ID of the snippet this one was forked from, if any.
+	Parent  string
+	Created time.Time
+}
+
+// Store keeps snippets by ID.
+type Store interface {
+	Get(ctx context.Context, id string) (*Snippet, error)
+	Put(ctx context.Context, snippet *Snippet) error
+}
+
+// ID returns the content-addressed ID of content forked from parent, which
+// is empty for new documents. Saving the same document twice results in the
+// same ID, but forks of different snippets get their own IDs so that each
+// keeps its lineage.
+func ID(content []byte, parent string) string {
+	// Parent IDs never contain a NUL, so the hashed message is unambiguous.
+	h := sha256.New()
+	h.Write([]byte(parent))
+	h.Write([]byte{0})
+	h.Write(content)
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil)[:ID_BYTES])
+}
+
+// ValidID reports whether id looks like an ID returned by ID.
+func ValidID(id string) bool {
+	return idRegex.MatchString(id)
+}
+
+// ParseStore returns the store for spec, which is "disk:<dir>" or
+// "datastore". An empty spec means datastore in production and
+// DEFAULT_LOCAL_DIR on the development server.
+func ParseStore(spec string) Store {
+	kind, arg := spec, ""
+	if i := strings.Index(spec, ":"); i >= 0 {
+		kind, arg = spec[:i], spec[i+1:]
+	}
+	switch kind {
+	case "disk":
+		if arg == "" {
+			arg = DEFAULT_LOCAL_DIR
+		}
+		return &DiskStore{Dir: arg}
+	case "datastore":
+		return &DatastoreStore{}
+	}
+	if appengine.IsDevAppServer() {
+		return &DiskStore{Dir: DEFAULT_LOCAL_DIR}
+	}
+	return &DatastoreStore{}
+}
+
+// Lineage returns the IDs of the snippets id was forked from, most recent
+// first, following at most max parents.
+func Lineage(ctx context.Context, store Store, snippet *Snippet, max int) []string {
+	var lineage []string
+	seen := map[string]bool{snippet.ID: true}
+	for parent := snippet.Parent; parent != "" && len(lineage) < max && !seen[parent]; {
+		seen[parent] = true
+		lineage = append(lineage, parent)
+		s, err := store.Get(ctx, parent)
+		if err != nil {
+			break
+		}
+		parent = s.Parent
+	}
+	return lineage
+}
@@ -0,0 +1,93 @@
+/**
+ * Copyright 2018 The AMP HTML Authors. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS-IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package snippets
+
+import (
+	"context"
+	"testing"
+)
+
+type mapStore map[string]*Snippet
+
+func (s mapStore) Get(ctx context.Context, id string) (*Snippet, error) {
+	if snippet, ok := s[id]; ok {
+		return snippet, nil
+	}
+	return nil, ErrNotFound
+}
+
+func (s mapStore) Put(ctx context.Context, snippet *Snippet) error {
+	s[snippet.ID] = snippet
+	return nil
+}
+
+func TestID(t *testing.T) {
+	doc := []byte("<!doctype html><html amp></html>")
+	root := ID(doc, "")
+	if !ValidID(root) {
+		t.Errorf("ID(doc, \"\") = %q isn't valid", root)
+	}
+	if ID(doc, "") != root {
+		t.Error("ID isn't stable")
+	}
+	forkA, forkB := ID(doc, "aaaaaaaaaaa"), ID(doc, "bbbbbbbbbbb")
+	if forkA == root || forkB == root || forkA == forkB {
+		t.Errorf("forks share IDs: root %q, forks %q and %q", root, forkA, forkB)
+	}
+	if ID([]byte("x"), "") == ID([]byte("y"), "") {
+		t.Error("different documents share an ID")
+	}
+}
+
+func TestLineage(t *testing.T) {
+	store := mapStore{}
+	save := func(content, parent string) *Snippet {
+		s := &Snippet{ID: ID([]byte(content), parent), Content: []byte(content), Parent: parent}
+		store.Put(context.Background(), s)
+		return s
+	}
+	root := save("doc", "")
+	a := save("doc", root.ID)
+	b := save("doc", a.ID)
+	// Saving unchanged forks of different snippets keeps both lineages.
+	other := save("other", "")
+	c := save("doc", other.ID)
+
+	tests := []struct {
+		snippet *Snippet
+		max     int
+		want    []string
+	}{
+		{root, 5, nil},
+		{b, 5, []string{a.ID, root.ID}},
+		{b, 1, []string{a.ID}},
+		{c, 5, []string{other.ID}},
+	}
+	for _, test := range tests {
+		got := Lineage(context.Background(), store, test.snippet, test.max)
+		if len(got) != len(test.want) {
+			t.Errorf("Lineage(%s, %d) = %v, want %v", test.snippet.ID, test.max, got, test.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("Lineage(%s, %d) = %v, want %v", test.snippet.ID, test.max, got, test.want)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,116 @@
+/**
+ * Copyright 2018 The AMP HTML Authors. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS-IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package snippets
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"google.golang.org/appengine/datastore"
+)
+
+const (
+	SNIPPET_KIND = "PlaygroundSnippet"
+)
+
+// DiskStore keeps each snippet as a JSON file in Dir.
+type DiskStore struct {
+	Dir string
+}
+
+func (s *DiskStore) Get(ctx context.Context, id string) (*Snippet, error) {
+	if !ValidID(id) {
+		return nil, ErrNotFound
+	}
+	data, err := ioutil.ReadFile(filepath.Join(s.Dir, id+".json"))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	var snippet Snippet
+	if err := json.Unmarshal(data, &snippet); err != nil {
+		return nil, err
+	}
+	return &snippet, nil
+}
+
+func (s *DiskStore) Put(ctx context.Context, snippet *Snippet) error {
+	data, err := json.Marshal(snippet)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return err
+	}
+	// Write to a temporary file first, so readers never see half a snippet.
+	tmp, err := ioutil.TempFile(s.Dir, snippet.ID)
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(s.Dir, snippet.ID+".json"))
+}
+
+// DatastoreStore keeps snippets in datastore, keyed by ID.
+type DatastoreStore struct{}
+
+type snippetEntity struct {
+	Content []byte `datastore:",noindex"`
+	Parent  string
+	Created time.Time
+}
+
+func (s *DatastoreStore) Get(ctx context.Context, id string) (*Snippet, error) {
+	if !ValidID(id) {
+		return nil, ErrNotFound
+	}
+	var entity snippetEntity
+	err := datastore.Get(ctx, datastore.NewKey(ctx, SNIPPET_KIND, id, 0, nil), &entity)
+	if err == datastore.ErrNoSuchEntity {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &Snippet{
+		ID:      id,
+		Content: entity.Content,
+		Parent:  entity.Parent,
+		Created: entity.Created,
+	}, nil
+}
+
+func (s *DatastoreStore) Put(ctx context.Context, snippet *Snippet) error {
+	entity := &snippetEntity{
+		Content: snippet.Content,
+		Parent:  snippet.Parent,
+		Created: snippet.Created,
+	}
+	_, err := datastore.Put(ctx, datastore.NewKey(ctx, SNIPPET_KIND, snippet.ID, 0, nil), entity)
+	return err
+}
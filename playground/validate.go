@@ -0,0 +1,86 @@
+/**
+ * Copyright 2018 The AMP HTML Authors. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS-IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package playground
+
+import (
+	"backend/config"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"playground/validator"
+	"strings"
+)
+
+const (
+	VALIDATE_PATH      = PLAYGROUND_PATH_PREFIX + "/validate"
+	VALIDATE_MAX_BYTES = 2 << 20 // 2 MB
+)
+
+func initValidator(cfg *config.Config) {
+	rules, err := validator.Load(cfg.Playground.ValidatorRules...)
+	if err != nil {
+		// The rules are copied by tools/validatorrules, the rest of the
+		// playground works without them.
+		log.Printf("Validator disabled: %v", err)
+		http.HandleFunc(VALIDATE_PATH, func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "Validator rules not loaded", http.StatusServiceUnavailable)
+		})
+		return
+	}
+	http.HandleFunc(VALIDATE_PATH, handleValidate(rules))
+}
+
+// handleValidate validates the posted document, e.g.
+//
+//	curl --data-binary @page.html https://ampbyexample.com/playground/validate?format=AMP4EMAIL
+//
+// The format is detected from the document if it isn't set.
+func handleValidate(rules *validator.Rules) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "only POST request supported", http.StatusBadRequest)
+			return
+		}
+		format := strings.ToUpper(r.URL.Query().Get("format"))
+		if format != "" && !isFormat(format) {
+			http.Error(w, fmt.Sprintf("Unknown format, use one of %s", strings.Join(validator.Formats, ", ")), http.StatusBadRequest)
+			return
+		}
+		doc, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, VALIDATE_MAX_BYTES))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Document larger than %d bytes", VALIDATE_MAX_BYTES), http.StatusRequestEntityTooLarge)
+			return
+		}
+		data, err := json.Marshal(rules.Validate(doc, format))
+		if err != nil {
+			http.Error(w, "Error encoding result", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-type", "application/json")
+		w.Write(data)
+	}
+}
+
+func isFormat(format string) bool {
+	for _, f := range validator.Formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,211 @@
+/**
+ * Copyright 2018 The AMP HTML Authors. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS-IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package validator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// repeatedFields are the protoascii fields read into slices. All other
+// fields keep their last value.
+var repeatedFields = map[string]bool{
+	"tags":                true,
+	"attrs":               true,
+	"attr_lists":          true,
+	"html_format":         true,
+	"value":               true,
+	"value_casei":         true,
+	"alternative_names":   true,
+	"disallowed_ancestor": true,
+}
+
+// protoasciiToJSON converts the protocol buffer text format used by the AMP
+// validator rules (validator-main.protoascii) to JSON with the same field
+// names, so it can be read like the JSON rules.
+func protoasciiToJSON(data []byte) ([]byte, error) {
+	p := &textParser{s: string(data), line: 1}
+	message, err := p.parseFields(false)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(message)
+}
+
+type textParser struct {
+	s    string
+	pos  int
+	line int
+}
+
+func (p *textParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("validator: protoascii line %d: %s", p.line, fmt.Sprintf(format, args...))
+}
+
+// skipSpace skips white space and # comments.
+func (p *textParser) skipSpace() {
+	for p.pos < len(p.s) {
+		switch c := p.s[p.pos]; {
+		case c == '\n':
+			p.line++
+			p.pos++
+		case c == ' ' || c == '\t' || c == '\r':
+			p.pos++
+		case c == '#':
+			for p.pos < len(p.s) && p.s[p.pos] != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (p *textParser) peek() byte {
+	p.skipSpace()
+	if p.pos >= len(p.s) {
+		return 0
+	}
+	return p.s[p.pos]
+}
+
+func (p *textParser) identifier() string {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.s) {
+		c := rune(p.s[p.pos])
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) && c != '_' && c != '.' && c != '-' && c != '+' {
+			break
+		}
+		p.pos++
+	}
+	return p.s[start:p.pos]
+}
+
+// parseFields reads "name: value" and "name { ... }" pairs until the end of
+// input, or until the closing brace if nested.
+func (p *textParser) parseFields(nested bool) (map[string]interface{}, error) {
+	message := make(map[string]interface{})
+	for {
+		c := p.peek()
+		if c == 0 {
+			if nested {
+				return nil, p.errorf("unexpected end of input")
+			}
+			return message, nil
+		}
+		if c == '}' || c == '>' {
+			if !nested {
+				return nil, p.errorf("unexpected %q", c)
+			}
+			p.pos++
+			return message, nil
+		}
+
+		name := p.identifier()
+		if name == "" {
+			return nil, p.errorf("expected field name, got %q", c)
+		}
+		if p.peek() == ':' {
+			p.pos++
+		}
+		var value interface{}
+		var err error
+		if c := p.peek(); c == '{' || c == '<' {
+			p.pos++
+			value, err = p.parseFields(true)
+		} else {
+			value, err = p.parseScalar()
+		}
+		if err != nil {
+			return nil, err
+		}
+		if repeatedFields[name] {
+			values, _ := message[name].([]interface{})
+			message[name] = append(values, value)
+		} else {
+			message[name] = value
+		}
+		// Fields may be separated by commas or semicolons.
+		if c := p.peek(); c == ',' || c == ';' {
+			p.pos++
+		}
+	}
+}
+
+// parseScalar reads a string, number or enum value. Adjacent strings are
+// concatenated.
+func (p *textParser) parseScalar() (interface{}, error) {
+	c := p.peek()
+	if c == '"' || c == '\'' {
+		var s bytes.Buffer
+		for c := p.peek(); c == '"' || c == '\''; c = p.peek() {
+			part, err := p.parseString(c)
+			if err != nil {
+				return nil, err
+			}
+			s.WriteString(part)
+		}
+		return s.String(), nil
+	}
+	token := p.identifier()
+	switch token {
+	case "":
+		return nil, p.errorf("expected value, got %q", c)
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	if n, err := strconv.ParseFloat(token, 64); err == nil {
+		return n, nil
+	}
+	// Enum values like AMP4EMAIL.
+	return token, nil
+}
+
+func (p *textParser) parseString(quote byte) (string, error) {
+	start := p.pos
+	p.pos++
+	for p.pos < len(p.s) {
+		switch p.s[p.pos] {
+		case '\\':
+			p.pos += 2
+			continue
+		case '\n':
+			return "", p.errorf("unterminated string")
+		case quote:
+			p.pos++
+			// Go doesn't allow \' in double quoted strings.
+			inner := strings.Replace(p.s[start+1:p.pos-1], `\'`, `'`, -1)
+			if quote == '\'' {
+				inner = strings.Replace(inner, `"`, `\"`, -1)
+			}
+			raw := `"` + inner + `"`
+			s, err := strconv.Unquote(raw)
+			if err != nil {
+				return "", p.errorf("invalid string %s", raw)
+			}
+			return s, nil
+		}
+		p.pos++
+	}
+	return "", p.errorf("unterminated string")
+}
@@ -0,0 +1,103 @@
+/**
+ * Copyright 2018 The AMP HTML Authors. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS-IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package validator
+
+import (
+	"testing"
+)
+
+func TestProtoasciiToJSON(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{`name: "a"`, `{"name":"a"}`},
+		{"name: \"a\" # comment\n", `{"name":"a"}`},
+		{`name: "a" "b" 'c'`, `{"name":"abc"}`},
+		{`name: 'it\'s "quoted"'`, `{"name":"it's \"quoted\""}`},
+		{`name: "tab\tnewline\n"`, `{"name":"tab\tnewline\n"}`},
+		{`mandatory: true unique: false`, `{"mandatory":true,"unique":false}`},
+		{`min_bytes: 42`, `{"min_bytes":42}`},
+		{`html_format: AMP4EMAIL`, `{"html_format":["AMP4EMAIL"]}`},
+		{`name: "a" name: "b"`, `{"name":"b"}`},
+		{`value: "a" value: "b"`, `{"value":["a","b"]}`},
+		{`value_casei: "a", value_casei: "b"`, `{"value_casei":["a","b"]}`},
+		{`attrs { name: "a"; mandatory: true }`, `{"attrs":[{"mandatory":true,"name":"a"}]}`},
+		{`attrs: < name: "a" > attrs: { name: "b" }`, `{"attrs":[{"name":"a"},{"name":"b"}]}`},
+		{`tags: { attrs: { name: "a" } }`, `{"tags":[{"attrs":[{"name":"a"}]}]}`},
+		{"", `{}`},
+	}
+	for _, test := range tests {
+		got, err := protoasciiToJSON([]byte(test.input))
+		if err != nil {
+			t.Errorf("protoasciiToJSON(%q) failed: %v", test.input, err)
+			continue
+		}
+		if string(got) != test.want {
+			t.Errorf("protoasciiToJSON(%q) = %s, want %s", test.input, got, test.want)
+		}
+	}
+}
+
+func TestProtoasciiToJSONErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		err   string
+	}{
+		{`name: "a`, "validator: protoascii line 1: unterminated string"},
+		{"name: \"a\nb\"", "validator: protoascii line 1: unterminated string"},
+		{"tags {\n  name: \"a\"\n", "validator: protoascii line 3: unexpected end of input"},
+		{"name: \"a\"\n}", "validator: protoascii line 2: unexpected '}'"},
+		{"name:", "validator: protoascii line 1: expected value, got '\\x00'"},
+		{": \"a\"", "validator: protoascii line 1: expected field name, got ':'"},
+		{`name: "\q"`, `validator: protoascii line 1: invalid string "\q"`},
+	}
+	for _, test := range tests {
+		_, err := protoasciiToJSON([]byte(test.input))
+		if err == nil || err.Error() != test.err {
+			t.Errorf("protoasciiToJSON(%q) error = %v, want %s", test.input, err, test.err)
+		}
+	}
+}
+
+func TestLoadProtoascii(t *testing.T) {
+	rules, err := Load("testdata/*.protoascii")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules.Tags) != 11 || len(rules.AttrLists) != 2 {
+		t.Errorf("loaded %d tags and %d attr lists, want 11 and 2", len(rules.Tags), len(rules.AttrLists))
+	}
+	script := rules.specs("script", FORMAT_AMP)
+	if len(script) != 1 {
+		t.Fatalf("%d script specs, want 1", len(script))
+	}
+	if want := "https://amp.dev/documentation/guides-and-tutorials/learn/spec/amphtml#required-markup"; script[0].SpecUrl != want {
+		t.Errorf("spec_url = %q, want %q", script[0].SpecUrl, want)
+	}
+	layout := rules.attrLists["extended-amp-global"].Attrs[1]
+	if want := []string{"fill", "fixed", "responsive"}; len(layout.ValueCasei) != len(want) ||
+		layout.ValueCasei[0] != want[0] || layout.ValueCasei[1] != want[1] || layout.ValueCasei[2] != want[2] {
+		t.Errorf("layout value_casei = %q, want %q", layout.ValueCasei, want)
+	}
+	if email := rules.specs("html", FORMAT_AMP4EMAIL); len(email) != 1 || email[0].name() != "html ⚡4email" {
+		t.Errorf("AMP4EMAIL html specs = %v", email)
+	}
+	if _, err := Load("testdata/missing-*.protoascii"); err == nil {
+		t.Error("Load succeeded without rules")
+	}
+}
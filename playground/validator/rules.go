@@ -0,0 +1,291 @@
+/**
+ * Copyright 2018 The AMP HTML Authors. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS-IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package validator checks AMP documents against the tag and attribute
+// rules of the AMP validator. Rules are read from validator.protoascii files
+// or from JSON files with the same field names.
+//
+// Only the structural rules are checked: which tags and attributes are
+// allowed, mandatory and unique tags and attributes, attribute values,
+// parents and ancestors. CSS, text content, URLs and layouts are not.
+package validator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	FORMAT_AMP       = "AMP"
+	FORMAT_AMP4ADS   = "AMP4ADS"
+	FORMAT_AMP4EMAIL = "AMP4EMAIL"
+	// Stories are AMP documents, tag specs can be limited to them with
+	// html_format: STORIES.
+	FORMAT_STORIES = "STORIES"
+
+	// Attributes allowed on all tags.
+	GLOBAL_ATTRS = "$GLOBAL_ATTRS"
+)
+
+var Formats = []string{FORMAT_AMP, FORMAT_AMP4ADS, FORMAT_AMP4EMAIL, FORMAT_STORIES}
+
+type Rules struct {
+	Tags      []*TagSpec  `json:"tags"`
+	AttrLists []*AttrList `json:"attr_lists"`
+
+	// Tag specs by lower case tag name.
+	byTag     map[string][]*TagSpec
+	attrLists map[string]*AttrList
+}
+
+type TagSpec struct {
+	TagName            string      `json:"tag_name"`
+	SpecName           string      `json:"spec_name"`
+	HtmlFormat         []string    `json:"html_format"`
+	Mandatory          bool        `json:"mandatory"`
+	MandatoryParent    string      `json:"mandatory_parent"`
+	MandatoryAncestor  string      `json:"mandatory_ancestor"`
+	DisallowedAncestor []string    `json:"disallowed_ancestor"`
+	Unique             bool        `json:"unique"`
+	Attrs              []*AttrSpec `json:"attrs"`
+	AttrLists          []string    `json:"attr_lists"`
+	SpecUrl            string      `json:"spec_url"`
+	Deprecation        string      `json:"deprecation"`
+}
+
+type AttrSpec struct {
+	Name                 string   `json:"name"`
+	AlternativeNames     []string `json:"alternative_names"`
+	Mandatory            bool     `json:"mandatory"`
+	Value                []string `json:"value"`
+	ValueCasei           []string `json:"value_casei"`
+	ValueRegex           string   `json:"value_regex"`
+	ValueRegexCasei      string   `json:"value_regex_casei"`
+	DisallowedValueRegex string   `json:"disallowed_value_regex"`
+	Deprecation          string   `json:"deprecation"`
+
+	valueRegex           *regexp.Regexp
+	disallowedValueRegex *regexp.Regexp
+}
+
+type AttrList struct {
+	Name  string      `json:"name"`
+	Attrs []*AttrSpec `json:"attrs"`
+}
+
+// Load reads and merges the rules files matching the given glob patterns.
+// Files ending in .json are read as JSON, all others as protoascii.
+func Load(patterns ...string) (*Rules, error) {
+	rules := &Rules{}
+	for _, pattern := range patterns {
+		paths, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(paths) == 0 {
+			return nil, fmt.Errorf("validator: no rules match %s", pattern)
+		}
+		for _, path := range paths {
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			if !strings.HasSuffix(path, ".json") {
+				if data, err = protoasciiToJSON(data); err != nil {
+					return nil, fmt.Errorf("%s: %v", path, err)
+				}
+			}
+			var file Rules
+			if err := json.Unmarshal(data, &file); err != nil {
+				return nil, fmt.Errorf("%s: %v", path, err)
+			}
+			rules.Tags = append(rules.Tags, file.Tags...)
+			rules.AttrLists = append(rules.AttrLists, file.AttrLists...)
+		}
+	}
+	if err := rules.init(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// init indexes the tag specs and compiles the attribute regular expressions.
+func (r *Rules) init() error {
+	r.byTag = make(map[string][]*TagSpec)
+	r.attrLists = make(map[string]*AttrList)
+	for _, list := range r.AttrLists {
+		r.attrLists[list.Name] = list
+		if err := compileAttrs(list.Attrs); err != nil {
+			return err
+		}
+	}
+	for _, spec := range r.Tags {
+		// Pseudo tags like $REFERENCE_POINT aren't elements.
+		if strings.HasPrefix(spec.TagName, "$") {
+			continue
+		}
+		if len(spec.HtmlFormat) == 0 {
+			spec.HtmlFormat = []string{FORMAT_AMP}
+		}
+		name := strings.ToLower(spec.TagName)
+		r.byTag[name] = append(r.byTag[name], spec)
+		if err := compileAttrs(spec.Attrs); err != nil {
+			return err
+		}
+		for _, list := range spec.AttrLists {
+			if r.attrLists[list] == nil {
+				return fmt.Errorf("validator: %s uses unknown attr list %s", spec.name(), list)
+			}
+		}
+	}
+	return nil
+}
+
+func compileAttrs(attrs []*AttrSpec) error {
+	for _, attr := range attrs {
+		var err error
+		switch {
+		case attr.ValueRegex != "":
+			attr.valueRegex, err = regexp.Compile("^(?:" + attr.ValueRegex + ")$")
+		case attr.ValueRegexCasei != "":
+			attr.valueRegex, err = regexp.Compile("^(?i:" + attr.ValueRegexCasei + ")$")
+		}
+		if err != nil {
+			return fmt.Errorf("validator: attribute %s: %v", attr.Name, err)
+		}
+		if attr.DisallowedValueRegex != "" {
+			attr.disallowedValueRegex, err = regexp.Compile("(?i)" + attr.DisallowedValueRegex)
+			if err != nil {
+				return fmt.Errorf("validator: attribute %s: %v", attr.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// specs returns the tag specs for a lower case tag name in format.
+func (r *Rules) specs(tag string, format string) []*TagSpec {
+	var specs []*TagSpec
+	for _, spec := range r.byTag[tag] {
+		if spec.hasFormat(format) {
+			specs = append(specs, spec)
+		}
+	}
+	return specs
+}
+
+// hasFormat reports whether the spec applies to format. Stories get the AMP
+// specs as well as their own.
+func (s *TagSpec) hasFormat(format string) bool {
+	for _, f := range s.HtmlFormat {
+		if f == format || (format == FORMAT_STORIES && f == FORMAT_AMP) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *TagSpec) name() string {
+	if s.SpecName != "" {
+		return s.SpecName
+	}
+	return strings.ToLower(s.TagName)
+}
+
+// attr returns the spec for a lower case attribute name, looking at the
+// attr lists of the tag and the global attributes too.
+func (r *Rules) attr(spec *TagSpec, name string) *AttrSpec {
+	if attr := findAttr(spec.Attrs, name); attr != nil {
+		return attr
+	}
+	for _, list := range spec.AttrLists {
+		if attr := findAttr(r.attrLists[list].Attrs, name); attr != nil {
+			return attr
+		}
+	}
+	if global := r.attrLists[GLOBAL_ATTRS]; global != nil {
+		return findAttr(global.Attrs, name)
+	}
+	return nil
+}
+
+// mandatoryAttrs returns the mandatory attributes of the spec including
+// those of its attr lists.
+func (r *Rules) mandatoryAttrs(spec *TagSpec) []*AttrSpec {
+	var mandatory []*AttrSpec
+	all := spec.Attrs
+	for _, list := range spec.AttrLists {
+		all = append(all[:len(all):len(all)], r.attrLists[list].Attrs...)
+	}
+	for _, attr := range all {
+		if attr.Mandatory {
+			mandatory = append(mandatory, attr)
+		}
+	}
+	return mandatory
+}
+
+func findAttr(attrs []*AttrSpec, name string) *AttrSpec {
+	for _, attr := range attrs {
+		if attr.matches(name) {
+			return attr
+		}
+	}
+	return nil
+}
+
+func (a *AttrSpec) matches(name string) bool {
+	if strings.ToLower(a.Name) == name {
+		return true
+	}
+	for _, alternative := range a.AlternativeNames {
+		if strings.ToLower(alternative) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// validValue reports whether value is allowed for the attribute.
+func (a *AttrSpec) validValue(value string) bool {
+	if a.disallowedValueRegex != nil && a.disallowedValueRegex.MatchString(value) {
+		return false
+	}
+	if len(a.Value) > 0 {
+		for _, allowed := range a.Value {
+			if value == allowed {
+				return true
+			}
+		}
+		return false
+	}
+	if len(a.ValueCasei) > 0 {
+		for _, allowed := range a.ValueCasei {
+			if strings.EqualFold(value, allowed) {
+				return true
+			}
+		}
+		return false
+	}
+	if a.valueRegex != nil {
+		return a.valueRegex.MatchString(value)
+	}
+	return true
+}
@@ -0,0 +1,327 @@
+/**
+ * Copyright 2018 The AMP HTML Authors. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS-IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package validator
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	STATUS_PASS = "PASS"
+	STATUS_FAIL = "FAIL"
+
+	SEVERITY_ERROR   = "ERROR"
+	SEVERITY_WARNING = "WARNING"
+)
+
+var (
+	// <html ⚡4email>, <html amp4ads>, ...
+	htmlFormatAttrs = map[string]string{
+		"⚡":         FORMAT_AMP,
+		"amp":       FORMAT_AMP,
+		"⚡4ads":     FORMAT_AMP4ADS,
+		"amp4ads":   FORMAT_AMP4ADS,
+		"⚡4email":   FORMAT_AMP4EMAIL,
+		"amp4email": FORMAT_AMP4EMAIL,
+	}
+	ampStoryRegex = regexp.MustCompile(`(?i)<amp-story[\s>]`)
+
+	voidElements = map[string]bool{
+		"area": true, "base": true, "br": true, "col": true, "embed": true,
+		"hr": true, "img": true, "input": true, "link": true, "meta": true,
+		"param": true, "source": true, "track": true, "wbr": true,
+	}
+)
+
+// Error is a single validation error. Lines start at 1, columns at 0 like
+// in the JS validator.
+type Error struct {
+	Line     int    `json:"line"`
+	Col      int    `json:"col"`
+	Code     string `json:"code"`
+	Message  string `json:"message"`
+	Severity string `json:"severity"`
+	SpecUrl  string `json:"specUrl,omitempty"`
+}
+
+type Result struct {
+	Status string  `json:"status"`
+	Format string  `json:"format"`
+	Errors []Error `json:"errors"`
+}
+
+// DetectFormat returns the format declared on the <html> tag, or
+// FORMAT_STORIES for AMP documents containing an <amp-story>.
+func DetectFormat(doc []byte) string {
+	z := html.NewTokenizer(bytes.NewReader(doc))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			return FORMAT_AMP
+		}
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			continue
+		}
+		token := z.Token()
+		if token.Data != "html" {
+			return FORMAT_AMP
+		}
+		for _, attr := range token.Attr {
+			if format, ok := htmlFormatAttrs[attr.Key]; ok {
+				if format == FORMAT_AMP && ampStoryRegex.Match(doc) {
+					return FORMAT_STORIES
+				}
+				return format
+			}
+		}
+		return FORMAT_AMP
+	}
+}
+
+// element is an open tag.
+type element struct {
+	name string
+}
+
+type validation struct {
+	rules  *Rules
+	format string
+	result *Result
+	stack  []element
+	// Number of tags matching each spec.
+	seen      map[*TagSpec]int
+	line, col int
+}
+
+// Validate checks doc against the rules for format. An empty format is
+// detected from the document.
+func (r *Rules) Validate(doc []byte, format string) *Result {
+	if format == "" {
+		format = DetectFormat(doc)
+	}
+	v := &validation{
+		rules:  r,
+		format: format,
+		result: &Result{Format: format, Errors: []Error{}},
+		seen:   make(map[*TagSpec]int),
+		line:   1,
+	}
+	if err := v.tokenize(doc); err != nil {
+		v.addError(v.line, v.col, "", "PARSE_ERROR", "%v", err)
+	}
+	v.checkMandatoryTags()
+	v.result.Status = STATUS_PASS
+	for _, err := range v.result.Errors {
+		if err.Severity == SEVERITY_ERROR {
+			v.result.Status = STATUS_FAIL
+		}
+	}
+	return v.result
+}
+
+func (v *validation) tokenize(doc []byte) error {
+	z := html.NewTokenizer(bytes.NewReader(doc))
+	for {
+		tt := z.Next()
+		// The tokenizer treats <noscript> like <script>, but AMP uses it
+		// for markup that needs to be validated too.
+		if tt == html.TextToken && len(v.stack) > 0 && v.stack[len(v.stack)-1].name == "noscript" {
+			text := append([]byte(nil), z.Raw()...)
+			if err := v.tokenize(text); err != nil {
+				return err
+			}
+			continue
+		}
+		line, col := v.line, v.col
+		v.advance(z.Raw())
+		switch tt {
+		case html.ErrorToken:
+			if z.Err() != io.EOF {
+				return z.Err()
+			}
+			return nil
+		case html.DoctypeToken:
+			for _, spec := range v.rules.specs("!doctype", v.format) {
+				v.seen[spec]++
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := z.Token()
+			v.checkTag(line, col, token)
+			if tt == html.StartTagToken && !voidElements[token.Data] {
+				v.stack = append(v.stack, element{token.Data})
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			v.closeTag(string(name))
+		}
+	}
+}
+
+// advance moves the position past raw, counting characters, not bytes.
+func (v *validation) advance(raw []byte) {
+	for _, b := range raw {
+		if b == '\n' {
+			v.line++
+			v.col = 0
+		} else if b&0xc0 != 0x80 {
+			v.col++
+		}
+	}
+}
+
+func (v *validation) closeTag(name string) {
+	for i := len(v.stack) - 1; i >= 0; i-- {
+		if v.stack[i].name == name {
+			v.stack = v.stack[:i]
+			return
+		}
+	}
+}
+
+func (v *validation) addError(line int, col int, specUrl string, code string, format string, args ...interface{}) {
+	v.result.Errors = append(v.result.Errors, Error{
+		Line:     line,
+		Col:      col,
+		Code:     code,
+		Message:  fmt.Sprintf(format, args...),
+		Severity: SEVERITY_ERROR,
+		SpecUrl:  specUrl,
+	})
+}
+
+func (v *validation) addWarning(line int, col int, specUrl string, code string, format string, args ...interface{}) {
+	v.addError(line, col, specUrl, code, format, args...)
+	v.result.Errors[len(v.result.Errors)-1].Severity = SEVERITY_WARNING
+}
+
+// checkTag validates the tag against the spec it fits best, which is the
+// first one without errors or the one with the fewest.
+func (v *validation) checkTag(line int, col int, token html.Token) {
+	specs := v.rules.specs(token.Data, v.format)
+	if len(specs) == 0 {
+		v.addError(line, col, "", "DISALLOWED_TAG", "The tag '%s' is disallowed.", token.Data)
+		return
+	}
+	var best *TagSpec
+	var bestErrors []Error
+	for _, spec := range specs {
+		check := &validation{rules: v.rules, format: v.format, result: &Result{}, stack: v.stack}
+		check.checkSpec(line, col, spec, token)
+		if best == nil || errorCount(check.result.Errors) < errorCount(bestErrors) {
+			best, bestErrors = spec, check.result.Errors
+		}
+		if errorCount(bestErrors) == 0 {
+			break
+		}
+	}
+	v.result.Errors = append(v.result.Errors, bestErrors...)
+	v.seen[best]++
+	if best.Unique && v.seen[best] == 2 {
+		v.addError(line, col, best.SpecUrl, "DUPLICATE_UNIQUE_TAG", "The tag '%s' appears more than once in the document.", best.name())
+	}
+}
+
+func errorCount(errors []Error) int {
+	n := 0
+	for _, err := range errors {
+		if err.Severity == SEVERITY_ERROR {
+			n++
+		}
+	}
+	return n
+}
+
+func (v *validation) checkSpec(line int, col int, spec *TagSpec, token html.Token) {
+	name := spec.name()
+	url := spec.SpecUrl
+	if spec.Deprecation != "" {
+		v.addWarning(line, col, url, "DEPRECATED_TAG", "The tag '%s' is deprecated - use '%s' instead.", name, spec.Deprecation)
+	}
+
+	present := make(map[*AttrSpec]bool)
+	for _, attr := range token.Attr {
+		// Custom data and amp-bind attributes are allowed everywhere.
+		if strings.HasPrefix(attr.Key, "data-") || strings.HasPrefix(attr.Key, "[") {
+			continue
+		}
+		attrSpec := v.rules.attr(spec, attr.Key)
+		if attrSpec == nil {
+			v.addError(line, col, url, "DISALLOWED_ATTR", "The attribute '%s' may not appear in tag '%s'.", attr.Key, name)
+			continue
+		}
+		present[attrSpec] = true
+		if !attrSpec.validValue(attr.Val) {
+			v.addError(line, col, url, "INVALID_ATTR_VALUE", "The attribute '%s' in tag '%s' is set to the invalid value '%s'.", attr.Key, name, attr.Val)
+		}
+		if attrSpec.Deprecation != "" {
+			v.addWarning(line, col, url, "DEPRECATED_ATTR", "The attribute '%s' in tag '%s' is deprecated - use '%s' instead.", attr.Key, name, attrSpec.Deprecation)
+		}
+	}
+	for _, attrSpec := range v.rules.mandatoryAttrs(spec) {
+		if !present[attrSpec] {
+			v.addError(line, col, url, "MANDATORY_ATTR_MISSING", "The mandatory attribute '%s' is missing in tag '%s'.", attrSpec.Name, name)
+		}
+	}
+
+	if spec.MandatoryParent != "" {
+		parent := "$ROOT"
+		if len(v.stack) > 0 {
+			parent = strings.ToUpper(v.stack[len(v.stack)-1].name)
+		}
+		want := strings.ToUpper(spec.MandatoryParent)
+		// The doctype isn't an element, its children are at the root.
+		if want == "!DOCTYPE" {
+			want = "$ROOT"
+		}
+		if parent != want {
+			v.addError(line, col, url, "WRONG_PARENT_TAG", "The parent tag of tag '%s' is '%s', but it can only be '%s'.", name, strings.ToLower(parent), strings.ToLower(spec.MandatoryParent))
+		}
+	}
+	for _, ancestor := range spec.DisallowedAncestor {
+		if v.hasAncestor(ancestor) {
+			v.addError(line, col, url, "DISALLOWED_TAG_ANCESTOR", "The tag '%s' may not appear as a descendant of tag '%s'.", name, strings.ToLower(ancestor))
+		}
+	}
+	if spec.MandatoryAncestor != "" && !v.hasAncestor(spec.MandatoryAncestor) {
+		v.addError(line, col, url, "MANDATORY_TAG_ANCESTOR", "The tag '%s' may only appear as a descendant of tag '%s'.", name, strings.ToLower(spec.MandatoryAncestor))
+	}
+}
+
+func (v *validation) hasAncestor(name string) bool {
+	name = strings.ToLower(name)
+	for _, e := range v.stack {
+		if e.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// checkMandatoryTags reports mandatory tags that didn't appear at the end
+// of the document.
+func (v *validation) checkMandatoryTags() {
+	for _, spec := range v.rules.Tags {
+		if spec.Mandatory && spec.hasFormat(v.format) && !strings.HasPrefix(spec.TagName, "$") && v.seen[spec] == 0 {
+			v.addError(v.line, v.col, spec.SpecUrl, "MANDATORY_TAG_MISSING", "The mandatory tag '%s' is missing or incorrect.", spec.name())
+		}
+	}
+}
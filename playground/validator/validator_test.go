@@ -0,0 +1,117 @@
+/**
+ * Copyright 2018 The AMP HTML Authors. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS-IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package validator
+
+import (
+	"strings"
+	"testing"
+)
+
+const (
+	testHead = `<meta charset="utf-8"><script async src="https://cdn.ampproject.org/v0.js"></script>`
+	testImg  = `<amp-img src="a.jpg" layout="responsive" width="4" height="3"></amp-img>`
+)
+
+func testDoc(html string, head string, body string) string {
+	return "<!doctype html>\n<html " + html + ">\n<head>" + head + "</head>\n<body>" + body + "</body>\n</html>\n"
+}
+
+func TestValidate(t *testing.T) {
+	rules, err := Load("testdata/*.protoascii")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		doc    string
+		format string
+		status string
+		codes  []string
+	}{
+		{testDoc("⚡", testHead, testImg), FORMAT_AMP, STATUS_PASS, nil},
+		{testDoc("amp lang=en", testHead, testImg), FORMAT_AMP, STATUS_PASS, nil},
+		// value_casei accepts any of its values in any case.
+		{testDoc("⚡", `<meta charset="UTF-8"><script async src="https://cdn.ampproject.org/v0.js"></script>`, `<amp-img src="a.jpg" layout="FIXED" width="4" height="3"></amp-img><amp-img src="b.jpg" layout="Fill"></amp-img>`), FORMAT_AMP, STATUS_PASS, nil},
+		{testDoc("⚡", `<meta charset="latin1"><script async src="https://cdn.ampproject.org/v0.js"></script>`, ""), FORMAT_AMP, STATUS_FAIL, []string{"INVALID_ATTR_VALUE"}},
+		{testDoc("⚡", testHead, `<amp-img src="a.jpg" layout="intrinsic"></amp-img>`), FORMAT_AMP, STATUS_FAIL, []string{"INVALID_ATTR_VALUE"}},
+		{testDoc("⚡", testHead, `<amp-img src="a.jpg" width="AUTO" height="auto"></amp-img>`), FORMAT_AMP, STATUS_PASS, nil},
+		{testDoc("⚡", testHead, `<amp-img src="a.jpg" height="AUTO"></amp-img>`), FORMAT_AMP, STATUS_FAIL, []string{"INVALID_ATTR_VALUE"}},
+		{testDoc("⚡", testHead, `<amp-img srcset="a.jpg 1x" alt="A" class="hero" data-x="1" [src]="x"></amp-img>`), FORMAT_AMP, STATUS_PASS, nil},
+		{testDoc("⚡", testHead, `<amp-img src="a.jpg" id="amp-hero"></amp-img>`), FORMAT_AMP, STATUS_FAIL, []string{"INVALID_ATTR_VALUE"}},
+		{testDoc("⚡", testHead, `<amp-img layout="fill"></amp-img>`), FORMAT_AMP, STATUS_FAIL, []string{"MANDATORY_ATTR_MISSING"}},
+		{testDoc("⚡", testHead, `<amp-img src="a.jpg" onclick="x()"></amp-img>`), FORMAT_AMP, STATUS_FAIL, []string{"DISALLOWED_ATTR"}},
+		{testDoc("⚡", testHead, `<img src="a.jpg">`), FORMAT_AMP, STATUS_FAIL, []string{"DISALLOWED_TAG"}},
+		{testDoc("⚡", testHead, `<amp-img src="a.jpg" lightbox></amp-img>`), FORMAT_AMP, STATUS_PASS, []string{"DEPRECATED_ATTR"}},
+		{testDoc("⚡", testHead, `<font>x</font>`), FORMAT_AMP, STATUS_PASS, []string{"DEPRECATED_TAG"}},
+		{testDoc("⚡", testHead, `<amp-sidebar><amp-img src="a.jpg"></amp-img></amp-sidebar>`), FORMAT_AMP, STATUS_FAIL, []string{"DISALLOWED_TAG_ANCESTOR"}},
+		{testDoc("⚡", testHead, `<font><amp-sidebar></amp-sidebar></font>`), FORMAT_AMP, STATUS_FAIL, []string{"DEPRECATED_TAG", "WRONG_PARENT_TAG"}},
+		{testDoc("⚡", `<meta charset="utf-8">`, ""), FORMAT_AMP, STATUS_FAIL, []string{"MANDATORY_TAG_MISSING"}},
+		{testDoc("⚡", testHead+`<meta charset="utf-8">`, ""), FORMAT_AMP, STATUS_FAIL, []string{"DUPLICATE_UNIQUE_TAG"}},
+		{testDoc("", testHead, ""), FORMAT_AMP, STATUS_FAIL, []string{"MANDATORY_ATTR_MISSING"}},
+		// The format is detected from the <html> tag.
+		{testDoc("⚡4email", `<meta charset="utf-8">`, testImg), "", STATUS_PASS, nil},
+		{testDoc("amp4email", testHead, ""), "", STATUS_FAIL, []string{"DISALLOWED_TAG"}},
+		{testDoc("⚡4email", `<meta charset="utf-8">`, `<font></font>`), "", STATUS_FAIL, []string{"DISALLOWED_TAG"}},
+	}
+	for _, test := range tests {
+		result := rules.Validate([]byte(test.doc), test.format)
+		var codes []string
+		for _, err := range result.Errors {
+			codes = append(codes, err.Code)
+		}
+		if result.Status != test.status || strings.Join(codes, " ") != strings.Join(test.codes, " ") {
+			t.Errorf("Validate(%q) = %s %v, want %s %v", test.doc, result.Status, result.Errors, test.status, test.codes)
+		}
+	}
+}
+
+func TestValidatePositions(t *testing.T) {
+	rules, err := Load("testdata/*.protoascii")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := rules.Validate([]byte(testDoc("⚡", testHead, "\n  ⚡ <img src=a.jpg>")), FORMAT_AMP)
+	if len(result.Errors) != 1 {
+		t.Fatalf("errors = %v, want one", result.Errors)
+	}
+	if err := result.Errors[0]; err.Line != 5 || err.Col != 4 || err.Message != "The tag 'img' is disallowed." {
+		t.Errorf("error = %+v, want DISALLOWED_TAG at 5:4", err)
+	}
+	result = rules.Validate([]byte(testDoc("⚡", testHead, `<amp-img></amp-img>`)), FORMAT_AMP)
+	if len(result.Errors) != 1 || result.Errors[0].SpecUrl != "https://amp.dev/documentation/components/amp-img" {
+		t.Errorf("errors = %+v, want one with the amp-img spec URL", result.Errors)
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		doc  string
+		want string
+	}{
+		{"<!doctype html><html ⚡>", FORMAT_AMP},
+		{"<html amp4ads>", FORMAT_AMP4ADS},
+		{"<!-- x --><html ⚡4email>", FORMAT_AMP4EMAIL},
+		{"<html amp><body><amp-story standalone>", FORMAT_STORIES},
+		{"<html amp4email><body><amp-story>", FORMAT_AMP4EMAIL},
+		{"<p>no html tag", FORMAT_AMP},
+		{"", FORMAT_AMP},
+	}
+	for _, test := range tests {
+		if got := DetectFormat([]byte(test.doc)); got != test.want {
+			t.Errorf("DetectFormat(%q) = %s, want %s", test.doc, got, test.want)
+		}
+	}
+}
@@ -16,39 +16,51 @@ package main
 
 import (
 	"backend"
+	"backend/config"
 	"net/http"
 	"playground"
 )
 
 func init() {
-	backend.InitRedirects()
-	backend.InitAmpLiveList()
-	backend.InitAmpEmail()
-	backend.InitAmpForm()
-	backend.InitAmpInputmask()
-	backend.InitAmpCache()
-	backend.InitProductBrowse()
-	backend.InitHousingForm()
-	backend.InitAmpAnalytics()
-	backend.InitCommentSection()
-	backend.InitHotelSample()
-	backend.InitSlowResponseSample()
-	backend.InitPollSample()
-	backend.InitRatingSample()
-	backend.InitAutosuggestSample()
-	backend.InitPagedListSample()
-	backend.InitAmpAccess()
-	backend.InitFavoriteSample()
-	backend.InitCheckout()
-	backend.InitAmpConsent()
-	backend.InitAmpStoryAutoAds()
-	backend.InitPackager()
-	backend.InitSeatmapPage()
-	backend.InitOAuth()
-	backend.InitStateRefreshSection()
-	backend.InitEcho()
-	playground.InitPlayground()
-	// backend.InitStatic()
+	cfg, err := config.Load("")
+	if err != nil {
+		panic(err)
+	}
+	backend.InitSecrets(cfg)
+	backend.InitAssets(cfg)
+	backend.InitErrorPages(cfg)
+	backend.InitFaults(cfg)
+	backend.InitRedirects(cfg)
+	backend.InitAmpLiveList(cfg)
+	backend.InitAmpEmail(cfg)
+	backend.InitAmpForm(cfg)
+	backend.InitAmpInputmask(cfg)
+	backend.InitAmpCache(cfg)
+	backend.InitProductBrowse(cfg)
+	backend.InitHousingForm(cfg)
+	backend.InitAmpAnalytics(cfg)
+	backend.InitCommentSection(cfg)
+	backend.InitHotelSample(cfg)
+	backend.InitSlowResponseSample(cfg)
+	backend.InitPollSample(cfg)
+	backend.InitRatingSample(cfg)
+	backend.InitAutosuggestSample(cfg)
+	backend.InitPagedListSample(cfg)
+	backend.InitAmpAccess(cfg)
+	backend.InitFavoriteSample(cfg)
+	backend.InitCheckout(cfg)
+	backend.InitPayments(cfg)
+	backend.InitAmpConsent(cfg)
+	backend.InitAmpStoryAutoAds(cfg)
+	backend.InitPackager(cfg)
+	backend.InitSeatmapPage(cfg)
+	backend.InitOAuth(cfg)
+	backend.InitStateRefreshSection(cfg)
+	backend.InitEcho(cfg)
+	playground.InitPlayground(cfg)
+	if cfg.Features.Static {
+		backend.InitStatic(cfg)
+	}
 	http.HandleFunc("/_ah/warmup", warmup)
 }
 
@@ -0,0 +1,177 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command fingerprint prepares the built site for backend/assets: it copies
+// assets to names containing a hash of their content, writes the manifest
+// mapping the original names to the fingerprinted ones and adds gzip
+// compressed siblings of text files. Run it from the repository root after
+// building dist/:
+//
+//	go run tools/fingerprint/main.go
+//
+// Brotli siblings (.br) are served too, but have to be created by other
+// tools.
+package main
+
+import (
+	"backend/assets"
+	"backend/config"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	HASH_LENGTH = 10
+	// Smaller files aren't worth compressing.
+	MIN_GZIP_SIZE = 1024
+)
+
+var compressible = map[string]bool{
+	".css":  true,
+	".html": true,
+	".js":   true,
+	".json": true,
+	".svg":  true,
+	".txt":  true,
+	".xml":  true,
+}
+
+func main() {
+	cfg, err := config.Load("")
+	if err != nil {
+		fail(err)
+	}
+	dist := flag.String("dist", cfg.DistDir, "built site")
+	manifestPath := flag.String("manifest", cfg.AssetManifest, "manifest to write")
+	exts := flag.String("ext", ".css,.js,.svg,.png,.jpg,.jpeg,.gif,.webp,.woff,.woff2", "extensions of the files to fingerprint")
+	compress := flag.Bool("gzip", true, "write .gz siblings of text files")
+	flag.Parse()
+
+	fingerprinted := make(map[string]bool)
+	for _, ext := range strings.Split(*exts, ",") {
+		fingerprinted[strings.TrimSpace(ext)] = true
+	}
+
+	var files []string
+	err = filepath.Walk(*dist, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		ext := filepath.Ext(name)
+		if info.IsDir() || ext == ".gz" || ext == ".br" || assets.IsFingerprinted(name) {
+			return nil
+		}
+		files = append(files, name)
+		return nil
+	})
+	if err != nil {
+		fail(err)
+	}
+
+	manifest := assets.Manifest{}
+	for _, name := range files {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			fail(err)
+		}
+		ext := filepath.Ext(name)
+		if fingerprinted[ext] {
+			sum := sha256.Sum256(data)
+			hashed := assets.Fingerprint(name, hex.EncodeToString(sum[:])[:HASH_LENGTH])
+			if err := ioutil.WriteFile(hashed, data, 0644); err != nil {
+				fail(err)
+			}
+			if *compress && compressible[ext] && len(data) >= MIN_GZIP_SIZE {
+				if err := writeGzip(hashed, data); err != nil {
+					fail(err)
+				}
+			}
+			manifest[relative(*dist, name)] = relative(*dist, hashed)
+		}
+		if *compress && compressible[ext] && len(data) >= MIN_GZIP_SIZE {
+			if err := writeGzip(name, data); err != nil {
+				fail(err)
+			}
+		}
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		fail(err)
+	}
+	if err := ioutil.WriteFile(*manifestPath, append(data, '\n'), 0644); err != nil {
+		fail(err)
+	}
+	names := make([]string, 0, len(manifest))
+	for name := range manifest {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("%s -> %s\n", name, manifest[name])
+	}
+	fmt.Printf("%d files fingerprinted, manifest written to %s\n", len(manifest), *manifestPath)
+}
+
+// writeGzip writes data compressed to name.gz, keeping the modification
+// time of name so both have the same Last-Modified.
+func writeGzip(name string, data []byte) error {
+	f, err := os.Create(name + ".gz")
+	if err != nil {
+		return err
+	}
+	zw, err := gzip.NewWriterLevel(f, gzip.BestCompression)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := zw.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	info, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+	return os.Chtimes(name+".gz", info.ModTime(), info.ModTime())
+}
+
+func relative(dir string, name string) string {
+	rel, err := filepath.Rel(dir, name)
+	if err != nil {
+		fail(err)
+	}
+	return filepath.ToSlash(rel)
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(2)
+}
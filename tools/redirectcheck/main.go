@@ -0,0 +1,89 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command redirectcheck validates the redirect rules before they are
+// deployed. Run it from the repository root after building dist/:
+//
+//	go run tools/redirectcheck/main.go
+//
+// It exits with status 1 if any problem is found.
+package main
+
+import (
+	"backend/config"
+	"backend/redirect"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+func main() {
+	cfg, err := config.Load("")
+	if err != nil {
+		fail(err)
+	}
+	file := flag.String("file", cfg.Redirects, "JSON file with the redirect rules")
+	host := flag.String("host", cfg.Host, "origin relative targets are resolved against")
+	dist := flag.String("dist", cfg.DistDir, "built site to check targets against, empty to skip")
+	flag.Parse()
+
+	data, err := ioutil.ReadFile(*file)
+	if err != nil {
+		fail(err)
+	}
+	rules, err := redirect.ParseRules(data)
+	if err != nil {
+		fail(fmt.Errorf("%s: %v", *file, err))
+	}
+
+	var exists func(string) bool
+	if *dist != "" {
+		if _, err := os.Stat(*dist); err != nil {
+			fmt.Fprintf(os.Stderr, "Not checking targets, %v\n", err)
+		} else {
+			exists = distExists(*dist)
+		}
+	}
+
+	problems := redirect.Analyze(rules, *host, exists)
+	for _, problem := range problems {
+		fmt.Printf("%s: %v\n", *file, problem)
+	}
+	fmt.Printf("%d rules, %d problems\n", len(rules), len(problems))
+	if len(problems) > 0 {
+		os.Exit(1)
+	}
+}
+
+// distExists resolves paths like http.FileServer does when serving dir.
+func distExists(dir string) func(string) bool {
+	return func(path string) bool {
+		info, err := os.Stat(filepath.Join(dir, filepath.FromSlash(path)))
+		if err != nil {
+			return false
+		}
+		if info.IsDir() {
+			_, err = os.Stat(filepath.Join(dir, filepath.FromSlash(path), "index.html"))
+			return err == nil
+		}
+		return true
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(2)
+}
@@ -0,0 +1,177 @@
+// Copyright Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command validatorrules copies the AMP validator rules into the folder the
+// playground reads them from. Run it from the repository root before
+// serving or deploying the playground:
+//
+//	go run tools/validatorrules/main.go
+//
+// The rules are validator-main.protoascii and the validator-*.protoascii file
+// of every extension, read from GitHub or from a local amphtml checkout with
+// -amphtml. The copied rules are loaded once to make sure they parse.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"playground/validator"
+	"regexp"
+	"strings"
+)
+
+const (
+	GITHUB_TREE_URL = "https://api.github.com/repos/ampproject/amphtml/git/trees/master?recursive=1"
+	GITHUB_RAW_URL  = "https://raw.githubusercontent.com/ampproject/amphtml/master/"
+)
+
+var rulesPathRegex = regexp.MustCompile(`^(validator/validator-main|extensions/amp-[^/]+/validator-amp-[^/]+)\.protoascii$`)
+
+func main() {
+	amphtml := flag.String("amphtml", "", "amphtml checkout to copy the rules from, empty for GitHub")
+	out := flag.String("out", "playground/validator-rules", "folder to write the rules to")
+	token := flag.String("token", os.Getenv("GITHUB_TOKEN"), "GitHub token to avoid the rate limits")
+	flag.Parse()
+
+	var paths []string
+	var read func(string) ([]byte, error)
+	var err error
+	if *amphtml != "" {
+		paths, err = checkoutPaths(*amphtml)
+		read = func(p string) ([]byte, error) {
+			return ioutil.ReadFile(filepath.Join(*amphtml, filepath.FromSlash(p)))
+		}
+	} else {
+		paths, err = gitHubPaths(*token)
+		read = func(p string) ([]byte, error) {
+			return get(GITHUB_RAW_URL+p, *token)
+		}
+	}
+	if err != nil {
+		fail(err)
+	}
+	if len(paths) == 0 {
+		fail(fmt.Errorf("no validator rules found"))
+	}
+
+	if err := os.MkdirAll(*out, 0755); err != nil {
+		fail(err)
+	}
+	// Rules of removed extensions mustn't stay around.
+	stale, err := filepath.Glob(filepath.Join(*out, "*.protoascii"))
+	if err != nil {
+		fail(err)
+	}
+	for _, p := range stale {
+		if err := os.Remove(p); err != nil {
+			fail(err)
+		}
+	}
+	for _, p := range paths {
+		data, err := read(p)
+		if err != nil {
+			fail(fmt.Errorf("%s: %v", p, err))
+		}
+		if err := ioutil.WriteFile(filepath.Join(*out, path.Base(p)), data, 0644); err != nil {
+			fail(err)
+		}
+	}
+
+	rules, err := validator.Load(filepath.Join(*out, "*.protoascii"))
+	if err != nil {
+		fail(err)
+	}
+	fmt.Printf("%d files, %d tag specs written to %s\n", len(paths), len(rules.Tags), *out)
+}
+
+// checkoutPaths lists the rules files of a local amphtml checkout.
+func checkoutPaths(dir string) ([]string, error) {
+	var paths []string
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if info.IsDir() && rel != "." && (info.Name() == "node_modules" || strings.HasPrefix(info.Name(), ".")) {
+			return filepath.SkipDir
+		}
+		if rulesPathRegex.MatchString(rel) {
+			paths = append(paths, rel)
+		}
+		return nil
+	})
+	return paths, err
+}
+
+// gitHubPaths lists the rules files of the amphtml repository on GitHub.
+func gitHubPaths(token string) ([]string, error) {
+	data, err := get(GITHUB_TREE_URL, token)
+	if err != nil {
+		return nil, err
+	}
+	var tree struct {
+		Tree []struct {
+			Path string `json:"path"`
+			Type string `json:"type"`
+		} `json:"tree"`
+		Truncated bool `json:"truncated"`
+	}
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return nil, err
+	}
+	if tree.Truncated {
+		return nil, fmt.Errorf("GitHub tree truncated")
+	}
+	var paths []string
+	for _, entry := range tree.Tree {
+		if entry.Type == "blob" && rulesPathRegex.MatchString(entry.Path) {
+			paths = append(paths, entry.Path)
+		}
+	}
+	return paths, nil
+}
+
+func get(url string, token string) ([]byte, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "token "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(2)
+}